@@ -2,39 +2,167 @@
 //
 // Configuration file format:
 //
-// # A comment
-// [rules]
-// * * * -  # deny all to all, to start with
-// purchasing /purchasing/* * +
+//	# A comment
+//	[rules]
+//	* * * -  # deny all to all, to start with
+//	purchasing /purchasing/* * +
+//	* /home/{user}/** * +
+//	auditors /projects/*/private/** read - 10
 //
-// [groups]
-// name group1 group2 ...
+//	[groups]
+//	name group1 group2 ...
 //
-// All rules are checked in order.
+//	[options]
+//	combine deny-overrides
 //
+// A rule is 'subject object operation [polarity [priority]] [if condition]'.
+// Objects can be paths, globs or regular expressions (see Rule). The rules
+// that match a request are combined as follows: only those with the highest
+// priority count, and among them the combining algorithm decides (the last
+// matching rule by default). If no rule matches, access is granted.
+//
+// A comment starts with a '#' at the start of a line or after white space.
 package acl
 
 import (
 	"bufio"
+	"fmt"
+	"io"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/rveen/ogdl"
 )
 
 // ACL contains rules and groups for implementing
-// an access control list
+// an access control list. It is safe for concurrent use, also while it is
+// being reloaded.
 type ACL struct {
-	file   string
-	rules  []Rule
-	groups map[string][]string
+	mu      sync.RWMutex
+	file    string
+	stamp   string // modification time and size of file when loaded
+	rules   []Rule
+	groups  map[string][]string
+	Combine Combining
+}
+
+// ConfigError is returned when a configuration file has errors. The file is
+// then rejected as a whole.
+type ConfigError struct {
+	File   string
+	Errors []LineError
+}
+
+// LineError is an error in one line of a configuration file.
+type LineError struct {
+	Line   int
+	Text   string
+	Reason string
 }
 
+func (e *ConfigError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("acl: ")
+	if e.File != "" {
+		sb.WriteString(e.File + ": ")
+	}
+	sb.WriteString(strconv.Itoa(len(e.Errors)) + " error(s)")
+	for _, le := range e.Errors {
+		sb.WriteString(fmt.Sprintf("; line %d: %s", le.Line, le.Reason))
+	}
+	return sb.String()
+}
+
+// Combining is the algorithm that decides between matching rules of the same
+// priority.
+type Combining int
+
+const (
+	LastMatch      Combining = iota // the last matching rule decides (default)
+	FirstMatch                      // the first matching rule decides
+	DenyOverrides                   // any matching deny rule decides
+	AllowOverrides                  // any matching allow rule decides
+)
+
+var combinings = map[string]Combining{
+	"last-match":      LastMatch,
+	"first-match":     FirstMatch,
+	"deny-overrides":  DenyOverrides,
+	"allow-overrides": AllowOverrides,
+}
+
+func (c Combining) String() string {
+	for k, v := range combinings {
+		if v == c {
+			return k
+		}
+	}
+	return strconv.Itoa(int(c))
+}
+
+// Rule grants (Polarity true) or denies an operation on an object to a
+// subject, which is a user or a group (or * for all).
+//
+// Objects are matched as follows:
+//
+//   - '*' matches all objects.
+//   - '/a/b' matches '/a/b' and all paths below it.
+//   - '/a/b*' (a single trailing star) matches all paths starting with '/a/b'.
+//   - '/a/*/c/**' is a glob: '*', '?' and '[...]' match within one path
+//     element (as in path.Match) and '**' matches any number of elements.
+//   - '~regexp' matches the paths that match the regular expression.
+//
+// The placeholder {user} in an object is replaced by the subject of the
+// request before matching.
+//
+// A rule with a Condition only applies if the condition is true. Conditions
+// are expressions as in the parser package, and refer to the context passed
+// to EnforceCtx and to the built-in variables subject, object, operation,
+// time ("15:04"), date ("2006-01-02"), weekday ("Mon") and hour.
 type Rule struct {
 	Subject   string
 	Object    string
 	Operation string
 	Polarity  bool
 	Prefix    bool
+	Priority  int
+	Condition string
+	Line      int // line in the configuration file, 0 if added with AddRule
+
+	m    *matcher
+	cond *ogdl.Graph
+}
+
+// String returns the rule in the format of the configuration file.
+func (r *Rule) String() string {
+	obj := r.Object
+	if r.Prefix {
+		obj += "*"
+	}
+	pol := "-"
+	if r.Polarity {
+		pol = "+"
+	}
+	s := r.Subject + " " + obj + " " + r.Operation + " " + pol
+	if r.Priority != 0 || r.Condition != "" {
+		s += " " + strconv.Itoa(r.Priority)
+	}
+	if r.Condition != "" {
+		s += " if " + r.Condition
+	}
+	return s
+}
+
+// Decision is the result of Explain.
+type Decision struct {
+	Allow bool
+	Rule  *Rule  // the rule that decided, or nil if no rule applies
+	Index int    // index of the rule in the rule list, -1 if none
+	Why   string // human readable explanation
 }
 
 // New creates a new Acl object, either from a configuration
@@ -45,216 +173,462 @@ func New(filename string) (*ACL, error) {
 		return &ACL{}, nil
 	}
 
-	file, err := os.Open(filename)
+	acl, err := load(filename)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	section := ""
-	acl := &ACL{}
-	acl.file = filename
+	log.Println(filename, "loaded", len(acl.rules), "rules,", len(acl.groups), "groups")
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
+	return acl, nil
+}
 
-		line := scanner.Text()
+// Reload reads the configuration file again. If the file has errors (see
+// ConfigError) or cannot be read, the current rules stay in force.
+func (acl *ACL) Reload() error {
 
-		switch line {
-		case "[rules]":
-			section = "r"
+	acl.mu.RLock()
+	filename := acl.file
+	acl.mu.RUnlock()
 
-		case "[groups]":
-			section = "g"
+	acl2, err := load(filename)
+	if err != nil {
+		return err
+	}
 
-		default:
+	acl.mu.Lock()
+	acl.groups = acl2.groups
+	acl.rules = acl2.rules
+	acl.Combine = acl2.Combine
+	acl.stamp = acl2.stamp
+	acl.mu.Unlock()
 
-			tk := strings.Fields(line)
+	return nil
+}
 
-			if len(tk) == 0 || tk[0] == "#" {
-				continue
+// Watch checks the configuration file for changes every interval, and
+// reloads it when its modification time or size change. Errors (such as a
+// ConfigError) are passed to report, or logged if report is nil; the rules
+// in force are then kept until the file is fixed. Watch returns a function
+// that stops watching.
+func (acl *ACL) Watch(interval time.Duration, report func(error)) (stop func()) {
+
+	if report == nil {
+		report = func(err error) { log.Println(err) }
+	}
+
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		failed := "" // stamp of a file that did not load
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
 			}
 
-			if section == "r" {
-				// sub obj op [pol]
-				switch len(tk) {
-				case 3:
-					acl.AddRule(tk[0], tk[1], tk[2], true)
-				case 4:
-					acl.AddRule(tk[0], tk[1], tk[2], tk[3] == "+")
-				default:
-					println("rule: error in number of attributes", len(tk))
-				}
+			acl.mu.RLock()
+			filename, loaded := acl.file, acl.stamp
+			acl.mu.RUnlock()
 
-			} else if section == "g" {
-				if len(tk) > 1 {
-					for i := 1; i < len(tk); i++ {
-						acl.AddGroup(tk[i], tk[0])
-					}
+			s, err := stamp(filename)
+			if err != nil {
+				if failed != "-" {
+					report(err)
 				}
+				failed = "-"
+				continue
+			}
+			if s == loaded || s == failed {
+				continue
+			}
+
+			if err := acl.Reload(); err != nil {
+				failed = s
+				report(err)
+				continue
 			}
+			failed = ""
+			log.Println(filename, "reloaded")
 		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
 
+// stamp returns the modification time and size of a file.
+func stamp(filename string) (string, error) {
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return "", err
 	}
+	return fmt.Sprintf("%d %d", fi.ModTime().UnixNano(), fi.Size()), nil
+}
 
-	if err := scanner.Err(); err != nil {
+func load(filename string) (*ACL, error) {
+
+	s, err := stamp(filename)
+	if err != nil {
 		return nil, err
 	}
 
-	log.Println(filename, "loaded", len(acl.rules), "rules,", len(acl.groups), "groups")
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
 
+	acl, err := parse(file)
+	if ce, ok := err.(*ConfigError); ok {
+		ce.File = filename
+	}
+	if err != nil {
+		return nil, err
+	}
+	acl.file = filename
+	acl.stamp = s
 	return acl, nil
 }
 
-// Reload is meant to be called by a file watcher that monitors the ACL definition
-// file for changes.
-func (acl *ACL) Reload() error {
-
-	file, err := os.Open(acl.file)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+// parse reads a configuration file. All errors are collected in a
+// ConfigError.
+func parse(r io.Reader) (*ACL, error) {
 
 	section := ""
-	acl2 := &ACL{}
+	acl := &ACL{}
+	n := 0
+	var errs []LineError
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 
 		line := scanner.Text()
+		n++
+
+		fail := func(reason string) {
+			errs = append(errs, LineError{Line: n, Text: scanner.Text(), Reason: reason})
+		}
+
+		line = stripComment(line)
 
-		switch line {
+		switch strings.TrimSpace(line) {
 		case "[rules]":
 			section = "r"
 
 		case "[groups]":
 			section = "g"
 
+		case "[options]":
+			section = "o"
+
 		default:
 
 			tk := strings.Fields(line)
 
-			if len(tk) == 0 || tk[0] == "#" {
+			if len(tk) == 0 {
 				continue
 			}
 
-			if section == "r" {
-				// sub obj op [pol]
-				switch len(tk) {
-				case 3:
-					acl2.AddRule(tk[0], tk[1], tk[2], true)
-				case 4:
-					acl2.AddRule(tk[0], tk[1], tk[2], tk[3] == "+")
-				default:
-					println("rule: error in number of attributes", len(tk))
-				}
+			if strings.HasPrefix(tk[0], "[") {
+				fail("unknown section " + tk[0])
+				continue
+			}
 
-			} else if section == "g" {
-				if len(tk) > 1 {
-					for i := 1; i < len(tk); i++ {
-						acl2.AddGroup(tk[i], tk[0])
+			switch section {
+			case "r":
+				// sub obj op [pol [prio]] [if condition]
+				cond := ""
+				for i, t := range tk {
+					if t == "if" && i > 2 {
+						cond = after(line, i+1)
+						tk = tk[:i]
+						break
 					}
 				}
+				if cond == "" && len(tk) < len(strings.Fields(line)) {
+					fail("if without condition")
+					continue
+				}
+				if len(tk) < 3 || len(tk) > 5 {
+					fail(fmt.Sprintf("rule needs 3 to 5 fields, has %d", len(tk)))
+					continue
+				}
+				r := Rule{Subject: tk[0], Object: tk[1], Operation: tk[2], Polarity: true, Condition: cond, Line: n}
+				if len(tk) > 3 {
+					switch tk[3] {
+					case "+":
+					case "-":
+						r.Polarity = false
+					default:
+						fail("polarity must be + or -, not " + tk[3])
+						continue
+					}
+				}
+				if len(tk) > 4 {
+					var err error
+					r.Priority, err = strconv.Atoi(tk[4])
+					if err != nil {
+						fail("priority is not a number: " + tk[4])
+						continue
+					}
+				}
+				if err := acl.Add(r); err != nil {
+					fail(err.Error())
+				}
+
+			case "g":
+				if len(tk) < 2 {
+					fail("group without members")
+					continue
+				}
+				for i := 1; i < len(tk); i++ {
+					acl.AddGroup(tk[i], tk[0])
+				}
+
+			case "o":
+				if len(tk) != 2 || tk[0] != "combine" {
+					fail("unknown option " + tk[0])
+					continue
+				}
+				c, ok := combinings[tk[1]]
+				if !ok {
+					fail("unknown combining algorithm " + tk[1])
+					continue
+				}
+				acl.Combine = c
+
+			default:
+				fail("line outside of a section")
 			}
 		}
-
 	}
 
 	if err := scanner.Err(); err != nil {
-		return err
+		return nil, err
 	}
 
-	// TODO: mutex
-	acl.groups = acl2.groups
-	acl.rules = acl2.rules
+	if errs != nil {
+		return nil, &ConfigError{Errors: errs}
+	}
 
-	return nil
+	return acl, nil
 }
 
+// AddRule adds a rule with priority 0.
 func (acl *ACL) AddRule(sub, obj, op string, pol bool) {
-	r := Rule{sub, obj, op, pol, false}
+	acl.Add(Rule{Subject: sub, Object: obj, Operation: op, Polarity: pol})
+}
+
+// Add adds a rule. It returns an error if the object is not a valid pattern
+// or the condition is not a valid expression.
+func (acl *ACL) Add(r Rule) error {
 
-	if strings.HasSuffix(obj, "*") {
-		r.Object = obj[0 : len(obj)-1]
+	if !r.Prefix && isPrefix(r.Object) {
+		r.Object = r.Object[0 : len(r.Object)-1]
 		r.Prefix = true
 	}
 
-	println("AddRule", r.Subject, r.Object, r.Operation, r.Polarity, r.Prefix)
+	m, err := compile(r.Object, r.Prefix)
+	if err != nil {
+		return fmt.Errorf("invalid object %s: %w", r.Object, err)
+	}
+	r.m = m
+
+	if r.Condition != "" {
+		r.cond, err = compileCondition(r.Condition)
+		if err != nil {
+			return err
+		}
+	}
 
+	acl.mu.Lock()
 	acl.rules = append(acl.rules, r)
+	acl.mu.Unlock()
+	return nil
 }
 
+// AddGroup makes sub (a user or a group) a member of group. Membership is
+// transitive: members of sub are also members of group.
 func (acl *ACL) AddGroup(sub, group string) {
-	g := acl.groups
-	if g == nil {
+
+	acl.mu.Lock()
+	defer acl.mu.Unlock()
+
+	if acl.groups == nil {
 		acl.groups = make(map[string][]string)
 	}
-
+	for _, g := range acl.groups[sub] {
+		if g == group {
+			return
+		}
+	}
 	acl.groups[sub] = append(acl.groups[sub], group)
-	// TODO: fill in multiple levels
-	println("addGroup", group, sub, len(acl.groups[sub]))
 }
 
 // Enforce checks the ACL for a specific resource and user, and returns true
-// if access is granted.
+// if access is granted. The object is cleaned as with path.Clean before it is
+// matched, so that /a/public/../private is /a/private.
 func (acl *ACL) Enforce(sub, obj, op string) bool {
+	return acl.ExplainCtx(sub, obj, op, nil).Allow
+}
+
+// EnforceCtx is Enforce for rules with conditions. The context holds the
+// values that conditions refer to, for example:
+//
+//	user
+//	  role contractor
+//	resource
+//	  owner alice
+//
+// where resource could hold the Data() of a document. Values in the context
+// take precedence over the built-in variables of the same name.
+func (acl *ACL) EnforceCtx(sub, obj, op string, ctx *ogdl.Graph) bool {
+	return acl.ExplainCtx(sub, obj, op, ctx).Allow
+}
+
+// Explain returns the decision for a request together with the rule that
+// made it.
+func (acl *ACL) Explain(sub, obj, op string) Decision {
+	return acl.ExplainCtx(sub, obj, op, nil)
+}
+
+// ExplainCtx is Explain with a context for conditions (see EnforceCtx).
+func (acl *ACL) ExplainCtx(sub, obj, op string, ctx *ogdl.Graph) Decision {
+
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
 
-	result := true
+	obj = cleanObject(obj)
+	d := Decision{Allow: true, Index: -1, Why: "no rule applies: allowed by default"}
+	e := &env{ctx: ctx, sub: sub, obj: obj, op: op, now: time.Now()}
 
-	for _, r := range acl.rules {
+	for i := range acl.rules {
 
-		// operation in rule ?
-		if op != r.Operation && r.Operation != "*" {
+		r := &acl.rules[i]
+
+		if !acl.applies(r, sub, obj, op) {
 			continue
 		}
-
-		// Object in rule ?
-		if len(obj) < len(r.Object) {
+		if r.cond != nil && !truth(e.eval(r.cond)) {
 			continue
 		}
 
-		if strings.HasPrefix(obj, r.Object) {
-			if len(obj) > len(r.Object) && obj[len(r.Object)] != '/' {
-				// Check that this works for any encoding
+		if d.Rule != nil {
+			if r.Priority < d.Rule.Priority {
 				continue
 			}
-		} else {
-			continue
+			if r.Priority == d.Rule.Priority {
+				switch acl.Combine {
+				case FirstMatch:
+					continue
+				case DenyOverrides:
+					if !d.Rule.Polarity || r.Polarity {
+						continue
+					}
+				case AllowOverrides:
+					if d.Rule.Polarity || !r.Polarity {
+						continue
+					}
+				}
+			}
 		}
 
-		// Subject in rule
-		if r.Subject != "*" && sub != r.Subject {
-			if !acl.InGroup(sub, r.Subject) {
-				continue
-			}
+		d.Rule = r
+		d.Index = i
+	}
+
+	if d.Rule != nil {
+		d.Allow = d.Rule.Polarity
+		verb := "denied"
+		if d.Allow {
+			verb = "allowed"
+		}
+		d.Why = fmt.Sprintf("%s by rule %d '%s'", verb, d.Index+1, d.Rule.String())
+		if d.Rule.Line > 0 {
+			d.Why += fmt.Sprintf(" (line %d)", d.Rule.Line)
 		}
+		if acl.Combine != LastMatch {
+			d.Why += ", " + acl.Combine.String()
+		}
+	}
 
-		// Rule applies !
-		result = r.Polarity
+	return d
+}
+
+// applies returns true if the rule matches the request
+func (acl *ACL) applies(r *Rule, sub, obj, op string) bool {
+
+	// operation in rule ?
+	if op != r.Operation && r.Operation != "*" {
+		return false
+	}
 
+	// Subject in rule
+	if r.Subject != "*" && sub != r.Subject && !acl.inGroup(sub, r.Subject) {
+		return false
 	}
 
-	return result
+	// Object in rule ?
+	return r.m.match(obj, sub)
 }
 
 // InGroup checks whether the first argument is part of the group given
-// as second argument
+// as second argument, directly or through other groups.
 func (acl *ACL) InGroup(sub, group string) bool {
-	gg := acl.groups[sub]
+	acl.mu.RLock()
+	defer acl.mu.RUnlock()
+	return acl.inGroup(sub, group)
+}
 
-	if gg == nil {
-		return false
-	}
+func (acl *ACL) inGroup(sub, group string) bool {
 
-	for _, g := range gg {
-		if g == group {
-			return true
-		}
-		if acl.InGroup(g, group) {
-			return true
+	seen := map[string]bool{sub: true}
+	todo := []string{sub}
+
+	for len(todo) > 0 {
+		s := todo[0]
+		todo = todo[1:]
+
+		for _, g := range acl.groups[s] {
+			if g == group {
+				return true
+			}
+			if !seen[g] {
+				seen[g] = true
+				todo = append(todo, g)
+			}
 		}
 	}
 
 	return false
 }
+
+// stripComment removes a comment from a line. A comment starts with a '#' at
+// the start of the line or after white space; other '#' characters, as in
+// regular expressions and conditions, are kept.
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// after returns the text of line after its first n fields.
+func after(line string, n int) string {
+	for ; n > 0; n-- {
+		line = strings.TrimLeft(line, " \t")
+		i := strings.IndexAny(line, " \t")
+		if i == -1 {
+			return ""
+		}
+		line = line[i:]
+	}
+	return strings.TrimSpace(line)
+}
@@ -2,7 +2,13 @@ package acl
 
 import (
 	"fmt"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/rveen/ogdl"
 )
 
 func TestAcl(t *testing.T) {
@@ -46,3 +52,310 @@ func TestConfFile(t *testing.T) {
 
 	println("test.conf:", len(acl.groups), len(acl.rules))
 }
+
+func TestObjects(t *testing.T) {
+
+	acl, _ := New("")
+	acl.AddRule("*", "*", "*", false)
+	acl.AddRule("*", "/static", "*", true)
+	acl.AddRule("*", "/pub*", "*", true)
+	acl.AddRule("*", "/projects/*/public/**", "*", true)
+	acl.AddRule("*", "~^/api/v[0-9]+/", "read", true)
+	acl.AddRule("*", "/home/{user}/**", "*", true)
+
+	for _, c := range []struct {
+		sub, obj, op string
+		allow        bool
+	}{
+		{"bob", "/static", "read", true},
+		{"bob", "/static/css/a.css", "read", true},
+		{"bob", "/static2", "read", false},
+		{"bob", "/public/x", "read", true},
+		{"bob", "/projects/p1/public", "read", true},
+		{"bob", "/projects/p1/public/a/b", "read", true},
+		{"bob", "/projects/p1/private/a", "read", false},
+		{"bob", "/api/v2/items", "read", true},
+		{"bob", "/api/v2/items", "write", false},
+		{"bob", "/home/bob/notes.md", "write", true},
+		{"bob", "/home/alice/notes.md", "write", false},
+		{"*", "/home/alice/notes.md", "write", false},
+		{"bob", "/projects/p1/public/../private/x", "read", false},
+		{"bob", "/projects/p1/private/../public/x", "read", true},
+		{"bob", "/home/bob/../alice/notes.md", "write", false},
+		{"bob", "/home/bob/./a/../notes.md", "write", true},
+		{"bob", "/static/../etc/passwd", "read", false},
+		{"bob", "/api/v2/../../etc", "read", false},
+		{"bob", "//home//bob//notes.md", "write", true},
+	} {
+		if acl.Enforce(c.sub, c.obj, c.op) != c.allow {
+			t.Errorf("%s %s %s: expected %v (%s)", c.sub, c.obj, c.op, c.allow, acl.Explain(c.sub, c.obj, c.op).Why)
+		}
+	}
+
+	// {user} objects are compiled once per subject
+	if m := acl.rules[5].m; len(m.byUser) != 2 {
+		t.Errorf("%d compiled {user} objects", len(m.byUser))
+	}
+}
+
+func TestCombining(t *testing.T) {
+
+	acl, err := parse(strings.NewReader(`[rules]
+* /projects/** * +
+auditors /projects/*/private/** * -
+admin /projects/** * + 10
+
+[groups]
+auditors alice
+admin alice
+
+[options]
+combine deny-overrides
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if acl.Combine != DenyOverrides {
+		t.Errorf("combine %v", acl.Combine)
+	}
+
+	d := acl.Explain("bob", "/projects/p1/private/x", "read")
+	if !d.Allow || d.Index != 0 {
+		t.Errorf("bob: %+v", d)
+	}
+
+	acl.AddGroup("bob", "auditors")
+	d = acl.Explain("bob", "/projects/p1/private/x", "read")
+	if d.Allow || d.Rule.Line != 3 || !strings.Contains(d.Why, "line 3") {
+		t.Errorf("auditor: %+v", d)
+	}
+
+	// Higher priority wins over deny-overrides
+	if !acl.Enforce("alice", "/projects/p1/private/x", "read") {
+		t.Errorf("alice: %s", acl.Explain("alice", "/projects/p1/private/x", "read").Why)
+	}
+}
+
+func TestGroupLevels(t *testing.T) {
+
+	acl, _ := New("")
+	acl.AddGroup("rolf", "fuelcell")
+	acl.AddGroup("fuelcell", "automotive")
+	acl.AddGroup("automotive", "fuelcell") // cycle
+
+	if !acl.InGroup("rolf", "automotive") {
+		t.Error("rolf should be in automotive")
+	}
+	if acl.InGroup("rolf", "marketing") {
+		t.Error("rolf should not be in marketing")
+	}
+}
+
+func TestReload(t *testing.T) {
+
+	file := t.TempDir() + "/acl.conf"
+	write := func(s string) {
+		if err := os.WriteFile(file, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("[rules]\n* * * -\nalice /docs *\n")
+	acl, err := New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !acl.Enforce("alice", "/docs", "read") {
+		t.Error("alice should read /docs")
+	}
+
+	// A broken file is rejected as a whole
+	write("[rules]\n* * * -\nalice /docs\nbob /docs * + high\n[options]\ncombine sometimes\n")
+	err = acl.Reload()
+	ce, ok := err.(*ConfigError)
+	if !ok {
+		t.Fatalf("expected a ConfigError, got %v", err)
+	}
+	lines := []int{}
+	for _, le := range ce.Errors {
+		lines = append(lines, le.Line)
+	}
+	if fmt.Sprint(lines) != "[3 4 6]" {
+		t.Errorf("error lines %v: %v", lines, err)
+	}
+	if !acl.Enforce("alice", "/docs", "read") {
+		t.Error("previous rules should stay in force")
+	}
+
+	write("[rules]\n* * * -\n")
+	if err := acl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if acl.Enforce("alice", "/docs", "read") {
+		t.Error("new rules should be in force")
+	}
+}
+
+func TestConcurrentReload(t *testing.T) {
+
+	acl, err := New("test.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				if !acl.Enforce("rolf", "/prj/ssb", "read") {
+					t.Error("rolf should access /prj/ssb")
+					return
+				}
+			}
+		}()
+	}
+	for j := 0; j < 50; j++ {
+		if err := acl.Reload(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestWatch(t *testing.T) {
+
+	file := t.TempDir() + "/acl.conf"
+	if err := os.WriteFile(file, []byte("[rules]\n* * * -\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	acl, err := New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 10)
+	stop := acl.Watch(10*time.Millisecond, func(err error) { errs <- err })
+	defer stop()
+
+	// Change the size, so that coarse modification times don't matter
+	if err := os.WriteFile(file, []byte("[rules]\n* * * -\nalice /docs *\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100 && !acl.Enforce("alice", "/docs", "read"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !acl.Enforce("alice", "/docs", "read") {
+		t.Fatal("change not picked up")
+	}
+
+	if err := os.WriteFile(file, []byte("[rules]\n* * * - x y\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if _, ok := err.(*ConfigError); !ok {
+			t.Errorf("expected a ConfigError, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("error not reported")
+	}
+	if !acl.Enforce("alice", "/docs", "read") {
+		t.Error("previous rules should stay in force")
+	}
+}
+
+func TestConditions(t *testing.T) {
+
+	conf := `[rules]
+* * * -
+* /specs/** read + 0 if user.role != "contractor" || (time >= "09:00" && time < "17:00" && weekday != "Sat" && weekday != "Sun")
+*	/docs/**	write	+	0	if	resource.owner == subject
+* /archive/** read + 0 if date >= '2026-01-01' && date <= '2026-03-31'
+* /quota * + 0 if user.used * 2 < user.limit && !(user.blocked)
+`
+	acl, err := parse(strings.NewReader(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ctx  string
+		sub  string
+		obj  string
+		op   string
+		want bool
+	}{
+		{"user\n  role staff\ntime 22:00", "ann", "/specs/a", "read", true},
+		{"user\n  role contractor\ntime 10:30\nweekday Tue", "bob", "/specs/a", "read", true},
+		{"user\n  role contractor\ntime 18:00\nweekday Tue", "bob", "/specs/a", "read", false},
+		{"user\n  role contractor\ntime 10:30\nweekday Sat", "bob", "/specs/a", "read", false},
+		{"resource\n  owner ann", "ann", "/docs/x.md", "write", true},
+		{"resource\n  owner ann", "bob", "/docs/x.md", "write", false},
+		{"", "bob", "/docs/x.md", "write", false},
+		{"date 2026-02-10", "bob", "/archive/2025", "read", true},
+		{"date 2026-04-01", "bob", "/archive/2025", "read", false},
+		{"user\n  used 4\n  limit 10", "bob", "/quota", "write", true},
+		{"user\n  used 6\n  limit 10", "bob", "/quota", "write", false},
+		{"user\n  used 4\n  limit 10\n  blocked true", "bob", "/quota", "write", false},
+	}
+
+	for i, tc := range tests {
+		ctx := ogdl.FromString(tc.ctx)
+		if got := acl.EnforceCtx(tc.sub, tc.obj, tc.op, ctx); got != tc.want {
+			t.Errorf("%d: %s %s %s: got %v, %s", i, tc.sub, tc.obj, tc.op, got, acl.ExplainCtx(tc.sub, tc.obj, tc.op, ctx).Why)
+		}
+	}
+
+	// Conditions on missing values are false
+	if acl.Enforce("ann", "/docs/x.md", "write") {
+		t.Error("write without owner should be denied")
+	}
+
+	// Polarity and priority are optional before if
+	a, err := parse(strings.NewReader("[rules]\n* /a read if x == 1\n* /b read - if x == 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := a.rules; len(rr) != 2 || !rr[0].Polarity || rr[1].Polarity || rr[1].Priority != 0 || rr[1].Condition != "x == 1" {
+		t.Errorf("rules %v", rr)
+	}
+
+	if _, err := parse(strings.NewReader("[rules]\n* * * + 0 if a == \n* * * + 0 if\n")); err == nil {
+		t.Error("bad conditions should be rejected")
+	} else if ce := err.(*ConfigError); len(ce.Errors) != 2 {
+		t.Error(err)
+	}
+}
+
+func TestComments(t *testing.T) {
+
+	acl, err := parse(strings.NewReader(`# rules
+[rules]
+* * * -   # deny by default
+* ~^/tags/#[a-z]+$ read +
+	# indented comment
+* /notes/** read + 0 if resource.tag == "#public" # but not this
+[groups]
+admin alice#1 # the first alice
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(acl.rules) != 3 {
+		t.Fatalf("%d rules", len(acl.rules))
+	}
+	if !acl.Enforce("bob", "/tags/#go", "read") {
+		t.Error("regexp with # not matched")
+	}
+	if !acl.EnforceCtx("bob", "/notes/a", "read", ogdl.FromString("resource\n  tag '#public'")) {
+		t.Errorf("condition with #: %s", acl.ExplainCtx("bob", "/notes/a", "read", ogdl.FromString("resource\n  tag '#public'")).Why)
+	}
+	if !acl.InGroup("alice#1", "admin") {
+		t.Error("group member with #")
+	}
+}
@@ -0,0 +1,248 @@
+package acl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rveen/golib/eventhandler"
+	"github.com/rveen/golib/parser"
+	"github.com/rveen/ogdl"
+)
+
+// compileCondition parses a condition with the expression grammar of the
+// parser package and returns its syntax tree.
+func compileCondition(s string) (*ogdl.Graph, error) {
+
+	// The trailing space lets the parser stop before the end
+	src := strings.TrimSpace(s) + " "
+
+	eh := eventhandler.New()
+	p := parser.New([]byte(src), eh)
+	if !p.Expression() || p.Ix != len(src) {
+		return nil, errors.New("invalid condition: " + s)
+	}
+
+	g := eh.Graph()
+	parser.Ast(g)
+	if g.Len() != 1 {
+		return nil, errors.New("invalid condition: " + s)
+	}
+	return g.Out[0], nil
+}
+
+// env holds the values that conditions refer to.
+type env struct {
+	ctx          *ogdl.Graph
+	sub, obj, op string
+	now          time.Time
+}
+
+// value returns the value of a path in a condition. Paths are looked up in the
+// context first, and then in the built-in variables.
+func (e *env) value(n *ogdl.Graph) interface{} {
+
+	var path []string
+	for _, c := range n.Out {
+		if c.ThisString() == parser.TypeIndex {
+			if c.Len() == 0 {
+				return nil
+			}
+			path = append(path, str(e.eval(c.Out[0])))
+			continue
+		}
+		path = append(path, c.ThisString())
+	}
+	if len(path) == 0 {
+		return nil
+	}
+
+	if e.ctx != nil {
+		if v := e.ctx.Get(strings.Join(path, ".")); v != nil && v.Len() > 0 {
+			return v.String()
+		}
+	}
+
+	if len(path) > 1 {
+		return nil
+	}
+
+	switch path[0] {
+	case "subject":
+		return e.sub
+	case "object":
+		return e.obj
+	case "operation":
+		return e.op
+	case "time":
+		return e.now.Format("15:04")
+	case "date":
+		return e.now.Format("2006-01-02")
+	case "weekday":
+		return e.now.Format("Mon")
+	case "hour":
+		return float64(e.now.Hour())
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return nil
+}
+
+// eval returns the value of an expression: a string, a float64, a bool or nil.
+func (e *env) eval(n *ogdl.Graph) interface{} {
+
+	s := n.ThisString()
+
+	switch s {
+	case parser.TypePath:
+		return e.value(n)
+	case parser.TypeString:
+		if n.Len() == 0 {
+			return ""
+		}
+		return n.Out[0].ThisString()
+	case parser.TypeGroup:
+		if n.Len() == 0 {
+			return nil
+		}
+		return e.eval(n.Out[0])
+	}
+
+	if n.Len() == 0 {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+		return s
+	}
+
+	// Unary operators
+	if n.Len() == 1 {
+		v := e.eval(n.Out[0])
+		switch s {
+		case "!":
+			return !truth(v)
+		case "-":
+			if f, ok := number(v); ok {
+				return -f
+			}
+		case "+":
+			return v
+		}
+		return nil
+	}
+
+	// Short circuit
+	switch s {
+	case "&&":
+		return truth(e.eval(n.Out[0])) && truth(e.eval(n.Out[1]))
+	case "||":
+		return truth(e.eval(n.Out[0])) || truth(e.eval(n.Out[1]))
+	}
+
+	a, b := e.eval(n.Out[0]), e.eval(n.Out[1])
+
+	switch s {
+	case "==", "!=", "<", "<=", ">", ">=":
+		c := compare(a, b)
+		switch s {
+		case "==":
+			return c == 0
+		case "!=":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		default:
+			return c >= 0
+		}
+	}
+
+	x, ok1 := number(a)
+	y, ok2 := number(b)
+	if !ok1 || !ok2 {
+		if s == "+" {
+			return str(a) + str(b)
+		}
+		return nil
+	}
+
+	switch s {
+	case "+":
+		return x + y
+	case "-":
+		return x - y
+	case "*":
+		return x * y
+	case "/":
+		if y != 0 {
+			return x / y
+		}
+	case "%":
+		if y != 0 {
+			return float64(int64(x) % int64(y))
+		}
+	}
+	return nil
+}
+
+// compare compares two values as numbers if both are numbers, and as strings
+// otherwise.
+func compare(a, b interface{}) int {
+
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(str(a), str(b))
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// str converts a value to a string. Missing values are empty strings.
+func str(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// truth returns false for nil, false, 0, "", "false" and "0", and true for
+// anything else.
+func truth(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != "" && v != "false" && v != "0"
+	}
+	return false
+}
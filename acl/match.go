@@ -0,0 +1,169 @@
+package acl
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// placeholder is replaced by the subject of a request in rule objects.
+const placeholder = "{user}"
+
+var globEscaper = strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`)
+
+// matcher is the compiled object of a rule.
+type matcher struct {
+	object string
+	prefix bool
+	glob   []string
+	re     *regexp.Regexp
+	user   bool // object contains {user}: compiled per subject
+
+	mu     sync.Mutex
+	byUser map[string]*matcher // compiled objects of {user} matchers
+}
+
+// maxUsers bounds the number of subjects for which the object of a {user}
+// matcher is kept compiled.
+const maxUsers = 1000
+
+// isPrefix returns true for objects with a single trailing '*' and no other
+// pattern characters, which are prefixes.
+func isPrefix(obj string) bool {
+	return strings.HasSuffix(obj, "*") && !strings.HasPrefix(obj, "~") &&
+		!strings.ContainsAny(obj[:len(obj)-1], "*?[")
+}
+
+// compile prepares the object of a rule for matching.
+func compile(obj string, prefix bool) (*matcher, error) {
+
+	m := &matcher{object: obj, prefix: prefix}
+
+	if strings.Contains(obj, placeholder) {
+		m.user = true
+		// Check the pattern with a dummy user
+		_, err := compile(strings.ReplaceAll(obj, placeholder, "user"), prefix)
+		return m, err
+	}
+
+	switch {
+	case prefix:
+	case strings.HasPrefix(obj, "~"):
+		re, err := regexp.Compile(obj[1:])
+		if err != nil {
+			return nil, err
+		}
+		m.re = re
+	case strings.ContainsAny(obj, "*?["):
+		m.glob = strings.Split(obj, "/")
+		for _, p := range m.glob {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// match returns true if the object of a request matches. sub is the subject
+// of the request, which replaces {user}.
+func (m *matcher) match(obj, sub string) bool {
+
+	if m.user {
+		// A subject cannot span path elements or act as a pattern
+		if sub == "" || strings.Contains(sub, "/") {
+			return false
+		}
+		m2 := m.forUser(sub)
+		return m2 != nil && m2.match(obj, sub)
+	}
+
+	switch {
+	case m.prefix:
+		return strings.HasPrefix(obj, m.object)
+	case m.re != nil:
+		return m.re.MatchString(obj)
+	case m.glob != nil:
+		return glob(m.glob, strings.Split(obj, "/"))
+	}
+
+	// A path matches itself and the paths below it
+	if !strings.HasPrefix(obj, m.object) {
+		return false
+	}
+	return len(obj) == len(m.object) || obj[len(m.object)] == '/' || strings.HasSuffix(m.object, "/")
+}
+
+// forUser returns the matcher of a {user} object with the placeholder
+// replaced by sub, or nil if it does not compile.
+func (m *matcher) forUser(sub string) *matcher {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m2, ok := m.byUser[sub]; ok {
+		return m2
+	}
+
+	o := m.object
+	switch {
+	case strings.HasPrefix(o, "~"):
+		o = strings.ReplaceAll(o, placeholder, regexp.QuoteMeta(sub))
+	case m.prefix:
+		o = strings.ReplaceAll(o, placeholder, sub)
+	default:
+		o = strings.ReplaceAll(o, placeholder, globEscaper.Replace(sub))
+	}
+	m2, err := compile(o, m.prefix)
+	if err != nil {
+		m2 = nil
+	}
+
+	if m.byUser == nil || len(m.byUser) >= maxUsers {
+		m.byUser = make(map[string]*matcher)
+	}
+	m.byUser[sub] = m2
+	return m2
+}
+
+// cleanObject returns the object of a request with . and .. elements and
+// repeated slashes resolved, so that it cannot escape the pattern of a rule.
+// A trailing slash is kept.
+func cleanObject(obj string) string {
+	if obj == "" {
+		return obj
+	}
+	c := path.Clean(obj)
+	if strings.HasSuffix(obj, "/") && c != "/" {
+		c += "/"
+	}
+	return c
+}
+
+// glob matches path elements against pattern elements, where '**' matches
+// any number of elements.
+func glob(pattern, elems []string) bool {
+
+	for len(pattern) > 0 {
+
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if glob(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+
+	return len(elems) == 0
+}
@@ -175,3 +175,42 @@ func ReadString(in string) ([]map[string]string, error) {
 
 	return rr, nil
 }
+
+// Records reads a CSV text and returns the field names (the first line) and
+// the remaining lines, in order. Values are trimmed and unquoted as in
+// ReadString, but empty values are kept so that row[j] belongs to keys[j].
+func Records(in string) ([]string, [][]string, error) {
+
+	// Remove byte order marker
+	if strings.HasPrefix(in, "\xef\xbb\xbf") {
+		in = in[3:]
+	}
+
+	var keys []string
+	var rows [][]string
+
+	scanner := bufio.NewScanner(strings.NewReader(in))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		l := Split(line)
+		for j, value := range l {
+			value = strings.TrimSpace(value)
+			if len(value) > 1 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+				value = value[1 : len(value)-1]
+			}
+			l[j] = value
+		}
+
+		if keys == nil {
+			keys = l
+		} else {
+			rows = append(rows, l)
+		}
+	}
+
+	return keys, rows, scanner.Err()
+}
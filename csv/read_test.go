@@ -29,3 +29,17 @@ func TestSplit_2(t *testing.T) {
 	}
 
 }
+
+func TestRecords(t *testing.T) {
+
+	keys, rows, err := Records("\xef\xbb\xbfref, value,fp\n# comment\nR1, 10k, \"0603\"\n\nC2,,0402\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 || keys[1] != "value" {
+		t.Fatalf("keys %q", keys)
+	}
+	if len(rows) != 2 || rows[0][2] != "0603" || rows[1][0] != "C2" || rows[1][1] != "" {
+		t.Errorf("rows %q", rows)
+	}
+}
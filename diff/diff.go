@@ -0,0 +1,516 @@
+// Package diff compares two versions of a file and returns the differences as
+// an OGDL graph, so that they can be rendered with templates.
+//
+// Markdown documents are compared section by section (with the section paths
+// used by document.Part), OGDL data files node by node, and any other file line
+// by line.
+package diff
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rveen/golib/document"
+	"github.com/rveen/ogdl"
+)
+
+// Context is the number of unchanged lines shown around each change.
+var Context = 3
+
+// maxD is the maximum number of edits for which a minimal diff is computed.
+// Beyond that, the differing block is reported as a single replacement.
+const maxD = 1000
+
+// Files compares two versions of the file name, choosing the comparison by
+// extension: .md as document, .ogdl as data, anything else as text.
+//
+//	type text|data|document
+//	... (see Lines, Data and Document)
+func Files(name string, a, b []byte) *ogdl.Graph {
+
+	var g *ogdl.Graph
+
+	switch filepath.Ext(name) {
+	case ".md":
+		g = Document(string(a), string(b))
+	case ".ogdl":
+		g = Data(ogdl.FromBytes(a), ogdl.FromBytes(b))
+	default:
+		g = Lines(string(a), string(b))
+	}
+
+	return g
+}
+
+// Revisions compares the versions a and b of the file path at the revisions
+// from and to. It returns the differences as in Files, with the path and the
+// revisions added, and as a unified diff.
+//
+//	type text|data|document
+//	...
+//	path file
+//	from rev
+//	to rev
+func Revisions(path, from, to string, a, b []byte) (*ogdl.Graph, string) {
+
+	g := Files(path, a, b)
+	g.Add("path").Add(path)
+	g.Add("from").Add(from)
+	g.Add("to").Add(to)
+
+	return g, Unified(path+"@"+from, path+"@"+to, string(a), string(b))
+}
+
+// Lines returns a line diff of a and b:
+//
+//	type text
+//	hunks
+//	  -
+//	    a 12       (first line in a, 1 based)
+//	    b 14       (first line in b)
+//	    lines
+//	      " unchanged"
+//	      "-removed"
+//	      "+added"
+func Lines(a, b string) *ogdl.Graph {
+
+	g := ogdl.New(nil)
+	g.Add("type").Add("text")
+	hunksToGraph(g.Add("hunks"), hunks(split(a), split(b)))
+	return g
+}
+
+// Unified returns the line diff of a and b in unified diff format.
+func Unified(nameA, nameB, a, b string) string {
+
+	hh := hunks(split(a), split(b))
+	if len(hh) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("--- " + nameA + "\n+++ " + nameB + "\n")
+
+	for _, h := range hh {
+		na, nb := 0, 0
+		for _, l := range h.lines {
+			if l[0] != '+' {
+				na++
+			}
+			if l[0] != '-' {
+				nb++
+			}
+		}
+		sb.WriteString("@@ -" + rng(h.a, na) + " +" + rng(h.b, nb) + " @@\n")
+		for _, l := range h.lines {
+			sb.WriteString(l)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+func rng(start, n int) string {
+	if n == 0 {
+		start--
+	}
+	return strconv.Itoa(start) + "," + strconv.Itoa(n)
+}
+
+// Data returns the differences between two OGDL graphs. Nodes are matched by
+// name among their siblings (in order, if a name is repeated). Paths are the
+// node names joined by dots.
+//
+//	type data
+//	added
+//	  path
+//	    value
+//	removed
+//	  path
+//	    value
+//	changed
+//	  path
+//	    from
+//	      old value
+//	    to
+//	      new value
+func Data(a, b *ogdl.Graph) *ogdl.Graph {
+
+	g := ogdl.New(nil)
+	g.Add("type").Add("data")
+	added := g.Add("added")
+	removed := g.Add("removed")
+	changed := g.Add("changed")
+
+	dataDiff(a, b, "", added, removed, changed)
+	return g
+}
+
+func dataDiff(a, b *ogdl.Graph, path string, added, removed, changed *ogdl.Graph) {
+
+	ma := match(a, b)
+	used := make([]bool, b.Len())
+
+	for i := 0; i < a.Len(); i++ {
+		na := a.Out[i]
+		p := join(path, na.ThisString())
+
+		j := ma[i]
+		if j < 0 {
+			removed.Add(p).Out = na.Out
+			continue
+		}
+		used[j] = true
+		nb := b.Out[j]
+
+		if isLeafList(na) || isLeafList(nb) {
+			if na.Text() != nb.Text() {
+				c := changed.Add(p)
+				c.Add("from").Out = na.Out
+				c.Add("to").Out = nb.Out
+			}
+			continue
+		}
+		dataDiff(na, nb, p, added, removed, changed)
+	}
+
+	for j := 0; j < b.Len(); j++ {
+		if !used[j] {
+			nb := b.Out[j]
+			added.Add(join(path, nb.ThisString())).Out = nb.Out
+		}
+	}
+}
+
+// match returns for each child of a the index of the child of b with the same
+// name (the n-th occurrence of a name matches the n-th occurrence), or -1.
+func match(a, b *ogdl.Graph) []int {
+
+	ix := make(map[string][]int)
+	for j := 0; j < b.Len(); j++ {
+		s := b.Out[j].ThisString()
+		ix[s] = append(ix[s], j)
+	}
+
+	m := make([]int, a.Len())
+	for i := 0; i < a.Len(); i++ {
+		s := a.Out[i].ThisString()
+		if jj := ix[s]; len(jj) > 0 {
+			m[i] = jj[0]
+			ix[s] = jj[1:]
+		} else {
+			m[i] = -1
+		}
+	}
+	return m
+}
+
+// isLeafList returns true if the children of g have no children themselves,
+// that is, g holds a value or a list of values.
+func isLeafList(g *ogdl.Graph) bool {
+	for _, n := range g.Out {
+		if n.Len() != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Document returns the differences between two markdown documents, section by
+// section. A section is the text between its header and the next header, and
+// is identified by its path as in document.Part. Text before the first header
+// has the path "_".
+//
+//	type document
+//	added
+//	  path
+//	    text
+//	removed
+//	  path
+//	    text
+//	changed
+//	  path
+//	    hunks (as in Lines)
+func Document(a, b string) *ogdl.Graph {
+
+	g := ogdl.New(nil)
+	g.Add("type").Add("document")
+	added := g.Add("added")
+	removed := g.Add("removed")
+	changed := g.Add("changed")
+
+	sa := sectionTexts(a)
+	sb := sectionTexts(b)
+
+	// Match sections by path (n-th occurrence to n-th occurrence)
+	ix := make(map[string][]int)
+	for i, s := range sa {
+		ix[s.path] = append(ix[s.path], i)
+	}
+	used := make([]bool, len(sa))
+
+	for _, s := range sb {
+		ii := ix[s.path]
+		if len(ii) == 0 {
+			added.Add(s.path).Add("text").Add(s.text)
+			continue
+		}
+		ix[s.path] = ii[1:]
+		used[ii[0]] = true
+
+		if t := sa[ii[0]].text; t != s.text {
+			hunksToGraph(changed.Add(s.path).Add("hunks"), hunks(split(t), split(s.text)))
+		}
+	}
+
+	for i, s := range sa {
+		if !used[i] {
+			removed.Add(s.path).Add("text").Add(s.text)
+		}
+	}
+
+	return g
+}
+
+type sectionText struct {
+	path string
+	text string
+}
+
+func sectionTexts(src string) []sectionText {
+
+	lines := strings.SplitAfter(src, "\n")
+	ss := document.Sections(src)
+
+	var st []sectionText
+
+	first := len(lines)
+	if len(ss) > 0 {
+		first = ss[0].Start
+	}
+	if pre := strings.Join(lines[:first], ""); strings.TrimSpace(pre) != "" {
+		st = append(st, sectionText{"_", pre})
+	}
+
+	for _, s := range ss {
+		st = append(st, sectionText{s.Path, strings.Join(lines[s.Start:s.Body], "")})
+	}
+	return st
+}
+
+type hunk struct {
+	a, b  int
+	lines []string
+}
+
+func hunksToGraph(g *ogdl.Graph, hh []hunk) {
+	for _, h := range hh {
+		n := g.Add("-")
+		n.Add("a").Add(h.a)
+		n.Add("b").Add(h.b)
+		l := n.Add("lines")
+		for _, s := range h.lines {
+			l.Add(s)
+		}
+	}
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// hunks groups the edit script of a and b into hunks with Context lines of
+// unchanged text around each change. Changes separated by no more than
+// 2*Context unchanged lines go into the same hunk.
+func hunks(a, b []string) []hunk {
+
+	ops := edits(a, b)
+
+	// Line in a and b before each op
+	xs := make([]int, len(ops)+1)
+	ys := make([]int, len(ops)+1)
+	for i, op := range ops {
+		xs[i+1], ys[i+1] = xs[i], ys[i]
+		if op != '+' {
+			xs[i+1]++
+		}
+		if op != '-' {
+			ys[i+1]++
+		}
+	}
+
+	var hh []hunk
+
+	for i := 0; i < len(ops); {
+		if ops[i] == ' ' {
+			i++
+			continue
+		}
+
+		// i is the first change of a hunk, find the last one
+		end := i
+		for j := i + 1; j < len(ops) && j-end <= 2*Context+1; j++ {
+			if ops[j] != ' ' {
+				end = j
+			}
+		}
+
+		from := max(0, i-Context)
+		to := min(len(ops), end+Context+1)
+
+		h := hunk{a: xs[from] + 1, b: ys[from] + 1}
+		for k := from; k < to; k++ {
+			switch ops[k] {
+			case '+':
+				h.lines = append(h.lines, "+"+b[ys[k]])
+			case '-':
+				h.lines = append(h.lines, "-"+a[xs[k]])
+			default:
+				h.lines = append(h.lines, " "+a[xs[k]])
+			}
+		}
+		hh = append(hh, h)
+		i = to
+	}
+
+	return hh
+}
+
+// edits returns the edit script that transforms a into b, one byte per line:
+// ' ' (unchanged), '-' (line of a removed) or '+' (line of b added).
+func edits(a, b []string) []byte {
+
+	// Common prefix and suffix
+	p := 0
+	for p < len(a) && p < len(b) && a[p] == b[p] {
+		p++
+	}
+	s := 0
+	for s < len(a)-p && s < len(b)-p && a[len(a)-1-s] == b[len(b)-1-s] {
+		s++
+	}
+
+	var ops []byte
+	for i := 0; i < p; i++ {
+		ops = append(ops, ' ')
+	}
+
+	ma, mb := a[p:len(a)-s], b[p:len(b)-s]
+	mid, ok := myers(ma, mb)
+	if !ok {
+		mid = mid[:0]
+		for range ma {
+			mid = append(mid, '-')
+		}
+		for range mb {
+			mid = append(mid, '+')
+		}
+	}
+	ops = append(ops, mid...)
+
+	for i := 0; i < s; i++ {
+		ops = append(ops, ' ')
+	}
+	return ops
+}
+
+// myers computes a minimal edit script with Myers' algorithm. It returns false
+// if more than maxD edits are needed.
+func myers(a, b []string) ([]byte, bool) {
+
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil, true
+	}
+
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+
+		if d > maxD {
+			return nil, false
+		}
+
+		// Save the furthest reaching paths of d-1 (diagonals -d..d)
+		t := make([]int, 2*d+1)
+		copy(t, v[off-d:off+d+1])
+		trace = append(trace, t)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, n, m), true
+			}
+		}
+	}
+	return nil, false
+}
+
+func backtrack(trace [][]int, x, y int) []byte {
+
+	var ops []byte
+
+	for d := len(trace) - 1; d > 0; d-- {
+		t := trace[d]
+		k := x - y
+
+		var pk int
+		if k == -d || (k != d && t[k-1+d] < t[k+1+d]) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := t[pk+d]
+		py := px - pk
+
+		for x > px && y > py {
+			ops = append(ops, ' ')
+			x--
+			y--
+		}
+		if x == px {
+			ops = append(ops, '+')
+			y--
+		} else {
+			ops = append(ops, '-')
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		ops = append(ops, ' ')
+		x--
+		y--
+	}
+
+	// Reverse
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
@@ -0,0 +1,138 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rveen/ogdl"
+)
+
+func TestUnified(t *testing.T) {
+
+	a := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\n"
+	b := "a\nb\nc\nD\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+
+	s := Unified("x@1", "x@2", a, b)
+	exp := "--- x@1\n+++ x@2\n" +
+		"@@ -1,7 +1,7 @@\n a\n b\n c\n-d\n+D\n e\n f\n g\n" +
+		"@@ -10,3 +10,4 @@\n j\n k\n l\n+m\n"
+	if s != exp {
+		t.Errorf("unexpected diff:\n%s", s)
+	}
+
+	if s := Unified("a", "b", a, a); s != "" {
+		t.Errorf("expected no diff, got:\n%s", s)
+	}
+}
+
+func TestEdits(t *testing.T) {
+
+	a := strings.Split("the quick brown fox jumps over the lazy dog", " ")
+	b := strings.Split("a quick brown cat jumps over the dog today", " ")
+
+	ops := edits(a, b)
+
+	// Apply the edit script to a and check that it gives b
+	var r []string
+	x, y := 0, 0
+	for _, op := range ops {
+		switch op {
+		case ' ':
+			if a[x] != b[y] {
+				t.Fatalf("line %d of a does not match line %d of b", x, y)
+			}
+			r = append(r, a[x])
+			x++
+			y++
+		case '-':
+			x++
+		case '+':
+			r = append(r, b[y])
+			y++
+		}
+	}
+	if strings.Join(r, " ") != strings.Join(b, " ") {
+		t.Errorf("got %v", r)
+	}
+	if n := strings.Count(string(ops), " "); n != 6 {
+		t.Errorf("diff is not minimal: %d common words", n)
+	}
+}
+
+// keys returns the names of the children of g, separated by spaces.
+func keys(g *ogdl.Graph) string {
+	var ss []string
+	for _, n := range g.Out {
+		ss = append(ss, n.ThisString())
+	}
+	return strings.Join(ss, " ")
+}
+
+func TestDocument(t *testing.T) {
+
+	a := "intro\n# Intro\ntext\n## Sub Part\nmore\n# Other\nx\n"
+	b := "# Intro\ntext\n## Sub Part\nmore, changed\n# New\ny\n"
+
+	g := Document(a, b)
+	if s := g.Node("type").String(); s != "document" {
+		t.Errorf("type %s", s)
+	}
+	if s := keys(g.Node("added")); s != "new" {
+		t.Errorf("added %s", s)
+	}
+	if s := keys(g.Node("removed")); s != "_ other" {
+		t.Errorf("removed %s", s)
+	}
+	if s := keys(g.Node("changed")); s != "intro.sub_part" {
+		t.Errorf("changed %s", s)
+	}
+	if s := g.Node("removed").Node("other").Node("text").String(); s != "# Other\nx\n" {
+		t.Errorf("removed text %q", s)
+	}
+
+	if g := Document(a, a); g.Node("added").Len()+g.Node("removed").Len()+g.Node("changed").Len() != 0 {
+		t.Error("differences in the same document")
+	}
+}
+
+func TestData(t *testing.T) {
+
+	a := ogdl.FromString("name x\nport 80\nlist a b\nsub\n  k 1\n  old 2\n")
+	b := ogdl.FromString("name x\nport 81\nlist a b\nsub\n  k 1\n  new 3\n")
+
+	g := Data(a, b)
+	if s := g.Node("type").String(); s != "data" {
+		t.Errorf("type %s", s)
+	}
+	if s := keys(g.Node("added")); s != "sub.new" {
+		t.Errorf("added %s", s)
+	}
+	if s := keys(g.Node("removed")); s != "sub.old" {
+		t.Errorf("removed %s", s)
+	}
+	c := g.Node("changed")
+	if s := keys(c); s != "port" {
+		t.Fatalf("changed %s", s)
+	}
+	if from, to := c.Node("port").Node("from").String(), c.Node("port").Node("to").String(); from != "80" || to != "81" {
+		t.Errorf("port from %s to %s", from, to)
+	}
+}
+
+func TestFiles(t *testing.T) {
+
+	a, b := []byte("# A\nx\n"), []byte("# A\ny\n")
+	for name, typ := range map[string]string{"doc.md": "document", "data.ogdl": "data", "notes.txt": "text"} {
+		if s := Files(name, a, b).Node("type").String(); s != typ {
+			t.Errorf("%s: type %s, want %s", name, s, typ)
+		}
+	}
+
+	g, u := Revisions("notes.txt", "1", "2", a, b)
+	if g.Node("path").String() != "notes.txt" || g.Node("from").String() != "1" || g.Node("to").String() != "2" {
+		t.Errorf("revisions\n%s", g.Text())
+	}
+	if !strings.HasPrefix(u, "--- notes.txt@1\n+++ notes.txt@2\n") || !strings.Contains(u, "-x\n+y\n") {
+		t.Errorf("unified\n%s", u)
+	}
+}
@@ -188,3 +188,39 @@ func TestCodeBlockBlankLine(t *testing.T) {
 		t.Errorf("blank line in code block caused header parsing: %s", h)
 	}
 }
+
+func TestReplacePart(t *testing.T) {
+
+	src := "# one\n\ntext\n\n## sub\n\nsub text\n\n# two\n\nmore\n"
+
+	s, err := ReplacePart(src, "one.sub", "## sub\n\nnew")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "# one\n\ntext\n\n## sub\n\nnew\n\n# two\n\nmore\n" {
+		t.Errorf("unexpected result: %q", s)
+	}
+
+	s, _ = ReplacePart(src, "one", "")
+	if s != "# two\n\nmore\n" {
+		t.Errorf("unexpected result: %q", s)
+	}
+
+	if _, err = ReplacePart(src, "three", "x"); err != ErrPartNotFound {
+		t.Errorf("expected ErrPartNotFound, got %v", err)
+	}
+}
+
+func TestDataBlock(t *testing.T) {
+
+	doc, _ := New("# Pedal force {#DEMO-12} {!requirement}\n\n{\nstatus approved\nowner ann\n}\n\nThe pedal.\n")
+
+	if h := doc.Html(); strings.Contains(h, "!g") || !strings.Contains(h, "DEMO-12") {
+		t.Errorf("html: %s", h)
+	}
+
+	d := doc.Data().Node("DEMO-12")
+	if d == nil || d.Node("_type").String() != "requirement" || d.Node("status").String() != "approved" || d.Node("owner").String() != "ann" {
+		t.Errorf("data\n%s", doc.Data().Text())
+	}
+}
@@ -33,6 +33,30 @@ func (doc *Document) textToData(eh *eventhandler.EventHandler) {
 	eh.Dec()
 }
 
+// dataToData adds the content of a data block ({ ... }) below the current
+// header.
+func (doc *Document) dataToData(eh *eventhandler.EventHandler) {
+
+	text, n := doc.stream.Item(doc.ix)
+	if n < 1 {
+		return
+	}
+	doc.ix++
+
+	lv := eh.Level()
+	addGraph(eh, ogdl.FromString(text))
+	eh.SetLevel(lv)
+}
+
+func addGraph(eh *eventhandler.EventHandler, g *ogdl.Graph) {
+	for _, n := range g.Out {
+		eh.Add(n.ThisString())
+		eh.Inc()
+		addGraph(eh, n)
+		eh.Dec()
+	}
+}
+
 func (doc *Document) headerToData(eh *eventhandler.EventHandler) {
 
 	level, _ := doc.stream.Item(doc.ix)
@@ -52,7 +76,11 @@ func (doc *Document) headerToData(eh *eventhandler.EventHandler) {
 		typ = typ[1:]
 	}
 
+	// The title and subtitle of the document are not data
 	n, _ := strconv.Atoi(level)
+	if n < 1 {
+		return
+	}
 	eh.SetLevel(n - 1)
 	eh.Add(key)
 	eh.Inc()
@@ -97,6 +97,8 @@ func (doc *Document) html(flat bool) string {
 			tableToHtml(n, &sb)
 		case "!var":
 			sb.WriteString(variable(n.String(), doc.Context))
+		case "!g":
+			// Data is not shown
 		default:
 			sb.WriteString(s)
 		}
@@ -215,6 +217,14 @@ func (doc *Document) HtmlNoHeader() string {
 	return sb.String()
 }
 
+// Copy returns a document that shares the parsed content of doc but has its
+// own reading position, so that both can be read concurrently. The index used
+// by Part is shared only if it was already built when Copy was called.
+func (doc *Document) Copy() *Document {
+	d := *doc
+	return &d
+}
+
 // Part returns the part of the document indicated by the given path.
 func (doc *Document) Part(path string) *Document {
 
@@ -285,6 +295,8 @@ func (doc *Document) Data() *ogdl.Graph {
 			// doc.textToData(eh)
 		case "!tb":
 			doc.tableToData(eh)
+		case "!g":
+			doc.dataToData(eh)
 		}
 	}
 
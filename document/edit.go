@@ -0,0 +1,160 @@
+package document
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrPartNotFound is returned by ReplacePart when the path does not address a
+// section of the document.
+var ErrPartNotFound = errors.New("document part not found")
+
+// Section is the location of a header in the markdown source, in lines.
+type Section struct {
+	Path  string // header keys joined by dots, as used in Part
+	Level int    // 0 for titles, 1..6 for headers
+	Start int    // line of the header
+	Body  int    // first line after the section text (the next header of any level)
+	End   int    // first line after the section, subsections included
+}
+
+// ReplacePart returns the markdown source src with the section addressed by path
+// replaced by part. Paths are the same as in Part: header keys joined by dots.
+//
+// The section starts at its header line and extends up to the next header of
+// the same or a higher level, so part should normally include the header.
+// If part is empty the section is removed.
+func ReplacePart(src, path, part string) (string, error) {
+
+	lines := strings.SplitAfter(src, "\n")
+
+	for _, s := range sections(lines) {
+		if s.Path != path {
+			continue
+		}
+
+		if part != "" && !strings.HasSuffix(part, "\n") {
+			part += "\n"
+		}
+		// Keep a blank line between the new part and the next header
+		if part != "" && s.End < len(lines) && !strings.HasSuffix(part, "\n\n") {
+			part += "\n"
+		}
+
+		var sb strings.Builder
+		for _, l := range lines[:s.Start] {
+			sb.WriteString(l)
+		}
+		if s.Start > 0 && !strings.HasSuffix(lines[s.Start-1], "\n") {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(part)
+		for _, l := range lines[s.End:] {
+			sb.WriteString(l)
+		}
+		return sb.String(), nil
+	}
+
+	return "", ErrPartNotFound
+}
+
+// Sections returns the sections of the markdown source src, in order of
+// appearance. Line numbers are 0 based and refer to strings.SplitAfter(src, "\n").
+func Sections(src string) []*Section {
+	return sections(strings.SplitAfter(src, "\n"))
+}
+
+// sections returns the headers found in the source lines with their nesting
+// path. Keys are computed as in header(), and nesting follows headerToPart:
+// a header is placed under the last header seen at the level above it.
+func sections(lines []string) []*Section {
+
+	var ss []*Section
+	var keys []string
+	code := false
+	data := false
+
+	for i, l := range lines {
+
+		switch {
+		case strings.HasPrefix(l, "```"):
+			code = !code
+			continue
+		case code:
+			continue
+		case data:
+			if strings.HasPrefix(l, "}") {
+				data = false
+			}
+			continue
+		case strings.HasPrefix(l, "{"):
+			data = true
+			continue
+		}
+
+		lv, key, ok := headerLine(l)
+		if !ok {
+			continue
+		}
+
+		for _, s := range ss {
+			if s.End == len(lines) && lv <= s.Level {
+				s.End = i
+			}
+		}
+		if n := len(ss); n > 0 && ss[n-1].Body == len(lines) {
+			ss[n-1].Body = i
+		}
+
+		if lv < 1 {
+			continue
+		}
+		for len(keys) < lv {
+			keys = append(keys, "")
+		}
+		keys[lv-1] = key
+
+		path := ""
+		for _, k := range keys[:lv] {
+			if k == "" {
+				continue
+			}
+			if path != "" {
+				path += "."
+			}
+			path += k
+		}
+
+		ss = append(ss, &Section{Path: path, Level: lv, Start: i, Body: len(lines), End: len(lines)})
+	}
+
+	return ss
+}
+
+// headerLine returns the level and key of a header line. Titles (#!) have level 0.
+func headerLine(l string) (int, string, bool) {
+
+	l = strings.TrimRight(l, "\r\n")
+
+	n := 0
+	for n < len(l) && l[n] == '#' {
+		n++
+	}
+	if n == 0 || n == len(l) {
+		return 0, "", false
+	}
+
+	lv := n
+	s := l[n:]
+	if s[0] == '!' {
+		lv = 0
+		s = s[1:]
+	}
+	if s == "" || s[0] != ' ' {
+		return 0, "", false
+	}
+
+	_, s = getType(strings.TrimSpace(s))
+	key, _ := getKey(s)
+	return lv, key, true
+}
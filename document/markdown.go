@@ -10,7 +10,7 @@ import (
 )
 
 var (
-	anchor     = regexp.MustCompile(`{#\w+}`)
+	anchor     = regexp.MustCompile(`{#[\w-]+}`)
 	typ        = regexp.MustCompile(`{!\w+}`)
 	link       = regexp.MustCompile(`\[([^\]]+)\]\(([^\)]+)\)`)
 	link2      = regexp.MustCompile(`\[\]\(([^\)]+)\)`)
@@ -786,6 +786,7 @@ func data(p *parser.Parser) {
 	for {
 		s := p.Line()
 		sb.WriteString(s)
+		sb.WriteByte('\n')
 
 		if p.PeekByte() == '}' || p.End() {
 			p.Line()
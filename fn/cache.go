@@ -0,0 +1,269 @@
+package fn
+
+import (
+	"container/list"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/rveen/golib/document"
+	"github.com/rveen/ogdl"
+)
+
+// Cache keeps parsed files in memory, so that repeated requests for the same
+// file do not read and parse it again. It is enabled by setting FNode.Cache;
+// one Cache is normally shared by all the nodes created for a root, and is safe
+// for concurrent use.
+//
+// Files in the OS file system (or in RootFs) are cached after parsing, and the
+// entry is dropped when the modification time or size of the file changes.
+// Requests into SVN and Git repositories are cached as a whole (including the
+// navigation in the repository), and dropped when the repository changes: a
+// new youngest revision for SVN, a change in any reference for Git.
+//
+// Cached Data graphs are shared between nodes and must be treated as read-only.
+// Documents are shallow copies (see [document.Document.Copy]).
+//
+// A Cache should not be shared by nodes with different RootFs file systems, as
+// these have no root path to tell their files apart.
+type Cache struct {
+	mu      sync.Mutex
+	max     int
+	ll      *list.List
+	entries map[cacheKey]*list.Element
+	stats   CacheStats
+}
+
+// CacheStats holds the counters of a Cache.
+type CacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64 // entries dropped because the cache was full
+	Stale     int64 // entries dropped because the file or repository changed
+	Entries   int
+}
+
+type cacheKey struct {
+	root, path, rev string
+}
+
+type cacheEntry struct {
+	key   cacheKey
+	stamp string // mtime and size, or repository state
+
+	// What is restored into the FNode
+	Path     string
+	Revision string
+	Type     string
+	Data     *ogdl.Graph
+	Document *document.Document
+	Content  []byte
+	Params   map[string]string
+}
+
+// NewCache returns a cache that holds at most size entries. The least recently
+// used entry is dropped when a new one does not fit.
+func NewCache(size int) *Cache {
+	if size < 1 {
+		size = 1
+	}
+	return &Cache{max: size, ll: list.New(), entries: make(map[cacheKey]*list.Element)}
+}
+
+// Stats returns the hit and miss counters and the number of entries.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = c.ll.Len()
+	return s
+}
+
+// Purge removes all entries. Counters are kept.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	c.ll.Init()
+	c.entries = make(map[cacheKey]*list.Element)
+	c.mu.Unlock()
+}
+
+// get returns the entry for key if its stamp is still the same.
+func (c *Cache) get(key cacheKey, stamp string) (*cacheEntry, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+
+	e := el.Value.(*cacheEntry)
+	if e.stamp != stamp {
+		c.ll.Remove(el)
+		delete(c.entries, key)
+		c.stats.Stale++
+		c.stats.Misses++
+		return nil, false
+	}
+
+	c.ll.MoveToFront(el)
+	c.stats.Hits++
+	return e, true
+}
+
+func (c *Cache) put(e *cacheEntry) {
+
+	// Build the parts index now, so that it is shared by all copies.
+	if e.Document != nil {
+		e.Document.Part("")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[e.key]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.entries[e.key] = c.ll.PushFront(e)
+
+	for c.ll.Len() > c.max {
+		el := c.ll.Back()
+		c.ll.Remove(el)
+		delete(c.entries, el.Value.(*cacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// load reads the file at fn.Path and parses it (see parse), or takes both
+// from the cache if the file did not change.
+func (fn *FNode) load() error {
+
+	if fn.Cache == nil {
+		fn.file()
+		return fn.parse()
+	}
+
+	f, err := fn.stat(fn.Path)
+	if err != nil {
+		fn.file()
+		return fn.parse()
+	}
+
+	key := cacheKey{root: fn.Root, path: fn.Path}
+	stamp := fmt.Sprintf("%d %d", f.ModTime().UnixNano(), f.Size())
+
+	e, ok := fn.Cache.get(key, stamp)
+	if !ok {
+		if err := fn.file(); err != nil {
+			return err
+		}
+		e = &cacheEntry{key: key, stamp: stamp, Content: fn.Content}
+		e.Data, e.Document, err = fn.parsed()
+		if err != nil {
+			return err
+		}
+		fn.Cache.put(e)
+	}
+
+	fn.Content = e.Content
+	doc := e.Document
+	if doc != nil {
+		doc = doc.Copy()
+	}
+	return fn.into(e.Data, doc)
+}
+
+// cached runs get (svnGet or gitGet) for path, or restores its result from
+// the cache if the repository did not change. The state of the repository is
+// given by stamp.
+func (fn *FNode) cached(path string, stamp func() (string, error), get func(string) error) error {
+
+	if fn.Cache == nil {
+		return get(path)
+	}
+
+	s, err := stamp()
+	if err != nil {
+		return get(path)
+	}
+
+	p, rev := splitRevision(path)
+	key := cacheKey{root: fn.Root, path: p, rev: rev}
+
+	if e, ok := fn.Cache.get(key, s); ok {
+		fn.Path = e.Path
+		fn.Revision = e.Revision
+		fn.Type = e.Type
+		fn.Data = e.Data
+		fn.Document = e.Document
+		if fn.Document != nil {
+			fn.Document = fn.Document.Copy()
+		}
+		fn.Content = e.Content
+		if e.Params != nil {
+			fn.Params = make(map[string]string, len(e.Params))
+			for k, v := range e.Params {
+				fn.Params[k] = v
+			}
+		}
+		return nil
+	}
+
+	if err := get(path); err != nil {
+		return err
+	}
+
+	fn.Cache.put(&cacheEntry{
+		key:      key,
+		stamp:    s,
+		Path:     fn.Path,
+		Revision: fn.Revision,
+		Type:     fn.Type,
+		Data:     fn.Data,
+		Document: fn.Document,
+		Content:  fn.Content,
+		Params:   fn.Params,
+	})
+	if fn.Document != nil {
+		fn.Document = fn.Document.Copy()
+	}
+	return nil
+}
+
+// svnYoungest returns the youngest revision of the SVN repository at fn.Root.
+func (fn *FNode) svnYoungest() (string, error) {
+	b, err := exec.Command("svnlook", "youngest", fn.Root).Output()
+	return strings.TrimSpace(string(b)), err
+}
+
+// gitRefs returns the references of the Git repository at fn.Root with the
+// commits they point to.
+func (fn *FNode) gitRefs() (string, error) {
+	b, err := fn.git("show-ref", "--head")
+	return string(b), err
+}
+
+// splitRevision removes the revision (part@rev) from a repository path. A
+// path ending in @ (a log request) is returned as is.
+func splitRevision(path string) (string, string) {
+
+	if strings.HasSuffix(path, "@") {
+		return path, ""
+	}
+
+	i := strings.IndexByte(path, '@')
+	if i == -1 {
+		return path, ""
+	}
+	j := strings.IndexByte(path[i:], '/')
+	if j == -1 {
+		return path[:i], path[i+1:]
+	}
+	return path[:i] + path[i+j:], path[i+1 : i+j]
+}
@@ -0,0 +1,125 @@
+package fn
+
+import (
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestCacheFile(t *testing.T) {
+
+	root := t.TempDir()
+	os.WriteFile(root+"/data.ogdl", []byte("k v\n"), 0644)
+
+	cache := NewCache(10)
+
+	get := func(path string) *FNode {
+		fnode := New(root)
+		fnode.Cache = cache
+		if err := fnode.Get(path); err != nil {
+			t.Fatal(err)
+		}
+		return fnode
+	}
+
+	get("data.ogdl/k")
+	if s := get("data.ogdl/k").Data.String(); s != "v" {
+		t.Errorf("got %q", s)
+	}
+	if st := cache.Stats(); st.Hits != 1 || st.Misses != 1 || st.Entries != 1 {
+		t.Errorf("stats %+v", st)
+	}
+
+	// A change in size invalidates the entry
+	os.WriteFile(root+"/data.ogdl", []byte("k new\n"), 0644)
+	if s := get("data.ogdl/k").Data.String(); s != "new" {
+		t.Errorf("after change: got %q", s)
+	}
+	if st := cache.Stats(); st.Stale != 1 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestCacheLRU(t *testing.T) {
+
+	c := NewCache(2)
+	for _, p := range []string{"a", "b", "a", "c"} {
+		if _, ok := c.get(cacheKey{path: p}, ""); !ok {
+			c.put(&cacheEntry{key: cacheKey{path: p}})
+		}
+	}
+
+	// b was the least recently used
+	if _, ok := c.get(cacheKey{path: "b"}, ""); ok {
+		t.Error("b should have been evicted")
+	}
+	if _, ok := c.get(cacheKey{path: "a"}, ""); !ok {
+		t.Error("a should be cached")
+	}
+	if st := c.Stats(); st.Evictions != 1 || st.Entries != 2 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestCacheGit(t *testing.T) {
+
+	root := gitRepo(t)
+	cache := NewCache(10)
+
+	for _, path := range []string{"repo.git/data.ogdl@v1/k", "repo.git/data.ogdl/k@v1"} {
+		fnode := New(root)
+		fnode.Cache = cache
+		if err := fnode.Get(path); err != nil {
+			t.Fatal(err)
+		}
+		if s := fnode.Data.String(); s != "v" {
+			t.Errorf("%s: got %q", path, s)
+		}
+	}
+
+	if st := cache.Stats(); st.Hits != 1 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestCacheConcurrent(t *testing.T) {
+
+	root := t.TempDir()
+	os.WriteFile(root+"/doc.md", []byte("# A\n\ntext a\n\n# B\n\ntext b\n"), 0644)
+
+	cache := NewCache(10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fnode := New(root)
+			fnode.Cache = cache
+			if err := fnode.Get("doc.md/b"); err != nil {
+				t.Error(err)
+				return
+			}
+			fnode.Document.Html()
+		}()
+	}
+	wg.Wait()
+
+	if st := cache.Stats(); st.Hits+st.Misses != 20 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestSplitRevision(t *testing.T) {
+
+	for _, c := range [][3]string{
+		{"a/b", "a/b", ""},
+		{"a@12/b", "a/b", "12"},
+		{"a/b@v1", "a/b", "v1"},
+		{"a/b@", "a/b@", ""},
+	} {
+		if p, r := splitRevision(c[0]); p != c[1] || r != c[2] {
+			t.Errorf("%s: got %s %s", c[0], p, r)
+		}
+	}
+}
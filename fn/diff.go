@@ -0,0 +1,54 @@
+package fn
+
+import (
+	"errors"
+
+	"github.com/rveen/golib/diff"
+)
+
+// diff compares fn.Path at revisions fn.diffFrom and fn.Revision, loading each
+// version with load (svnFile or gitFile). fn.Data is set to the differences
+// (see package diff), fn.Content to a unified diff and fn.Type to "diff".
+func (fn *FNode) diff(load func() error) error {
+
+	switch fn.Type {
+	case "dir", "log", "":
+		return errors.New("diff: not a file")
+	}
+	if fn.n != len(fn.parts) {
+		return errors.New("diff: path inside a file not supported")
+	}
+
+	from, to := fn.diffFrom, fn.Revision
+
+	if err := load(); err != nil {
+		return err
+	}
+	b := fn.Content
+
+	fn.Revision = from
+	err := load()
+	fn.Revision = to
+	if err != nil {
+		return err
+	}
+	a := fn.Content
+
+	if from == "" {
+		from = "HEAD"
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+
+	g, u := diff.Revisions(fn.Path, from, to, a, b)
+
+	fn.Data = g
+	fn.Document = nil
+	fn.Content = []byte(u)
+	fn.Type = "diff"
+	fn.Revision = from + ".." + to
+	fn.diffFrom = ""
+
+	return nil
+}
@@ -32,6 +32,8 @@
 //     .md file; sub-paths address named sections within it.
 //   - Type "dir"      — Data holds a graph describing the directory listing
 //     (name, type, size, modification time for each entry).
+//   - Other types     — files with a handler in package [filetype] ("csv",
+//     "ini", "json", "notebook", ...); Data holds the parsed graph.
 //
 // Path, Type, and Params are always set after a successful Get, regardless of
 // the resolved type. Params captures any named wildcards matched during
@@ -79,6 +81,19 @@
 //
 //	fn.Get("manual.md/_")                // returns document.Data()
 //
+// Other file types
+//
+// The types above, and how sub-paths are resolved, come from the registry in
+// package [filetype]. It also knows CSV files (one node per line, named by the
+// first column), INI files, JSON and Jupyter notebooks, where numbers index
+// into lists:
+//
+//	fn.Get("parts.csv/R12/value")        // the value column of line R12
+//	fn.Get("notebook.ipynb/cells/3")     // the fourth cell
+//
+// Further types are added with [filetype.Register], normally from the init()
+// of the package that knows the format.
+//
 // Generic (wildcard) segments
 //
 // A directory whose name starts with "_" acts as a named wildcard. When a path
@@ -99,17 +114,26 @@
 // Params["tilde"]. This provides a conventional mechanism for user-scoped
 // paths (e.g. /~username/page).
 //
-// # SVN repositories
+// # SVN and Git repositories
 //
 // When navigation encounters a bare SVN repository directory, it seamlessly
 // delegates to SVN-aware logic using the svnlook and svn command-line tools.
+// Bare Git repositories are handled in the same way through the local git
+// binary, which reads the object store directly (no network access).
 // The same structured navigation rules (data sub-paths, document sections,
-// index files, directory listings) apply to content inside SVN.
+// index files, directory listings) apply to content inside both.
 //
-// Revisions are specified inline in the path with "@":
+// Revisions are specified inline in the path with "@". In Git a revision is
+// a commit hash, a tag or a branch:
 //
 //	fn.Get("repo/trunk/file.md@42")   // revision 42
 //	fn.Get("repo/trunk/file.md@")     // list all revisions (log)
+//	fn.Get("repo.git/file.md@v1.2")   // the file as tagged v1.2
+//	fn.Get("repo/trunk/file.md@12..15") // differences between 12 and 15
+//
+// A revision range sets Type to "diff" and Data to the differences as built
+// by package diff: changed sections of .md files, changed nodes of .ogdl files
+// and a line diff of any other file. Content holds a unified diff.
 //
 // File content is size-checked before loading to prevent out-of-memory
 // conditions for large binary assets (limit: 100 MB).
@@ -121,7 +145,8 @@
 //   - OS filesystem: created with [New](root), where root is an absolute path.
 //   - Embedded filesystem: created with [NewFS](fsys), where fsys is any
 //     [fs.FS] value (e.g. from go:embed). The same navigation and type
-//     detection logic applies to both.
+//     detection logic applies to both. [NewOverlay](fsys, dir) adds a
+//     writable directory whose files take precedence over those in fsys.
 //
 // # Retrieval variants
 //
@@ -131,4 +156,33 @@
 //   - [FNode.GetMeta] — resolves the path and sets Path, Type, and Params
 //     without reading file content. Useful when the caller intends to stream
 //     the file directly.
+//
+// # Caching
+//
+// Parsing is repeated on every Get unless the node has a [Cache], which is
+// shared by all the nodes of a root (and safe for concurrent use):
+//
+//	cache := fn.NewCache(1000)
+//
+//	fnode := fn.New(root)
+//	fnode.Cache = cache
+//	err := fnode.Get("spec.md/requirements")
+//
+// Entries are checked against the modification time and size of the file, or
+// against the state of the SVN or Git repository, on each use. [Cache.Stats]
+// returns hit and miss counters.
+//
+// # Writing
+//
+// [FNode.Put], [FNode.Delete] and [FNode.Move] resolve paths with the same
+// rules as Get, except that the last elements of the path may not exist yet.
+// A path that continues into a .ogdl file or a .md file addresses a node or a
+// section, and only that part of the file is replaced or removed:
+//
+//	fn.Put("config.ogdl/database", []byte("host localhost"))
+//	fn.Put("manual.md/introduction", []byte("# Introduction\n\nNew text\n"))
+//
+// OS roots are written in place. Embedded roots are written to the overlay
+// directory (and are read-only without one). Paths inside an SVN repository
+// are committed with svnmucc, with Author and Message as commit metadata.
 package fn
@@ -0,0 +1,75 @@
+package filetype
+
+import (
+	"strconv"
+
+	"github.com/rveen/golib/csv"
+	"github.com/rveen/golib/document"
+	"github.com/rveen/golib/ini"
+	"github.com/rveen/golib/jupyter"
+	"github.com/rveen/ogdl"
+)
+
+func init() {
+	Register(".md", &Handler{Type: "document", Parse: parseDocument})
+	Register(".ogdl", &Handler{Type: "data", Parse: parseData})
+	Register(".json", &Handler{Type: "json", Parse: parseJSON, Navigate: Index})
+	Register(".csv", &Handler{Type: "csv", Parse: parseCSV})
+	Register(".ini", &Handler{Type: "ini", Parse: parseINI})
+	Register(".ipynb", &Handler{Type: "notebook", Parse: parseNotebook, Navigate: Index})
+}
+
+func parseDocument(b []byte) (*ogdl.Graph, *document.Document, error) {
+	doc, err := document.New(string(b))
+	return nil, doc, err
+}
+
+func parseData(b []byte) (*ogdl.Graph, *document.Document, error) {
+	return ogdl.FromBytes(b), nil, nil
+}
+
+func parseJSON(b []byte) (*ogdl.Graph, *document.Document, error) {
+	g, err := ogdl.FromJSON(b)
+	return g, nil, err
+}
+
+func parseINI(b []byte) (*ogdl.Graph, *document.Document, error) {
+	g, err := ini.FromBytes(b)
+	return g, nil, err
+}
+
+func parseNotebook(b []byte) (*ogdl.Graph, *document.Document, error) {
+	g, err := jupyter.FromJupyter(b)
+	return g, nil, err
+}
+
+// parseCSV returns one node per line, named by the value in the first column
+// (or the line number, from 0, if empty), with the non empty fields of the
+// line below it:
+//
+//	R12
+//	  ref R12
+//	  value 10k
+func parseCSV(b []byte) (*ogdl.Graph, *document.Document, error) {
+
+	keys, rows, err := csv.Records(string(b))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g := ogdl.New(nil)
+
+	for i, row := range rows {
+		name := strconv.Itoa(i)
+		if len(row) > 0 && row[0] != "" {
+			name = row[0]
+		}
+		r := g.Add(name)
+		for j, v := range row {
+			if j < len(keys) && v != "" {
+				r.Add(keys[j]).Add(v)
+			}
+		}
+	}
+	return g, nil, nil
+}
@@ -0,0 +1,109 @@
+// Package filetype is a registry of file types that can be navigated into.
+//
+// A handler is registered for a file extension. It has a type name, a parser
+// that converts the file content into an ogdl.Graph and/or a document, and
+// optionally a navigator that resolves a sub-path inside the parsed data.
+// Paths such as 'parts.csv/R12/value' or 'notebook.ipynb/cells/3' are resolved
+// this way by package fn, in the same way as '.ogdl' files always were.
+//
+// Markdown, OGDL, JSON, CSV, INI and Jupyter notebooks are registered by this
+// package. Other integrations register their handlers from their own init(),
+// and are enabled by blank importing them (see formats/altium/altiumtype).
+package filetype
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rveen/golib/document"
+	"github.com/rveen/ogdl"
+)
+
+// Handler describes how files of one type are parsed and navigated.
+type Handler struct {
+	// Type is the type name of the file, as in fn.FNode.Type. The types
+	// "document" and "data" are those of .md and .ogdl files.
+	Type string
+
+	// Parse converts the content of a file into data, a document, or both.
+	Parse func(b []byte) (*ogdl.Graph, *document.Document, error)
+
+	// Navigate returns the part of g addressed by path (already split in
+	// elements). If nil, the elements are joined with dots and passed to
+	// g.Get, as for .ogdl files.
+	Navigate func(g *ogdl.Graph, path []string) *ogdl.Graph
+}
+
+var (
+	mu       sync.RWMutex
+	handlers = map[string]*Handler{}
+)
+
+// Register associates a handler with a file extension (".csv"). Extensions
+// are case insensitive. A later registration for the same extension replaces
+// the earlier one. It is meant to be called from init().
+func Register(ext string, h *Handler) {
+	mu.Lock()
+	handlers[strings.ToLower(ext)] = h
+	mu.Unlock()
+}
+
+// Lookup returns the handler for the extension of path, or nil.
+func Lookup(path string) *Handler {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return nil
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	return handlers[ext]
+}
+
+// Get returns the part of g addressed by path, using h.Navigate if set.
+// With an empty path g itself is returned.
+func (h *Handler) Get(g *ogdl.Graph, path []string) *ogdl.Graph {
+	if g == nil || len(path) == 0 {
+		return g
+	}
+	if h.Navigate != nil {
+		return h.Navigate(g, path)
+	}
+	return g.Get(strings.Join(path, "."))
+}
+
+// Index is a navigator for graphs converted from JSON, where objects are
+// '{' nodes and arrays '-' nodes. Such nodes are skipped, and a numeric path
+// element selects the n-th element (0 based) of a list.
+func Index(g *ogdl.Graph, path []string) *ogdl.Graph {
+
+	for _, p := range path {
+		g = skip(g)
+		if g == nil {
+			return nil
+		}
+
+		n := g.Node(p)
+		if n == nil {
+			i, err := strconv.Atoi(p)
+			if err != nil || i < 0 || i >= len(g.Out) {
+				return nil
+			}
+			n = g.Out[i]
+		}
+		g = n
+	}
+	return g
+}
+
+// skip returns the value of a key if it is an object or a list.
+func skip(g *ogdl.Graph) *ogdl.Graph {
+	if g == nil || len(g.Out) != 1 || g.ThisString() == "-" {
+		return g
+	}
+	if s := g.Out[0].ThisString(); s == "{" || s == "-" {
+		return g.Out[0]
+	}
+	return g
+}
@@ -0,0 +1,47 @@
+package filetype
+
+import (
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+
+	if h := Lookup("dir/Parts.CSV"); h == nil || h.Type != "csv" {
+		t.Errorf("csv handler not found")
+	}
+	if h := Lookup("README"); h != nil {
+		t.Errorf("handler for a file without extension")
+	}
+}
+
+func TestCSV(t *testing.T) {
+
+	h := Lookup("parts.csv")
+	g, _, err := h.Parse([]byte("ref,value,footprint\nR1,10k,0603\n,1u,0402\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := h.Get(g, []string{"R1", "value"}).String(); s != "10k" {
+		t.Errorf("R1/value: got %q", s)
+	}
+	if s := h.Get(g, []string{"1", "footprint"}).String(); s != "0402" {
+		t.Errorf("1/footprint: got %q", s)
+	}
+}
+
+func TestNotebook(t *testing.T) {
+
+	h := Lookup("notebook.ipynb")
+	g, _, err := h.Parse([]byte(`{"cells": [{"cell_type": "markdown"}, {"cell_type": "code"}], "nbformat": 4}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := h.Get(g, []string{"cells", "1", "cell_type"}).String(); s != "code" {
+		t.Errorf("cells/1/cell_type: got %q", s)
+	}
+	if n := h.Get(g, []string{"cells", "2"}); n != nil {
+		t.Errorf("cells/2 should not exist")
+	}
+}
@@ -1,16 +1,23 @@
 package fn
 
 import (
+	"errors"
 	"io/fs"
 	"strings"
 
 	"github.com/rveen/golib/document"
+	"github.com/rveen/golib/fn/filetype"
 	"github.com/rveen/ogdl"
 )
 
 type FNode struct {
-	Root   string
-	RootFs fs.FS
+	Root    string
+	RootFs  fs.FS
+	Overlay string
+
+	// Author and Message are used for commits when writing into SVN
+	Author  string
+	Message string
 
 	Path     string
 	Revision string
@@ -20,8 +27,12 @@ type FNode struct {
 	Content  []byte
 	Params   map[string]string
 
-	parts []string
-	n     int
+	// Cache, if set, keeps parsed files between calls to Get
+	Cache *Cache
+
+	parts    []string
+	n        int
+	diffFrom string // first revision of a range (rev1..rev2)
 }
 
 // joinParts joins fn.parts[fn.n:] with sep. Returns "" if there are no remaining parts.
@@ -45,31 +56,43 @@ func (fn *FNode) remainingPath() string { return fn.joinParts("/") }
 // remainingPathDot returns the unprocessed portion of the path (fn.parts[fn.n:]) joined by ".".
 func (fn *FNode) remainingPathDot() string { return fn.joinParts(".") }
 
-// Return the path as data. Start with fn.Content and process remaining
-// parts of path. If there are no remaining parts, the whole data file is returned.
-//
-// The file is what is loaded into fn.Content
-func (fn *FNode) data() {
-
-	fn.Data = ogdl.FromBytes(fn.Content)
+// parse parses fn.Content with the handler registered for its file type (see
+// package filetype) and processes the remaining parts of the path (see into).
+func (fn *FNode) parse() error {
+	g, doc, err := fn.parsed()
+	if err != nil {
+		return err
+	}
+	return fn.into(g, doc)
+}
 
-	path := fn.remainingPathDot()
-	if path != "" {
-		fn.Data = fn.Data.Get(path)
+func (fn *FNode) parsed() (*ogdl.Graph, *document.Document, error) {
+	h := filetype.Lookup(fn.Path)
+	if h == nil {
+		return nil, nil, errors.New("no handler for file type of " + fn.Path)
 	}
+	return h.Parse(fn.Content)
 }
 
-// Return the path as a document. Start with fn.Content and process remaining
-// parts of path. If there are no remaining parts, the whole document file is returned.
+// into sets fn.Data and fn.Document from the parsed file and processes the
+// remaining parts of the path. If there are no remaining parts, the whole file
+// is returned.
 //
-// The file is what is loaded into fn.Content
-func (fn *FNode) document() error {
+// Documents are navigated by section, and "_" selects their data view. Other
+// types are navigated by their handler.
+func (fn *FNode) into(g *ogdl.Graph, doc *document.Document) error {
 
-	var err error
-	fn.Document, err = document.New(string(fn.Content))
-	if err != nil {
-		return err
+	// A directory listing in fn.Data is kept when reading an index.md
+	if g != nil {
+		fn.Data = g
 	}
+	if doc == nil {
+		if fn.n < len(fn.parts) {
+			fn.Data = filetype.Lookup(fn.Path).Get(g, fn.parts[fn.n:])
+		}
+		return nil
+	}
+	fn.Document = doc
 
 	// If the current part is "_" then we want the data view of this document.
 	data := false
@@ -97,13 +120,11 @@ func (fn *FNode) fileType() string {
 	return fileType(fn.Path)
 }
 
-// fileType returns the type of a file: "data" (.ogdl), "document" (.md), or "file" (anything else).
+// fileType returns the type of a file: "data" (.ogdl), "document" (.md), the
+// type of any other handler registered in package filetype, or "file".
 func fileType(path string) string {
-	if strings.HasSuffix(path, ".md") {
-		return "document"
-	}
-	if strings.HasSuffix(path, ".ogdl") {
-		return "data"
+	if h := filetype.Lookup(path); h != nil {
+		return h.Type
 	}
 	return "file"
 }
@@ -61,8 +61,18 @@ func (fn *FNode) get(path string, raw, noRead bool) error {
 		case "svn":
 			// Create a new fn to return the SVN part
 			fn2 := New(fn.Path)
+			fn2.Cache = fn.Cache
 			fn.n++
-			err := fn2.svnGet(fn.remainingPath())
+			err := fn2.cached(fn.remainingPath(), fn2.svnYoungest, fn2.svnGet)
+			*fn = *fn2
+			return err
+
+		case "git":
+			// Same for a bare Git repository
+			fn2 := New(fn.Path)
+			fn2.Cache = fn.Cache
+			fn.n++
+			err := fn2.cached(fn.remainingPath(), fn2.gitRefs, fn2.gitGet)
 			*fn = *fn2
 			return err
 
@@ -71,33 +81,6 @@ func (fn *FNode) get(path string, raw, noRead bool) error {
 			// which are detected by fn.info()
 			break
 
-		case "document":
-			if noRead {
-				return nil
-			}
-			fn.file()
-
-			if !raw {
-				// Process remaining parts in document()
-				fn.n++
-				if err := fn.document(); err != nil {
-					return err
-				}
-			}
-			return nil
-
-		case "data":
-			if noRead {
-				return nil
-			}
-			fn.file()
-
-			if !raw {
-				// Process remaining parts in data()
-				fn.data()
-			}
-			return nil
-
 		case "":
 			// A part has been found that is not directly in the upper directory
 			// Cases:
@@ -115,13 +98,27 @@ func (fn *FNode) get(path string, raw, noRead bool) error {
 			} else {
 				fn.Path += "/" + genericPart
 			}
+
+		default:
+			// A document, data or other file type known to package filetype
+			if noRead {
+				return nil
+			}
+			if raw {
+				fn.file()
+				return nil
+			}
+
+			// Process remaining parts in load()
+			fn.n++
+			return fn.load()
 		}
 	}
 
 	switch fn.Type {
 
 	case "document":
-		return fn.document()
+		return fn.load()
 
 	case "file":
 		if fn.n != len(fn.parts) {
@@ -150,19 +147,10 @@ func (fn *FNode) processFile(raw, noRead bool) error {
 		return nil
 	}
 
-	err := fn.file()
-
-	if raw || err != nil {
-		return err
-	}
-
-	switch fn.Type {
-	case "document":
-		return fn.document()
-	case "data":
-		fn.data()
+	if raw || fn.Type == "dir" || fn.Type == "file" {
+		return fn.file()
 	}
-	return nil
+	return fn.load()
 }
 
 func (fn *FNode) generic() string {
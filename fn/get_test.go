@@ -1,6 +1,7 @@
 package fn
 
 import (
+	"os"
 	"testing"
 )
 
@@ -103,3 +104,20 @@ func TestGetDocPart(t *testing.T) {
 	t.Log(fnode.Type)
 	t.Log(fnode.Document.Html())
 }
+
+func TestGetTyped(t *testing.T) {
+
+	root := t.TempDir()
+	os.WriteFile(root+"/parts.csv", []byte("ref,value\nR12,4k7\n"), 0644)
+
+	fnode := New(root)
+	if err := fnode.Get("parts.csv/R12/value"); err != nil {
+		t.Fatal(err)
+	}
+	if fnode.Type != "csv" {
+		t.Errorf("type %s", fnode.Type)
+	}
+	if s := fnode.Data.String(); s != "4k7" {
+		t.Errorf("got %q", s)
+	}
+}
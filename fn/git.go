@@ -0,0 +1,202 @@
+package fn
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rveen/golib/fs/gitfs"
+	"github.com/rveen/ogdl"
+)
+
+// gitGet is the Git counterpart of svnGet. fn.Root is a bare Git repository,
+// which is read through the local git binary.
+func (fn *FNode) gitGet(path string) error {
+
+	fn.Root, _ = filepath.Abs(filepath.Clean(fn.Root))
+
+	log.Printf("gitGet: fn.Root [%s] path [%s]\n", fn.Root, path)
+
+	if err := fn.repoNavigate(path, fn.gitType); err != nil {
+		return err
+	}
+
+	if fn.diffFrom != "" {
+		return fn.diff(fn.gitFile)
+	}
+
+	switch fn.Type {
+
+	case "dir":
+		if err := fn.gitDir(); err != nil {
+			return err
+		}
+		if fn.Type != "dir" {
+			fn.Type += "_dir"
+		}
+		return nil
+
+	case "log":
+		return fn.gitLog()
+
+	case "file":
+		if len(fn.parts) != fn.n {
+			return errors.New("not navigable")
+		}
+		return fn.gitFile()
+
+	case "":
+		return errors.New("404")
+
+	default:
+		// A document, data or other file type known to package filetype
+		if err := fn.gitFile(); err != nil {
+			return err
+		}
+		return fn.parse()
+	}
+}
+
+// git runs a git command on the repository at fn.Root and returns its output.
+func (fn *FNode) git(args ...string) ([]byte, error) {
+	return exec.Command("git", append([]string{"--git-dir", fn.Root}, args...)...).Output()
+}
+
+// gitRev returns the effective Git revision (a commit, tag or branch).
+// An empty revision is normalized to "HEAD".
+func (fn *FNode) gitRev() string {
+	if fn.Revision == "" {
+		return "HEAD"
+	}
+	return fn.Revision
+}
+
+// gitObject returns the object name of fn.Path at fn.Revision, as in 'HEAD:dir/file'.
+func (fn *FNode) gitObject() string {
+	return fn.gitRev() + ":" + strings.TrimPrefix(fn.Path, "/")
+}
+
+// Return 'dir', 'file', 'document', 'data' or ""
+func (fn *FNode) gitType() string {
+
+	b, err := fn.git("cat-file", "-t", fn.gitObject())
+	if err != nil {
+		return ""
+	}
+
+	switch strings.TrimSpace(string(b)) {
+	case "tree":
+		return "dir"
+	case "blob":
+		return fn.fileType()
+	}
+	return ""
+}
+
+// gitFile loads the file in fn.Path into fn.Content
+func (fn *FNode) gitFile() error {
+
+	const maxGitFileSize = 100 * 1024 * 1024 // 100 MB
+
+	obj := fn.gitObject()
+
+	// Check file size before loading to avoid OOM for large files
+	if b, err := fn.git("cat-file", "-s", obj); err == nil {
+		n, _ := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		if n > maxGitFileSize {
+			return fmt.Errorf("git file too large to serve: %d bytes (limit %d)", n, maxGitFileSize)
+		}
+	}
+
+	var err error
+	fn.Content, err = fn.git("cat-file", "blob", obj)
+	return err
+}
+
+func (fn *FNode) gitDir() error {
+
+	b, err := fn.git("ls-tree", "-z", "-l", fn.gitObject())
+	if err != nil {
+		return err
+	}
+
+	dd := ogdl.New(nil)
+
+	path := fn.Path // save path, restore later in case of index.* or readme.*
+	mode := 0       // 1: index, 2: readme
+
+	for _, e := range strings.Split(string(b), "\x00") {
+
+		// <mode> SP <type> SP <object> SP <size> TAB <name>
+		i := strings.IndexByte(e, '\t')
+		if i == -1 {
+			continue
+		}
+		meta := strings.Fields(e[:i])
+		fileName := e[i+1:]
+		if len(meta) < 4 || fileName == "" || fileName[0] == '.' {
+			continue
+		}
+
+		// Check if there is a index or readme file in this directory
+		if strings.HasPrefix(fileName, "index.") {
+			mode = 1
+			fn.Path = path + "/" + fileName
+			fn.Type = fileType(fileName)
+			continue // do not add to dir list
+		} else if strings.HasPrefix(fileName, "readme.") {
+			if mode != 1 {
+				mode = 2
+				fn.Path = path + "/" + fileName
+				fn.Type = fileType(fileName)
+				continue // do not add to dir list
+			}
+		}
+
+		d := dd.Add(fileName)
+		d.Add("name").Add(fileName)
+		if meta[1] == "tree" {
+			d.Add("type").Add("dir")
+		} else {
+			d.Add("type").Add("file")
+			size, _ := strconv.ParseInt(meta[3], 10, 64)
+			d.Add("size").Add(size)
+		}
+	}
+
+	fn.Data = dd
+
+	if mode > 0 {
+		// Read and parse the content of index.* or readme.* (which needs
+		// its path)
+		fn.gitFile()
+		if fn.Type != "file" {
+			err = fn.parse()
+		}
+		fn.Path = path
+	}
+	return err
+}
+
+// gitLog returns the commits that touch fn.Path, with the same structure as
+// the SVN log (see gitfs.ParseLog).
+func (fn *FNode) gitLog() error {
+
+	b, err := fn.git(gitfs.LogArgs(fn.Path, fn.gitRev())...)
+	if err != nil {
+		log.Println("gitLog error", err.Error())
+		return err
+	}
+
+	g := gitfs.ParseLog(b)
+	if g.Node("log").Len() == 0 {
+		return errors.New("no git log")
+	}
+
+	fn.Data = g
+	return nil
+}
@@ -0,0 +1,174 @@
+package fn
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// gitRepo creates a bare repository with two commits of data.ogdl, the first
+// one tagged v1, and returns the directory that contains it (as repo.git).
+func gitRepo(t *testing.T) string {
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	wc := dir + "/wc"
+
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = wc
+		if b, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, b)
+		}
+	}
+
+	os.MkdirAll(wc+"/docs", 0755)
+	exec.Command("git", "init", "-q", wc).Run()
+	os.WriteFile(wc+"/docs/readme.md", []byte("# A\n\ntext\n"), 0644)
+	os.WriteFile(wc+"/data.ogdl", []byte("k v\n"), 0644)
+	run("add", ".")
+	run("commit", "-qm", "first")
+	run("tag", "v1")
+	os.WriteFile(wc+"/data.ogdl", []byte("k w\n"), 0644)
+	run("commit", "-qam", "second")
+	run("clone", "-q", "--bare", ".", dir+"/root/repo.git")
+
+	return dir + "/root"
+}
+
+func TestGitData(t *testing.T) {
+
+	root := gitRepo(t)
+
+	fnode := New(root)
+	if err := fnode.Get("repo.git/data.ogdl/k"); err != nil {
+		t.Fatal(err)
+	}
+	if s := fnode.Data.String(); s != "w" {
+		t.Errorf("HEAD: got %q", s)
+	}
+
+	fnode = New(root)
+	if err := fnode.Get("repo.git/data.ogdl@v1/k"); err != nil {
+		t.Fatal(err)
+	}
+	if s := fnode.Data.String(); s != "v" {
+		t.Errorf("v1: got %q", s)
+	}
+}
+
+func TestGitLog(t *testing.T) {
+
+	root := gitRepo(t)
+
+	fnode := New(root)
+	if err := fnode.Get("repo.git/data.ogdl@"); err != nil {
+		t.Fatal(err)
+	}
+	if fnode.Type != "log" {
+		t.Fatalf("type %s", fnode.Type)
+	}
+	if n := fnode.Data.Node("log").Len(); n != 2 {
+		t.Errorf("expected 2 log entries, got %d", n)
+	}
+}
+
+func TestGitDir(t *testing.T) {
+
+	root := gitRepo(t)
+
+	fnode := New(root)
+	if err := fnode.Get("repo.git/docs"); err != nil {
+		t.Fatal(err)
+	}
+	if fnode.Type != "document_dir" {
+		t.Errorf("readme not found: type %s", fnode.Type)
+	}
+}
+
+func TestWalk(t *testing.T) {
+
+	root := gitRepo(t)
+	os.WriteFile(root+"/top.md", []byte("# Top\n"), 0644)
+	os.WriteFile(root+"/.hidden", []byte(""), 0644)
+
+	var paths []string
+	err := New(root).Walk(func(path, stamp string) error {
+		if stamp == "" {
+			t.Errorf("%s: no stamp", path)
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "repo.git/data.ogdl repo.git/docs/readme.md top.md"
+	if got := strings.Join(paths, " "); got != want {
+		t.Errorf("got %s", got)
+	}
+}
+
+// Revisions that git would read as options are rejected before git is run.
+func TestGitRevisionOption(t *testing.T) {
+
+	root := gitRepo(t)
+	defer os.Remove("gitout")
+
+	for _, path := range []string{
+		"repo.git/data.ogdl@--output=gitout@",
+		"repo.git/data.ogdl@--output=gitout",
+		"repo.git/data.ogdl@--output=gitout..HEAD",
+		"repo.git/data.ogdl@HEAD..--output=gitout",
+	} {
+		if err := New(root).Get(path); err == nil || !strings.Contains(err.Error(), "invalid revision") {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+	if _, err := os.Stat("gitout"); err == nil {
+		t.Error("option passed to git")
+	}
+
+	// The log of a revision
+	fnode := New(root)
+	if err := fnode.Get("repo.git/data.ogdl@v1@"); err != nil {
+		t.Fatal(err)
+	}
+	if n := fnode.Data.Node("log").Len(); n != 1 {
+		t.Errorf("expected 1 log entry at v1, got %d", n)
+	}
+}
+
+func TestGitDiff(t *testing.T) {
+
+	root := gitRepo(t)
+
+	fnode := New(root)
+	if err := fnode.Get("repo.git/data.ogdl@v1..HEAD"); err != nil {
+		t.Fatal(err)
+	}
+	if fnode.Type != "diff" || fnode.Revision != "v1..HEAD" {
+		t.Fatalf("type %s revision %s", fnode.Type, fnode.Revision)
+	}
+	c := fnode.Data.Node("changed").Node("k")
+	if c.Node("from").String() != "v" || c.Node("to").String() != "w" {
+		t.Errorf("diff\n%s", fnode.Data.Text())
+	}
+	if s := string(fnode.Content); !strings.Contains(s, "--- /data.ogdl@v1\n+++ /data.ogdl@HEAD\n") || !strings.Contains(s, "-k v\n+k w\n") {
+		t.Errorf("unified\n%s", s)
+	}
+
+	// From HEAD when the first revision is empty
+	fnode = New(root)
+	if err := fnode.Get("repo.git/data.ogdl@..v1"); err != nil {
+		t.Fatal(err)
+	}
+	if fnode.Data.Node("from").String() != "HEAD" || fnode.Data.Node("to").String() != "v1" {
+		t.Errorf("diff\n%s", fnode.Data.Text())
+	}
+}
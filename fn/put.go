@@ -0,0 +1,486 @@
+package fn
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rveen/golib/document"
+	"github.com/rveen/ogdl"
+)
+
+var errReadOnly = errors.New("read-only file system (no overlay)")
+
+// Put writes content to the given path.
+//
+// The path is resolved with the same rules as Get: missing extensions are
+// inferred, _name wildcards are followed and a path that ends in a directory
+// addresses its index.* or readme.* file. The last element does not need to
+// exist; missing intermediate directories are created.
+//
+// If the path continues into a .ogdl file, content (OGDL text) replaces the
+// node addressed by the rest of the path. If it continues into a .md file,
+// content (markdown) replaces the addressed section, header included.
+//
+// On an OS root the file is written directly, on an fs.FS root it is written to
+// the Overlay directory, and in an SVN repository it is committed with svnmucc,
+// using fn.Author and fn.Message.
+func (fn *FNode) Put(path string, content []byte) error {
+
+	if content == nil {
+		content = []byte{}
+	}
+
+	w := fn.writer()
+	svn, err := w.target(path)
+	if err != nil {
+		return err
+	}
+
+	sub := w.remainingPathDot()
+	if sub != "" {
+		if content, err = w.merge(svn, sub, content); err != nil {
+			return err
+		}
+	}
+
+	return w.write(svn, content)
+}
+
+// Delete removes the file addressed by path, or the node or section addressed
+// by a sub-path into a data or document file. See Put for how paths are
+// resolved. A node or section that does not exist is document.ErrPartNotFound.
+func (fn *FNode) Delete(path string) error {
+
+	w := fn.writer()
+	svn, err := w.target(path)
+	if err != nil {
+		return err
+	}
+
+	sub := w.remainingPathDot()
+	if sub != "" {
+		content, err := w.merge(svn, sub, nil)
+		if err != nil {
+			return err
+		}
+		return w.write(svn, content)
+	}
+
+	if !w.exists(svn) {
+		return errors.New("404")
+	}
+
+	if svn {
+		return w.svnmucc("rm", w.svnURL(w.Path))
+	}
+
+	if w.RootFs != nil {
+		p, ok := w.overlayPath(w.Path)
+		if !ok {
+			return errReadOnly
+		}
+		return os.Remove(p)
+	}
+
+	return os.Remove(w.Path)
+}
+
+// Move renames the file addressed by from to the path to. Both paths must be in
+// the same backend (and the same SVN repository), and neither can address a
+// part of a data or document file. In an fs.FS root only files that are in the
+// overlay can be moved.
+func (fn *FNode) Move(from, to string) error {
+
+	src := fn.writer()
+	svn, err := src.target(from)
+	if err != nil {
+		return err
+	}
+	if src.remainingPath() != "" || !src.exists(svn) {
+		return errors.New("404")
+	}
+
+	dst := fn.writer()
+	svn2, err := dst.target(to)
+	if err != nil {
+		return err
+	}
+	if dst.remainingPath() != "" {
+		return errors.New("cannot move into a data or document file")
+	}
+	if svn != svn2 || src.Root != dst.Root {
+		return errors.New("cannot move across file systems")
+	}
+
+	if svn {
+		return src.svnmucc("mv", src.svnURL(src.Path), src.svnURL(dst.Path))
+	}
+
+	srcPath, dstPath := src.Path, dst.Path
+	if fn.RootFs != nil {
+		var ok bool
+		if srcPath, ok = src.overlayPath(src.Path); !ok {
+			return errReadOnly
+		}
+		if fn.Overlay == "" {
+			return errReadOnly
+		}
+		dstPath = filepath.Join(fn.Overlay, ioPathClean(dst.Path))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return err
+	}
+	return os.Rename(srcPath, dstPath)
+}
+
+// writer returns a new FNode with the same root and write settings as fn.
+func (fn *FNode) writer() *FNode {
+	return &FNode{Root: fn.Root, RootFs: fn.RootFs, Overlay: fn.Overlay, Author: fn.Author, Message: fn.Message}
+}
+
+// target resolves path for writing. It follows the rules of get, but the last
+// elements of the path need not exist. On return fn.Path is the file to write
+// and fn.parts[fn.n:] the path inside it, if it is a data or document file.
+//
+// If the path enters an SVN repository, fn is rerooted at the repository and
+// svn is true.
+func (fn *FNode) target(path string) (svn bool, err error) {
+
+	fn.parts = parts(path)
+	fn.Path = fn.Root
+	fn.Type = "dir"
+
+	for fn.n = 0; fn.n < len(fn.parts); fn.n++ {
+
+		part := fn.parts[fn.n]
+
+		if part[0] == '.' {
+			return false, errors.New(". not allowed in paths")
+		}
+		if strings.IndexByte(part, '@') != -1 {
+			return false, errors.New("cannot write to a revision")
+		}
+
+		savePath := fn.Path
+		fn.Path += "/" + part
+		fn.Type = fn.info()
+
+		switch fn.Type {
+		case "dir":
+			// continue
+
+		case "svn":
+			fn.n++
+			return true, fn.svnTarget(fn.remainingPath())
+
+		case "git":
+			return false, errors.New("git repositories are read-only")
+
+		case "file":
+			if fn.n != len(fn.parts)-1 {
+				return false, errors.New("404 (extra path after file)")
+			}
+			fn.n++
+			return false, nil
+
+		case "":
+			// Not found: follow a _token entry if there is one, else this
+			// and the remaining parts are new.
+			fn.Path = savePath
+			if err := fn.dir(); err != nil {
+				return false, err
+			}
+			if genericPart := fn.generic(); genericPart != "" {
+				fn.Path += "/" + genericPart
+				continue
+			}
+			fn.Path += "/" + fn.remainingPath()
+			fn.Type = fn.fileType()
+			fn.n = len(fn.parts)
+			return false, nil
+
+		default:
+			// A document, data or other typed file
+			fn.n++
+			return false, nil
+		}
+	}
+
+	fn.n = len(fn.parts)
+
+	if fn.Type == "dir" {
+		if err := fn.dir(); err != nil {
+			return false, err
+		}
+		if !fn.index() {
+			return false, errors.New("cannot write to a directory")
+		}
+	}
+	return false, nil
+}
+
+// svnTarget does what target does, inside the SVN repository at fn.Path.
+func (fn *FNode) svnTarget(path string) error {
+
+	svn := fn.writer()
+	svn.Root, _ = filepath.Abs(filepath.Clean(fn.Path))
+
+	if err := svn.svnNavigate(path); err != nil {
+		return err
+	}
+	if svn.Revision != "" || svn.Type == "log" {
+		return errors.New("cannot write to a revision")
+	}
+
+	switch svn.Type {
+	case "dir":
+		if svn.n == len(svn.parts) {
+			return errors.New("cannot write to a directory")
+		}
+		svn.Path += "/" + svn.remainingPath()
+		svn.Type = svn.fileType()
+		svn.n = len(svn.parts)
+	case "file":
+		if svn.n != len(svn.parts) {
+			return errors.New("404 (extra path after file)")
+		}
+	}
+
+	*fn = *svn
+	return nil
+}
+
+// exists reports whether fn.Path is present.
+func (fn *FNode) exists(svn bool) bool {
+	if svn {
+		return fn.svnType() != ""
+	}
+	_, err := fn.stat(fn.Path)
+	return err == nil
+}
+
+// merge reads the current file and returns it with the node or section at sub
+// replaced by content, or removed if content is nil.
+func (fn *FNode) merge(svn bool, sub string, content []byte) ([]byte, error) {
+
+	var err error
+	if svn {
+		err = fn.svnFile()
+	} else {
+		err = fn.file()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch fn.Type {
+	case "data":
+		return putData(fn.Content, fn.parts[fn.n:], content)
+	case "document":
+		s, err := document.ReplacePart(string(fn.Content), sub, string(content))
+		return []byte(s), err
+	}
+	return nil, errors.New("404 (extra path after file)")
+}
+
+// putData replaces the node at path in the OGDL text b with the nodes in
+// content, creating it if needed. If content is nil, the node is removed, and
+// document.ErrPartNotFound returned if there is none.
+func putData(b []byte, path []string, content []byte) ([]byte, error) {
+
+	g := ogdl.FromBytes(b)
+	if g == nil {
+		g = ogdl.New(nil)
+	}
+
+	n := g
+	for i, part := range path {
+
+		m := n.Node(part)
+		if m == nil {
+			if content == nil {
+				return nil, document.ErrPartNotFound
+			}
+			m = n.Add(part)
+		}
+
+		if content == nil && i == len(path)-1 {
+			for j, o := range n.Out {
+				if o == m {
+					n.Out = append(n.Out[:j], n.Out[j+1:]...)
+					break
+				}
+			}
+			return []byte(g.Text() + "\n"), nil
+		}
+		n = m
+	}
+
+	n.Out = nil
+	if c := ogdl.FromBytes(content); c != nil {
+		n.Out = c.Out
+	}
+
+	return []byte(g.Text() + "\n"), nil
+}
+
+// write stores content in fn.Path.
+func (fn *FNode) write(svn bool, content []byte) error {
+
+	if svn {
+		return fn.svnPut(content)
+	}
+
+	path := fn.Path
+	if fn.RootFs != nil {
+		if fn.Overlay == "" {
+			return errReadOnly
+		}
+		path = filepath.Join(fn.Overlay, ioPathClean(fn.Path))
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it, so that readers never see a
+	// partially written file. The temporary file is 0600: give it the mode
+	// of the file it replaces, or 0644.
+	mode := fs.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	f, err := os.CreateTemp(dir, ".put-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// svnPut commits content to fn.Path in the repository at fn.Root. Parent
+// directories that do not exist are created in the same commit.
+func (fn *FNode) svnPut(content []byte) error {
+
+	var args []string
+
+	var missing []string
+	path := fn.Path
+	for {
+		path = filepath.Dir(path)
+		if path == "/" || path == "." {
+			break
+		}
+		probe := &FNode{Root: fn.Root, Path: path}
+		if probe.svnType() != "" {
+			break
+		}
+		missing = append([]string{path}, missing...)
+	}
+	for _, p := range missing {
+		args = append(args, "mkdir", fn.svnURL(p))
+	}
+	args = append(args, "put", "-", fn.svnURL(fn.Path))
+
+	cmd := fn.svnmuccCmd(args...)
+	cmd.Stdin = bytes.NewReader(content)
+	return run(cmd)
+}
+
+// svnmucc runs a single svnmucc commit with the given actions.
+func (fn *FNode) svnmucc(args ...string) error {
+	return run(fn.svnmuccCmd(args...))
+}
+
+func (fn *FNode) svnmuccCmd(args ...string) *exec.Cmd {
+
+	msg := fn.Message
+	if msg == "" {
+		msg = "fn: " + strings.Join(args, " ")
+	}
+
+	a := []string{"-m", msg}
+	if fn.Author != "" {
+		a = append(a, "--username", fn.Author)
+	}
+	return exec.Command("svnmucc", append(a, args...)...)
+}
+
+func (fn *FNode) svnURL(path string) string {
+	return "file:///" + fn.Root + "/" + strings.TrimPrefix(path, "/")
+}
+
+// run executes cmd and returns its standard error as error if it fails.
+func run(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %v: %s", cmd.Args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// overlayPath returns the path in the overlay directory that corresponds to
+// path, and whether it exists.
+func (fn *FNode) overlayPath(path string) (string, bool) {
+	if fn.Overlay == "" {
+		return "", false
+	}
+	p := filepath.Join(fn.Overlay, ioPathClean(path))
+	_, err := os.Lstat(p)
+	return p, err == nil
+}
+
+// overlayReadDir reads a directory of fn.RootFs merged with the same directory
+// in the overlay, if any. Overlay entries take precedence.
+func (fn *FNode) overlayReadDir(path string) ([]fs.DirEntry, error) {
+
+	dir, err := fs.ReadDir(fn.RootFs, ioPathClean(path))
+
+	p, ok := fn.overlayPath(path)
+	if !ok {
+		return dir, err
+	}
+
+	odir, oerr := os.ReadDir(p)
+	if oerr != nil {
+		return dir, err
+	}
+
+	entries := make(map[string]fs.DirEntry, len(dir)+len(odir))
+	for _, e := range dir {
+		entries[e.Name()] = e
+	}
+	for _, e := range odir {
+		entries[e.Name()] = e
+	}
+
+	dir = dir[:0]
+	for _, e := range entries {
+		dir = append(dir, e)
+	}
+	sort.Slice(dir, func(i, j int) bool { return dir[i].Name() < dir[j].Name() })
+
+	return dir, nil
+}
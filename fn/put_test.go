@@ -0,0 +1,144 @@
+package fn
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rveen/golib/document"
+)
+
+func TestPutFile(t *testing.T) {
+
+	root := t.TempDir()
+	fnode := New(root)
+
+	if err := fnode.Put("adir/new.txt", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(root + "/adir/new.txt")
+	if err != nil || string(b) != "hello" {
+		t.Fatalf("got %q, %v", b, err)
+	}
+	if fi, _ := os.Stat(root + "/adir/new.txt"); fi.Mode().Perm() != 0644 {
+		t.Errorf("new file mode %v", fi.Mode())
+	}
+
+	// An existing file keeps its mode
+	os.WriteFile(root+"/run.sh", []byte("#!/bin/sh\n"), 0755)
+	os.Chmod(root+"/run.sh", 0755)
+	if err := fnode.Put("run.sh", []byte("#!/bin/sh\necho\n")); err != nil {
+		t.Fatal(err)
+	}
+	if fi, _ := os.Stat(root + "/run.sh"); fi.Mode().Perm() != 0755 {
+		t.Errorf("replaced file mode %v", fi.Mode())
+	}
+}
+
+func TestPutExtension(t *testing.T) {
+
+	root := t.TempDir()
+	os.WriteFile(root+"/doc.md", []byte("# old\n"), 0644)
+
+	if err := New(root).Put("doc", []byte("# new\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(root + "/doc.md")
+	if string(b) != "# new\n" {
+		t.Errorf("extension not inferred: %q", b)
+	}
+}
+
+func TestPutData(t *testing.T) {
+
+	root := t.TempDir()
+	os.WriteFile(root+"/config.ogdl", []byte("database\n  host a\nname x\n"), 0644)
+
+	if err := New(root).Put("config.ogdl/database/host", []byte("b")); err != nil {
+		t.Fatal(err)
+	}
+
+	fnode := New(root)
+	if err := fnode.Get("config.ogdl"); err != nil {
+		t.Fatal(err)
+	}
+	if s := fnode.Data.Get("database.host").String(); s != "b" {
+		t.Errorf("database.host = %q", s)
+	}
+	if s := fnode.Data.Get("name").String(); s != "x" {
+		t.Errorf("name = %q", s)
+	}
+
+	// Deleting a missing node, as a missing section, is an error
+	if err := New(root).Delete("config.ogdl/database/port"); err != document.ErrPartNotFound {
+		t.Errorf("delete missing node: %v", err)
+	}
+	if err := New(root).Delete("config.ogdl/database/host"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPutDocumentPart(t *testing.T) {
+
+	root := t.TempDir()
+	os.WriteFile(root+"/doc.md", []byte("# one\n\ntext 1\n\n# two\n\ntext 2\n"), 0644)
+
+	if err := New(root).Put("doc.md/one", []byte("# one\n\nnew text\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(root + "/doc.md")
+	if string(b) != "# one\n\nnew text\n\n# two\n\ntext 2\n" {
+		t.Errorf("unexpected document: %q", b)
+	}
+
+	if err := New(root).Delete("doc.md/three"); err != document.ErrPartNotFound {
+		t.Errorf("delete missing section: %v", err)
+	}
+}
+
+func TestDeleteMove(t *testing.T) {
+
+	root := t.TempDir()
+	os.WriteFile(root+"/a.txt", []byte("a"), 0644)
+
+	fnode := New(root)
+	if err := fnode.Move("a.txt", "sub/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(root + "/sub/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fnode.Delete("sub/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(root + "/sub/b.txt"); err == nil {
+		t.Error("file not deleted")
+	}
+}
+
+func TestPutOverlay(t *testing.T) {
+
+	fsys := fstest.MapFS{
+		"page.md": {Data: []byte("# page\n")},
+	}
+
+	if err := NewFS(fsys).Put("page.md", []byte("x")); err == nil {
+		t.Error("expected error writing without overlay")
+	}
+
+	fnode := NewOverlay(fsys, t.TempDir())
+	if err := fnode.Put("page.md", []byte("# changed\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fnode.GetRaw("page.md"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(fnode.Content), "changed") {
+		t.Errorf("overlay not read: %q", fnode.Content)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/rveen/golib/fs/gitfs"
 	"github.com/rveen/ogdl"
 	"github.com/rveen/ogdl/io/gxml"
 )
@@ -25,29 +26,19 @@ func (fn *FNode) svnGet(path string) error {
 			return err
 		}
 
+		if fn.diffFrom != "" {
+			return fn.diff(fn.svnFile)
+		}
+
 		left := len(fn.parts) - fn.n
 
 		switch fn.Type {
 
-		case "document":
-			fn.svnFile()
-			return fn.document()
-
-		case "data":
-			fn.svnFile()
-			fn.data()
-			return nil
-
 		case "dir":
 			// check _token
 			// check index / readme
-			fn.svnDir()
-			if fn.Type == "document" {
-				if err := fn.document(); err != nil {
-					return err
-				}
-			} else if fn.Type == "data" {
-				fn.data()
+			if err := fn.svnDir(); err != nil {
+				return err
 			}
 			if fn.Type != "dir" {
 				fn.Type += "_dir"
@@ -65,13 +56,24 @@ func (fn *FNode) svnGet(path string) error {
 			}
 			return fn.svnFile()
 
+		case "":
+			return errors.New("404")
+
 		default:
-			return errors.New("unknown: " + fn.Type)
+			// A document, data or other file type known to package filetype
+			fn.svnFile()
+			return fn.parse()
 		}
 	}
 }
 
 func (fn *FNode) svnNavigate(path string) error {
+	return fn.repoNavigate(path, fn.svnType)
+}
+
+// repoNavigate walks path inside a versioned repository rooted at fn.Root,
+// using typeOf to get the type of fn.Path at fn.Revision.
+func (fn *FNode) repoNavigate(path string, typeOf func() string) error {
 
 	// Handle revisions
 	// @ at the end means list revisions (in fn.Data, fn.Type => "log")
@@ -93,6 +95,7 @@ func (fn *FNode) svnNavigate(path string) error {
 
 	// Extract revision if any
 	fn.Revision = ""
+	fn.diffFrom = ""
 	for i, part := range fn.parts {
 		n := strings.IndexByte(part, '@')
 		if n != -1 {
@@ -103,6 +106,25 @@ func (fn *FNode) svnNavigate(path string) error {
 		}
 	}
 
+	// A range rev1..rev2 asks for the differences between two revisions.
+	// Navigation is done at rev2. An empty rev1 is HEAD.
+	if i := strings.Index(fn.Revision, ".."); i != -1 {
+		fn.diffFrom = fn.Revision[:i]
+		fn.Revision = fn.Revision[i+2:]
+		if fn.diffFrom == "" {
+			fn.diffFrom = "HEAD"
+		}
+	}
+
+	// Revisions are passed to git and svn as arguments: they cannot look
+	// like options.
+	if err := gitfs.CheckRevision(fn.Revision); err != nil {
+		return err
+	}
+	if err := gitfs.CheckRevision(fn.diffFrom); err != nil {
+		return err
+	}
+
 	// Go step by step, we don't know where the file path ends.
 	for _, part := range fn.parts {
 
@@ -110,10 +132,10 @@ func (fn *FNode) svnNavigate(path string) error {
 		fn.Path += "/" + part
 		fn.Path = filepath.Clean(fn.Path)
 
-		typ := fn.svnType()
+		typ := typeOf()
 		fn.Type = typ
 
-		log.Println("svn part: type ", fn.Path, typ)
+		log.Println("repo part: type ", fn.Path, typ)
 
 		if typ == "" {
 			fn.Path = saveThis
@@ -122,8 +144,9 @@ func (fn *FNode) svnNavigate(path string) error {
 
 		fn.n++
 
-		if typ == "file" {
-			// Cannot navigate into a file here
+		if typ != "dir" {
+			// Cannot navigate into a file here: remaining parts are a path
+			// inside a data, document or other typed file
 			if revs {
 				fn.Type = "log"
 			}
@@ -131,11 +154,11 @@ func (fn *FNode) svnNavigate(path string) error {
 		}
 	}
 
-	fn.Type = fn.svnType()
+	fn.Type = typeOf()
 	if revs {
 		fn.Type = "log"
 	}
-	log.Printf("svnNav: fn.Root [%s] fn.Path [%s] fn.Type [%s]\n", fn.Root, fn.Path, fn.Type)
+	log.Printf("repoNav: fn.Root [%s] fn.Path [%s] fn.Type [%s]\n", fn.Root, fn.Path, fn.Type)
 
 	return nil
 }
@@ -238,14 +261,18 @@ func (fn *FNode) svnDir() error {
 		}
 	}
 
+	fn.Data = dd
+
 	if mode > 0 {
-		// Read content of index.* or readme.*
+		// Read and parse the content of index.* or readme.* (which needs
+		// its path)
 		fn.svnFile()
+		if fn.Type != "file" {
+			err = fn.parse()
+		}
 		fn.Path = path
 	}
-
-	fn.Data = dd
-	return nil
+	return err
 }
 
 func (fn *FNode) svnLog() error {
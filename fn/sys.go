@@ -24,8 +24,11 @@ func NewFS(fs fs.FS) *FNode {
 	return &FNode{RootFs: fs}
 }
 
-func (fn *FNode) Put(path string, content []byte) error {
-	return errors.New("not implemented")
+// Create an empty FNode with the root set to a io.FS filesystem and a writable
+// overlay directory. Files in the overlay take precedence over those in fs, and
+// Put, Delete and Move operate on the overlay.
+func NewOverlay(fs fs.FS, dir string) *FNode {
+	return &FNode{RootFs: fs, Overlay: dir}
 }
 
 // Get returns an FNode (it updates its receiving object).
@@ -77,6 +80,10 @@ func (fn *FNode) file() error {
 	var err error
 
 	if fn.RootFs != nil {
+		if p, ok := fn.overlayPath(fn.Path); ok {
+			fn.Content, err = os.ReadFile(p)
+			return err
+		}
 		fn.Content, err = fs.ReadFile(fn.RootFs, ioPathClean(fn.Path))
 	} else {
 		fn.Content, err = os.ReadFile(fn.Path)
@@ -91,6 +98,10 @@ func (fn *FNode) stat(path string) (fs.FileInfo, error) {
 		return os.Stat(path)
 	}
 
+	if p, ok := fn.overlayPath(path); ok {
+		return os.Stat(p)
+	}
+
 	// io.fs (possibly embedded)
 	f, err := fn.RootFs.Open(ioPathClean(path))
 
@@ -116,7 +127,7 @@ func (fn *FNode) dir() error {
 	var err error
 
 	if fn.RootFs != nil {
-		dir, err = fs.ReadDir(fn.RootFs, ioPathClean(fn.Path))
+		dir, err = fn.overlayReadDir(fn.Path)
 	} else {
 		dir, err = os.ReadDir(fn.Path)
 	}
@@ -0,0 +1,143 @@
+package fn
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rveen/ogdl/io/gxml"
+)
+
+// Walk calls walk for each file below the root of fn, with its path (as used
+// in Get) and a stamp that changes when the file changes. Entries starting
+// with '.' are skipped, as in directory listings. SVN and Git repositories
+// found below the root are walked at HEAD.
+//
+// If walk returns an error, Walk stops and returns it.
+func (fn *FNode) Walk(walk func(path, stamp string) error) error {
+	return fn.walkDir("", walk)
+}
+
+func (fn *FNode) walkDir(path string, walk func(path, stamp string) error) error {
+
+	var dir []fs.DirEntry
+	var err error
+
+	if fn.RootFs != nil {
+		dir, err = fn.overlayReadDir(fn.Root + path)
+	} else {
+		dir, err = os.ReadDir(fn.Root + path)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range dir {
+
+		name := entry.Name()
+		if name[0] == '.' {
+			continue
+		}
+		p := path + "/" + name
+
+		fi, err := fn.stat(fn.Root + p)
+		if err != nil {
+			continue
+		}
+
+		if !fi.IsDir() {
+			if err := walk(p[1:], fmt.Sprintf("%d %d", fi.ModTime().UnixNano(), fi.Size())); err != nil {
+				return err
+			}
+			continue
+		}
+
+		d := &FNode{Root: fn.Root, RootFs: fn.RootFs, Overlay: fn.Overlay, Path: fn.Root + p}
+
+		switch d.dirType() {
+		case "svn":
+			err = walkSvn(fn.Root+p, p[1:], walk)
+		case "git":
+			err = walkGit(fn.Root+p, p[1:], walk)
+		default:
+			err = fn.walkDir(p, walk)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkSvn lists the files of the SVN repository at root. The stamp is the
+// revision of the last commit that changed the file.
+func walkSvn(root, prefix string, walk func(path, stamp string) error) error {
+
+	root, _ = filepath.Abs(root)
+
+	b, err := exec.Command("svn", "list", "-R", "--xml", "file://"+root).Output()
+	if err != nil {
+		return err
+	}
+
+	g := gxml.FromXML(b).Get("lists.list")
+	if g == nil {
+		return nil
+	}
+
+	for _, e := range g.Out {
+
+		if e.ThisString() != "entry" || e.Get("'@'.kind").String() != "file" {
+			continue
+		}
+		name := e.Get("name").String()
+		if hidden(name) {
+			continue
+		}
+		if err := walk(prefix+"/"+name, e.Get("commit.'@'.revision").String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walkGit lists the files of the bare Git repository at root. The stamp is
+// the object name of the file.
+func walkGit(root, prefix string, walk func(path, stamp string) error) error {
+
+	b, err := exec.Command("git", "--git-dir", root, "ls-tree", "-r", "-z", "HEAD").Output()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range strings.Split(string(b), "\x00") {
+
+		// <mode> SP blob SP <object> TAB <name>
+		i := strings.IndexByte(e, '\t')
+		if i == -1 {
+			continue
+		}
+		meta := strings.Fields(e[:i])
+		name := e[i+1:]
+		if len(meta) < 3 || meta[1] != "blob" || hidden(name) {
+			continue
+		}
+		if err := walk(prefix+"/"+name, meta[2]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hidden returns true if any element of path starts with '.'
+func hidden(path string) bool {
+	for _, s := range strings.Split(path, "/") {
+		if strings.HasPrefix(s, ".") {
+			return true
+		}
+	}
+	return false
+}
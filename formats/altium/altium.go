@@ -2,16 +2,22 @@
 //
 // ConvertToKicadSch converts a .SchDoc file (read into a byte slice) to the
 // KiCad .kicad_sch format. ConvertToKicadPcb does the same for .PcbDoc files.
+// ConvertProjectToKicad converts the schematics of a .PrjPcb project to a
+// KiCad hierarchy. ConvertSchLibToKicad and ConvertPcbLibToKicad convert
+// .SchLib and .PcbLib libraries to KiCad symbol and footprint libraries.
 package altium
 
 import (
 	"fmt"
 	"log"
+	"path"
 
 	"github.com/rveen/golib/formats/altium/altium/mapper"
 	"github.com/rveen/golib/formats/altium/altium/pcbmapper"
 	"github.com/rveen/golib/formats/altium/altium/pcbreader"
+	"github.com/rveen/golib/formats/altium/altium/project"
 	"github.com/rveen/golib/formats/altium/altium/reader"
+	"github.com/rveen/golib/formats/altium/altium/record"
 	kicad "github.com/rveen/golib/formats/altium/emit/kicad"
 	"github.com/rveen/golib/formats/altium/emit/kicadpcb"
 )
@@ -49,6 +55,32 @@ func ConvertToKicadSch(in []byte) ([]byte, error) {
 	return artifacts[0].Data, nil
 }
 
+// ConvertProjectToKicad converts the schematic documents of an Altium project
+// file (.PrjPcb) to a KiCad project: a root .kicad_sch named after the
+// project, one .kicad_sch per sheet and a .kicad_pro, by file name.
+func ConvertProjectToKicad(file string) (map[string][]byte, error) {
+
+	sch, rep, err := project.Load(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading project: %w", err)
+	}
+	for _, n := range rep.Notes {
+		log.Printf("%s: %s\n", n.Prov.Sheet, n.Message)
+	}
+
+	artifacts, _, err := kicad.Emitter{}.Emit(sch, nil)
+	if err != nil {
+		return nil, fmt.Errorf("emitting kicad_sch: %w", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, a := range artifacts {
+		files[a.Name] = a.Data
+	}
+	log.Printf("converted project %s to %d kicad files\n", sch.Meta.Project, len(files))
+	return files, nil
+}
+
 // ConvertToKicadPcb converts an Altium .PcbDoc file (as a byte slice) to
 // KiCad .kicad_pcb format, returning the output as a byte slice.
 func ConvertToKicadPcb(in []byte) ([]byte, error) {
@@ -72,3 +104,57 @@ func ConvertToKicadPcb(in []byte) ([]byte, error) {
 	log.Printf("converted to kicad sch; size %d\n", len(artifacts[0].Data))
 	return artifacts[0].Data, nil
 }
+
+// ConvertSchLibToKicad converts an Altium .SchLib library (as a byte slice) to
+// a KiCad symbol library (.kicad_sym). name is the name of the library file,
+// used for diagnostics.
+func ConvertSchLibToKicad(in []byte, name string) ([]byte, error) {
+	syms, err := reader.ReadLibBytes(in)
+	if err != nil {
+		return nil, fmt.Errorf("reading library: %w", err)
+	}
+	recs := make([][]record.Record, len(syms))
+	for i, sym := range syms {
+		recs[i] = sym.Records
+	}
+
+	sch, _, err := mapper.MapLibrary(recs, name, 10)
+	if err != nil {
+		return nil, fmt.Errorf("mapping library: %w", err)
+	}
+
+	artifacts, _, err := kicad.SymbolLibEmitter{}.Emit(sch, nil)
+	if err != nil {
+		return nil, fmt.Errorf("emitting kicad_sym: %w", err)
+	}
+	log.Printf("converted %d symbols to kicad_sym; size %d\n", len(sch.Symbols), len(artifacts[0].Data))
+	return artifacts[0].Data, nil
+}
+
+// ConvertPcbLibToKicad converts an Altium .PcbLib library (as a byte slice)
+// to a KiCad footprint library, returning the .kicad_mod files by file name.
+// name is the name of the library file; the files are meant for the directory
+// <name>.pretty.
+func ConvertPcbLibToKicad(in []byte, name string) (map[string][]byte, error) {
+	fps, err := pcbreader.ReadLibBytes(in)
+	if err != nil {
+		return nil, fmt.Errorf("reading library: %w", err)
+	}
+
+	lib, _, err := pcbmapper.MapLibrary(fps, name)
+	if err != nil {
+		return nil, fmt.Errorf("mapping library: %w", err)
+	}
+
+	artifacts, _, err := kicadpcb.LibraryEmitter{}.Emit(lib, nil)
+	if err != nil {
+		return nil, fmt.Errorf("emitting kicad_mod: %w", err)
+	}
+
+	files := make(map[string][]byte)
+	for _, a := range artifacts {
+		files[path.Base(a.Name)] = a.Data
+	}
+	log.Printf("converted %d footprints to kicad_mod\n", len(files))
+	return files, nil
+}
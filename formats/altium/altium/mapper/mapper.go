@@ -31,6 +31,7 @@ func Map(records []record.Record, sheetName, sheetFile string, coordScale int) (
 		records:    records,
 		byIndex:    make(map[int]record.Record),
 		children:   make(map[int][]record.Record),
+		implLists:  make(map[int]int),
 		symbols:    make(map[schema.SymbolID]*schema.Symbol),
 		report:     rep,
 		sheetName:  sheetName,
@@ -40,10 +41,49 @@ func Map(records []record.Record, sheetName, sheetFile string, coordScale int) (
 	return m.run()
 }
 
+// MapLibrary converts the symbols of a schematic library (.SchLib) to a
+// Schematic without sheets, with each symbol in its own coordinates. A symbol
+// is given as the records of its Data stream (see reader.ReadLibFile): the
+// COMPONENT record and after it its primitives, which belong to it without an
+// OWNERINDEX. coordScale is as for Map, 10 for the CFB libraries Altium
+// writes.
+func MapLibrary(symbols [][]record.Record, libFile string, coordScale int) (*schema.Schematic, *emit.Report, error) {
+	if coordScale <= 0 {
+		coordScale = 1
+	}
+	rep := &emit.Report{}
+	m := &mapper{
+		symbols:    make(map[schema.SymbolID]*schema.Symbol),
+		report:     rep,
+		sheetFile:  libFile,
+		coordScale: coordScale,
+	}
+	for i, recs := range symbols {
+		prov := schema.Provenance{Sheet: libFile, Record: i, Kind: "SYMBOL"}
+		if len(recs) == 0 || recs[0].Type != record.TypeComponent {
+			rep.Add(emit.Warn, prov, "library entry %d is not a component", i)
+			continue
+		}
+		sym := m.buildLibSymbol(recs[0], recs[1:])
+		sym.Prov = prov
+		if _, dup := m.symbols[sym.ID]; dup {
+			rep.Add(emit.Warn, prov, "symbol %s is in the library twice", sym.LibRef)
+		}
+		m.symbols[sym.ID] = sym
+	}
+
+	sch := &schema.Schematic{
+		Symbols: m.symbols,
+		Meta:    schema.Meta{SourceFile: libFile},
+	}
+	return sch, rep, nil
+}
+
 type mapper struct {
 	records    []record.Record
 	byIndex    map[int]record.Record
 	children   map[int][]record.Record // ownerIndex -> []child records
+	implLists  map[int]int             // ownerIndex -> stream position of the implementation list
 	symbols    map[schema.SymbolID]*schema.Symbol
 	report     *emit.Report
 	sheetName  string
@@ -53,12 +93,15 @@ type mapper struct {
 
 func (m *mapper) run() (*schema.Schematic, *emit.Report, error) {
 	// Step 1: index by INDEXINSHEET and bucket children by OWNERINDEX.
-	for _, r := range m.records {
+	for i, r := range m.records {
 		if r.Index >= 0 {
 			m.byIndex[r.Index] = r
 		}
 		owner := r.IntDef("OWNERINDEX", -1)
 		m.children[owner] = append(m.children[owner], r)
+		if r.Type == record.TypeImplementList {
+			m.implLists[owner] = i
+		}
 	}
 
 	sheet := m.buildSheet()
@@ -267,13 +310,14 @@ func (m *mapper) buildComponent(streamPos int, r record.Record) (*schema.Compone
 	unit := max(r.IntDef("CURRENTPARTID", 1), 1)
 
 	comp := &schema.Component{
-		Symbol:   sym.ID,
-		Position: anchor,
-		Rotation: rot,
-		Mirrored: mirrored,
-		Unit:     unit,
-		Fields:   m.collectFields(owned, anchor, orient),
-		Prov:     schema.Provenance{Record: r.Index, Kind: "COMPONENT"},
+		Symbol:    sym.ID,
+		Position:  anchor,
+		Rotation:  rot,
+		Mirrored:  mirrored,
+		Unit:      unit,
+		Fields:    m.collectFields(owned, anchor, orient),
+		Footprint: m.footprint(childKey),
+		Prov:      schema.Provenance{Record: r.Index, Kind: "COMPONENT"},
 	}
 	// Extract designator from the owned DESIGNATOR record.
 	for _, child := range owned {
@@ -393,6 +437,24 @@ func (m *mapper) buildSymbol(compRec record.Record, owned []record.Record, ancho
 	return sym
 }
 
+// buildLibSymbol builds a library symbol, with the properties that a library
+// gives its placements: the default designator, the description, the
+// parameters and the footprint.
+func (m *mapper) buildLibSymbol(r record.Record, owned []record.Record) *schema.Symbol {
+	anchor := m.readPointFrac(r, "LOCATION")
+	sym := m.buildSymbol(r, owned, anchor, 0)
+	sym.Description = r.UTF8Str("COMPONENTDESCRIPTION")
+	sym.Fields = m.collectFields(owned, anchor, 0)
+	sym.Footprint = currentFootprint(owned)
+	for _, child := range owned {
+		if child.Type == record.TypeDesignator {
+			sym.Designator = child.UTF8Str("TEXT")
+			break
+		}
+	}
+	return sym
+}
+
 // canonicalSymbolID hashes the symbol's pins and graphics for deduplication.
 func canonicalSymbolID(sym *schema.Symbol) schema.SymbolID {
 	h := sha256.New()
@@ -528,7 +590,7 @@ func (m *mapper) buildSheetSymbol(streamPos int, r record.Record) *schema.SheetS
 		case record.TypeSheetEntry:
 			ss.Entries = append(ss.Entries, m.buildSheetEntry(c, loc, xs, ys))
 		case record.TypeSheetName:
-			ss.Name = c.UTF8Str("TEXT")
+			ss.Name, ss.Repeat = parseRepeat(c.UTF8Str("TEXT"))
 		case record.TypeFileName:
 			ss.FileName = c.UTF8Str("TEXT")
 		}
@@ -536,6 +598,35 @@ func (m *mapper) buildSheetSymbol(streamPos int, r record.Record) *schema.SheetS
 	return ss
 }
 
+// parseRepeat splits a sheet symbol name of the form Repeat(Name,First,Last)
+// (a repeated channel) into the channel name and range. Other names are
+// returned as is.
+func parseRepeat(s string) (string, *schema.Repeat) {
+	args, ok := repeatArgs(s)
+	if !ok || len(args) != 3 {
+		return s, nil
+	}
+	first, err1 := strconv.Atoi(args[1])
+	last, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil || last < first {
+		return s, nil
+	}
+	return args[0], &schema.Repeat{First: first, Last: last}
+}
+
+// repeatArgs returns the comma separated arguments of Repeat(...), trimmed.
+func repeatArgs(s string) ([]string, bool) {
+	t := strings.TrimSpace(s)
+	if len(t) < 8 || !strings.EqualFold(t[:7], "repeat(") || t[len(t)-1] != ')' {
+		return nil, false
+	}
+	args := strings.Split(t[7:len(t)-1], ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	return args, true
+}
+
 // buildSheetEntry converts an Altium SHEET_ENTRY record (RECORD=16) to a
 // schema.SheetEntry. The entry sits on one edge of the parent box: SIDE 0/1
 // select the left/right edge, 2/3 the top/bottom edge. DISTANCEFROMTOP locates
@@ -555,10 +646,17 @@ func (m *mapper) buildSheetEntry(r record.Record, loc schema.Point, xs, ys schem
 	case 3: // bottom edge: dist runs from the left, Y at the box bottom
 		pos = schema.Point{X: loc.X + dist, Y: loc.Y - ys}
 	}
+	// Repeat(NAME) gives each channel its own element of the bus NAME.
+	name := r.UTF8Str("NAME")
+	args, repeated := repeatArgs(name)
+	if repeated && len(args) == 1 {
+		name = args[0]
+	}
 	return schema.SheetEntry{
-		Name:      r.UTF8Str("NAME"),
+		Name:      name,
 		Direction: portDirection(r.IntDef("IOTYPE", 0)),
 		Pos:       pos,
+		Repeated:  repeated && len(args) == 1,
 	}
 }
 
@@ -739,6 +837,36 @@ func (m *mapper) collectFields(owned []record.Record, anchor schema.Point, orien
 	return fields
 }
 
+// footprint returns the model name of the current PCB footprint in the
+// implementation list of a component (section 9.8), or of its first PCB
+// footprint when none is marked current. childKey is the OWNERINDEX of the
+// component's children; the implementations are children of the list.
+func (m *mapper) footprint(childKey int) string {
+	list, ok := m.implLists[childKey]
+	if !ok {
+		return ""
+	}
+	return currentFootprint(m.children[list-1])
+}
+
+// currentFootprint returns the model name of the current PCB footprint among
+// records, or of the first one when none is marked current.
+func currentFootprint(records []record.Record) string {
+	first := ""
+	for _, impl := range records {
+		if impl.Type != record.TypeImplementation || !strings.EqualFold(impl.Str("MODELTYPE"), "PCBLIB") {
+			continue
+		}
+		if impl.Bool("ISCURRENT") {
+			return impl.UTF8Str("MODELNAME")
+		}
+		if first == "" {
+			first = impl.UTF8Str("MODELNAME")
+		}
+	}
+	return first
+}
+
 // ---------- Coordinate helpers ----------
 
 // scaleToNm converts mils (in the file's native coordinate unit) to nanometres,
@@ -1,9 +1,12 @@
 package mapper
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/rveen/golib/formats/altium/altium/reader"
+	"github.com/rveen/golib/formats/altium/altium/record"
+	"github.com/rveen/golib/formats/altium/schema"
 )
 
 func TestMapFromTestSchDoc(t *testing.T) {
@@ -72,3 +75,117 @@ func TestSymbolDedup(t *testing.T) {
 		}
 	}
 }
+
+func TestRepeatedSheetSymbol(t *testing.T) {
+	recs, err := reader.ReadASCII(strings.NewReader(`|HEADER=Protel for Windows - Schematic Capture Ascii File Version 5.0
+|RECORD=15|INDEXINSHEET=0|LOCATION.X=300|LOCATION.Y=500|XSIZE=100|YSIZE=60
+|RECORD=16|OWNERINDEX=0|SIDE=0|DISTANCEFROMTOP=2|NAME=Repeat(IN)|IOTYPE=2
+|RECORD=16|OWNERINDEX=0|SIDE=1|DISTANCEFROMTOP=2|NAME=GND|IOTYPE=3
+|RECORD=32|OWNERINDEX=0|TEXT=Repeat(CH, 1, 3)
+|RECORD=33|OWNERINDEX=0|TEXT=Channel.SchDoc
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sch, _, err := Map(recs, "top", "top.SchDoc", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := sch.Sheets[0].SubSheets[0]
+	if ss.Name != "CH" || ss.Repeat == nil || ss.Repeat.First != 1 || ss.Repeat.Last != 3 {
+		t.Fatalf("name %q repeat %v", ss.Name, ss.Repeat)
+	}
+	if got := strings.Join(ss.Instances(), ","); got != "CH1,CH2,CH3" {
+		t.Errorf("instances %s", got)
+	}
+	if e := ss.Entries[0]; e.Name != "IN" || !e.Repeated {
+		t.Errorf("entry %+v", e)
+	}
+	if e := ss.Entries[1]; e.Name != "GND" || e.Repeated {
+		t.Errorf("entry %+v", e)
+	}
+
+	if name, r := parseRepeat("Repeat(CH,3,1)"); name != "Repeat(CH,3,1)" || r != nil {
+		t.Errorf("bad range parsed as %s %v", name, r)
+	}
+}
+
+func TestFootprint(t *testing.T) {
+	recs, err := reader.ReadASCII(strings.NewReader(`|HEADER=Protel for Windows - Schematic Capture Ascii File Version 5.0
+|RECORD=1|INDEXINSHEET=0|LIBREFERENCE=RES|LOCATION.X=100|LOCATION.Y=100|CURRENTPARTID=1
+|RECORD=34|OWNERINDEX=0|TEXT=R1|LOCATION.X=100|LOCATION.Y=110
+|RECORD=44|OWNERINDEX=0
+|RECORD=45|OWNERINDEX=2|MODELNAME=RES_SIM|MODELTYPE=SIM|ISCURRENT=T
+|RECORD=45|OWNERINDEX=2|MODELNAME=R0805|MODELTYPE=PCBLIB
+|RECORD=45|OWNERINDEX=2|MODELNAME=R0603|MODELTYPE=PCBLIB|ISCURRENT=T
+|RECORD=1|INDEXINSHEET=6|LIBREFERENCE=RES|LOCATION.X=200|LOCATION.Y=100|CURRENTPARTID=1
+|RECORD=44|OWNERINDEX=6
+|RECORD=45|OWNERINDEX=7|MODELNAME=R1206|MODELTYPE=PCBLIB
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sch, _, err := Map(recs, "top", "top.SchDoc", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comps := sch.Sheets[0].Components
+	if len(comps) != 2 || comps[0].Footprint != "R0603" || comps[1].Footprint != "R1206" {
+		t.Fatalf("footprints %+v", comps)
+	}
+}
+
+// Library symbols own the records after them, without OWNERINDEX, and keep
+// their designator, description, parameters and footprint.
+func TestMapLibrary(t *testing.T) {
+	lib := []string{`|RECORD=1|LIBREFERENCE=RES|COMPONENTDESCRIPTION=Resistor|PARTCOUNT=1
+|RECORD=2|OWNERPARTID=1|DESIGNATOR=1|NAME=1|PINLENGTH=2|LOCATION.X=-2|LOCATION.Y=0|PINCONGLOMERATE=2
+|RECORD=2|OWNERPARTID=1|DESIGNATOR=2|NAME=2|PINLENGTH=2|LOCATION.X=6|LOCATION.Y=0|PINCONGLOMERATE=0
+|RECORD=14|LOCATION.X=0|LOCATION.Y=-1|CORNER.X=4|CORNER.Y=1
+|RECORD=34|TEXT=R?|LOCATION.X=0|LOCATION.Y=2
+|RECORD=41|NAME=MPN|TEXT=RC0603|ISHIDDEN=T
+|RECORD=44
+|RECORD=45|MODELNAME=R0805|MODELTYPE=PCBLIB
+|RECORD=45|MODELNAME=R0603|MODELTYPE=PCBLIB|ISCURRENT=T
+`, `|RECORD=1|LIBREFERENCE=CAP
+|RECORD=2|DESIGNATOR=1|LOCATION.X=0|LOCATION.Y=0
+`, `|RECORD=31|SHEETSTYLE=1
+`}
+	var syms [][]record.Record
+	for _, s := range lib {
+		recs, err := reader.ReadASCII(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		syms = append(syms, recs)
+	}
+
+	sch, rep, err := MapLibrary(syms, "lib.SchLib", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sch.Sheets) != 0 || len(sch.Symbols) != 2 || len(rep.Notes) != 1 {
+		t.Fatalf("%d sheets, %d symbols, notes %+v", len(sch.Sheets), len(sch.Symbols), rep.Notes)
+	}
+	var res *schema.Symbol
+	for _, sym := range sch.Symbols {
+		if sym.LibRef == "RES" {
+			res = sym
+		}
+	}
+	if res == nil {
+		t.Fatal("no RES")
+	}
+	if res.Designator != "R?" || res.Description != "Resistor" || res.Footprint != "R0603" {
+		t.Errorf("RES %q %q %q", res.Designator, res.Description, res.Footprint)
+	}
+	if len(res.Fields) != 1 || res.Fields[0].Name != "MPN" || res.Fields[0].Value != "RC0603" {
+		t.Errorf("fields %+v", res.Fields)
+	}
+	if len(res.Pins) != 2 || len(res.Graphics) != 1 {
+		t.Fatalf("%d pins, %d graphics", len(res.Pins), len(res.Graphics))
+	}
+	if p := res.Pins[1]; p.Number != "2" || p.Position.X != 60*25400 || p.PinLength != 20*25400 {
+		t.Errorf("pin 2 %+v", p)
+	}
+}
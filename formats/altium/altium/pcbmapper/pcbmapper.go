@@ -57,6 +57,77 @@ func Map(rb *pcbreader.RawBoard, sourceFile string) (*pcbschema.Board, *emit.Rep
 	return b, rep, nil
 }
 
+// MapLibrary converts the footprints of a .PcbLib to a pcbschema.Library. Each
+// footprint is mapped as a board with one component at the origin, so that
+// its pads, texts and graphics go through the same builders as on a board.
+func MapLibrary(fps []*pcbreader.RawFootprint, sourceFile string) (*pcbschema.Library, *emit.Report, error) {
+	rep := &emit.Report{}
+	lib := &pcbschema.Library{Meta: pcbschema.Meta{SourceFile: sourceFile}}
+
+	for i, fp := range fps {
+		prov := schema.Provenance{Sheet: sourceFile, Record: i, Kind: "footprint"}
+		b, r, err := Map(adopt(fp), sourceFile)
+		if err != nil {
+			return nil, rep, fmt.Errorf("footprint %s: %w", fp.Name, err)
+		}
+		rep.Notes = append(rep.Notes, r.Notes...)
+		if len(b.Vias) > 0 {
+			rep.Add(emit.Warn, prov, "footprint %s: %d vias left out", fp.Name, len(b.Vias))
+			b.Vias = nil
+		}
+		if len(b.Keepouts) > 0 {
+			rep.Add(emit.Warn, prov, "footprint %s: %d keepouts left out", fp.Name, len(b.Keepouts))
+			b.Keepouts = nil
+		}
+		b.Components = []*pcbschema.Component{{
+			Designator: "REF**",
+			Pattern:    fp.Name,
+			Layer:      1,
+			Prov:       prov,
+		}}
+		lib.Footprints = append(lib.Footprints, &pcbschema.Footprint{
+			Name:        fp.Name,
+			Description: fp.Params.UTF8Str("DESCRIPTION"),
+			Board:       b,
+		})
+	}
+	return lib, rep, nil
+}
+
+// adopt returns the primitives of a footprint as those of a board on which
+// they all belong to component 0. In a library they are stored as free
+// primitives, and the regions, though in the Regions6 format, are the shapes
+// of the footprint that a board has in ShapeBasedRegions6.
+func adopt(fp *pcbreader.RawFootprint) *pcbreader.RawBoard {
+	rb := fp.RawBoard
+	rb.Arcs = append([]pcbreader.RawArc(nil), rb.Arcs...)
+	for i := range rb.Arcs {
+		rb.Arcs[i].Component = 0
+	}
+	rb.Pads = append([]pcbreader.RawPad(nil), rb.Pads...)
+	for i := range rb.Pads {
+		rb.Pads[i].Component = 0
+	}
+	rb.Tracks = append([]pcbreader.RawTrack(nil), rb.Tracks...)
+	for i := range rb.Tracks {
+		rb.Tracks[i].Component = 0
+	}
+	rb.Texts = append([]pcbreader.RawText(nil), rb.Texts...)
+	for i := range rb.Texts {
+		rb.Texts[i].Component = 0
+	}
+	rb.Fills = append([]pcbreader.RawFill(nil), rb.Fills...)
+	for i := range rb.Fills {
+		rb.Fills[i].Component = 0
+	}
+	rb.Regions = append([]pcbreader.RawRegion(nil), rb.Regions...)
+	for i := range rb.Regions {
+		rb.Regions[i].Component = 0
+		rb.Regions[i].Storage = "ShapeBasedRegions6"
+	}
+	return &rb
+}
+
 // ---------- Nets ----------
 
 func buildNets(rb *pcbreader.RawBoard, b *pcbschema.Board) {
@@ -35,3 +35,51 @@ func TestMap(t *testing.T) {
 		len(board.Nets), len(board.Components), len(board.Tracks),
 		len(board.Vias), len(board.Pads), len(board.Arcs), len(board.BoardOutline))
 }
+
+// rawFootprint is a two-pad footprint with a silkscreen line, a copper region
+// and a via, its primitives free as in a .PcbLib.
+func rawFootprint() *pcbreader.RawFootprint {
+	const mil = 10000 // 0.1 µin units
+	fp := &pcbreader.RawFootprint{Name: "R0603", Storage: "R0603"}
+	fp.Params.Props = map[string]string{"PATTERN": "R0603", "DESCRIPTION": "Chip resistor"}
+	for i, x := range []int32{-30 * mil, 30 * mil} {
+		fp.Pads = append(fp.Pads, pcbreader.RawPad{
+			Designator: string(rune('1' + i)), Layer: 1, Net: 0xFFFF, Component: 0xFFFF,
+			PosX: x, TopSizeX: 30 * mil, TopSizeY: 35 * mil, TopShape: 2, BotShape: 2,
+		})
+	}
+	fp.Tracks = append(fp.Tracks, pcbreader.RawTrack{
+		Layer: 33, Net: 0xFFFF, Polygon: 0xFFFF, Component: 0xFFFF,
+		StartX: -60 * mil, EndX: 60 * mil, Width: 5 * mil,
+	})
+	fp.Regions = append(fp.Regions, pcbreader.RawRegion{
+		Layer: 1, Net: 0xFFFF, Polygon: 0xFFFF, Component: 0xFFFF, Storage: "Regions6",
+		Vertices: [][2]int32{{0, 0}, {10 * mil, 0}, {10 * mil, 10 * mil}, {0, 10 * mil}},
+	})
+	fp.Vias = append(fp.Vias, pcbreader.RawVia{Net: 0xFFFF, Diameter: 20 * mil, HoleSize: 10 * mil})
+	return fp
+}
+
+func TestMapLibrary(t *testing.T) {
+	lib, rep, err := pcbmapper.MapLibrary([]*pcbreader.RawFootprint{rawFootprint()}, "lib.PcbLib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lib.Footprints) != 1 || len(rep.Notes) != 1 {
+		t.Fatalf("%d footprints, notes %+v", len(lib.Footprints), rep.Notes)
+	}
+	fp := lib.Footprints[0]
+	b := fp.Board
+	if fp.Name != "R0603" || fp.Description != "Chip resistor" || len(b.Components) != 1 || b.Components[0].Pattern != "R0603" {
+		t.Errorf("footprint %+v, components %+v", fp, b.Components)
+	}
+	if len(b.Pads) != 2 || b.Pads[0].Component != 0 || b.Pads[1].Position.X != 30*25400 {
+		t.Errorf("pads %+v", b.Pads)
+	}
+	if len(b.Tracks) != 1 || b.Tracks[0].Component != 0 {
+		t.Errorf("tracks %+v", b.Tracks)
+	}
+	if len(b.CustomPads) != 1 || len(b.Polys) != 0 || len(b.Vias) != 0 {
+		t.Errorf("%d custom pads, %d polygons, %d vias", len(b.CustomPads), len(b.Polys), len(b.Vias))
+	}
+}
@@ -0,0 +1,117 @@
+package pcbreader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/richardlehane/mscfb"
+
+	"github.com/rveen/golib/formats/altium/altium/record"
+)
+
+// ---------- Libraries ----------
+
+// RawFootprint holds one footprint of a .PcbLib: the primitives of the Data
+// stream of its storage, in footprint coordinates, and its Parameters record.
+// The text storages of the embedded RawBoard are empty.
+type RawFootprint struct {
+	Name    string        // PATTERN, or the storage name
+	Storage string        // storage name: the footprint name, cut to 31 characters
+	Params  record.Record // PATTERN, DESCRIPTION, HEIGHT, …
+	RawBoard
+}
+
+// ReadLibFile opens a .PcbLib CFB file and returns its footprints.
+func ReadLibFile(path string) ([]*RawFootprint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readLibFrom(f)
+}
+
+// ReadLibBytes reads a .PcbLib CFB file from an in-memory byte slice.
+func ReadLibBytes(data []byte) ([]*RawFootprint, error) {
+	return readLibFrom(bytes.NewReader(data))
+}
+
+// readLibFrom parses a .PcbLib CFB container. Each footprint is a storage
+// under the root with a Parameters stream (one property list) and a Data
+// stream: a subrecord holding the footprint name as a Pascal string, then the
+// same binary primitive records as the storages of a board, for all kinds of
+// primitive at once. Other storages (Library, Models, …) have no Parameters.
+func readLibFrom(rs io.ReaderAt) ([]*RawFootprint, error) {
+	doc, err := mscfb.New(rs)
+	if err != nil {
+		return nil, fmt.Errorf("CFB open: %w", err)
+	}
+
+	var order []string
+	data := make(map[string][]byte)
+	params := make(map[string][]byte)
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		if len(entry.Path) != 1 || (entry.Name != "Data" && entry.Name != "Parameters") {
+			continue
+		}
+		storage := entry.Path[0]
+		buf := make([]byte, entry.Size)
+		if _, err := io.ReadFull(doc, buf); err != nil {
+			return nil, fmt.Errorf("reading %s/%s: %w", storage, entry.Name, err)
+		}
+		if _, ok := data[storage]; !ok {
+			if _, ok := params[storage]; !ok {
+				order = append(order, storage)
+			}
+		}
+		if entry.Name == "Data" {
+			data[storage] = buf
+		} else {
+			params[storage] = buf
+		}
+	}
+
+	var fps []*RawFootprint
+	for _, storage := range order {
+		pbuf, ok := params[storage]
+		if !ok {
+			continue
+		}
+		fp, err := parseFootprint(storage, pbuf, data[storage])
+		if err != nil {
+			return nil, fmt.Errorf("parsing footprint %s: %w", storage, err)
+		}
+		fps = append(fps, fp)
+	}
+	return fps, nil
+}
+
+// parseFootprint decodes the Parameters and Data streams of a footprint.
+// Regions are in the non-extended format of Regions6.
+func parseFootprint(storage string, params, data []byte) (*RawFootprint, error) {
+	fp := &RawFootprint{Name: storage, Storage: storage}
+	recs, err := parseTextStorage(params)
+	if err != nil {
+		return nil, err
+	}
+	if len(recs) > 0 {
+		fp.Params = recs[0]
+		if p := fp.Params.UTF8Str("PATTERN"); p != "" {
+			fp.Name = p
+		}
+	}
+
+	name, n := readSubrecord(data, 0)
+	if n == 0 {
+		return fp, nil // no primitives
+	}
+	if fp.Params.Props == nil && len(name) > 0 {
+		fp.Name, _ = readPascalStr(name, 0)
+	}
+	if err := parseBinaryStorage("Regions6", data[n:], &fp.RawBoard); err != nil {
+		return nil, err
+	}
+	return fp, nil
+}
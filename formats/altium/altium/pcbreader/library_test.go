@@ -0,0 +1,55 @@
+package pcbreader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestParseFootprint(t *testing.T) {
+	le := func(b *bytes.Buffer, v any) { binary.Write(b, binary.LittleEndian, v) }
+
+	var params bytes.Buffer
+	p := "|PATTERN=SOT-23|DESCRIPTION=3 leads|HEIGHT=40mil\x00"
+	le(&params, uint32(len(p)))
+	params.WriteString(p)
+
+	var data bytes.Buffer
+	le(&data, uint32(7))
+	data.WriteByte(6)
+	data.WriteString("SOT-23")
+
+	// A silkscreen track from (-10, 0) to (10, 0) mil, 0.1 µin units.
+	track := make([]byte, 33)
+	track[0] = 33 // top overlay
+	binary.LittleEndian.PutUint16(track[3:], 0xFFFF)
+	binary.LittleEndian.PutUint16(track[5:], 0xFFFF)
+	binary.LittleEndian.PutUint16(track[7:], 0xFFFF)
+	s4 := func(off int, v int32) { binary.LittleEndian.PutUint32(track[off:], uint32(v)) }
+	s4(13, -100000)
+	s4(21, 100000)
+	s4(29, 50000)
+	data.WriteByte(4)
+	le(&data, uint32(len(track)))
+	data.Write(track)
+
+	fp, err := parseFootprint("SOT-23", params.Bytes(), data.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.Name != "SOT-23" || fp.Params.Str("DESCRIPTION") != "3 leads" {
+		t.Errorf("footprint %q %v", fp.Name, fp.Params.Props)
+	}
+	if len(fp.Tracks) != 1 {
+		t.Fatalf("%d tracks", len(fp.Tracks))
+	}
+	if tr := fp.Tracks[0]; tr.Layer != 33 || tr.StartX != -100000 || tr.EndX != 100000 || tr.Width != 50000 {
+		t.Errorf("track %+v", tr)
+	}
+
+	// Without parameters, the name is that of the Data stream.
+	fp, err = parseFootprint("SOT-23_1", nil, data.Bytes())
+	if err != nil || fp.Name != "SOT-23" {
+		t.Errorf("name %q, %v", fp.Name, err)
+	}
+}
@@ -1,7 +1,8 @@
 // Package pcbreader decodes Altium .PcbDoc files into a RawBoard structure.
 // Both text-format storages (Board6, Components6, Nets6, Polygons6) and
 // binary-format storages (Arcs6, Tracks6, Vias6, Pads6, Texts6, Fills6,
-// Regions6, BoardRegions) are parsed.
+// Regions6, BoardRegions) are parsed. ReadLibFile reads the footprints of a
+// .PcbLib library, which are made of the same binary records.
 package pcbreader
 
 import (
@@ -142,7 +143,7 @@ type RawRegion struct {
 	IsKeepout     bool   // flags2 == 2: region is a keepout rule area
 	IsBoardCutout bool   // KIND=0 + ISBOARDCUTOUT=true: contributes to board Edge.Cuts
 	Kind          int    // ALTIUM_REGION_KIND: 0=copper,1=polygon-cutout,2=dashed,4=cavity
-	Storage       string // source storage: "Regions6", "ShapeBasedRegions6", or "BoardRegions"
+	Storage       string // source storage: "Regions6", "ShapeBasedRegions6", or "BoardRegions" ("Regions6" in a footprint)
 	Vertices      [][2]int32
 	VertexArcs    []RawVertexArc // arc info per outline vertex (extended regions only; aligned with Vertices)
 	Holes         [][][2]int32   // hole polygons cutting into this region's copper
@@ -0,0 +1,300 @@
+// Package project reads Altium projects (.PrjPcb): the documents of the
+// project, and its schematic documents as one schema.Schematic in which each
+// sheet symbol is resolved to the sheet of its file (SheetSymbol.Child).
+//
+//	sch, rep, err := project.Load("board/Board.PrjPcb")
+//	artifacts, _, err := kicad.Emitter{}.Emit(sch, nil)
+//
+// A .PrjPcb is an INI file with a [DocumentN] section per document:
+//
+//	[Document1]
+//	DocumentPath=Top.SchDoc
+//	[Document2]
+//	DocumentPath=Sheets\Power.SchDoc
+package project
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rveen/golib/formats/altium/altium/mapper"
+	"github.com/rveen/golib/formats/altium/altium/reader"
+	"github.com/rveen/golib/formats/altium/emit"
+	"github.com/rveen/golib/formats/altium/schema"
+	"github.com/rveen/golib/ini"
+)
+
+// Project is an Altium project file.
+type Project struct {
+	Name      string   // file name without extension
+	File      string   // path of the project file
+	Dir       string   // directory of the project; documents are relative to it
+	Documents []string // document paths with / separators, in project order
+}
+
+// Read reads a project file.
+func Read(file string) (*Project, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	p, err := Parse(b)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+	base := filepath.Base(file)
+	p.Name = strings.TrimSuffix(base, filepath.Ext(base))
+	p.File = file
+	p.Dir = filepath.Dir(file)
+	return p, nil
+}
+
+// Parse reads the documents of a project file that is already in memory.
+func Parse(b []byte) (*Project, error) {
+
+	g, err := ini.FromBytes(bytes.TrimPrefix(b, []byte("\xef\xbb\xbf")))
+	if err != nil {
+		return nil, err
+	}
+
+	type doc struct {
+		n    int
+		path string
+	}
+	var docs []doc
+	for _, sec := range g.Out {
+		s := sec.ThisString()
+		if !strings.HasPrefix(s, "Document") {
+			continue
+		}
+		n, err := strconv.Atoi(s[len("Document"):])
+		if err != nil {
+			continue
+		}
+		if p := sec.Node("DocumentPath"); p != nil && p.String() != "" {
+			docs = append(docs, doc{n, strings.ReplaceAll(p.String(), `\`, "/")})
+		}
+	}
+	if docs == nil {
+		return nil, errors.New("no documents in project")
+	}
+	sort.SliceStable(docs, func(i, j int) bool { return docs[i].n < docs[j].n })
+
+	p := &Project{}
+	for _, d := range docs {
+		p.Documents = append(p.Documents, d.path)
+	}
+	return p, nil
+}
+
+// SchDocs returns the schematic documents of the project.
+func (p *Project) SchDocs() []string {
+	var docs []string
+	for _, d := range p.Documents {
+		if strings.EqualFold(path.Ext(d), ".SchDoc") {
+			docs = append(docs, d)
+		}
+	}
+	return docs
+}
+
+// Load reads a project and its schematic documents, see Project.Load.
+func Load(file string) (*schema.Schematic, *emit.Report, error) {
+	p, err := Read(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p.Load()
+}
+
+// Load reads the schematic documents of the project into one schematic, with
+// one sheet per document, named after its file. Sheets that are placed by a
+// sheet symbol but are not in the project are read too when found next to
+// the placing sheet or in the project directory. Then the sheet symbols are
+// resolved (see Resolve). Documents that cannot be found, or that have the
+// same file name as one read before, are reported.
+func (p *Project) Load() (*schema.Schematic, *emit.Report, error) {
+
+	rep := &emit.Report{}
+	s := &schema.Schematic{
+		Symbols: make(map[schema.SymbolID]*schema.Symbol),
+		Meta: schema.Meta{
+			SourceFile: p.File,
+			Project:    p.Name,
+			Tool:       "Altium Designer",
+		},
+	}
+
+	// Sheet symbols name their file without a directory, so documents are
+	// known by their base name. A second document with the same name is
+	// skipped.
+	loaded := map[string]string{}
+	load := func(doc string, prov schema.Provenance) error {
+		key := strings.ToLower(path.Base(doc))
+		if first, ok := loaded[key]; ok {
+			if first != doc {
+				rep.Add(emit.Warn, prov, "document %s skipped: same name as %s", doc, first)
+			}
+			return nil
+		}
+		loaded[key] = doc
+		file := p.find(doc)
+		if file == "" {
+			rep.Add(emit.Warn, prov, "document %s not found", doc)
+			return nil
+		}
+		return readSheet(s, file, doc, rep)
+	}
+
+	docs := p.SchDocs()
+	if docs == nil {
+		return nil, nil, fmt.Errorf("no schematic documents in project %s", p.Name)
+	}
+	for _, doc := range docs {
+		if err := load(doc, schema.Provenance{Sheet: p.Name, Kind: "project"}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Sheets placed by sheet symbols but missing from the project. Loading
+	// one can add more, so go on until there are no new sheets.
+	for i := 0; i < len(s.Sheets); i++ {
+		sh := s.Sheets[i]
+		for _, ss := range sh.SubSheets {
+			if _, ok := loaded[strings.ToLower(path.Base(fileName(ss.FileName)))]; ss.FileName == "" || ok {
+				continue
+			}
+			doc := path.Join(path.Dir(sh.FileName), fileName(ss.FileName))
+			if p.find(doc) == "" {
+				doc = fileName(ss.FileName)
+			}
+			if err := load(doc, ss.Prov); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	Resolve(s, rep)
+	return s, rep, nil
+}
+
+// find returns the path of a document in the file system, or "". Documents
+// with a path that does not exist (as absolute Windows paths) are looked for
+// in the project directory.
+func (p *Project) find(doc string) string {
+	for _, f := range []string{filepath.Join(p.Dir, filepath.FromSlash(doc)), filepath.Join(p.Dir, path.Base(doc))} {
+		if st, err := os.Stat(f); err == nil && !st.IsDir() {
+			return f
+		}
+	}
+	return ""
+}
+
+// readSheet reads a schematic document and adds its sheet to s.
+func readSheet(s *schema.Schematic, file, doc string, rep *emit.Report) error {
+
+	records, isBinary, err := reader.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", doc, err)
+	}
+	coordScale := 1
+	if isBinary {
+		coordScale = 10
+	}
+
+	base := path.Base(doc)
+	name := strings.TrimSuffix(base, path.Ext(base))
+	sch, mrep, err := mapper.Map(records, name, doc, coordScale)
+	if err != nil {
+		return fmt.Errorf("mapping %s: %w", doc, err)
+	}
+
+	for _, n := range mrep.Notes {
+		if n.Prov.Sheet == "" {
+			n.Prov.Sheet = name
+		}
+		rep.Notes = append(rep.Notes, n)
+	}
+	for _, sh := range sch.Sheets {
+		sh.Prov.Sheet = name
+		for _, ss := range sh.SubSheets {
+			ss.Prov.Sheet = name
+		}
+	}
+	s.Sheets = append(s.Sheets, sch.Sheets...)
+	for id, sym := range sch.Symbols {
+		if _, ok := s.Symbols[id]; !ok {
+			s.Symbols[id] = sym
+		}
+	}
+	return nil
+}
+
+// Resolve sets the Child of each sheet symbol in s to the sheet of its file.
+// Files are matched by name, without directory and case, as Altium does.
+// Sheet symbols of unknown files, and those that would place a sheet inside
+// itself, are reported and left unresolved.
+func Resolve(s *schema.Schematic, rep *emit.Report) {
+
+	byFile := map[string]*schema.Sheet{}
+	for _, sh := range s.Sheets {
+		key := strings.ToLower(path.Base(fileName(sh.FileName)))
+		if _, ok := byFile[key]; !ok && key != "." {
+			byFile[key] = sh
+		}
+	}
+
+	for _, sh := range s.Sheets {
+		for _, ss := range sh.SubSheets {
+			ss.Child = byFile[strings.ToLower(path.Base(fileName(ss.FileName)))]
+			if ss.Child == nil {
+				rep.Add(emit.Warn, ss.Prov, "sheet symbol %s: sheet %s not found", ss.Name, ss.FileName)
+			}
+		}
+	}
+
+	// Depth first, breaking the sheet symbols that lead back to a sheet
+	// being visited.
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[*schema.Sheet]int{}
+	var visit func(sh *schema.Sheet)
+	visit = func(sh *schema.Sheet) {
+		state[sh] = visiting
+		for _, ss := range sh.SubSheets {
+			if ss.Child == nil {
+				continue
+			}
+			switch state[ss.Child] {
+			case visiting:
+				rep.Add(emit.Error, ss.Prov, "sheet symbol %s: sheet %s contains itself", ss.Name, ss.FileName)
+				ss.Child = nil
+			case 0:
+				visit(ss.Child)
+			}
+		}
+		state[sh] = done
+	}
+	for _, sh := range s.Roots() {
+		visit(sh)
+	}
+	for _, sh := range s.Sheets {
+		if state[sh] == 0 {
+			visit(sh)
+		}
+	}
+}
+
+// fileName returns a file name with / separators.
+func fileName(s string) string {
+	return strings.ReplaceAll(strings.TrimSpace(s), `\`, "/")
+}
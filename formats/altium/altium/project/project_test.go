@@ -0,0 +1,157 @@
+package project_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rveen/golib/formats/altium/altium/project"
+	"github.com/rveen/golib/formats/altium/emit"
+	"github.com/rveen/golib/formats/altium/schema"
+)
+
+func TestRead(t *testing.T) {
+	p, err := project.Read("testdata/Demo.PrjPcb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "Demo" || p.Dir != "testdata" {
+		t.Errorf("name %q dir %q", p.Name, p.Dir)
+	}
+	want := []string{"Top.SchDoc", "Sheets/Power.SchDoc", "Sheets/Channel.SchDoc", "Demo.PcbDoc"}
+	if !reflect.DeepEqual(p.Documents, want) {
+		t.Errorf("documents %q, want %q", p.Documents, want)
+	}
+	if n := len(p.SchDocs()); n != 3 {
+		t.Errorf("%d schematic documents, want 3", n)
+	}
+}
+
+func TestParseBOM(t *testing.T) {
+	p, err := project.Parse([]byte("\xef\xbb\xbf[Design]\nVersion=1.0\n[Document2]\nDocumentPath=B.SchDoc\n[Document1]\nDocumentPath=A.SchDoc\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p.Documents, []string{"A.SchDoc", "B.SchDoc"}) {
+		t.Errorf("documents %q", p.Documents)
+	}
+	if _, err := project.Parse([]byte("[Design]\nVersion=1.0\n")); err == nil {
+		t.Error("no error for a project without documents")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	s, rep, err := project.Load("testdata/Demo.PrjPcb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range rep.Notes {
+		t.Errorf("note: %s", n.Message)
+	}
+
+	if s.Meta.Project != "Demo" || len(s.Sheets) != 3 {
+		t.Fatalf("project %q, %d sheets", s.Meta.Project, len(s.Sheets))
+	}
+	top, power, channel := s.Sheets[0], s.Sheets[1], s.Sheets[2]
+	if top.Name != "Top" || power.Name != "Power" || channel.FileName != "Sheets/Channel.SchDoc" {
+		t.Errorf("sheets %q %q %q", top.Name, power.Name, channel.FileName)
+	}
+	if roots := s.Roots(); len(roots) != 1 || roots[0] != top {
+		t.Errorf("roots %v", roots)
+	}
+
+	if len(top.SubSheets) != 2 {
+		t.Fatalf("%d sheet symbols", len(top.SubSheets))
+	}
+	if ss := top.SubSheets[0]; ss.Child != power || ss.Repeat != nil {
+		t.Errorf("sheet symbol %s not resolved to Power", ss.Name)
+	}
+	ss := top.SubSheets[1]
+	if ss.Child != channel || ss.Name != "CH" || ss.Repeat == nil {
+		t.Fatalf("sheet symbol %s not resolved to a repeated Channel", ss.Name)
+	}
+	if got := ss.Instances(); !reflect.DeepEqual(got, []string{"CH1", "CH2"}) {
+		t.Errorf("instances %q", got)
+	}
+
+	// Both the resistor and the capacitor symbols are there.
+	if len(s.Symbols) != 2 {
+		t.Errorf("%d symbols, want 2", len(s.Symbols))
+	}
+}
+
+// A sheet symbol to a file that is not in the project is read from the
+// directory of its sheet.
+func TestLoadUnlisted(t *testing.T) {
+	dir := t.TempDir()
+	copyFile(t, "testdata/Top.SchDoc", filepath.Join(dir, "Top.SchDoc"))
+	copyFile(t, "testdata/Sheets/Power.SchDoc", filepath.Join(dir, "Power.SchDoc"))
+	os.WriteFile(filepath.Join(dir, "P.PrjPcb"), []byte("[Document1]\r\nDocumentPath=Top.SchDoc\r\n"), 0o644)
+
+	s, rep, err := project.Load(filepath.Join(dir, "P.PrjPcb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Sheets) != 2 || s.Sheets[0].SubSheets[0].Child != s.Sheets[1] {
+		t.Fatalf("%d sheets; Power not resolved", len(s.Sheets))
+	}
+	// Channel.SchDoc is nowhere.
+	if len(rep.Notes) == 0 || !strings.Contains(rep.Notes[0].Message, "Channel.SchDoc") {
+		t.Errorf("notes %v", rep.Notes)
+	}
+}
+
+// Two documents with the same file name in different directories: the
+// second is skipped with a warning.
+func TestLoadSameName(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "a"), 0o755)
+	os.Mkdir(filepath.Join(dir, "b"), 0o755)
+	copyFile(t, "testdata/Sheets/Power.SchDoc", filepath.Join(dir, "a", "Power.SchDoc"))
+	copyFile(t, "testdata/Sheets/Power.SchDoc", filepath.Join(dir, "b", "power.schdoc"))
+	os.WriteFile(filepath.Join(dir, "P.PrjPcb"), []byte("[Document1]\r\nDocumentPath=a\\Power.SchDoc\r\n[Document2]\r\nDocumentPath=b\\power.schdoc\r\n"), 0o644)
+
+	s, rep, err := project.Load(filepath.Join(dir, "P.PrjPcb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Sheets) != 1 || s.Sheets[0].FileName != "a/Power.SchDoc" {
+		t.Fatalf("%d sheets", len(s.Sheets))
+	}
+	if len(rep.Notes) != 1 || rep.Notes[0].Severity != emit.Warn || !strings.Contains(rep.Notes[0].Message, "b/power.schdoc") {
+		t.Errorf("notes %v", rep.Notes)
+	}
+}
+
+func TestResolveLoop(t *testing.T) {
+	a := &schema.Sheet{Name: "A", FileName: "A.SchDoc"}
+	b := &schema.Sheet{Name: "B", FileName: "sub\\b.schdoc"}
+	a.SubSheets = []*schema.SheetSymbol{{Name: "b", FileName: "B.SchDoc"}}
+	b.SubSheets = []*schema.SheetSymbol{{Name: "a", FileName: "A.SchDoc"}}
+	s := &schema.Schematic{Sheets: []*schema.Sheet{a, b}}
+
+	rep := &emit.Report{}
+	project.Resolve(s, rep)
+
+	if a.SubSheets[0].Child != b {
+		t.Error("A does not place B")
+	}
+	if b.SubSheets[0].Child != nil {
+		t.Error("loop not broken")
+	}
+	if !rep.HasErrors() {
+		t.Error("loop not reported")
+	}
+}
+
+func copyFile(t *testing.T, from, to string) {
+	b, err := os.ReadFile(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(to, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,5 +1,6 @@
 // Package reader decodes Altium .SchDoc files into a flat slice of records.
 // Both binary CFB and ASCII variants are supported; the format is auto-detected.
+// ReadLibFile reads the symbols of a .SchLib library, one record slice each.
 package reader
 
 import (
@@ -123,8 +124,9 @@ func readCFB(rs io.ReaderAt) ([]record.Record, error) {
 //	      bits 24..31 payload type: 0x00 = text (property list), nonzero = binary
 //	  <length> bytes  payload
 //
-// Text payloads are null-terminated property lists; binary payloads (type≠0)
-// are skipped (used by the Storage stream and SchLib pin-auxiliary streams).
+// Text payloads are null-terminated property lists. Binary payloads (type≠0)
+// are decoded when they are SchLib pins (see parseBinaryPin) and skipped
+// otherwise (the Storage stream and SchLib pin-auxiliary streams).
 func parseRecordStream(buf []byte) ([]record.Record, error) {
 	r := bytes.NewReader(buf)
 	var records []record.Record
@@ -143,7 +145,10 @@ func parseRecordStream(buf []byte) ([]record.Record, error) {
 			break
 		}
 		if payloadType != 0 {
-			// Binary payload — not a property list; skip.
+			// Binary payload — not a property list; keep it only if it is a pin.
+			if rec, ok := parseBinaryPin(prop); ok {
+				records = append(records, rec)
+			}
 			continue
 		}
 		// Strip null terminator and any trailing garbage.
@@ -195,3 +200,132 @@ func parsePropString(s string) (record.Record, error) {
 	}
 	return rec, nil
 }
+
+// parseBinaryPin decodes the binary pin record of a .SchLib Data stream into
+// the properties of a text PIN record (section 9.4), so that pins read the
+// same from a library as from a document. The layout, little-endian, is:
+//
+//	int32 RECORD (2), byte, int16 OWNERPARTID, byte OWNERPARTDISPLAYMODE,
+//	byte SYMBOL_INNEREDGE, SYMBOL_OUTEREDGE, SYMBOL_INNER, SYMBOL_OUTER,
+//	pstring TEXT, byte, byte ELECTRICAL, byte PINCONGLOMERATE,
+//	int16 PINLENGTH, LOCATION.X, LOCATION.Y, int32 COLOR,
+//	pstring NAME, DESIGNATOR, SWAPIDGROUP, …
+//
+// where a pstring is a length byte and that many bytes. ok is false for any
+// other binary payload.
+func parseBinaryPin(b []byte) (record.Record, bool) {
+	if len(b) < 4 || int(binary.LittleEndian.Uint32(b)) != record.TypePin {
+		return record.Record{}, false
+	}
+	props := map[string]string{"RECORD": "2"}
+	pos := 5
+	ok := true
+	u8 := func(key string) {
+		if pos+1 > len(b) {
+			ok = false
+			return
+		}
+		if key != "" {
+			props[key] = fmt.Sprint(b[pos])
+		}
+		pos++
+	}
+	i16 := func(key string) {
+		if pos+2 > len(b) {
+			ok = false
+			return
+		}
+		props[key] = fmt.Sprint(int16(binary.LittleEndian.Uint16(b[pos:])))
+		pos += 2
+	}
+	str := func(key string) {
+		if pos+1 > len(b) || pos+1+int(b[pos]) > len(b) {
+			ok = false
+			return
+		}
+		n := int(b[pos])
+		props[key] = string(b[pos+1 : pos+1+n])
+		pos += 1 + n
+	}
+
+	i16("OWNERPARTID")
+	u8("OWNERPARTDISPLAYMODE")
+	u8("SYMBOL_INNEREDGE")
+	u8("SYMBOL_OUTEREDGE")
+	u8("SYMBOL_INNER")
+	u8("SYMBOL_OUTER")
+	str("TEXT")
+	u8("")
+	u8("ELECTRICAL")
+	u8("PINCONGLOMERATE")
+	i16("PINLENGTH")
+	i16("LOCATION.X")
+	i16("LOCATION.Y")
+	if pos += 4; pos > len(b) {
+		ok = false
+	}
+	str("NAME")
+	str("DESIGNATOR")
+	if !ok {
+		return record.Record{}, false
+	}
+	return record.Record{Props: props, Type: record.TypePin, Index: -1}, true
+}
+
+// ---------- Libraries ----------
+
+// LibSymbol is one symbol of a schematic library: the records of the Data
+// stream of its storage, the COMPONENT record first and its primitives after
+// it.
+type LibSymbol struct {
+	Storage string // storage name: the library reference, cut to 31 characters
+	Records []record.Record
+}
+
+// ReadLibBytes reads a schematic library (.SchLib) from an in-memory byte
+// slice and returns its symbols in storage order. Libraries are CFB
+// containers, with coordinates in decamils as in a binary .SchDoc.
+func ReadLibBytes(data []byte) ([]LibSymbol, error) {
+	return readLib(bytes.NewReader(data))
+}
+
+// ReadLibFile opens a schematic library (.SchLib) and returns its symbols.
+func ReadLibFile(path string) ([]LibSymbol, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readLib(f)
+}
+
+// readLib reads the Data stream of every storage under the root of a .SchLib
+// (section 2): each one is a symbol. The pin auxiliary streams next to it are
+// not read, so pins are at their rounded LOCATION.
+func readLib(rs io.ReaderAt) ([]LibSymbol, error) {
+	doc, err := mscfb.New(rs)
+	if err != nil {
+		return nil, fmt.Errorf("CFB open: %w", err)
+	}
+
+	var syms []LibSymbol
+	for entry, err := doc.Next(); err == nil; entry, err = doc.Next() {
+		if entry.Name != "Data" || len(entry.Path) != 1 {
+			continue
+		}
+		storage := entry.Path[0]
+		buf := make([]byte, entry.Size)
+		if _, err := io.ReadFull(doc, buf); err != nil {
+			return nil, fmt.Errorf("reading %s/Data: %w", storage, err)
+		}
+		recs, err := parseRecordStream(buf)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s/Data: %w", storage, err)
+		}
+		if len(recs) == 0 || recs[0].Type != record.TypeComponent {
+			continue // not a symbol
+		}
+		syms = append(syms, LibSymbol{Storage: storage, Records: recs})
+	}
+	return syms, nil
+}
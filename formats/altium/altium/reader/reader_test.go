@@ -1,6 +1,8 @@
 package reader
 
 import (
+	"bytes"
+	"encoding/binary"
 	"strings"
 	"testing"
 
@@ -60,3 +62,54 @@ func TestReadFileCFB(t *testing.T) {
 	}
 	t.Logf("total records: %d, components: %d", len(recs), comps)
 }
+
+// A .SchLib Data stream: a text COMPONENT record and a binary pin.
+func TestParseBinaryPin(t *testing.T) {
+	var stream, pin bytes.Buffer
+	le := func(b *bytes.Buffer, v any) { binary.Write(b, binary.LittleEndian, v) }
+	pstr := func(s string) { pin.WriteByte(byte(len(s))); pin.WriteString(s) }
+
+	comp := "|RECORD=1|LIBREFERENCE=OPAMP|PARTCOUNT=2\x00"
+	le(&stream, uint32(len(comp)))
+	stream.WriteString(comp)
+
+	le(&pin, int32(record.TypePin))
+	pin.WriteByte(0)
+	le(&pin, int16(2)) // OWNERPARTID
+	pin.Write([]byte{0, 0, 0, 0, 0})
+	pstr("")
+	pin.Write([]byte{0, 4, 0x18 | 2}) // passive, name and number shown, pointing left
+	le(&pin, int16(3))                // PINLENGTH
+	le(&pin, int16(-2))               // LOCATION.X
+	le(&pin, int16(1))                // LOCATION.Y
+	le(&pin, int32(0))
+	pstr("IN+")
+	pstr("3")
+	pstr("")
+	pin.WriteByte(0)
+	pstr("2|&|3")
+	le(&stream, uint32(pin.Len())|1<<24)
+	stream.Write(pin.Bytes())
+
+	recs, err := parseRecordStream(stream.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 || recs[0].Type != record.TypeComponent || recs[1].Type != record.TypePin {
+		t.Fatalf("records %+v", recs)
+	}
+	p := recs[1]
+	for k, want := range map[string]string{
+		"NAME": "IN+", "DESIGNATOR": "3", "OWNERPARTID": "2", "ELECTRICAL": "4",
+		"PINCONGLOMERATE": "26", "PINLENGTH": "3", "LOCATION.X": "-2", "LOCATION.Y": "1",
+	} {
+		if got := p.Str(k); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+
+	// Binary payloads that are not pins are still skipped.
+	if _, ok := parseBinaryPin([]byte{1, 0, 0, 0, 0}); ok {
+		t.Error("non-pin decoded as pin")
+	}
+}
@@ -0,0 +1,124 @@
+// Package altiumtype registers Altium schematic (.SchDoc) and PCB (.PcbDoc)
+// files with golib/fn/filetype, so that their components can be addressed by
+// path. Blank import it to enable:
+//
+//	import _ "github.com/rveen/golib/formats/altium/altiumtype"
+//
+// Components are listed by designator:
+//
+//	fn.Get("board.SchDoc/R12/value")
+//	fn.Get("board.PcbDoc/U1/footprint")
+package altiumtype
+
+import (
+	"fmt"
+
+	"github.com/rveen/golib/document"
+	"github.com/rveen/golib/fn/filetype"
+	"github.com/rveen/golib/formats/altium/altium/mapper"
+	"github.com/rveen/golib/formats/altium/altium/pcbmapper"
+	"github.com/rveen/golib/formats/altium/altium/pcbreader"
+	"github.com/rveen/golib/formats/altium/altium/reader"
+	"github.com/rveen/ogdl"
+)
+
+func init() {
+	filetype.Register(".schdoc", &filetype.Handler{Type: "schematic", Parse: parseSch})
+	filetype.Register(".pcbdoc", &filetype.Handler{Type: "pcb", Parse: parsePcb})
+}
+
+// parseSch returns the components of a schematic:
+//
+//	R12
+//	  value 10k
+//	  symbol RES_1
+//	  footprint R0603
+//	  fields
+//	    Comment 10k
+//	    Footprint 0603
+//
+// Parts of multi-part components are listed once.
+func parseSch(b []byte) (*ogdl.Graph, *document.Document, error) {
+
+	records, isBinary, err := reader.ReadBytes(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading schematic: %w", err)
+	}
+
+	coordScale := 1
+	if isBinary {
+		coordScale = 10
+	}
+
+	sch, _, err := mapper.Map(records, "", "", coordScale)
+	if err != nil {
+		return nil, nil, fmt.Errorf("mapping schematic: %w", err)
+	}
+
+	g := ogdl.New(nil)
+
+	for _, sheet := range sch.Sheets {
+		for _, c := range sheet.Components {
+			if c.Designator == "" || g.Node(c.Designator) != nil {
+				continue
+			}
+			n := g.Add(c.Designator)
+			if v, _, ok := c.Value(); ok {
+				n.Add("value").Add(v)
+			}
+			n.Add("symbol").Add(string(c.Symbol))
+			if c.Footprint != "" {
+				n.Add("footprint").Add(c.Footprint)
+			}
+			ff := n.Add("fields")
+			for _, f := range c.Fields {
+				if f.Value != "" {
+					ff.Add(f.Name).Add(f.Value)
+				}
+			}
+		}
+	}
+	return g, nil, nil
+}
+
+// parsePcb returns the components of a PCB:
+//
+//	U1
+//	  footprint SOIC-8
+//	  layer top
+//	  x 12.7
+//	  y 30.48
+//	  rotation 90
+//
+// Coordinates are in millimetres.
+func parsePcb(b []byte) (*ogdl.Graph, *document.Document, error) {
+
+	rb, err := pcbreader.ReadBytes(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading PCB: %w", err)
+	}
+
+	board, _, err := pcbmapper.Map(rb, "")
+	if err != nil {
+		return nil, nil, fmt.Errorf("mapping PCB: %w", err)
+	}
+
+	g := ogdl.New(nil)
+
+	for _, c := range board.Components {
+		if c.Designator == "" {
+			continue
+		}
+		n := g.Add(c.Designator)
+		n.Add("footprint").Add(c.Pattern)
+		if c.Layer == 32 {
+			n.Add("layer").Add("bottom")
+		} else {
+			n.Add("layer").Add("top")
+		}
+		n.Add("x").Add(float64(c.Position.X) / 1e6)
+		n.Add("y").Add(float64(c.Position.Y) / 1e6)
+		n.Add("rotation").Add(c.Rotation)
+	}
+	return g, nil, nil
+}
@@ -1,13 +1,15 @@
 // Command pcbconv reads Altium .PcbDoc files and converts them to KiCad .kicad_pcb.
+// A footprint library (.PcbLib) is converted to a KiCad footprint library, a
+// .pretty directory with one .kicad_mod file per footprint.
 //
 // Usage:
 //
-//	pcbconv [options] file.PcbDoc
+//	pcbconv [options] file.PcbDoc|library.PcbLib
 //
 // Options:
 //
-//	-kicad   convert to .kicad_pcb (default when no mode flag is given)
-//	-i       print storage record counts
+//	-kicad   convert to .kicad_pcb, or .pretty for a library (default when no mode flag is given)
+//	-i       print storage record counts, or the footprints of a library
 //	-out dir output directory (default: directory of input file)
 package main
 
@@ -18,6 +20,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"strings"
 
 	"github.com/rveen/golib/formats/altium/altium/pcbmapper"
 	"github.com/rveen/golib/formats/altium/altium/pcbreader"
@@ -40,7 +43,7 @@ func run() int {
 	memprofile := flag.String("memprofile", "", "write memory profile to file")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: pcbconv [options] file.PcbDoc\n\nOptions:\n")
+		fmt.Fprintf(os.Stderr, "Usage: pcbconv [options] file.PcbDoc|library.PcbLib\n\nOptions:\n")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -74,9 +77,14 @@ func run() int {
 	}
 
 	var err error
+	lib := strings.EqualFold(filepath.Ext(path), ".PcbLib")
 	switch {
+	case *doInfo && lib:
+		err = cmdLibInfo(path)
 	case *doInfo:
 		err = cmdInfo(path)
+	case lib:
+		err = cmdConvertLib(path, *outDir)
 	default:
 		err = cmdConvert(path, *outDir)
 	}
@@ -123,6 +131,19 @@ func cmdInfo(path string) error {
 	return nil
 }
 
+func cmdLibInfo(path string) error {
+	fps, err := pcbreader.ReadLibFile(path)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Footprints: %d\n\n", len(fps))
+	for _, fp := range fps {
+		fmt.Printf("%-32s  pads %3d  tracks %3d  arcs %3d  texts %2d  fills %2d  regions %2d\n",
+			fp.Name, len(fp.Pads), len(fp.Tracks), len(fp.Arcs), len(fp.Texts), len(fp.Fills), len(fp.Regions))
+	}
+	return nil
+}
+
 // ---------- convert ----------
 
 func cmdConvert(path, outDir string) error {
@@ -156,6 +177,37 @@ func cmdConvert(path, outDir string) error {
 	return nil
 }
 
+func cmdConvertLib(path, outDir string) error {
+	fps, err := pcbreader.ReadLibFile(path)
+	if err != nil {
+		return err
+	}
+
+	lib, rep, err := pcbmapper.MapLibrary(fps, path)
+	if err != nil {
+		return err
+	}
+	printReport(rep, "mapper")
+
+	artifacts, rep2, err := kicadpcb.LibraryEmitter{}.Emit(lib, nil)
+	if err != nil {
+		return err
+	}
+	printReport(rep2, "kicadpcb")
+
+	for _, a := range artifacts {
+		outPath := filepath.Join(outDir, a.Name)
+		if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(outPath, a.Data, 0o644); err != nil {
+			return fmt.Errorf("writing %s: %w", outPath, err)
+		}
+		fmt.Printf("wrote %s (%d bytes)\n", outPath, len(a.Data))
+	}
+	return nil
+}
+
 func printReport(rep *emit.Report, stage string) {
 	for _, n := range rep.Notes {
 		sev := "INFO"
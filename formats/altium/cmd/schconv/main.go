@@ -3,11 +3,23 @@
 // Usage:
 //
 //	schconv [options] file.SchDoc
+//	schconv [options] project.PrjPcb
+//	schconv [options] library.SchLib
+//
+// A project is converted as a whole: a KiCad hierarchy with a root sheet named
+// after the project, one file per sheet and a .kicad_pro. A library is
+// converted to a KiCad symbol library (.kicad_sym), or with -sym rendered as a
+// catalog.
 //
 // Options:
 //
-//	-kicad   convert to KiCad .kicad_sch (default when no mode flag is given)
+//	-kicad   convert to KiCad .kicad_sch, or .kicad_sym for a library (default when no mode flag is given)
 //	-svg     convert to SVG
+//	-bom     write the bill of materials as CSV and JSON
+//	-bom-group list  with -bom, the properties the parts of a line have in common, comma-separated (default Value,Footprint,MPN)
+//	-dnp param       with -bom, the parameter that marks a part as not placed (default DNP)
+//	-net fmt write the netlist: kicad (.net), xml, json or spice (.cir)
+//	-sym     render a catalog of the symbols as SVG
 //	-i       print record-type counts
 //	-json    dump all records as JSON
 //	-out dir output directory (default: same directory as the input file)
@@ -20,26 +32,36 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/rveen/golib/formats/altium/altium/mapper"
+	"github.com/rveen/golib/formats/altium/altium/project"
 	"github.com/rveen/golib/formats/altium/altium/reader"
 	"github.com/rveen/golib/formats/altium/altium/record"
 	"github.com/rveen/golib/formats/altium/emit"
+	bomemit "github.com/rveen/golib/formats/altium/emit/bom"
+	"github.com/rveen/golib/formats/altium/emit/generic"
 	kicademit "github.com/rveen/golib/formats/altium/emit/kicad"
+	spiceemit "github.com/rveen/golib/formats/altium/emit/spice"
 	svgemit "github.com/rveen/golib/formats/altium/emit/svg"
 	symcatemit "github.com/rveen/golib/formats/altium/emit/symcat"
+	"github.com/rveen/golib/formats/altium/schema"
 )
 
 func main() {
 	doKicad := flag.Bool("kicad", false, "convert to KiCad .kicad_sch")
 	doSVG := flag.Bool("svg", false, "convert to SVG")
+	doBOM := flag.Bool("bom", false, "write the bill of materials as CSV and JSON")
+	bomGroup := flag.String("bom-group", "", "with -bom, comma-separated properties to group parts by (default Value,Footprint,MPN)")
+	dnp := flag.String("dnp", "", "with -bom, the parameter that marks a part as not placed (default DNP)")
+	netFormat := flag.String("net", "", "write the netlist: kicad, xml, json or spice")
 	doSym := flag.Bool("sym", false, "render symbol catalog SVG")
 	doInfo := flag.Bool("i", false, "print record-type counts")
 	doJSON := flag.Bool("json", false, "dump all records as JSON")
 	outDir := flag.String("out", "", "output directory (default: directory of input file)")
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: schconv [options] file.SchDoc\n\nOptions:\n")
+		fmt.Fprintf(os.Stderr, "Usage: schconv [options] file.SchDoc|project.PrjPcb|library.SchLib\n\nOptions:\n")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -51,7 +73,7 @@ func main() {
 	path := flag.Arg(0)
 
 	// Default to -kicad when no mode flag is given.
-	if !*doKicad && !*doSVG && !*doSym && !*doInfo && !*doJSON {
+	if !*doKicad && !*doSVG && !*doBOM && *netFormat == "" && !*doSym && !*doInfo && !*doJSON {
 		*doKicad = true
 	}
 
@@ -66,11 +88,17 @@ func main() {
 	case *doJSON:
 		err = cmdJSON(path)
 	case *doSVG:
-		err = cmdConvert(path, svgemit.Emitter{}, *outDir)
+		err = cmdConvert(path, svgemit.Emitter{}, nil, *outDir)
+	case *doBOM:
+		err = cmdConvert(path, bomemit.Emitter{}, bomOptions(*bomGroup, *dnp), *outDir)
+	case *netFormat != "":
+		err = cmdNet(path, *netFormat, *outDir)
 	case *doSym:
-		err = cmdConvert(path, symcatemit.Emitter{}, *outDir)
+		err = cmdConvert(path, symcatemit.Emitter{}, nil, *outDir)
+	case isLib(path): // -kicad
+		err = cmdConvert(path, kicademit.SymbolLibEmitter{}, nil, *outDir)
 	default: // -kicad
-		err = cmdConvert(path, kicademit.Emitter{}, *outDir)
+		err = cmdConvert(path, kicademit.Emitter{}, nil, *outDir)
 	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
@@ -146,27 +174,13 @@ func cmdJSON(path string) error {
 
 // ---------- convert ----------
 
-func cmdConvert(path string, emitter emit.Emitter, outDir string) error {
-	records, isBinary, err := reader.ReadFile(path)
+func cmdConvert(path string, emitter emit.Emitter, opts any, outDir string) error {
+	sch, err := load(path)
 	if err != nil {
 		return err
 	}
 
-	base := filepath.Base(path)
-	ext := filepath.Ext(base)
-	name := base[:len(base)-len(ext)]
-
-	coordScale := 1
-	if isBinary {
-		coordScale = 10
-	}
-	sch, rep, err := mapper.Map(records, name, path, coordScale)
-	if err != nil {
-		return err
-	}
-	printReport(rep, "mapper")
-
-	artifacts, rep2, err := emitter.Emit(sch, nil)
+	artifacts, rep2, err := emitter.Emit(sch, opts)
 	if err != nil {
 		return err
 	}
@@ -185,6 +199,84 @@ func cmdConvert(path string, emitter emit.Emitter, outDir string) error {
 	return nil
 }
 
+// cmdNet writes the netlist in the given format.
+func cmdNet(path, format, outDir string) error {
+	switch strings.ToLower(format) {
+	case "kicad":
+		return cmdConvert(path, kicademit.NetlistEmitter{}, nil, outDir)
+	case "xml", "json":
+		return cmdConvert(path, generic.Emitter{}, &generic.Options{Format: format}, outDir)
+	case "spice":
+		return cmdConvert(path, spiceemit.Emitter{}, nil, outDir)
+	}
+	return fmt.Errorf("unknown netlist format %q: kicad, xml, json or spice", format)
+}
+
+// bomOptions returns the BOM options of the -bom-group and -dnp flags; empty
+// flags give the defaults.
+func bomOptions(group, dnp string) *bomemit.Options {
+	o := &bomemit.Options{DNP: strings.TrimSpace(dnp)}
+	for _, g := range strings.Split(group, ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			o.GroupBy = append(o.GroupBy, g)
+		}
+	}
+	return o
+}
+
+// load reads a schematic document, a project or a library.
+func load(path string) (*schema.Schematic, error) {
+	if strings.EqualFold(filepath.Ext(path), ".PrjPcb") {
+		sch, rep, err := project.Load(path)
+		if err != nil {
+			return nil, err
+		}
+		printReport(rep, "project")
+		return sch, nil
+	}
+	if isLib(path) {
+		syms, err := reader.ReadLibFile(path)
+		if err != nil {
+			return nil, err
+		}
+		recs := make([][]record.Record, len(syms))
+		for i, sym := range syms {
+			recs[i] = sym.Records
+		}
+		sch, rep, err := mapper.MapLibrary(recs, path, 10)
+		if err != nil {
+			return nil, err
+		}
+		printReport(rep, "mapper")
+		return sch, nil
+	}
+
+	records, isBinary, err := reader.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	name := base[:len(base)-len(ext)]
+
+	coordScale := 1
+	if isBinary {
+		coordScale = 10
+	}
+	sch, rep, err := mapper.Map(records, name, path, coordScale)
+	if err != nil {
+		return nil, err
+	}
+	printReport(rep, "mapper")
+	return sch, nil
+}
+
+// isLib reports whether path is a schematic library.
+func isLib(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".SchLib")
+}
+
 func printReport(rep *emit.Report, stage string) {
 	for _, n := range rep.Notes {
 		sev := "INFO"
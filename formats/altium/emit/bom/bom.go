@@ -0,0 +1,392 @@
+// Package bom emits the bill of materials of a schema.Schematic: its parts in
+// lines of equal parts, as CSV and JSON files, or as an ogdl.Graph for
+// templates.
+//
+//	b, rep := bom.Build(sch, &bom.Options{GroupBy: []string{"Value", "Footprint"}})
+//	for _, l := range b.Lines {
+//		fmt.Println(l.Quantity, l.Designators, l.Value)
+//	}
+//
+// The parts are the components of each sheet instance (see
+// schema.Schematic.Instances): parts of sheets placed more than once are
+// counted once per instance, with the name of the instance as suffix of the
+// reference (C1_CH1), and multi-part components are counted once. Components
+// with a reference starting with '#' (power ports and other virtual parts)
+// are not parts.
+//
+// The value of a part is its Comment or Value parameter; a comment as =Value
+// refers to the parameter named. The footprint is the current PCB footprint of
+// the component, or else its Footprint parameter.
+package bom
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rveen/golib/formats/altium/emit"
+	"github.com/rveen/golib/formats/altium/schema"
+	"github.com/rveen/ogdl"
+)
+
+// Options configures Build and the Emitter. The zero value, as a nil
+// *Options, gives the defaults.
+type Options struct {
+	// GroupBy are the properties that the parts of a line have in common:
+	// "Value", "Footprint", "Designator" (one line per part) or parameter
+	// names. Default Value, Footprint and MPN.
+	GroupBy []string
+	// DNP is the parameter that marks a part as not placed, when its value is
+	// not empty, 0, no or false. Default "DNP".
+	DNP string
+	// Columns are the parameters listed for each line, in this order. Default
+	// all parameters of the parts, in alphabetical order.
+	Columns []string
+}
+
+// BOM is a bill of materials.
+type BOM struct {
+	Name    string   `json:"name"`
+	Parts   int      `json:"parts"`   // parts to place, without DNP parts
+	Columns []string `json:"columns"` // parameter columns
+	Lines   []*Line  `json:"lines"`
+}
+
+// Line is a group of equal parts.
+type Line struct {
+	Item        int               `json:"item"`
+	Quantity    int               `json:"quantity"`
+	Designators string            `json:"designators"` // as R1-R4,R7
+	Refs        []string          `json:"refs"`
+	Value       string            `json:"value"`
+	Footprint   string            `json:"footprint"`
+	DNP         bool              `json:"dnp"`
+	Fields      map[string]string `json:"fields,omitempty"` // by column
+}
+
+// Emitter implements emit.Emitter for bills of materials. Options are passed
+// as *Options.
+type Emitter struct{}
+
+func (Emitter) Name() string { return "bom" }
+
+// Emit produces the BOM as <name>-bom.csv and <name>-bom.json, where name is
+// the project or the first sheet.
+func (Emitter) Emit(s *schema.Schematic, opts any) ([]emit.Artifact, *emit.Report, error) {
+	o, _ := opts.(*Options)
+	b, rep := Build(s, o)
+
+	js, err := b.JSON()
+	if err != nil {
+		return nil, rep, err
+	}
+	artifacts := []emit.Artifact{
+		{Name: b.Name + "-bom.csv", Data: b.CSV()},
+		{Name: b.Name + "-bom.json", Data: js},
+	}
+	return artifacts, rep, nil
+}
+
+// part is a part with the properties used for grouping and listing.
+type part struct {
+	ref    string
+	c      *schema.Component
+	value  string
+	fp     string
+	dnp    bool
+	params map[string]schema.Field // by lower case name
+}
+
+// Build collects the parts of s in lines. Parts are grouped by the
+// properties in opts.GroupBy and their DNP state; parameters listed that
+// differ between the parts of a line are reported, and listed with their
+// values separated by commas. Lines are sorted by reference, with the DNP
+// lines last.
+func Build(s *schema.Schematic, opts *Options) (*BOM, *emit.Report) {
+
+	o := Options{}
+	if opts != nil {
+		o = *opts
+	}
+	if len(o.GroupBy) == 0 {
+		o.GroupBy = []string{"Value", "Footprint", "MPN"}
+	}
+	if o.DNP == "" {
+		o.DNP = "DNP"
+	}
+
+	rep := &emit.Report{}
+	b := &BOM{Name: s.Name()}
+
+	seen := map[string]bool{}
+	var parts []*part
+	for _, in := range s.Instances() {
+		for _, c := range in.Sheet.Components {
+			ref := in.Ref(c)
+			switch {
+			case c.Designator == "":
+				rep.Add(emit.Warn, c.Prov, "component %s without reference", c.Symbol)
+				continue
+			case strings.HasPrefix(c.Designator, "#") || seen[ref]:
+				continue
+			case strings.Contains(c.Designator, "?"):
+				rep.Add(emit.Warn, c.Prov, "part %s is not annotated", ref)
+			}
+			seen[ref] = true
+			parts = append(parts, newPart(ref, c, o.DNP))
+		}
+	}
+
+	sort.SliceStable(parts, func(i, j int) bool { return schema.NaturalLess(parts[i].ref, parts[j].ref) })
+
+	b.Columns = o.Columns
+	if b.Columns == nil {
+		b.Columns = columns(parts, o.DNP)
+	}
+
+	byKey := map[string]*Line{}
+	lparts := map[*Line][]*part{}
+	for _, p := range parts {
+		key := strconv.FormatBool(p.dnp)
+		for _, g := range o.GroupBy {
+			key += "\x00" + p.get(g)
+		}
+		l := byKey[key]
+		if l == nil {
+			l = &Line{DNP: p.dnp}
+			byKey[key] = l
+			b.Lines = append(b.Lines, l)
+		}
+		l.Refs = append(l.Refs, p.ref)
+		lparts[l] = append(lparts[l], p)
+		if !p.dnp {
+			b.Parts++
+		}
+	}
+
+	sort.SliceStable(b.Lines, func(i, j int) bool {
+		li, lj := b.Lines[i], b.Lines[j]
+		if li.DNP != lj.DNP {
+			return lj.DNP
+		}
+		return schema.NaturalLess(li.Refs[0], lj.Refs[0])
+	})
+
+	for i, l := range b.Lines {
+		l.Item = i + 1
+		l.Quantity = len(l.Refs)
+		l.Designators = Ranges(l.Refs)
+
+		pp := lparts[l]
+		for _, col := range b.Columns {
+			var vals []string
+			for _, p := range pp {
+				if v := p.get(col); v != "" && !slices.Contains(vals, v) {
+					vals = append(vals, v)
+				}
+			}
+			if vals == nil {
+				continue
+			}
+			if len(vals) > 1 {
+				rep.Add(emit.Warn, pp[0].c.Prov, "line %d (%s): different %s: %s", l.Item, l.Designators, col, strings.Join(vals, ", "))
+			}
+			if l.Fields == nil {
+				l.Fields = map[string]string{}
+			}
+			l.Fields[col] = strings.Join(vals, ", ")
+		}
+		// Value and footprint may differ too when not grouped by them.
+		l.Value = join(pp, func(p *part) string { return p.value })
+		l.Footprint = join(pp, func(p *part) string { return p.fp })
+	}
+
+	return b, rep
+}
+
+func newPart(ref string, c *schema.Component, dnp string) *part {
+
+	p := &part{ref: ref, c: c, params: map[string]schema.Field{}}
+	for _, f := range c.Fields {
+		k := strings.ToLower(f.Name)
+		if _, ok := p.params[k]; !ok && f.Name != "" {
+			p.params[k] = f
+		}
+	}
+
+	p.value = c.ResolvedValue()
+	p.fp = c.Footprint
+	if p.fp == "" {
+		p.fp = p.params["footprint"].Value
+	}
+	switch strings.ToLower(strings.TrimSpace(p.params[strings.ToLower(dnp)].Value)) {
+	case "", "0", "n", "no", "f", "false":
+	default:
+		p.dnp = true
+	}
+	return p
+}
+
+// get returns a property of the part, by name (without case).
+func (p *part) get(name string) string {
+	switch strings.ToLower(name) {
+	case "value", "comment":
+		return p.value
+	case "footprint":
+		return p.fp
+	case "designator":
+		return p.ref
+	}
+	return p.params[strings.ToLower(name)].Value
+}
+
+// columns returns the names of the parameters of the parts, without those
+// that are already columns of a line: value, footprint and DNP.
+func columns(parts []*part, dnp string) []string {
+	names := map[string]string{}
+	for _, p := range parts {
+		for k, f := range p.params {
+			if _, ok := names[k]; !ok && f.Value != "" {
+				names[k] = f.Name
+			}
+		}
+	}
+	for _, k := range []string{"comment", "value", "footprint", strings.ToLower(dnp)} {
+		delete(names, k)
+	}
+	var cols []string
+	for _, n := range names {
+		cols = append(cols, n)
+	}
+	sort.Slice(cols, func(i, j int) bool {
+		return strings.ToLower(cols[i]) < strings.ToLower(cols[j])
+	})
+	return cols
+}
+
+func join(pp []*part, get func(*part) string) string {
+	var vals []string
+	for _, p := range pp {
+		if v := get(p); v != "" && !slices.Contains(vals, v) {
+			vals = append(vals, v)
+		}
+	}
+	return strings.Join(vals, ", ")
+}
+
+// CSV returns the BOM as CSV, with a header row.
+func (b *BOM) CSV() []byte {
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(append([]string{"Item", "Quantity", "Designators", "Value", "Footprint", "DNP"}, b.Columns...))
+	for _, l := range b.Lines {
+		dnp := ""
+		if l.DNP {
+			dnp = "DNP"
+		}
+		row := []string{strconv.Itoa(l.Item), strconv.Itoa(l.Quantity), l.Designators, l.Value, l.Footprint, dnp}
+		for _, c := range b.Columns {
+			row = append(row, l.Fields[c])
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// JSON returns the BOM as indented JSON.
+func (b *BOM) JSON() ([]byte, error) {
+	js, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(js, '\n'), nil
+}
+
+// Graph returns the BOM as a graph for templates:
+//
+//	name Board
+//	parts 12
+//	lines
+//	  1
+//	    quantity 4
+//	    designators R1-R4
+//	    value 10k
+//	    footprint R0603
+//	    dnp false
+//	    refs
+//	      R1
+//	      …
+//	    fields
+//	      MPN RC0603FR-0710KL
+func (b *BOM) Graph() *ogdl.Graph {
+
+	g := ogdl.New(nil)
+	g.Add("name").Add(b.Name)
+	g.Add("parts").Add(b.Parts)
+
+	lines := g.Add("lines")
+	for _, l := range b.Lines {
+		n := lines.Add(strconv.Itoa(l.Item))
+		n.Add("quantity").Add(l.Quantity)
+		n.Add("designators").Add(l.Designators)
+		n.Add("value").Add(l.Value)
+		n.Add("footprint").Add(l.Footprint)
+		n.Add("dnp").Add(l.DNP)
+		refs := n.Add("refs")
+		for _, r := range l.Refs {
+			refs.Add(r)
+		}
+		ff := n.Add("fields")
+		for _, c := range b.Columns {
+			if v, ok := l.Fields[c]; ok {
+				ff.Add(c).Add(v)
+			}
+		}
+	}
+	return g
+}
+
+// Ranges returns sorted references as a list with ranges: R1-R4,R7. Runs of
+// three or more consecutive numbers with the same prefix are ranges.
+func Ranges(refs []string) string {
+
+	var out []string
+	for i := 0; i < len(refs); {
+		pre, n, ok := splitRef(refs[i])
+		j := i + 1
+		for ok && j < len(refs) {
+			pj, nj, okj := splitRef(refs[j])
+			if !okj || pj != pre || nj != n+j-i {
+				break
+			}
+			j++
+		}
+		if j-i >= 3 {
+			out = append(out, refs[i]+"-"+refs[j-1])
+		} else {
+			out = append(out, refs[i:j]...)
+		}
+		i = j
+	}
+	return strings.Join(out, ",")
+}
+
+// splitRef splits a reference as R12 in its prefix and number; ok is false
+// for other references, as R1_CH1.
+func splitRef(ref string) (prefix string, n int, ok bool) {
+	i := len(ref)
+	for i > 0 && ref[i-1] >= '0' && ref[i-1] <= '9' {
+		i--
+	}
+	if i == len(ref) || i == 0 || strings.ContainsAny(ref[:i], "0123456789") {
+		return ref, 0, false
+	}
+	n, err := strconv.Atoi(ref[i:])
+	return ref[:i], n, err == nil
+}
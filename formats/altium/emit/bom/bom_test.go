@@ -0,0 +1,122 @@
+package bom_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rveen/golib/formats/altium/altium/project"
+	"github.com/rveen/golib/formats/altium/emit/bom"
+	"github.com/rveen/golib/formats/altium/schema"
+)
+
+func comp(ref string, params ...string) *schema.Component {
+	c := &schema.Component{Symbol: "res", Designator: ref}
+	for i := 0; i+1 < len(params); i += 2 {
+		c.Fields = append(c.Fields, schema.Field{Name: params[i], Value: params[i+1]})
+	}
+	return c
+}
+
+func TestBuild(t *testing.T) {
+	sh := &schema.Sheet{Name: "main", Components: []*schema.Component{
+		comp("R7", "Comment", "10k", "MPN", "RC0603-10K", "Tolerance", "1%"),
+		comp("R2", "Comment", "10k", "MPN", "RC0603-10K", "Tolerance", "5%"),
+		comp("R1", "Comment", "10k", "MPN", "RC0603-10K"),
+		comp("R4", "Comment", "=Value", "Value", "10k", "MPN", "RC0603-10K"),
+		comp("R3", "Comment", "10k", "MPN", "RC0603-10K"),
+		comp("R5", "Comment", "10k", "MPN", "RC0603-10K", "DNP", "yes"),
+		comp("R6", "Comment", "10k", "MPN", "ERJ-3EKF1002V"),
+		comp("R10", "Comment", "10k", "MPN", "RC0603-10K", "DNP", "0"),
+		comp("#PWR1", "Comment", "GND"),
+	}}
+	sh.Components[0].Footprint = "R0603"
+	for _, c := range sh.Components[1:5] {
+		c.Footprint = "R0603"
+	}
+	sh.Components[7].Footprint = "R0603"
+	s := &schema.Schematic{Sheets: []*schema.Sheet{sh}}
+
+	b, rep := bom.Build(s, nil)
+
+	var got []string
+	for _, l := range b.Lines {
+		got = append(got, l.Designators+" "+l.Value+" "+l.Footprint+" "+l.Fields["MPN"])
+	}
+	want := "R1-R4,R7,R10 10k R0603 RC0603-10K|R6 10k  ERJ-3EKF1002V|R5 10k  RC0603-10K"
+	if strings.Join(got, "|") != want {
+		t.Errorf("lines\n%s\nwant\n%s", strings.Join(got, "|"), want)
+	}
+	if b.Parts != 7 || b.Lines[0].Quantity != 6 || !b.Lines[2].DNP || b.Lines[2].Item != 3 {
+		t.Errorf("%d parts, %+v", b.Parts, b.Lines)
+	}
+	if strings.Join(b.Columns, ",") != "MPN,Tolerance" {
+		t.Errorf("columns %q", b.Columns)
+	}
+	if len(rep.Notes) != 1 || rep.Notes[0].Message != "line 1 (R1-R4,R7,R10): different Tolerance: 5%, 1%" {
+		t.Errorf("notes %v", rep.Notes)
+	}
+
+	// One line per part.
+	b, _ = bom.Build(s, &bom.Options{GroupBy: []string{"Designator"}, Columns: []string{"MPN"}})
+	if len(b.Lines) != 8 || b.Lines[1].Designators != "R2" || b.Lines[7].Designators != "R5" {
+		t.Errorf("%d lines", len(b.Lines))
+	}
+
+	csv := string(b.CSV())
+	if !strings.HasPrefix(csv, "Item,Quantity,Designators,Value,Footprint,DNP,MPN\n1,1,R1,10k,R0603,,RC0603-10K\n") ||
+		!strings.HasSuffix(csv, "8,1,R5,10k,,DNP,RC0603-10K\n") {
+		t.Errorf("csv\n%s", csv)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	for _, c := range []struct{ refs, want string }{
+		{"R1 R2", "R1,R2"},
+		{"R1 R2 R3 R5 R6 R7 R8", "R1-R3,R5-R8"},
+		{"C1 C2 C3 D1", "C1-C3,D1"},
+		{"C1_CH1 C1_CH2 C1_CH3", "C1_CH1,C1_CH2,C1_CH3"},
+	} {
+		if got := bom.Ranges(strings.Fields(c.refs)); got != c.want {
+			t.Errorf("%s: %s, want %s", c.refs, got, c.want)
+		}
+	}
+}
+
+// The channel sheet of the demo project is placed twice, so its capacitor
+// is there twice.
+func TestEmitProject(t *testing.T) {
+	s, _, err := project.Load("../../altium/project/testdata/Demo.PrjPcb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts, rep, err := bom.Emitter{}.Emit(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range rep.Notes {
+		t.Errorf("note: %s", n.Message)
+	}
+	if len(artifacts) != 2 || artifacts[0].Name != "Demo-bom.csv" || artifacts[1].Name != "Demo-bom.json" {
+		t.Fatalf("artifacts %v", artifacts)
+	}
+
+	var b bom.BOM
+	if err := json.Unmarshal(artifacts[1].Data, &b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Parts != 3 || len(b.Lines) != 2 {
+		t.Fatalf("%d parts, %d lines", b.Parts, len(b.Lines))
+	}
+	if l := b.Lines[0]; l.Designators != "C1_CH1,C1_CH2" || l.Value != "100n" || l.Quantity != 2 {
+		t.Errorf("line 1 %+v", l)
+	}
+	if l := b.Lines[1]; l.Designators != "R1" || l.Value != "10k" || l.Footprint != "R0603" {
+		t.Errorf("line 2 %+v", l)
+	}
+
+	g := b.Graph()
+	if g.Get("lines.2.footprint").String() != "R0603" {
+		t.Errorf("graph\n%s", g.Text())
+	}
+}
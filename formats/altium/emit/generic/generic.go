@@ -0,0 +1,200 @@
+// Package generic emits the netlist of a schema.Schematic (see package
+// netlist) in a tool-neutral form, as XML or JSON, for scripts and tools such
+// as test-fixture generators:
+//
+//	<netlist name="Board" source="Board.PrjPcb">
+//	  <parts>
+//	    <part ref="R1" value="10k" footprint="R0603" symbol="RES" sheet="/Power">
+//	      <field name="MPN">RC0603FR-0710KL</field>
+//	      <pin number="1" net="GND"></pin>
+//	      <pin number="2" net="VCC_OUT"></pin>
+//	    </part>
+//	  </parts>
+//	  <nets>
+//	    <net name="GND">
+//	      <node ref="R1" pin="1"></node>
+//	    </net>
+//	  </nets>
+//	</netlist>
+//
+// The JSON form has the same structure. Parts are listed once per reference,
+// with the pins of all their units; pins connected to nothing have no net.
+package generic
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/rveen/golib/formats/altium/emit"
+	"github.com/rveen/golib/formats/altium/netlist"
+	"github.com/rveen/golib/formats/altium/schema"
+)
+
+// Options configures the Emitter.
+type Options struct {
+	// Format is "xml" or "json"; by default both are written.
+	Format string
+}
+
+// Netlist is the document written.
+type Netlist struct {
+	XMLName xml.Name `xml:"netlist" json:"-"`
+	Name    string   `xml:"name,attr" json:"name"`
+	Source  string   `xml:"source,attr,omitempty" json:"source,omitempty"`
+	Parts   []*Part  `xml:"parts>part" json:"parts"`
+	Nets    []*Net   `xml:"nets>net" json:"nets"`
+}
+
+// Part is a component, with the net of each of its pins.
+type Part struct {
+	Ref       string   `xml:"ref,attr" json:"ref"`
+	Value     string   `xml:"value,attr,omitempty" json:"value,omitempty"`
+	Footprint string   `xml:"footprint,attr,omitempty" json:"footprint,omitempty"`
+	Symbol    string   `xml:"symbol,attr,omitempty" json:"symbol,omitempty"` // library reference
+	Sheet     string   `xml:"sheet,attr" json:"sheet"`                       // instance path, / at the top
+	Fields    []*Field `xml:"field" json:"fields,omitempty"`
+	Pins      []*Pin   `xml:"pin" json:"pins"`
+}
+
+// Field is a parameter of a part.
+type Field struct {
+	Name  string `xml:"name,attr" json:"name"`
+	Value string `xml:",chardata" json:"value"`
+}
+
+// Pin is a pin of a part and its net.
+type Pin struct {
+	Number string `xml:"number,attr" json:"number"`
+	Name   string `xml:"name,attr,omitempty" json:"name,omitempty"`
+	Net    string `xml:"net,attr,omitempty" json:"net,omitempty"`
+}
+
+// Net is a net and its pins.
+type Net struct {
+	Name  string  `xml:"name,attr" json:"name"`
+	Nodes []*Node `xml:"node" json:"nodes"`
+}
+
+// Node is a pin of a net.
+type Node struct {
+	Ref string `xml:"ref,attr" json:"ref"`
+	Pin string `xml:"pin,attr" json:"pin"`
+}
+
+// Emitter implements emit.Emitter for generic netlists. Options are passed as
+// *Options.
+type Emitter struct{}
+
+func (Emitter) Name() string { return "netlist" }
+
+// Emit produces <name>-net.xml and <name>-net.json, or one of them, where name
+// is that of the project or of the first sheet.
+func (Emitter) Emit(s *schema.Schematic, opts any) ([]emit.Artifact, *emit.Report, error) {
+
+	format := ""
+	if o, _ := opts.(*Options); o != nil {
+		format = strings.ToLower(o.Format)
+	}
+
+	n, rep := Build(s)
+	var artifacts []emit.Artifact
+	if format == "" || format == "xml" {
+		b, err := xml.MarshalIndent(n, "", "  ")
+		if err != nil {
+			return nil, rep, err
+		}
+		b = append([]byte(xml.Header), b...)
+		artifacts = append(artifacts, emit.Artifact{Name: n.Name + "-net.xml", Data: append(b, '\n')})
+	}
+	if format == "" || format == "json" {
+		b, err := json.MarshalIndent(n, "", "  ")
+		if err != nil {
+			return nil, rep, err
+		}
+		artifacts = append(artifacts, emit.Artifact{Name: n.Name + "-net.json", Data: append(b, '\n')})
+	}
+	if artifacts == nil {
+		return nil, rep, fmt.Errorf("unknown netlist format %q", format)
+	}
+	return artifacts, rep, nil
+}
+
+// Build returns the netlist of s.
+func Build(s *schema.Schematic) (*Netlist, *emit.Report) {
+
+	nl, rep := netlist.Build(s)
+	n := &Netlist{Name: s.Name(), Source: s.Meta.SourceFile}
+
+	byRef := map[string]*Part{}
+	pins := map[string]bool{} // ref.pin
+	for _, p := range nl.Parts {
+		c := p.Component
+		if p.Component.Designator == "" || strings.HasPrefix(p.Ref, "#") {
+			continue
+		}
+		part := byRef[p.Ref]
+		if part == nil {
+			part = newPart(p)
+			byRef[p.Ref] = part
+			n.Parts = append(n.Parts, part)
+		}
+		for _, pin := range p.Pins() {
+			if pins[p.Ref+"."+pin.Number] {
+				continue // common to the units
+			}
+			pins[p.Ref+"."+pin.Number] = true
+			gp := &Pin{Number: pin.Number, Name: pin.Name}
+			if pin.Name == pin.Number {
+				gp.Name = ""
+			}
+			if net := nl.NetOf(netlist.Node{Part: p, Pin: pin}); net != nil {
+				gp.Net = net.Name
+			}
+			part.Pins = append(part.Pins, gp)
+		}
+		if len(part.Pins) == 0 && p.Symbol == nil {
+			rep.Add(emit.Warn, c.Prov, "part %s: symbol %s not found", p.Ref, c.Symbol)
+		}
+	}
+
+	for _, net := range nl.Nets {
+		gn := &Net{Name: net.Name}
+		for _, nd := range net.Nodes {
+			gn.Nodes = append(gn.Nodes, &Node{Ref: nd.Part.Ref, Pin: nd.Pin.Number})
+		}
+		n.Nets = append(n.Nets, gn)
+	}
+	return n, rep
+}
+
+func newPart(p *netlist.Part) *Part {
+
+	c := p.Component
+	part := &Part{Ref: p.Ref, Sheet: p.Path, Footprint: c.Footprint}
+	if part.Sheet == "" {
+		part.Sheet = "/"
+	}
+	if p.Symbol != nil {
+		part.Symbol = p.Symbol.LibRef
+	}
+
+	valField := c.ValueField()
+	if valField != nil {
+		part.Value = c.ResolvedValue()
+	}
+	for i := range c.Fields {
+		f := &c.Fields[i]
+		switch {
+		case f == valField || f.Name == "" || f.Value == "":
+		case strings.EqualFold(f.Name, "Footprint"):
+			if part.Footprint == "" {
+				part.Footprint = f.Value
+			}
+		default:
+			part.Fields = append(part.Fields, &Field{Name: f.Name, Value: f.Value})
+		}
+	}
+	return part
+}
@@ -0,0 +1,58 @@
+package generic_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/rveen/golib/formats/altium/altium/project"
+	"github.com/rveen/golib/formats/altium/emit/generic"
+)
+
+func TestEmit(t *testing.T) {
+	s, _, err := project.Load("../../altium/project/testdata/Demo.PrjPcb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts, rep, err := generic.Emitter{}.Emit(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range rep.Notes {
+		t.Errorf("note: %s", n.Message)
+	}
+	if len(artifacts) != 2 || artifacts[0].Name != "Demo-net.xml" || artifacts[1].Name != "Demo-net.json" {
+		t.Fatalf("artifacts %v", artifacts)
+	}
+
+	// Both forms read back the same.
+	var x, j generic.Netlist
+	if err := xml.Unmarshal(artifacts[0].Data, &x); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(artifacts[1].Data, &j); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []generic.Netlist{x, j} {
+		if len(n.Parts) != 3 || len(n.Nets) != 2 {
+			t.Fatalf("%d parts, %d nets", len(n.Parts), len(n.Nets))
+		}
+		r1 := n.Parts[0]
+		if r1.Ref != "R1" || r1.Value != "10k" || r1.Footprint != "R0603" || r1.Sheet != "/Power" {
+			t.Errorf("part %+v", r1)
+		}
+		if len(r1.Pins) != 2 || r1.Pins[0].Net != "GND" || r1.Pins[1].Net != "VCC_OUT" {
+			t.Errorf("pins %+v %+v", r1.Pins[0], r1.Pins[1])
+		}
+		if n.Nets[1].Name != "VCC_OUT" || len(n.Nets[1].Nodes) != 3 || n.Nets[1].Nodes[0].Ref != "C1_CH1" {
+			t.Errorf("net %+v", n.Nets[1])
+		}
+	}
+
+	if artifacts, _, _ := (generic.Emitter{}).Emit(s, &generic.Options{Format: "json"}); len(artifacts) != 1 {
+		t.Errorf("%d artifacts for json", len(artifacts))
+	}
+	if _, _, err := (generic.Emitter{}).Emit(s, &generic.Options{Format: "csv"}); err == nil {
+		t.Error("no error for csv")
+	}
+}
@@ -35,16 +35,21 @@ type Emitter struct{}
 
 func (Emitter) Name() string { return "kicad" }
 
-// Emit produces one .kicad_sch artifact per sheet.
+// Emit produces one .kicad_sch artifact per sheet. A project (Meta.Project
+// set, or sheet symbols resolved to their child sheets) is emitted as one
+// KiCad hierarchy instead, see emitProject.
 func (Emitter) Emit(s *schema.Schematic, _ any) ([]emit.Artifact, *emit.Report, error) {
 	rep := &emit.Report{}
+	if isProject(s) {
+		return emitProject(s, rep), rep, nil
+	}
 	var artifacts []emit.Artifact
 	for i, sh := range s.Sheets {
 		name := sh.Name
 		if name == "" {
 			name = fmt.Sprintf("sheet%d", i+1)
 		}
-		data := renderSheet(sh, s.Symbols, rep)
+		data := renderSheet(sh, s.Symbols, rep, singleSheet(sh))
 		artifacts = append(artifacts, emit.Artifact{
 			Name: name + ".kicad_sch",
 			Data: []byte(data),
@@ -55,12 +60,47 @@ func (Emitter) Emit(s *schema.Schematic, _ any) ([]emit.Artifact, *emit.Report,
 
 // ---------- Sheet renderer ----------
 
-func renderSheet(sh *schema.Sheet, syms map[schema.SymbolID]*schema.Symbol, rep *emit.Report) string {
-	w := &sexprWriter{pageH: mm(convert.PaperDims(sh.Paper).H)}
+// sheetCtx places a sheet file in a design: the project it belongs to, the
+// UUID of the file, and the instance paths of the sheet (one per placement of
+// the sheet in the hierarchy; symbol references are annotated per path).
+type sheetCtx struct {
+	project string
+	uuid    string
+	salt    string
+	root    bool
+	paths   []instPath
+
+	// subs holds the (sheet …) blocks of each resolved sheet symbol; a
+	// repeated channel has one per channel. Other sheet symbols are written
+	// as they are.
+	subs map[*schema.SheetSymbol][]sheetSym
+}
+
+// instPath is one instance of a sheet: its path of sheet UUIDs from the root,
+// the suffix of the references in it (for repeated channels), and its page.
+type instPath struct {
+	path   string
+	suffix string
+	page   int
+}
+
+// singleSheet returns the context of a sheet emitted on its own, as the root
+// of a one-sheet design.
+func singleSheet(sh *schema.Sheet) *sheetCtx {
+	projName := sh.Name
+	if projName == "" {
+		projName = "schconv"
+	}
+	u := sheetUUID(sh.Name)
+	return &sheetCtx{project: projName, uuid: u, root: true, paths: []instPath{{path: "/" + u, page: 1}}}
+}
+
+func renderSheet(sh *schema.Sheet, syms map[schema.SymbolID]*schema.Symbol, rep *emit.Report, ctx *sheetCtx) string {
+	w := &sexprWriter{pageH: mm(convert.PaperDims(sh.Paper).H), salt: ctx.salt}
 	w.open("kicad_sch")
 	w.attr("version", version)
 	w.attr("generator", `"schconv"`)
-	w.writeUUID(sheetUUID(sh.Name))
+	w.writeUUID(ctx.uuid)
 	writePaper(w, sh.Paper)
 
 	// lib_symbols block — sorted for deterministic output.
@@ -116,13 +156,8 @@ func renderSheet(sh *schema.Sheet, syms map[schema.SymbolID]*schema.Symbol, rep
 	for _, p := range sh.Ports {
 		writePort(w, sh, p, connPts)
 	}
-	projName := sh.Name
-	if projName == "" {
-		projName = "schconv"
-	}
-	rootUUID := sheetUUID(sh.Name)
 	for _, pp := range sh.PowerPorts {
-		writePowerPortInstance(w, sh, pp, projName, rootUUID)
+		writePowerPortInstance(w, sh, pp, ctx)
 	}
 	// Instances.
 	for _, comp := range sh.Components {
@@ -131,18 +166,27 @@ func renderSheet(sh *schema.Sheet, syms map[schema.SymbolID]*schema.Symbol, rep
 			rep.Add(emit.Warn, comp.Prov, "symbol %s not found for %q", comp.Symbol, comp.Designator)
 			continue
 		}
-		writeSymbolInstance(w, sh, comp, sym, projName, rootUUID)
+		writeSymbolInstance(w, sh, comp, sym, ctx)
 	}
 	// Hierarchical sheet symbols (references to child sheets).
 	for _, ss := range sh.SubSheets {
-		writeSheetSymbol(w, ss)
+		blocks, ok := ctx.subs[ss]
+		if !ok {
+			blocks = []sheetSym{plainSheetSym(w, ss)}
+		}
+		for _, b := range blocks {
+			writeSheetSymbol(w, ss, b, ctx.project)
+		}
 	}
 
 	// Sheet instances: required for KiCad to treat the sheet as the root and to
-	// assign a page number.
-	w.open("sheet_instances")
-	w.line(`(path "/" (page "1"))`)
-	w.close()
+	// assign a page number. The pages of the other sheets are given by the
+	// (sheet …) blocks that place them.
+	if ctx.root {
+		w.open("sheet_instances")
+		w.line(`(path "/" (page "1"))`)
+		w.close()
+	}
 
 	w.close()
 	return w.String()
@@ -171,8 +215,22 @@ func symLibID(sym *schema.Symbol) string {
 
 func writeLibSymbol(w *sexprWriter, sym *schema.Symbol, rep *emit.Report) {
 	localName := symLocalName(sym)
-	libID := "converted:" + localName
+	writeSymbolDef(w, sym, "converted:"+localName, localName, []libProp{
+		{name: "Reference", value: "?", y: 3.81},
+		{name: "Value", value: sym.LibRef, y: -3.81},
+	}, rep)
+}
 
+// libProp is a property of a symbol definition.
+type libProp struct {
+	name, value string
+	y           float64
+	hide        bool
+}
+
+// writeSymbolDef writes the definition of a symbol as libID, with its
+// sub-symbols named after localName, and the given properties.
+func writeSymbolDef(w *sexprWriter, sym *schema.Symbol, libID, localName string, props []libProp, rep *emit.Report) {
 	// KiCad controls name/number visibility primarily at the symbol level via
 	// pin_names/pin_numbers; per-pin hide in effects is not reliably respected.
 	// Derive global visibility from whether every pin wants the text hidden.
@@ -198,8 +256,9 @@ func writeLibSymbol(w *sexprWriter, sym *schema.Symbol, rep *emit.Report) {
 	}
 	w.line("(in_bom yes)")
 	w.line("(on_board yes)")
-	writeProp(w, "Reference", "?", 0, 3.81, false)
-	writeProp(w, "Value", sym.LibRef, 0, -3.81, false)
+	for _, p := range props {
+		writeProp(w, p.name, p.value, 0, p.y, p.hide)
+	}
 
 	// Body graphics in sub-symbol localName_0_1.
 	w.open("symbol", q(localName+"_0_1"))
@@ -416,13 +475,47 @@ func writeSheetGraphic(w *sexprWriter, g schema.Graphic) {
 
 // ---------- Hierarchical sheet symbols ----------
 
+// sheetSym is one (sheet …) block of a sheet symbol: its name, file and UUID,
+// and the page of the child sheet under each instance path of the parent.
+type sheetSym struct {
+	name  string
+	file  string
+	uuid  string
+	pages []instPath
+}
+
+// plainSheetSym returns the (sheet …) block of a sheet symbol as it is in the
+// Altium sheet, with the file name changed to .kicad_sch.
+func plainSheetSym(w *sexprWriter, ss *schema.SheetSymbol) sheetSym {
+	name := ss.Name
+	if name == "" {
+		name = "Sheet"
+	}
+	return sheetSym{
+		name: name,
+		file: kicadFileName(ss.FileName),
+		uuid: w.uuid("sheet:" + ss.Name + ":" + ss.FileName),
+	}
+}
+
+// kicadFileName changes the extension of an Altium sheet file to .kicad_sch.
+func kicadFileName(file string) string {
+	if file != "" && !strings.HasSuffix(strings.ToLower(file), ".kicad_sch") {
+		file = strings.TrimSuffix(file, ".SchDoc")
+		file = strings.TrimSuffix(file, ".schdoc") + ".kicad_sch"
+	}
+	return file
+}
+
 // writeSheetSymbol emits an Altium sheet symbol as a KiCad (sheet …) block: the
-// box, its Sheetname/Sheetfile properties, and one (pin …) per sheet entry.
+// box, its Sheetname/Sheetfile properties, and one (pin …) per sheet entry. In
+// a project the block ends with the page of the child under each instance of
+// the parent.
 //
 // KiCad's (at …) is the box top-left corner. In the schema (Y-up) that corner
 // is (Box.Min.X, Box.Max.Y); after the ky flip it becomes the visually top-left
 // point of the box in the KiCad (Y-down) sheet frame.
-func writeSheetSymbol(w *sexprWriter, ss *schema.SheetSymbol) {
+func writeSheetSymbol(w *sexprWriter, ss *schema.SheetSymbol, sym sheetSym, project string) {
 	atX, atY := w.kx(ss.Box.Min.X), w.ky(ss.Box.Max.Y)
 	width := mm(ss.Box.Max.X - ss.Box.Min.X)
 	height := mm(ss.Box.Max.Y - ss.Box.Min.Y)
@@ -437,24 +530,25 @@ func writeSheetSymbol(w *sexprWriter, ss *schema.SheetSymbol) {
 	w.line("(fields_autoplaced yes)")
 	writeSheetStroke(w, ss.Style)
 	writeSheetFill(w, ss.Fill)
-	w.writeUUID(makeUUID("sheet:" + ss.Name + ":" + ss.FileName))
+	w.writeUUID(sym.uuid)
 
 	// The sheet name label sits just above the box top edge; the file name is
 	// hidden, anchored at the corner. KiCad re-places these (fields_autoplaced).
-	name := ss.Name
-	if name == "" {
-		name = "Sheet"
-	}
-	file := ss.FileName
-	if file != "" && !strings.HasSuffix(strings.ToLower(file), ".kicad_sch") {
-		file = strings.TrimSuffix(file, ".SchDoc")
-		file = strings.TrimSuffix(file, ".schdoc") + ".kicad_sch"
-	}
-	writeSheetProp(w, "Sheetname", name, atX, atY-0.508, false)
-	writeSheetProp(w, "Sheetfile", file, atX, atY, true)
+	writeSheetProp(w, "Sheetname", sym.name, atX, atY-0.508, false)
+	writeSheetProp(w, "Sheetfile", sym.file, atX, atY, true)
 
 	for _, e := range ss.Entries {
-		writeSheetPin(w, ss, e)
+		writeSheetPin(w, ss, e, sym.name)
+	}
+
+	if len(sym.pages) > 0 {
+		w.open("instances")
+		w.open("project", q(project))
+		for _, p := range sym.pages {
+			w.line(fmt.Sprintf("(path %s (page %s))", q(p.path), q(fmt.Sprint(p.page))))
+		}
+		w.close() // project
+		w.close() // instances
 	}
 	w.close()
 }
@@ -477,7 +571,7 @@ func writeSheetProp(w *sexprWriter, name, value string, x, y float64, hide bool)
 // justification follow the box edge the entry sits on, with the label always
 // pointing away from the box: left edge → angle 180/left, right edge → angle
 // 0/right, top edge → angle 90/right, bottom edge → angle 270/left.
-func writeSheetPin(w *sexprWriter, ss *schema.SheetSymbol, e schema.SheetEntry) {
+func writeSheetPin(w *sexprWriter, ss *schema.SheetSymbol, e schema.SheetEntry, name string) {
 	angle, hjust := 180, -1 // left edge
 	switch {
 	case e.Pos.X == ss.Box.Max.X: // right edge
@@ -489,7 +583,7 @@ func writeSheetPin(w *sexprWriter, ss *schema.SheetSymbol, e schema.SheetEntry)
 	}
 	w.open("pin", q(convert.OverbarAltiumToKicad(e.Name)), sheetPinShape(e.Direction))
 	w.line(fmt.Sprintf("(at %s %s %d)", f(w.kx(e.Pos.X)), f(w.ky(e.Pos.Y)), angle))
-	w.writeUUID(makeUUID(fmt.Sprintf("sheetpin:%s:%d:%d:%s", ss.Name, e.Pos.X, e.Pos.Y, e.Name)))
+	w.writeUUID(w.uuid(fmt.Sprintf("sheetpin:%s:%d:%d:%s", name, e.Pos.X, e.Pos.Y, e.Name)))
 	w.line(fmt.Sprintf("(effects (font (size 1.27 1.27))%s)", justifyClause(hjust, 0)))
 	w.close()
 }
@@ -535,7 +629,7 @@ func writeWire(w *sexprWriter, wire *schema.Wire) {
 		w.line(fmt.Sprintf("(pts (xy %s %s) (xy %s %s))",
 			f(w.kx(a.X)), f(w.ky(a.Y)), f(w.kx(b.X)), f(w.ky(b.Y))))
 		w.line("(stroke (width 0) (type default))")
-		w.writeUUID(makeUUID(fmt.Sprintf("wire:%d:%d:%d:%d", a.X, a.Y, b.X, b.Y)))
+		w.writeUUID(w.uuid(fmt.Sprintf("wire:%d:%d:%d:%d", a.X, a.Y, b.X, b.Y)))
 		w.close()
 	}
 }
@@ -547,7 +641,7 @@ func writeBus(w *sexprWriter, bus *schema.Bus) {
 		w.line(fmt.Sprintf("(pts (xy %s %s) (xy %s %s))",
 			f(w.kx(a.X)), f(w.ky(a.Y)), f(w.kx(b.X)), f(w.ky(b.Y))))
 		w.line("(stroke (width 0) (type bus))")
-		w.writeUUID(makeUUID(fmt.Sprintf("bus:%d:%d:%d:%d", a.X, a.Y, b.X, b.Y)))
+		w.writeUUID(w.uuid(fmt.Sprintf("bus:%d:%d:%d:%d", a.X, a.Y, b.X, b.Y)))
 		w.close()
 	}
 }
@@ -557,7 +651,7 @@ func writeJunction(w *sexprWriter, j schema.Point) {
 	w.line(fmt.Sprintf("(at %s %s)", f(w.kx(j.X)), f(w.ky(j.Y))))
 	w.line("(diameter 0)")
 	w.line("(color 0 0 0 0)")
-	w.writeUUID(makeUUID(fmt.Sprintf("jct:%d:%d", j.X, j.Y)))
+	w.writeUUID(w.uuid(fmt.Sprintf("jct:%d:%d", j.X, j.Y)))
 	w.close()
 }
 
@@ -566,7 +660,7 @@ func writeNetLabel(w *sexprWriter, sh *schema.Sheet, nl *schema.NetLabel) {
 	w.open("label", q(convert.OverbarAltiumToKicad(nl.Text)))
 	w.line(fmt.Sprintf("(at %s %s %d)", f(w.kx(nl.Pos.X)), f(w.ky(nl.Pos.Y)), angle))
 	w.line(fmt.Sprintf("(effects (font %s)%s)", fontSize(sh.FontHeight(nl.Font)), justifyClause(h, v)))
-	w.writeUUID(makeUUID(fmt.Sprintf("nl:%d:%d:%s", nl.Pos.X, nl.Pos.Y, nl.Text)))
+	w.writeUUID(w.uuid(fmt.Sprintf("nl:%d:%d:%s", nl.Pos.X, nl.Pos.Y, nl.Text)))
 	w.close()
 }
 
@@ -625,7 +719,7 @@ func writePort(w *sexprWriter, sh *schema.Sheet, p *schema.Port, connPts map[sch
 	w.line(fmt.Sprintf("(shape %s)", portShape(p.Direction)))
 	w.line(fmt.Sprintf("(at %s %s %d)", f(w.kx(conn.X)), f(w.ky(conn.Y)), angle))
 	w.line(fmt.Sprintf("(effects (font %s)%s)", fontSize(sh.FontHeight(p.Font)), justifyClause(h, 0)))
-	w.writeUUID(makeUUID(fmt.Sprintf("port:%d:%d:%s", p.Pos.X, p.Pos.Y, p.Name)))
+	w.writeUUID(w.uuid(fmt.Sprintf("port:%d:%d:%s", p.Pos.X, p.Pos.Y, p.Name)))
 	w.close()
 }
 
@@ -774,20 +868,28 @@ func powerLabelDistance(style schema.PowerStyle) float64 {
 }
 
 // writeInstances emits the (instances …) block that binds a symbol placement to
-// a reference designator on the root sheet. Without this block KiCad treats the
-// symbol as unannotated and ignores the Reference property text.
-func writeInstances(w *sexprWriter, projName, rootUUID, ref string, unit int) {
+// a reference designator in each instance of the sheet. Without this block
+// KiCad treats the symbol as unannotated and ignores the Reference property
+// text. References in repeated channels get the suffix of the channel; power
+// symbols (#PWR) are left for KiCad to annotate.
+func writeInstances(w *sexprWriter, ctx *sheetCtx, ref string, unit int) {
 	w.open("instances")
-	w.open("project", q(projName))
-	w.open("path", q("/"+rootUUID))
-	w.line(fmt.Sprintf("(reference %s) (unit %d)", q(ref), unit))
-	w.close() // path
+	w.open("project", q(ctx.project))
+	for _, p := range ctx.paths {
+		r := ref
+		if !strings.HasPrefix(ref, "#") {
+			r += p.suffix
+		}
+		w.open("path", q(p.path))
+		w.line(fmt.Sprintf("(reference %s) (unit %d)", q(r), unit))
+		w.close() // path
+	}
 	w.close() // project
 	w.close() // instances
 }
 
 // writePowerPortInstance emits a power port as a proper KiCad power symbol instance.
-func writePowerPortInstance(w *sexprWriter, sh *schema.Sheet, pp *schema.PowerPort, projName, rootUUID string) {
+func writePowerPortInstance(w *sexprWriter, sh *schema.Sheet, pp *schema.PowerPort, ctx *sheetCtx) {
 	libID := powerLibID(pp.NetName)
 	x := w.kx(pp.Pos.X)
 	y := w.ky(pp.Pos.Y)
@@ -806,7 +908,7 @@ func writePowerPortInstance(w *sexprWriter, sh *schema.Sheet, pp *schema.PowerPo
 	w.line("(unit 1)")
 	w.line("(in_bom no)")
 	w.line("(on_board yes)")
-	w.writeUUID(makeUUID(fmt.Sprintf("pp:%d:%d:%s", pp.Pos.X, pp.Pos.Y, pp.NetName)))
+	w.writeUUID(w.uuid(fmt.Sprintf("pp:%d:%d:%s", pp.Pos.X, pp.Pos.Y, pp.NetName)))
 
 	// Reference property: always hidden.
 	writePropAt(w, "Reference", "#PWR", x, y, 0, 0, 0, schema.DefaultFontHeight, true)
@@ -820,10 +922,10 @@ func writePowerPortInstance(w *sexprWriter, sh *schema.Sheet, pp *schema.PowerPo
 	writePropAt(w, "Value", convert.OverbarAltiumToKicad(pp.NetName), x, y, 0, 0, 0, sh.FontHeight(pp.Font), true)
 
 	w.open("pin", q("1"))
-	w.writeUUID(makeUUID(fmt.Sprintf("pp_pin:%d:%d:%s", pp.Pos.X, pp.Pos.Y, pp.NetName)))
+	w.writeUUID(w.uuid(fmt.Sprintf("pp_pin:%d:%d:%s", pp.Pos.X, pp.Pos.Y, pp.NetName)))
 	w.close()
 
-	writeInstances(w, projName, rootUUID, "#PWR", 1)
+	writeInstances(w, ctx, "#PWR", 1)
 
 	w.close() // symbol
 
@@ -847,7 +949,7 @@ func writePowerPortLabel(w *sexprWriter, sh *schema.Sheet, pp *schema.PowerPort)
 	w.open("text", q(convert.OverbarAltiumToKicad(pp.NetName)))
 	w.line(fmt.Sprintf("(at %s %s 0)", f(w.kx(lx)), f(w.ky(ly))))
 	w.line(fmt.Sprintf("(effects (font %s)%s)", fontSize(sh.FontHeight(pp.Font)), justifyClause(h, v)))
-	w.writeUUID(makeUUID(fmt.Sprintf("pp_lbl:%d:%d:%s", pp.Pos.X, pp.Pos.Y, pp.NetName)))
+	w.writeUUID(w.uuid(fmt.Sprintf("pp_lbl:%d:%d:%s", pp.Pos.X, pp.Pos.Y, pp.NetName)))
 	w.close()
 }
 
@@ -874,7 +976,7 @@ func writeText(w *sexprWriter, sh *schema.Sheet, t *schema.Text) {
 	w.open("text", q(t.Content))
 	w.line(fmt.Sprintf("(at %s %s %d)", f(w.kx(t.Pos.X)), f(w.ky(t.Pos.Y)), angle))
 	w.line(fmt.Sprintf("(effects (font %s)%s)", fontSize(sh.FontHeight(t.Font)), justifyClause(h, v)))
-	w.writeUUID(makeUUID(fmt.Sprintf("txt:%d:%d:%s", t.Pos.X, t.Pos.Y, t.Content)))
+	w.writeUUID(w.uuid(fmt.Sprintf("txt:%d:%d:%s", t.Pos.X, t.Pos.Y, t.Content)))
 	w.close()
 }
 
@@ -886,7 +988,7 @@ func fontSize(h schema.Length) string {
 
 // ---------- Symbol instance ----------
 
-func writeSymbolInstance(w *sexprWriter, sh *schema.Sheet, comp *schema.Component, sym *schema.Symbol, projName, rootUUID string) {
+func writeSymbolInstance(w *sexprWriter, sh *schema.Sheet, comp *schema.Component, sym *schema.Symbol, ctx *sheetCtx) {
 	libID := symLibID(sym)
 	x := w.kx(comp.Position.X)
 	y := w.ky(comp.Position.Y)
@@ -917,7 +1019,7 @@ func writeSymbolInstance(w *sexprWriter, sh *schema.Sheet, comp *schema.Componen
 	w.line("(in_bom yes)")
 	w.line("(on_board yes)")
 	w.line("(dnp no)")
-	w.writeUUID(makeUUID(fmt.Sprintf("comp:%s:%d", comp.Designator, comp.Prov.Record)))
+	w.writeUUID(w.uuid(compSeed(comp)))
 
 	// Field text angle/justification are absolute in the KiCad file (KiCad does
 	// not re-rotate property text by the symbol's placement angle). Altium also
@@ -967,11 +1069,11 @@ func writeSymbolInstance(w *sexprWriter, sh *schema.Sheet, comp *schema.Componen
 	// (and stubs) silently invisible even though the lib_symbol defines them.
 	for _, p := range sym.Pins {
 		w.open("pin", q(p.Number))
-		w.writeUUID(makeUUID(fmt.Sprintf("comppin:%s:%d:%s", comp.Designator, comp.Prov.Record, p.Number)))
+		w.writeUUID(w.uuid(fmt.Sprintf("comppin:%s:%d:%s", comp.Designator, comp.Prov.Record, p.Number)))
 		w.close()
 	}
 
-	writeInstances(w, projName, rootUUID, comp.Designator, instUnit)
+	writeInstances(w, ctx, comp.Designator, instUnit)
 
 	w.close()
 }
@@ -1136,18 +1238,8 @@ func ptsStr(pts []schema.Point) string {
 // p.Position is the body-attachment end; the connection end is offset by
 // PinLength in the pin's outward direction.
 func pinConnectionEnd(p *schema.Pin) (schema.Length, schema.Length) {
-	x, y, l := p.Position.X, p.Position.Y, p.PinLength
-	switch p.Orientation {
-	case schema.DirRight:
-		return x + l, y
-	case schema.DirLeft:
-		return x - l, y
-	case schema.DirUp:
-		return x, y + l
-	case schema.DirDown:
-		return x, y - l
-	}
-	return x, y
+	e := p.Hotspot()
+	return e.X, e.Y
 }
 
 // ---------- Pin rotation table ----------
@@ -1204,6 +1296,11 @@ func makeUUID(s string) string {
 
 func sheetUUID(name string) string { return makeUUID("sheet:" + name) }
 
+// compSeed is the seed of the UUID of a symbol instance.
+func compSeed(comp *schema.Component) string {
+	return fmt.Sprintf("comp:%s:%d", comp.Designator, comp.Prov.Record)
+}
+
 // ---------- Misc ----------
 
 var nonAlnum = regexp.MustCompile(`[^A-Za-z0-9_]`)
@@ -1224,6 +1321,7 @@ type sexprWriter struct {
 	b     strings.Builder
 	depth int
 	pageH float64 // KiCad page height in mm, for the sheet-frame Y flip
+	salt  string  // prefix of uuid seeds, unique per file of a project
 }
 
 func (w *sexprWriter) indent() string { return strings.Repeat("\t", w.depth) }
@@ -1250,6 +1348,11 @@ func (w *sexprWriter) line(s string) {
 	w.b.WriteString(w.indent() + s + "\n")
 }
 
+// uuid returns the deterministic UUID of an element of the file. The salt
+// keeps equal elements of different sheet files (a wire at the same place,
+// say) from sharing a UUID in a project.
+func (w *sexprWriter) uuid(s string) string { return makeUUID(w.salt + s) }
+
 func (w *sexprWriter) writeUUID(u string) {
 	w.b.WriteString(w.indent() + `(uuid "` + u + `")` + "\n")
 }
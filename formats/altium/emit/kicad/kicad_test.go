@@ -1,14 +1,18 @@
 package kicad_test
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
 
 	"github.com/rveen/golib/formats/altium/altium/mapper"
+	"github.com/rveen/golib/formats/altium/altium/project"
 	"github.com/rveen/golib/formats/altium/altium/reader"
 	kicademit "github.com/rveen/golib/formats/altium/emit/kicad"
+	"github.com/rveen/golib/formats/altium/schema"
 )
 
 func TestEmitFromTestSchDoc(t *testing.T) {
@@ -105,3 +109,229 @@ func TestMakeUUIDDeterministic(t *testing.T) {
 		t.Error("KiCad emitter is not deterministic")
 	}
 }
+
+func TestEmitProject(t *testing.T) {
+	sch, _, err := project.Load("../../altium/project/testdata/Demo.PrjPcb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts, rep, err := kicademit.Emitter{}.Emit(sch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range rep.Notes {
+		t.Logf("emit note: %s", n.Message)
+	}
+
+	files := map[string]string{}
+	var names []string
+	for _, a := range artifacts {
+		files[a.Name] = string(a.Data)
+		names = append(names, a.Name)
+	}
+	want := []string{"Demo.kicad_sch", "Power.kicad_sch", "Channel.kicad_sch", "Demo.kicad_pro"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("artifacts %q, want %q", names, want)
+	}
+
+	// The root places Power once and Channel twice (CH1, CH2), on pages 2-4.
+	root := files["Demo.kicad_sch"]
+	rootUUID := uuidRe.FindStringSubmatch(root)[1]
+	if !strings.Contains(root, `(sheet_instances`) {
+		t.Error("root without sheet_instances")
+	}
+	sheets := map[string]string{} // name -> uuid
+	for _, m := range sheetRe.FindAllStringSubmatch(root, -1) {
+		sheets[m[2]] = m[1]
+	}
+	for i, name := range []string{"Power", "CH1", "CH2"} {
+		if sheets[name] == "" {
+			t.Fatalf("no sheet %s in root", name)
+		}
+		if !strings.Contains(root, fmt.Sprintf(`(path "/%s" (page "%d"))`, rootUUID, i+2)) {
+			t.Errorf("no page %d", i+2)
+		}
+	}
+	if strings.Count(root, `(property "Sheetfile" "Channel.kicad_sch"`) != 2 {
+		t.Error("Channel not placed twice")
+	}
+
+	// Each instance of a sheet annotates its symbols under its own path.
+	for _, c := range []struct{ file, sheet, ref string }{
+		{"Power.kicad_sch", "Power", "R1"},
+		{"Channel.kicad_sch", "CH1", "C1_CH1"},
+		{"Channel.kicad_sch", "CH2", "C1_CH2"},
+	} {
+		p := fmt.Sprintf("(path \"/%s/%s\"\n\t\t\t\t\t(reference %q)", rootUUID, sheets[c.sheet], c.ref)
+		if !strings.Contains(files[c.file], p) {
+			t.Errorf("%s: no %s in %s", c.file, c.ref, c.sheet)
+		}
+	}
+
+	// UUIDs are unique in the project.
+	seen := map[string]string{}
+	for _, name := range want[:3] {
+		for _, m := range uuidRe.FindAllStringSubmatch(files[name], -1) {
+			if f, ok := seen[m[1]]; ok {
+				t.Errorf("uuid %s in %s and %s", m[1], f, name)
+			}
+			seen[m[1]] = name
+		}
+	}
+
+	if !strings.Contains(files["Demo.kicad_pro"], rootUUID) {
+		t.Error("project file without root sheet")
+	}
+}
+
+var (
+	uuidRe  = regexp.MustCompile(`\(uuid "([^"]+)"\)`)
+	sheetRe = regexp.MustCompile(`\(uuid "([^"]+)"\)\n\t\t\(property "Sheetname" "([^"]+)"`)
+)
+
+// A flat project gets a root sheet that places each of its sheets.
+func TestEmitFlatProject(t *testing.T) {
+	sch := &schema.Schematic{
+		Sheets: []*schema.Sheet{{Name: "A", FileName: "A.SchDoc"}, {Name: "B", FileName: "B.SchDoc"}},
+		Meta:   schema.Meta{Project: "Flat"},
+	}
+	artifacts, rep, err := kicademit.Emitter{}.Emit(sch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 4 || artifacts[0].Name != "Flat.kicad_sch" || artifacts[2].Name != "B.kicad_sch" {
+		t.Fatalf("%d artifacts", len(artifacts))
+	}
+	root := string(artifacts[0].Data)
+	if strings.Count(root, "(sheet\n") != 2 || !strings.Contains(root, `(property "Sheetfile" "B.kicad_sch"`) {
+		t.Error("sheets not placed on the root")
+	}
+	if len(rep.Notes) != 1 {
+		t.Errorf("notes %v", rep.Notes)
+	}
+}
+
+func TestNetlist(t *testing.T) {
+	sch, _, err := project.Load("../../altium/project/testdata/Demo.PrjPcb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts, rep, err := kicademit.NetlistEmitter{}.Emit(sch, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range rep.Notes {
+		t.Errorf("note: %s", n.Message)
+	}
+	if len(artifacts) != 1 || artifacts[0].Name != "Demo.net" {
+		t.Fatalf("artifacts %v", artifacts)
+	}
+	net := string(artifacts[0].Data)
+	for _, s := range []string{
+		"(comp (ref \"R1\")\n\t\t\t(value \"10k\")\n\t\t\t(footprint \"R0603\")",
+		`(property (name "Sheetfile") (value "Channel.kicad_sch"))`,
+		`(net (code "2") (name "VCC_OUT")`,
+		`(node (ref "C1_CH2") (pin "1") (pintype "passive"))`,
+	} {
+		if !strings.Contains(net, s) {
+			t.Errorf("no %s", s)
+		}
+	}
+
+	// The sheet paths and symbol UUIDs are those of the schematic.
+	files := map[string]string{}
+	sheets, _, _ := kicademit.Emitter{}.Emit(sch, nil)
+	for _, a := range sheets {
+		files[a.Name] = string(a.Data)
+	}
+	root := files["Demo.kicad_sch"]
+	for _, m := range sheetRe.FindAllStringSubmatch(root, -1) {
+		if !strings.Contains(net, fmt.Sprintf("(sheetpath (names \"/%s/\") (tstamps \"/%s/\"))", m[2], m[1])) {
+			t.Errorf("no sheet path for %s", m[2])
+		}
+	}
+	for _, m := range regexp.MustCompile(`\(tstamps "([0-9a-f-]+)"\)`).FindAllStringSubmatch(net, -1) {
+		if !strings.Contains(files["Power.kicad_sch"]+files["Channel.kicad_sch"], m[1]) {
+			t.Errorf("symbol %s not in the schematic", m[1])
+		}
+	}
+
+	// A value as =Param is that of the parameter.
+	for _, sh := range sch.Sheets {
+		for _, c := range sh.Components {
+			if c.Designator == "R1" {
+				c.ValueField().Value = "=Resistance"
+				c.Fields = append(c.Fields, schema.Field{Name: "Resistance", Value: "4k7"})
+			}
+		}
+	}
+	artifacts, _, _ = kicademit.NetlistEmitter{}.Emit(sch, nil)
+	if net := string(artifacts[0].Data); !strings.Contains(net, "(comp (ref \"R1\")\n\t\t\t(value \"4k7\")") {
+		t.Error("=Resistance not resolved")
+	}
+}
+
+func TestSymbolLib(t *testing.T) {
+	const mil = 25400
+	sym := func(id, libRef string) *schema.Symbol {
+		return &schema.Symbol{
+			ID:          schema.SymbolID(id),
+			LibRef:      libRef,
+			Designator:  "R?",
+			Description: "Resistor",
+			Footprint:   "R0603",
+			Fields: []schema.Field{
+				{Name: "Datasheet", Value: "https://example.com/r.pdf"},
+				{Name: "MPN", Value: "RC0603"},
+				{Name: "Value", Value: "10k"},
+			},
+			Pins: []*schema.Pin{
+				{Number: "1", Name: "1", PinLength: 20 * mil, Orientation: schema.DirLeft, NumberVisible: true},
+				{Number: "2", Name: "2", Position: schema.Point{X: 40 * mil}, PinLength: 20 * mil, Orientation: schema.DirRight, NumberVisible: true},
+			},
+		}
+	}
+	s := &schema.Schematic{
+		Symbols: map[schema.SymbolID]*schema.Symbol{
+			"a": sym("a", "RES"),
+			"b": sym("b", "RES"),
+			"c": sym("c", "LED:RED"),
+		},
+		Meta: schema.Meta{SourceFile: "libs/Passives.SchLib"},
+	}
+	s.Symbols["c"].Designator = ""
+
+	artifacts, rep, err := kicademit.SymbolLibEmitter{}.Emit(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 1 || artifacts[0].Name != "Passives.kicad_sym" {
+		t.Fatalf("artifacts %v", artifacts)
+	}
+	if len(rep.Notes) != 1 {
+		t.Errorf("notes %+v", rep.Notes)
+	}
+
+	lib := string(artifacts[0].Data)
+	if !strings.HasPrefix(lib, "(kicad_symbol_lib") {
+		t.Errorf("output starts with %.40q", lib)
+	}
+	for _, s := range []string{
+		`(symbol "LED_RED"`, `(symbol "LED_RED_1_1"`,
+		`(symbol "RES"`, `(symbol "RES_0_1"`, `(symbol "RES_1_1"`, `(symbol "RES_2"`, `(symbol "RES_2_1_1"`,
+		`(property "Reference" "R"`, `(property "Reference" "U"`,
+		`(property "Value" "RES"`, `(property "Footprint" "R0603"`,
+		`(property "Datasheet" "https://example.com/r.pdf"`,
+		`(property "ki_description" "Resistor"`, `(property "MPN" "RC0603"`,
+	} {
+		if !strings.Contains(lib, s) {
+			t.Errorf("no %s in\n%s", s, lib)
+		}
+	}
+	if strings.Contains(lib, `"10k"`) {
+		t.Errorf("Value parameter written\n%s", lib)
+	}
+	if n := strings.Count(lib, "(pin "); n != 6 {
+		t.Errorf("%d pins", n)
+	}
+}
@@ -0,0 +1,126 @@
+package kicad
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rveen/golib/formats/altium/emit"
+	"github.com/rveen/golib/formats/altium/schema"
+)
+
+// ---------- Symbol libraries ----------
+//
+// SymbolLibEmitter writes the symbols of a schematic as a KiCad symbol
+// library. It is meant for the symbols of a library (.SchLib, see
+// mapper.MapLibrary), which carry a default designator, a description, a
+// footprint and parameters; the symbols used in a design work as well. Each
+// symbol is named by its library reference, and its parameters are hidden
+// properties.
+
+// SymbolLibEmitter implements emit.Emitter for KiCad symbol libraries
+// (.kicad_sym).
+type SymbolLibEmitter struct{}
+
+func (SymbolLibEmitter) Name() string { return "kicad-sym" }
+
+// Emit produces one <name>.kicad_sym artifact, where name is that of the
+// project or of the source file.
+func (SymbolLibEmitter) Emit(s *schema.Schematic, _ any) ([]emit.Artifact, *emit.Report, error) {
+	rep := &emit.Report{}
+
+	syms := make([]*schema.Symbol, 0, len(s.Symbols))
+	for _, sym := range s.Symbols {
+		syms = append(syms, sym)
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		if syms[i].LibRef != syms[j].LibRef {
+			return syms[i].LibRef < syms[j].LibRef
+		}
+		return syms[i].ID < syms[j].ID
+	})
+
+	w := &sexprWriter{}
+	w.open("kicad_symbol_lib")
+	w.attr("version", version)
+	w.attr("generator", `"schconv"`)
+	names := make(map[string]bool)
+	for _, sym := range syms {
+		name := libSymName(sym.LibRef)
+		if names[name] {
+			n := 2
+			for names[fmt.Sprintf("%s_%d", name, n)] {
+				n++
+			}
+			rep.Add(emit.Warn, sym.Prov, "symbol %s: name taken, written as %s_%d", sym.LibRef, name, n)
+			name = fmt.Sprintf("%s_%d", name, n)
+		}
+		names[name] = true
+		writeSymbolDef(w, sym, name, name, libSymProps(sym), rep)
+	}
+	w.close()
+
+	return []emit.Artifact{{Name: libName(s) + ".kicad_sym", Data: []byte(w.String())}}, rep, nil
+}
+
+// libSymProps returns the properties of a library symbol: the four that KiCad
+// requires, the description, and the parameters.
+func libSymProps(sym *schema.Symbol) []libProp {
+	ref := strings.TrimRight(sym.Designator, "?")
+	if ref == "" {
+		ref = "U"
+	}
+	datasheet := ""
+	var params []libProp
+	seen := map[string]bool{"reference": true, "value": true, "footprint": true, "datasheet": true, "ki_description": true}
+	for _, f := range sym.Fields {
+		key := strings.ToLower(f.Name)
+		switch {
+		case key == "datasheet":
+			datasheet = f.Value
+		case f.Name == "" || f.Value == "" || seen[key]:
+		default:
+			seen[key] = true
+			params = append(params, libProp{name: f.Name, value: f.Value, hide: true})
+		}
+	}
+
+	props := []libProp{
+		{name: "Reference", value: ref, y: 3.81},
+		{name: "Value", value: sym.LibRef, y: -3.81},
+		{name: "Footprint", value: sym.Footprint, hide: true},
+		{name: "Datasheet", value: datasheet, hide: true},
+	}
+	if sym.Description != "" {
+		props = append(props, libProp{name: "ki_description", value: sym.Description, hide: true})
+	}
+	return append(props, params...)
+}
+
+// libSymName returns a library reference as a KiCad symbol name, without the
+// characters that KiCad does not take in one.
+func libSymName(libRef string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`:\<>"`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(libRef))
+	if name == "" {
+		return "unnamed"
+	}
+	return name
+}
+
+// libName returns the name of the project, or else of the source file.
+func libName(s *schema.Schematic) string {
+	if s.Meta.Project != "" {
+		return s.Meta.Project
+	}
+	if s.Meta.SourceFile != "" {
+		base := filepath.Base(s.Meta.SourceFile)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return "symbols"
+}
@@ -0,0 +1,221 @@
+package kicad
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rveen/golib/formats/altium/emit"
+	"github.com/rveen/golib/formats/altium/netlist"
+	"github.com/rveen/golib/formats/altium/schema"
+)
+
+// ---------- Netlists ----------
+//
+// NetlistEmitter writes the connectivity of a schematic (see package netlist)
+// as a KiCad netlist, as Eeschema exports it for Pcbnew. The references,
+// library symbols, sheet paths and UUIDs are those of the schematic written
+// by Emitter, so that Pcbnew can link footprints to symbols by UUID as well as
+// by reference.
+
+// NetlistEmitter implements emit.Emitter for KiCad netlists (.net).
+type NetlistEmitter struct{}
+
+func (NetlistEmitter) Name() string { return "kicad-net" }
+
+// Emit produces one <name>.net artifact, where name is that of the project or
+// of the first sheet.
+func (NetlistEmitter) Emit(s *schema.Schematic, _ any) ([]emit.Artifact, *emit.Report, error) {
+
+	nl, rep := netlist.Build(s)
+	l := newLayout(s)
+
+	w := &sexprWriter{}
+	w.open("export", `(version "E")`)
+	w.open("design")
+	w.attr("source", q(s.Meta.SourceFile))
+	w.attr("tool", q("schconv"))
+	w.line(`(sheet (number "1") (name "/") (tstamps "/"))`)
+	w.close() // design
+
+	var parts []*netlist.Part
+	seen := map[string]bool{}
+	for _, p := range nl.Parts {
+		if !seen[p.Ref] && !strings.HasPrefix(p.Ref, "#") {
+			seen[p.Ref] = true
+			parts = append(parts, p)
+		}
+	}
+
+	w.open("components")
+	for _, p := range parts {
+		writeNetComp(w, p, l)
+	}
+	w.close() // components
+
+	w.open("libparts")
+	done := map[*schema.Symbol]bool{}
+	for _, p := range parts {
+		if p.Symbol != nil && !done[p.Symbol] {
+			done[p.Symbol] = true
+			writeLibPart(w, p.Symbol)
+		}
+	}
+	w.close() // libparts
+
+	w.open("nets")
+	for i, n := range nl.Nets {
+		w.open("net", fmt.Sprintf("(code %q)", strconv.Itoa(i+1)), "(name "+q(n.Name)+")")
+		for _, nd := range n.Nodes {
+			fn := ""
+			if nd.Pin.Name != "" && nd.Pin.Name != nd.Pin.Number {
+				fn = " (pinfunction " + q(nd.Pin.Name) + ")"
+			}
+			w.line(fmt.Sprintf("(node (ref %s) (pin %s)%s (pintype %s))",
+				q(nd.Part.Ref), q(nd.Pin.Number), fn, q(pinElecType(nd.Pin.Electrical))))
+		}
+		w.close() // net
+	}
+	w.close() // nets
+
+	w.close() // export
+	return []emit.Artifact{{Name: l.name + ".net", Data: []byte(w.String())}}, rep, nil
+}
+
+// layout is the file and context of each sheet, as Emitter writes them.
+type layout struct {
+	name  string
+	files map[*schema.Sheet]*sheetCtx
+	names map[*schema.Sheet]string
+}
+
+func newLayout(s *schema.Schematic) *layout {
+
+	if isProject(s) {
+		d := newDesign(s, &emit.Report{})
+		return &layout{name: d.name, files: d.files, names: d.names}
+	}
+
+	l := &layout{
+		name:  "schconv",
+		files: make(map[*schema.Sheet]*sheetCtx),
+		names: make(map[*schema.Sheet]string),
+	}
+	for i, sh := range s.Sheets {
+		name := sh.Name
+		if name == "" {
+			name = fmt.Sprintf("sheet%d", i+1)
+		}
+		if i == 0 {
+			l.name = name
+		}
+		l.files[sh] = singleSheet(sh)
+		l.names[sh] = name + ".kicad_sch"
+	}
+	return l
+}
+
+// writeNetComp writes the (comp …) of a part, with the properties of its
+// symbol instance in the schematic.
+func writeNetComp(w *sexprWriter, p *netlist.Part, l *layout) {
+
+	c := p.Component
+	w.open("comp", "(ref "+q(p.Ref)+")")
+
+	valField := c.ValueField()
+	value := ""
+	if p.Symbol != nil {
+		value = p.Symbol.LibRef
+	}
+	if valField != nil {
+		value = c.ResolvedValue()
+	}
+	w.attr("value", q(value))
+
+	fp := c.Footprint
+	var fields []*schema.Field
+	seen := map[string]bool{"Reference": true, "Value": true}
+	for i := range c.Fields {
+		fld := &c.Fields[i]
+		if fld == valField || fld.Name == "" || seen[fld.Name] {
+			continue
+		}
+		seen[fld.Name] = true
+		if fld.Name == "Footprint" {
+			if fp == "" {
+				fp = fld.Value
+			}
+			continue
+		}
+		fields = append(fields, fld)
+	}
+	if fp != "" {
+		w.attr("footprint", q(fp))
+	}
+	if len(fields) > 0 {
+		w.open("fields")
+		for _, fld := range fields {
+			w.line(fmt.Sprintf("(field (name %s) %s)", q(fld.Name), q(fld.Value)))
+		}
+		w.close() // fields
+	}
+
+	if p.Symbol != nil {
+		w.line(fmt.Sprintf(`(libsource (lib "converted") (part %s) (description ""))`, q(symLocalName(p.Symbol))))
+	}
+	sheetName := p.Path[strings.LastIndex(p.Path, "/")+1:]
+	w.line(fmt.Sprintf(`(property (name "Sheetname") (value %s))`, q(sheetName)))
+	w.line(fmt.Sprintf(`(property (name "Sheetfile") (value %s))`, q(l.names[p.Sheet])))
+
+	ctx := l.files[p.Sheet]
+	path, salt := "", ""
+	if ctx != nil {
+		salt = ctx.salt
+		suffix := strings.TrimPrefix(p.Ref, c.Designator)
+		for _, ip := range ctx.paths {
+			if ip.suffix == suffix {
+				path = ip.path
+				break
+			}
+		}
+	}
+	w.line(fmt.Sprintf("(sheetpath (names %s) (tstamps %s))", q(p.Path+"/"), q(sheetTstamps(path))))
+	w.attr("tstamps", q(makeUUID(salt+compSeed(c))))
+	w.close() // comp
+}
+
+// sheetTstamps returns an instance path of the schematic, /<root>/<sheet>…,
+// as a netlist sheet path: without the root, and ending in a slash.
+func sheetTstamps(path string) string {
+	if i := strings.Index(strings.TrimPrefix(path, "/"), "/"); i >= 0 {
+		return path[i+1:] + "/"
+	}
+	return "/"
+}
+
+// writeLibPart writes the (libpart …) of a symbol, with the pins of all its
+// units.
+func writeLibPart(w *sexprWriter, sym *schema.Symbol) {
+
+	w.open("libpart", `(lib "converted")`, "(part "+q(symLocalName(sym))+")")
+	w.open("fields")
+	w.line(`(field (name "Reference") "?")`)
+	w.line(fmt.Sprintf(`(field (name "Value") %s)`, q(sym.LibRef)))
+	w.close() // fields
+
+	w.open("pins")
+	seen := map[string]bool{}
+	for _, p := range sym.Pins {
+		if seen[p.Number] {
+			continue
+		}
+		seen[p.Number] = true
+		name := p.Name
+		if name == "" {
+			name = "~"
+		}
+		w.line(fmt.Sprintf("(pin (num %s) (name %s) (type %s))", q(p.Number), q(name), q(pinElecType(p.Electrical))))
+	}
+	w.close() // pins
+	w.close() // libpart
+}
@@ -0,0 +1,299 @@
+package kicad
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/rveen/golib/formats/altium/convert"
+	"github.com/rveen/golib/formats/altium/emit"
+	"github.com/rveen/golib/formats/altium/schema"
+)
+
+// ---------- Projects ----------
+//
+// A schematic read from a project, with its sheet symbols resolved to their
+// child sheets (SheetSymbol.Child), is emitted as one KiCad hierarchy: a root
+// file named after the project, one file per child sheet and a .kicad_pro.
+//
+// A sheet placed more than once — by several sheet symbols or as a repeated
+// channel — is still one file, with one instance path per placement:
+// "/<root uuid>/<sheet uuid>/…", where each sheet uuid is that of the (sheet …)
+// block placing it. KiCad annotates the symbols of the file once per path, so
+// the references of each instance get the suffix of the instance (R1_CH1,
+// R1_CH2). A repeated channel Repeat(CH,1,2) becomes two (sheet …) blocks, CH1
+// and CH2, on top of each other, so that their pins meet the same wires.
+//
+// Pages are numbered depth first, the root being page 1. A design with
+// several top-level sheets (a flat project) gets a new root sheet that places
+// each of them.
+
+// isProject reports whether s is to be emitted as one hierarchy.
+func isProject(s *schema.Schematic) bool {
+	if s.Meta.Project != "" {
+		return true
+	}
+	for _, sh := range s.Sheets {
+		for _, ss := range sh.SubSheets {
+			if ss.Child != nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// design is the layout of a hierarchy: the file and the instances of each
+// sheet.
+type design struct {
+	name     string
+	rootUUID string
+	root     *schema.Sheet
+	files    map[*schema.Sheet]*sheetCtx
+	names    map[*schema.Sheet]string // file name of each sheet
+	used     map[string]bool          // file names taken, in lower case
+	placed   map[*schema.Sheet]int    // number of sheet symbols placing a sheet
+	order    []*schema.Sheet          // sheets in the order of their first page
+	sheets   [][2]string              // uuid and name of each sheet, for the .kicad_pro
+	page     int
+	rep      *emit.Report
+}
+
+// emitProject emits s as one hierarchy.
+func emitProject(s *schema.Schematic, rep *emit.Report) []emit.Artifact {
+
+	d := newDesign(s, rep)
+
+	var artifacts []emit.Artifact
+	for _, sh := range d.order {
+		artifacts = append(artifacts, emit.Artifact{
+			Name: d.names[sh],
+			Data: []byte(renderSheet(sh, s.Symbols, rep, d.files[sh])),
+		})
+	}
+	return append(artifacts, d.projectFile())
+}
+
+// newDesign lays out s as one hierarchy: the file of each sheet and the
+// instances of the sheets in it.
+func newDesign(s *schema.Schematic, rep *emit.Report) *design {
+
+	name := s.Meta.Project
+	if name == "" && len(s.Sheets) > 0 {
+		name = sheetBase(s.Sheets[0])
+	}
+	if name == "" {
+		name = "schconv"
+	}
+
+	d := &design{
+		name:     name,
+		rootUUID: sheetUUID(name),
+		files:    make(map[*schema.Sheet]*sheetCtx),
+		names:    make(map[*schema.Sheet]string),
+		used:     make(map[string]bool),
+		placed:   make(map[*schema.Sheet]int),
+		rep:      rep,
+	}
+	d.root = d.rootSheet(s)
+	for _, sh := range s.Sheets {
+		for _, ss := range sh.SubSheets {
+			if ss.Child != nil {
+				d.placed[ss.Child] += len(ss.Instances())
+			}
+		}
+	}
+
+	d.sheets = append(d.sheets, [2]string{d.rootUUID, ""})
+	d.visit(d.root, "/"+d.rootUUID, "", map[*schema.Sheet]bool{})
+	return d
+}
+
+// rootSheet returns the root of the hierarchy: the only top-level sheet, or
+// a new sheet placing each top-level sheet. Sheets that cannot be reached
+// from a top-level sheet (in a loop of sheet symbols) are taken as top-level.
+func (d *design) rootSheet(s *schema.Schematic) *schema.Sheet {
+
+	roots := s.Roots()
+	reached := map[*schema.Sheet]bool{}
+	var reach func(sh *schema.Sheet)
+	reach = func(sh *schema.Sheet) {
+		if reached[sh] {
+			return
+		}
+		reached[sh] = true
+		for _, ss := range sh.SubSheets {
+			if ss.Child != nil {
+				reach(ss.Child)
+			}
+		}
+	}
+	for _, sh := range roots {
+		reach(sh)
+	}
+	for _, sh := range s.Sheets {
+		if !reached[sh] {
+			roots = append(roots, sh)
+			reach(sh)
+		}
+	}
+
+	if len(roots) == 1 {
+		return roots[0]
+	}
+
+	// A grid of sheet symbols, 4 per row, from the top left of an A4 page.
+	const (
+		boxW   = 38_100_000 // 1.5 in
+		boxH   = 25_400_000 // 1 in
+		pitchX = 50_800_000
+		pitchY = 38_100_000
+		margin = 25_400_000
+	)
+	top := &schema.Sheet{Name: d.name, Paper: schema.Paper{Std: schema.PaperA4}}
+	pageH := convert.PaperDims(top.Paper).H
+	for i, sh := range roots {
+		x := schema.Length(margin + (i%4)*pitchX)
+		y := pageH - schema.Length(margin+(i/4)*pitchY)
+		top.SubSheets = append(top.SubSheets, &schema.SheetSymbol{
+			FileName: sh.FileName,
+			Name:     sheetBase(sh),
+			Child:    sh,
+			Box:      schema.RectBox{Min: schema.Point{X: x, Y: y - boxH}, Max: schema.Point{X: x + boxW, Y: y}},
+			Style:    schema.Stroke{Width: 152_400, Color: schema.Color{A: 255}},
+			Prov:     schema.Provenance{Sheet: d.name, Kind: "kicad"},
+		})
+	}
+	if len(roots) > 1 {
+		d.rep.Add(emit.Info, schema.Provenance{Sheet: d.name, Kind: "kicad"},
+			"%d top-level sheets placed on a new root sheet %s; their ports are not connected", len(roots), d.name)
+	}
+	return top
+}
+
+// visit adds an instance of sh at path, and then the instances of its child
+// sheets, depth first. stack holds the sheets being visited, to break loops.
+func (d *design) visit(sh *schema.Sheet, path, suffix string, stack map[*schema.Sheet]bool) {
+
+	ctx := d.files[sh]
+	if ctx == nil {
+		ctx = d.sheetFile(sh)
+	}
+
+	d.page++
+	ctx.paths = append(ctx.paths, instPath{path: path, suffix: suffix, page: d.page})
+
+	stack[sh] = true
+	defer delete(stack, sh)
+
+	for _, ss := range sh.SubSheets {
+		if ss.Child == nil {
+			continue
+		}
+		if stack[ss.Child] {
+			d.rep.Add(emit.Warn, ss.Prov, "sheet %s places itself through sheet symbol %s; left out", sheetBase(ss.Child), ss.Name)
+			ctx.subs[ss] = nil
+			continue
+		}
+		syms := ctx.subs[ss]
+		for i := range syms {
+			sub := suffix
+			if ss.Repeat != nil || d.placed[ss.Child] > 1 {
+				sub += "_" + syms[i].name
+			}
+			syms[i].pages = append(syms[i].pages, instPath{path: path, page: d.page + 1})
+			d.visit(ss.Child, path+"/"+syms[i].uuid, sub, stack)
+			syms[i].file = d.names[ss.Child]
+		}
+	}
+}
+
+// sheetFile sets the file name and context of a sheet, when first visited,
+// with a (sheet …) block per instance of each resolved sheet symbol.
+func (d *design) sheetFile(sh *schema.Sheet) *sheetCtx {
+
+	base := d.name
+	if sh != d.root {
+		base = sheetBase(sh)
+	}
+	file := base
+	for i := 2; d.used[strings.ToLower(file)]; i++ {
+		file = fmt.Sprintf("%s_%d", base, i)
+	}
+	d.used[strings.ToLower(file)] = true
+	file += ".kicad_sch"
+	d.names[sh] = file
+
+	ctx := &sheetCtx{
+		project: d.name,
+		uuid:    makeUUID("sheetfile:" + file),
+		salt:    file + ":",
+		subs:    make(map[*schema.SheetSymbol][]sheetSym),
+	}
+	if sh == d.root {
+		ctx.uuid = d.rootUUID
+		ctx.root = true
+	}
+	d.files[sh] = ctx
+	d.order = append(d.order, sh)
+
+	// Sheet names must be unique on a sheet.
+	taken := map[string]bool{}
+	for _, ss := range sh.SubSheets {
+		if ss.Child == nil {
+			continue
+		}
+		for _, n := range ss.Instances() {
+			if n == "" {
+				n = sheetBase(ss.Child)
+			}
+			u := n
+			for i := 2; taken[u]; i++ {
+				u = fmt.Sprintf("%s_%d", n, i)
+			}
+			taken[u] = true
+			sym := sheetSym{name: u, file: kicadFileName(ss.FileName), uuid: makeUUID(ctx.salt + "sheet:" + u + ":" + ss.FileName)}
+			ctx.subs[ss] = append(ctx.subs[ss], sym)
+			d.sheets = append(d.sheets, [2]string{sym.uuid, sym.name})
+		}
+		if ss.Repeat != nil {
+			d.rep.Add(emit.Info, ss.Prov, "repeated channel %s placed as %d sheets on top of each other", ss.Name, len(ss.Instances()))
+			for _, e := range ss.Entries {
+				if e.Repeated {
+					d.rep.Add(emit.Warn, ss.Prov, "repeated sheet entry %s of %s connects all channels to one net; KiCad has no repeated entries", e.Name, ss.Name)
+				}
+			}
+		}
+	}
+	return ctx
+}
+
+// sheetBase returns the name of a sheet file without directory and extension,
+// or else the sheet name.
+func sheetBase(sh *schema.Sheet) string {
+	if sh.FileName != "" {
+		b := path.Base(strings.ReplaceAll(sh.FileName, `\`, "/"))
+		return strings.TrimSuffix(b, path.Ext(b))
+	}
+	if sh.Name != "" {
+		return sh.Name
+	}
+	return "sheet"
+}
+
+// projectFile returns a minimal .kicad_pro, which KiCad completes with its
+// defaults when the project is opened.
+func (d *design) projectFile() emit.Artifact {
+	type meta struct {
+		Filename string `json:"filename"`
+		Version  int    `json:"version"`
+	}
+	pro := struct {
+		Meta   meta        `json:"meta"`
+		Sheets [][2]string `json:"sheets"`
+	}{meta{d.name + ".kicad_pro", 1}, d.sheets}
+
+	b, _ := json.MarshalIndent(pro, "", "  ")
+	return emit.Artifact{Name: d.name + ".kicad_pro", Data: append(b, '\n')}
+}
@@ -33,20 +33,26 @@ func (Emitter) Name() string { return "kicadpcb" }
 func (Emitter) Emit(b *pcbschema.Board, _ any) ([]emit.Artifact, *emit.Report, error) {
 	rep := &emit.Report{}
 	data := renderBoard(b, rep)
-	name := "board.kicad_pcb"
-	if b.Meta.SourceFile != "" {
-		base := b.Meta.SourceFile
-		if i := strings.LastIndexAny(base, "/\\"); i >= 0 {
-			base = base[i+1:]
-		}
-		if ext := strings.LastIndex(base, "."); ext >= 0 {
-			base = base[:ext]
-		}
-		name = base + ".kicad_pcb"
-	}
+	name := baseName(b.Meta.SourceFile, "board") + ".kicad_pcb"
 	return []emit.Artifact{{Name: name, Data: []byte(data)}}, rep, nil
 }
 
+// baseName returns the name of a source file without directory and
+// extension, or def when there is none.
+func baseName(file, def string) string {
+	if file == "" {
+		return def
+	}
+	base := file
+	if i := strings.LastIndexAny(base, "/\\"); i >= 0 {
+		base = base[i+1:]
+	}
+	if ext := strings.LastIndex(base, "."); ext >= 0 {
+		base = base[:ext]
+	}
+	return base
+}
+
 // ---------- Board renderer ----------
 
 // A4 page dimensions in mm (KiCad default), used for board centering.
@@ -413,14 +419,22 @@ func writeFootprint(w *sexprWriter, comp *pcbschema.Component, items footprintIt
 	}
 	w.open("footprint", q(comp.Pattern), fmt.Sprintf("(layer %s)", q(layerName)),
 		fmt.Sprintf("(at %s %s %s)", f4(kx(comp.Position.X)), f4(ky(comp.Position.Y)), f4(comp.Rotation)))
+	writeFootprintItems(w, comp, items, nets, "")
+	w.close()
+}
 
+// writeFootprintItems writes the contents of a footprint: its reference and
+// value texts, pads and graphics. value is the value text when the component
+// has no comment text. nets is nil in a footprint library, where pads have no
+// net.
+func writeFootprintItems(w *sexprWriter, comp *pcbschema.Component, items footprintItems, nets []*pcbschema.Net, value string) {
 	// Reference and value as fp_text elements.
 	silkLayer := "F.SilkS"
 	if comp.Layer == 32 {
 		silkLayer = "B.SilkS"
 	}
 	ref := comp.Designator
-	val := ""
+	val := value
 	var refText, valText *pcbschema.PcbText
 	for _, t := range items.texts {
 		if t.IsDesignator {
@@ -463,8 +477,6 @@ func writeFootprint(w *sexprWriter, comp *pcbschema.Component, items footprintIt
 	for _, p := range items.polys {
 		writePolyInFootprint(w, p, comp)
 	}
-
-	w.close()
 }
 
 // holePadAttrs applies KiCad's NPTH rules to a through-hole pad. Unplated holes
@@ -502,7 +514,7 @@ func writePadInFootprint(w *sexprWriter, p *pcbschema.Pad, comp *pcbschema.Compo
 	if p.HoleSize > 0 {
 		padType, desig, sw, sh, layers, hasNet := holePadAttrs(p, sz)
 		netStr := ""
-		if hasNet {
+		if hasNet && nets != nil {
 			netStr = fmt.Sprintf(" (net %d %s)", kicadNet(p.Net), q(netName(p.Net, nets)))
 		}
 		w.line(fmt.Sprintf(`(pad %s %s %s (at %s %s %s) (size %s %s) (drill %s) (layers%s)%s%s)`,
@@ -514,12 +526,16 @@ func writePadInFootprint(w *sexprWriter, p *pcbschema.Pad, comp *pcbschema.Compo
 		))
 		return
 	}
-	w.line(fmt.Sprintf(`(pad %s smd %s (at %s %s %s) (size %s %s) (layers%s) (net %d %s)%s)`,
+	netStr := ""
+	if nets != nil {
+		netStr = fmt.Sprintf(" (net %d %s)", kicadNet(p.Net), q(netName(p.Net, nets)))
+	}
+	w.line(fmt.Sprintf(`(pad %s smd %s (at %s %s %s) (size %s %s) (layers%s)%s%s)`,
 		q(p.Designator), shape,
 		f4(relX), f4(relY), f4(p.Rotation),
 		f4(mm(sz.W)), f4(mm(sz.H)),
 		padLayers(p, comp.Layer),
-		kicadNet(p.Net), q(netName(p.Net, nets)), shapeExtra,
+		netStr, shapeExtra,
 	))
 }
 
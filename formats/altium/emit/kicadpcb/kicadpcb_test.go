@@ -7,6 +7,8 @@ import (
 	"github.com/rveen/golib/formats/altium/altium/pcbmapper"
 	"github.com/rveen/golib/formats/altium/altium/pcbreader"
 	"github.com/rveen/golib/formats/altium/emit/kicadpcb"
+	"github.com/rveen/golib/formats/altium/pcbschema"
+	"github.com/rveen/golib/formats/altium/schema"
 )
 
 func TestEmit(t *testing.T) {
@@ -40,3 +42,58 @@ func TestEmit(t *testing.T) {
 	}
 	t.Logf("output size: %d bytes", len(s))
 }
+
+func TestLibrary(t *testing.T) {
+	const mil = 25400
+	fp := func(name string) *pcbschema.Footprint {
+		return &pcbschema.Footprint{
+			Name:        name,
+			Description: "Chip resistor",
+			Board: &pcbschema.Board{
+				Components: []*pcbschema.Component{{Designator: "REF**", Pattern: name, Layer: 1}},
+				Pads: []*pcbschema.Pad{{
+					Designator: "1", Layer: 1, Net: 0xFFFF,
+					Position: schema.Point{X: -30 * mil},
+					TopSize:  schema.Size{W: 30 * mil, H: 35 * mil}, TopShape: pcbschema.PadShapeRect,
+				}},
+				Tracks: []*pcbschema.Track{{Layer: 33, Start: schema.Point{X: -60 * mil}, End: schema.Point{X: 60 * mil}, Width: 5 * mil}},
+			},
+		}
+	}
+	lib := &pcbschema.Library{
+		Footprints: []*pcbschema.Footprint{fp("R0603"), fp("SOT23/5"), fp("r0603")},
+		Meta:       pcbschema.Meta{SourceFile: "libs/Passives.PcbLib"},
+	}
+	artifacts, rep, err := kicadpcb.LibraryEmitter{}.Emit(lib, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, a := range artifacts {
+		names = append(names, a.Name)
+	}
+	if got := strings.Join(names, " "); got != "Passives.pretty/R0603.kicad_mod Passives.pretty/SOT23_5.kicad_mod Passives.pretty/r0603_2.kicad_mod" {
+		t.Errorf("artifacts %s", got)
+	}
+	if len(rep.Notes) != 1 {
+		t.Errorf("notes %+v", rep.Notes)
+	}
+
+	mod := string(artifacts[0].Data)
+	for _, s := range []string{
+		"(footprint \"R0603\" (version 20221018) (generator \"pcbconv\")\n",
+		`(descr "Chip resistor")`,
+		`(attr smd)`,
+		`(fp_text reference "REF**"`,
+		`(fp_text value "R0603"`,
+		`(pad "1" smd rect (at -0.7620 -0.0000 0.0000) (size 0.7620 0.8890) (layers "F.Cu" "F.Paste" "F.Mask"))`,
+		`(fp_line (start -1.5240 -0.0000) (end 1.5240 -0.0000)`,
+	} {
+		if !strings.Contains(mod, s) {
+			t.Errorf("no %s in\n%s", s, mod)
+		}
+	}
+	if strings.Contains(mod, "(net") {
+		t.Errorf("net in library footprint\n%s", mod)
+	}
+}
@@ -0,0 +1,145 @@
+package kicadpcb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rveen/golib/formats/altium/emit"
+	"github.com/rveen/golib/formats/altium/pcbschema"
+)
+
+// ---------- Footprint libraries ----------
+//
+// LibraryEmitter writes a footprint library as a KiCad one: a <name>.pretty
+// directory with a .kicad_mod file per footprint. Footprints are written as
+// on a board, at the origin and without nets, with REF** as reference and the
+// footprint name as value.
+
+// LibraryEmitter produces the .kicad_mod artifacts of a pcbschema.Library.
+type LibraryEmitter struct{}
+
+func (LibraryEmitter) Name() string { return "kicadpcb-lib" }
+
+// Emit converts lib to one <name>.pretty/<footprint>.kicad_mod artifact per
+// footprint, where name is that of the library file.
+func (LibraryEmitter) Emit(lib *pcbschema.Library, _ any) ([]emit.Artifact, *emit.Report, error) {
+	rep := &emit.Report{}
+	dir := baseName(lib.Meta.SourceFile, "footprints") + ".pretty"
+
+	offX, offY = 0, 0
+	var artifacts []emit.Artifact
+	seen := make(map[string]bool)
+	for _, fp := range lib.Footprints {
+		b := fp.Board
+		if len(b.Components) == 0 {
+			continue
+		}
+		file := fpFileName(fp.Name)
+		if seen[strings.ToLower(file)] {
+			n := 2
+			for seen[strings.ToLower(fmt.Sprintf("%s_%d", file, n))] {
+				n++
+			}
+			rep.Add(emit.Warn, b.Components[0].Prov, "footprint %s: file name taken, written as %s_%d", fp.Name, file, n)
+			file = fmt.Sprintf("%s_%d", file, n)
+		}
+		seen[strings.ToLower(file)] = true
+
+		artifacts = append(artifacts, emit.Artifact{
+			Name: dir + "/" + file + ".kicad_mod",
+			Data: []byte(renderFootprint(fp)),
+		})
+	}
+	return artifacts, rep, nil
+}
+
+// renderFootprint writes a library footprint as a .kicad_mod file.
+func renderFootprint(fp *pcbschema.Footprint) string {
+	b := fp.Board
+	comp := b.Components[0]
+
+	w := &sexprWriter{}
+	w.open("footprint", q(fp.Name), "(version "+version+")", "(generator "+q("pcbconv")+")")
+	w.attr("layer", q("F.Cu"))
+	if fp.Description != "" {
+		w.attr("descr", q(fp.Description))
+	}
+	if attr := fpAttr(b.Pads); attr != "" {
+		w.attr("attr", attr)
+	}
+	writeFootprintItems(w, comp, componentItems(b, comp.Index), nil, fp.Name)
+	w.close()
+	return w.String()
+}
+
+// componentItems returns the primitives of a board that belong to one
+// component.
+func componentItems(b *pcbschema.Board, idx int) footprintItems {
+	var items footprintItems
+	own := func(c uint16) bool { return c != noNet && int(c) == idx }
+	for _, p := range b.Pads {
+		if own(p.Component) {
+			items.pads = append(items.pads, p)
+		}
+	}
+	for _, t := range b.Texts {
+		if own(t.Component) {
+			items.texts = append(items.texts, t)
+		}
+	}
+	for _, a := range b.Arcs {
+		if own(a.Component) {
+			items.arcs = append(items.arcs, a)
+		}
+	}
+	for _, t := range b.Tracks {
+		if own(t.Component) {
+			items.tracks = append(items.tracks, t)
+		}
+	}
+	for _, f := range b.Fills {
+		if own(f.Component) {
+			items.fills = append(items.fills, f)
+		}
+	}
+	for _, p := range b.Polys {
+		if own(p.Component) {
+			items.polys = append(items.polys, p)
+		}
+	}
+	for _, p := range b.CustomPads {
+		if own(p.Component) {
+			items.customPads = append(items.customPads, p)
+		}
+	}
+	return items
+}
+
+// fpAttr returns the mounting type of a footprint: through_hole if it has a
+// plated hole, smd if it has only surface pads, and "" without pads.
+func fpAttr(pads []*pcbschema.Pad) string {
+	attr := ""
+	for _, p := range pads {
+		if p.HoleSize > 0 && p.Plated {
+			return "through_hole"
+		}
+		if p.HoleSize == 0 {
+			attr = "smd"
+		}
+	}
+	return attr
+}
+
+// fpFileName returns a footprint name as a file name, with the characters
+// that file systems do not take replaced by _.
+func fpFileName(name string) string {
+	if name == "" {
+		return "unnamed"
+	}
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
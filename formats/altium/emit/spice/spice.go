@@ -0,0 +1,297 @@
+// Package spice emits a SPICE deck (.cir) from the netlist of a
+// schema.Schematic (see package netlist), for simulation with ngspice and
+// similar simulators.
+//
+// Each part is one element, written as its parameters say:
+//
+//   - SPICE is the element line itself, with {ref} for the reference,
+//     {value} for the value and {N} for the node of pin N, as
+//     X{ref} {3} {2} {1} {8} {4} LM358.
+//   - Sim.Device is the kind of element: R, C, L, V, I, D, Q, M, J or X, or
+//     as KiCad names them, NPN, PNP, NMOS, PMOS, NJFET, PJFET and SUBCKT. By
+//     default it is the letter of the reference, for R, C, L, V, I, D, Q, M
+//     and J.
+//   - Sim.Pins are the pin numbers in the order of the nodes of the element,
+//     as "3 2 1" (or "3=C 2=B 1=E"). By default all pins, by number.
+//   - Sim.Name is the model or subcircuit, by default the value of the part.
+//   - Sim.Params is the rest of the element line, as "dc 5". For R, C, L, V
+//     and I it is by default the value.
+//   - Sim.Library is a file with models, which is included.
+//   - Sim.Enable as 0 or false leaves the part out.
+//
+// Element names start with the letter of their kind: U1 as a subcircuit is
+// XU1. Values as 4k7 and 1M are written as 4.7k and 1Meg. Nets with a ground
+// power port are node 0, also if a net label names them; other nets keep
+// their names, with the characters that
+// SPICE does not take in node names replaced by _. Parts that cannot be
+// written are reported and left in the deck as comments.
+package spice
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rveen/golib/formats/altium/emit"
+	"github.com/rveen/golib/formats/altium/netlist"
+	"github.com/rveen/golib/formats/altium/schema"
+)
+
+// Emitter implements emit.Emitter for SPICE decks.
+type Emitter struct{}
+
+func (Emitter) Name() string { return "spice" }
+
+// Emit produces one <name>.cir artifact, where name is that of the project or
+// of the first sheet.
+func (Emitter) Emit(s *schema.Schematic, _ any) ([]emit.Artifact, *emit.Report, error) {
+
+	nl, rep := netlist.Build(s)
+	name := s.Name()
+
+	// Ground is found by the power ports on a net, not by its name, which
+	// may be that of a net label.
+	ground := map[string]bool{"0": true}
+	for _, n := range nl.Nets {
+		if n.Ground() {
+			ground[n.Name] = true
+		}
+	}
+
+	// Parts by reference, with the nodes of the pins of all their units.
+	var parts []*part
+	byRef := map[string]*part{}
+	for _, p := range nl.Parts {
+		if p.Component.Designator == "" || strings.HasPrefix(p.Ref, "#") {
+			continue
+		}
+		sp := byRef[p.Ref]
+		if sp == nil {
+			sp = &part{ref: p.Ref, c: p.Component, nodes: map[string]string{}}
+			byRef[p.Ref] = sp
+			parts = append(parts, sp)
+		}
+		for _, pin := range p.Pins() {
+			if _, ok := sp.nodes[pin.Number]; ok {
+				continue
+			}
+			sp.pins = append(sp.pins, pin.Number)
+			sp.nodes[pin.Number] = ""
+			if net := nl.NetOf(netlist.Node{Part: p, Pin: pin}); net != nil {
+				sp.nodes[pin.Number] = nodeName(net.Name, ground)
+			}
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "* %s\n", name)
+
+	var libs []string
+	var lines []string
+	for _, p := range parts {
+		if lib, _ := p.c.Param("Sim.Library"); lib != "" && !slices.Contains(libs, lib) {
+			libs = append(libs, lib)
+		}
+		line, err := p.element()
+		if err != nil {
+			rep.Add(emit.Warn, p.c.Prov, "part %s: %v", p.ref, err)
+			line = "* " + p.ref + ": " + err.Error()
+		} else {
+			for _, n := range p.open {
+				rep.Add(emit.Warn, p.c.Prov, "part %s: pin %s is not connected", p.ref, n)
+			}
+		}
+		lines = append(lines, line)
+	}
+	for _, lib := range libs {
+		fmt.Fprintf(&b, ".include %q\n", lib)
+	}
+	b.WriteString("\n")
+	for _, l := range lines {
+		b.WriteString(l + "\n")
+	}
+	b.WriteString(".end\n")
+
+	return []emit.Artifact{{Name: name + ".cir", Data: []byte(b.String())}}, rep, nil
+}
+
+// part is a component and the node of each of its pins ("" if the pin is
+// connected to nothing).
+type part struct {
+	ref   string
+	c     *schema.Component
+	pins  []string
+	nodes map[string]string
+	open  []string // pins of the element that are connected to nothing
+}
+
+// Kinds of elements by Sim.Device, and the least number of nodes of each.
+var (
+	devices = map[string]string{
+		"NPN": "Q", "PNP": "Q", "NMOS": "M", "PMOS": "M",
+		"NJFET": "J", "PJFET": "J", "SUBCKT": "X",
+	}
+	minNodes = map[string]int{
+		"R": 2, "C": 2, "L": 2, "V": 2, "I": 2, "D": 2,
+		"Q": 3, "J": 3, "M": 4, "X": 1,
+	}
+)
+
+// element returns the element line of the part.
+func (p *part) element() (string, error) {
+
+	value := p.c.ResolvedValue()
+	if enable, ok := p.c.Param("Sim.Enable"); ok {
+		switch strings.ToLower(strings.TrimSpace(enable)) {
+		case "0", "n", "no", "f", "false":
+			return "", fmt.Errorf("not simulated (Sim.Enable=%s)", enable)
+		}
+	}
+
+	if tmpl, _ := p.c.Param("SPICE"); tmpl != "" {
+		var err error
+		line := placeholder.ReplaceAllStringFunc(tmpl, func(m string) string {
+			switch key := m[1 : len(m)-1]; key {
+			case "ref":
+				return p.ref
+			case "value":
+				return spiceValue(value)
+			default:
+				if _, ok := p.nodes[key]; ok {
+					return p.node(key)
+				}
+				err = fmt.Errorf("SPICE line %q: no pin %s", tmpl, key)
+				return m
+			}
+		})
+		return line, err
+	}
+
+	dev, _ := p.c.Param("Sim.Device")
+	dev = strings.ToUpper(strings.TrimSpace(dev))
+	if d, ok := devices[dev]; ok {
+		dev = d
+	}
+	if dev == "" {
+		dev = strings.ToUpper(p.ref[:1])
+		if _, ok := minNodes[dev]; !ok || dev == "X" {
+			return "", fmt.Errorf("no SPICE model: no Sim.Device or SPICE parameter")
+		}
+	}
+	if _, ok := minNodes[dev]; !ok {
+		return "", fmt.Errorf("unknown Sim.Device %s", dev)
+	}
+
+	pins := p.pins
+	if sp, _ := p.c.Param("Sim.Pins"); sp != "" {
+		pins = nil
+		for _, f := range strings.Fields(sp) {
+			n, _, _ := strings.Cut(f, "=")
+			if _, ok := p.nodes[n]; !ok {
+				return "", fmt.Errorf("Sim.Pins %q: no pin %s", sp, n)
+			}
+			pins = append(pins, n)
+		}
+	} else {
+		sort.SliceStable(pins, func(i, j int) bool { return pinLess(pins[i], pins[j]) })
+	}
+	if len(pins) < minNodes[dev] {
+		return "", fmt.Errorf("%d pins for element %s", len(pins), dev)
+	}
+
+	name := p.ref
+	if !strings.HasPrefix(strings.ToUpper(name), dev) {
+		name = dev + name
+	}
+	fields := []string{name}
+	for _, n := range pins {
+		fields = append(fields, p.node(n))
+	}
+
+	params, _ := p.c.Param("Sim.Params")
+	switch dev {
+	case "R", "C", "L", "V", "I":
+		if params == "" {
+			params = spiceValue(value)
+		}
+		if params == "" {
+			return "", fmt.Errorf("no value")
+		}
+	default:
+		model, _ := p.c.Param("Sim.Name")
+		if model == "" {
+			model = value
+		}
+		if model == "" {
+			return "", fmt.Errorf("no model: no Sim.Name or value")
+		}
+		fields = append(fields, model)
+	}
+	if params != "" {
+		fields = append(fields, params)
+	}
+	return strings.Join(fields, " "), nil
+}
+
+var placeholder = regexp.MustCompile(`\{[^{}\s]+\}`)
+
+// node returns the node of a pin; pins connected to nothing get a node of
+// their own.
+func (p *part) node(pin string) string {
+	if n := p.nodes[pin]; n != "" {
+		return n
+	}
+	p.open = append(p.open, pin)
+	return nodeName("NC_"+p.ref+"_"+pin, nil)
+}
+
+// nodeName returns the node of a net: 0 for ground nets, or else the name
+// without characters that separate SPICE fields.
+func nodeName(net string, ground map[string]bool) string {
+	if ground[net] {
+		return "0"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || strings.ContainsRune("()=,;*", r) {
+			return '_'
+		}
+		return r
+	}, net)
+}
+
+var infix = regexp.MustCompile(`^(\d+)([RrpnuUmkKMG])(\d+)$`)
+
+// spiceValue returns a value as SPICE reads it: 4k7 as 4.7k, 1R5 as 1.5 and
+// 1M (mega, not milli as in SPICE) as 1Meg.
+func spiceValue(v string) string {
+	v = strings.TrimSpace(v)
+	v = strings.NewReplacer("µ", "u", "μ", "u", "Ω", "").Replace(v)
+	if m := infix.FindStringSubmatch(v); m != nil {
+		scale := m[2]
+		if scale == "R" || scale == "r" {
+			scale = ""
+		}
+		v = m[1] + "." + m[3] + scale
+	}
+	if i := strings.IndexFunc(v, func(r rune) bool { return (r < '0' || r > '9') && r != '.' }); i > 0 && v[i] == 'M' &&
+		!strings.HasPrefix(strings.ToUpper(v[i:]), "MEG") {
+		v = v[:i] + "Meg" + v[i+1:]
+	}
+	return v
+}
+
+// pinLess orders pin numbers as numbers when they are.
+func pinLess(a, b string) bool {
+	na, ea := strconv.Atoi(a)
+	nb, eb := strconv.Atoi(b)
+	if ea == nil && eb == nil {
+		return na < nb
+	}
+	if (ea == nil) != (eb == nil) {
+		return ea == nil
+	}
+	return a < b
+}
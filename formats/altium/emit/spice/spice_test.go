@@ -0,0 +1,115 @@
+package spice
+
+import (
+	"testing"
+
+	"github.com/rveen/golib/formats/altium/schema"
+)
+
+const mil = 25400
+
+func pt(x, y int64) schema.Point { return schema.Point{X: x * mil, Y: y * mil} }
+
+// two has pin 1 at (-20, 0) and pin 2 at (60, 0) mils.
+var two = &schema.Symbol{
+	ID: "two",
+	Pins: []*schema.Pin{
+		{Number: "1", Position: pt(0, 0), PinLength: 20 * mil, Orientation: schema.DirLeft},
+		{Number: "2", Position: pt(40, 0), PinLength: 20 * mil, Orientation: schema.DirRight},
+	},
+}
+
+func comp(ref string, x int64, params ...string) *schema.Component {
+	c := &schema.Component{Symbol: "two", Designator: ref, Position: pt(x, 0)}
+	for i := 0; i+1 < len(params); i += 2 {
+		c.Fields = append(c.Fields, schema.Field{Name: params[i], Value: params[i+1]})
+	}
+	return c
+}
+
+func TestEmit(t *testing.T) {
+	sh := &schema.Sheet{
+		Name: "main",
+		Components: []*schema.Component{
+			comp("V1", 0, "Sim.Params", "dc 5"),
+			comp("R1", 80, "Comment", "4k7"),
+			comp("D1", 80, "Comment", "1N4148", "Sim.Pins", "2 1", "Sim.Library", "diodes.lib"),
+			comp("R2", 160, "Comment", "=Value", "Value", "1M"),
+			comp("U1", 160, "SPICE", "X{ref} {1} {2} opamp", "Sim.Library", "diodes.lib"),
+			comp("Q1", 500, "Comment", "BC547"),
+			comp("U2", 600),
+			comp("R3", 700, "Comment", "1k", "Sim.Enable", "0"),
+		},
+		PowerPorts: []*schema.PowerPort{
+			{NetName: "GND", Style: schema.PowerStyleGND, Pos: pt(-20, 0)},
+			{NetName: "GND", Style: schema.PowerStyleGND, Pos: pt(220, 0)},
+		},
+		NetLabels: []*schema.NetLabel{{Text: "VIN", Pos: pt(60, 0)}, {Text: "OUT (A)", Pos: pt(140, 0)}},
+	}
+	s := &schema.Schematic{Sheets: []*schema.Sheet{sh}, Symbols: map[schema.SymbolID]*schema.Symbol{"two": two}}
+
+	artifacts, rep, err := Emitter{}.Emit(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `* main
+.include "diodes.lib"
+
+V1 0 VIN dc 5
+R1 VIN OUT__A_ 4.7k
+D1 OUT__A_ VIN 1N4148
+R2 OUT__A_ 0 1Meg
+XU1 OUT__A_ 0 opamp
+* Q1: 2 pins for element Q
+* U2: no SPICE model: no Sim.Device or SPICE parameter
+* R3: not simulated (Sim.Enable=0)
+.end
+`
+	if artifacts[0].Name != "main.cir" || string(artifacts[0].Data) != want {
+		t.Errorf("%s\n%s\nwant\n%s", artifacts[0].Name, artifacts[0].Data, want)
+	}
+	if len(rep.Notes) != 3 {
+		t.Errorf("notes %v", rep.Notes)
+	}
+}
+
+// A net label has priority over a power port in naming a net, but the net
+// is still ground.
+func TestLabeledGround(t *testing.T) {
+	sh := &schema.Sheet{
+		Name:       "main",
+		Components: []*schema.Component{comp("R1", 0, "Comment", "1k")},
+		PowerPorts: []*schema.PowerPort{
+			{NetName: "GND", Style: schema.PowerStyleGND, Pos: pt(-20, 0)},
+			{NetName: "VCC", Style: schema.PowerStyleBar, Pos: pt(60, 0)},
+		},
+		NetLabels: []*schema.NetLabel{{Text: "AGND", Pos: pt(-20, 0)}},
+	}
+	s := &schema.Schematic{Sheets: []*schema.Sheet{sh}, Symbols: map[schema.SymbolID]*schema.Symbol{"two": two}}
+
+	artifacts, _, err := Emitter{}.Emit(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "* main\n\nR1 0 VCC 1k\n.end\n"; string(artifacts[0].Data) != want {
+		t.Errorf("%s\nwant\n%s", artifacts[0].Data, want)
+	}
+}
+
+func TestSpiceValue(t *testing.T) {
+	for v, want := range map[string]string{
+		"10k":  "10k",
+		"4k7":  "4.7k",
+		"1R5":  "1.5",
+		"2M2":  "2.2Meg",
+		"1M":   "1Meg",
+		"1Meg": "1Meg",
+		"10m":  "10m",
+		"4.7µ": "4.7u",
+		"100Ω": "100",
+	} {
+		if got := spiceValue(v); got != want {
+			t.Errorf("%s: %s, want %s", v, got, want)
+		}
+	}
+}
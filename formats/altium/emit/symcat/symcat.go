@@ -7,6 +7,7 @@ package symcat
 import (
 	"fmt"
 	"math"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -33,7 +34,9 @@ func (Emitter) Name() string { return "symcat" }
 
 // Emit renders one SVG containing all unique symbols laid out in a grid.
 // Each symbol is scaled to fill its cell; the cross at origin is always the
-// same size so it is visible regardless of symbol scale.
+// same size so it is visible regardless of symbol scale. The SVG is
+// symbols.svg, or <name>-symbols.svg for a library (a schematic without
+// sheets, see mapper.MapLibrary) read from <name>.SchLib.
 func (Emitter) Emit(s *schema.Schematic, _ any) ([]emit.Artifact, *emit.Report, error) {
 	rep := &emit.Report{}
 
@@ -100,7 +103,13 @@ func (Emitter) Emit(s *schema.Schematic, _ any) ([]emit.Artifact, *emit.Report,
 	}
 
 	b.writef(`</svg>`)
-	return []emit.Artifact{{Name: "symbols.svg", Data: []byte(b.String())}}, rep, nil
+
+	name := "symbols.svg"
+	if len(s.Sheets) == 0 && s.Meta.SourceFile != "" {
+		base := filepath.Base(s.Meta.SourceFile)
+		name = strings.TrimSuffix(base, filepath.Ext(base)) + "-symbols.svg"
+	}
+	return []emit.Artifact{{Name: name, Data: []byte(b.String())}}, rep, nil
 }
 
 // fitScale returns the uniform scale factor that makes the symbol's bounding
@@ -0,0 +1,199 @@
+package netlist
+
+import "github.com/rveen/golib/formats/altium/schema"
+
+// local is the connectivity of one sheet: the group of connected elements
+// that each wire, pin, label, port and sheet entry belongs to.
+type local struct {
+	groups  int
+	wires   []int // group of each wire of the sheet
+	pins    []pinAt
+	labels  []named
+	powers  []named
+	ports   []named
+	entries map[*schema.SheetSymbol][]named
+}
+
+// pinAt is a pin of the component with index comp in the sheet.
+type pinAt struct {
+	comp  int
+	pin   *schema.Pin
+	group int
+}
+
+// named is an element that names a net.
+type named struct {
+	name     string
+	group    int
+	repeated bool
+	prov     schema.Provenance
+}
+
+// connect computes the groups of connected elements of a sheet.
+func connect(sh *schema.Sheet, syms map[schema.SymbolID]*schema.Symbol) *local {
+
+	var uf unionFind
+	uf.grow(len(sh.Wires))
+
+	// Wires touching another wire, and wires through a junction.
+	for i, a := range sh.Wires {
+		for j := i + 1; j < len(sh.Wires); j++ {
+			if touches(a, sh.Wires[j]) || touches(sh.Wires[j], a) {
+				uf.union(i, j)
+			}
+		}
+	}
+	for _, p := range sh.Junctions {
+		first := -1
+		for i, w := range sh.Wires {
+			if onWire(p, w) {
+				if first < 0 {
+					first = i
+				} else {
+					uf.union(first, i)
+				}
+			}
+		}
+	}
+
+	// Other elements connect to the wires through their points, and to each
+	// other at the same point.
+	at := map[schema.Point][]int{}
+	add := func(pts ...schema.Point) int {
+		id := uf.grow(1)
+		for _, p := range pts {
+			for i, w := range sh.Wires {
+				if onWire(p, w) {
+					uf.union(id, i)
+				}
+			}
+			for _, o := range at[p] {
+				uf.union(id, o)
+			}
+			at[p] = append(at[p], id)
+		}
+		return id
+	}
+
+	lc := &local{entries: map[*schema.SheetSymbol][]named{}}
+	for ci, c := range sh.Components {
+		sym := syms[c.Symbol]
+		if sym == nil {
+			continue
+		}
+		for _, p := range unitPins(c, sym) {
+			lc.pins = append(lc.pins, pinAt{ci, p, add(c.Abs(p.Hotspot()))})
+		}
+	}
+	for _, l := range sh.NetLabels {
+		lc.labels = append(lc.labels, named{name: l.Text, group: add(l.Pos), prov: l.Prov})
+	}
+	for _, p := range sh.PowerPorts {
+		lc.powers = append(lc.powers, named{name: p.NetName, group: add(p.Pos), prov: p.Prov})
+	}
+	for _, p := range sh.Ports {
+		end := p.Pos
+		if p.Vertical {
+			end.Y -= p.Width
+		} else {
+			end.X += p.Width
+		}
+		lc.ports = append(lc.ports, named{name: p.Name, group: add(p.Pos, end), prov: p.Prov})
+	}
+	for _, ss := range sh.SubSheets {
+		for _, e := range ss.Entries {
+			lc.entries[ss] = append(lc.entries[ss], named{name: e.Name, group: add(e.Pos), repeated: e.Repeated, prov: ss.Prov})
+		}
+	}
+
+	// Number the groups.
+	index := map[int]int{}
+	group := func(id int) int {
+		r := uf.find(id)
+		g, ok := index[r]
+		if !ok {
+			g = len(index)
+			index[r] = g
+		}
+		return g
+	}
+	for i := range sh.Wires {
+		lc.wires = append(lc.wires, group(i))
+	}
+	for i := range lc.pins {
+		lc.pins[i].group = group(lc.pins[i].group)
+	}
+	for _, nn := range [][]named{lc.labels, lc.powers, lc.ports} {
+		for i := range nn {
+			nn[i].group = group(nn[i].group)
+		}
+	}
+	for _, nn := range lc.entries {
+		for i := range nn {
+			nn[i].group = group(nn[i].group)
+		}
+	}
+	lc.groups = len(index)
+	return lc
+}
+
+// touches reports whether a vertex of a lies on b.
+func touches(a, b *schema.Wire) bool {
+	for _, p := range a.Points {
+		if onWire(p, b) {
+			return true
+		}
+	}
+	return false
+}
+
+// onWire reports whether p lies on a segment of w.
+func onWire(p schema.Point, w *schema.Wire) bool {
+	for i := 0; i+1 < len(w.Points); i++ {
+		if onSegment(p, w.Points[i], w.Points[i+1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func onSegment(p, a, b schema.Point) bool {
+	if p.X < min(a.X, b.X) || p.X > max(a.X, b.X) || p.Y < min(a.Y, b.Y) || p.Y > max(a.Y, b.Y) {
+		return false
+	}
+	// Collinear: the cross product is 0. Most wires are orthogonal, for
+	// which the box test above is enough.
+	if a.X == b.X || a.Y == b.Y {
+		return true
+	}
+	return (b.X-a.X)*(p.Y-a.Y) == (b.Y-a.Y)*(p.X-a.X)
+}
+
+// unionFind is a disjoint-set forest over ids 0, 1, ...
+type unionFind struct {
+	parent []int
+}
+
+// grow adds n ids and returns the first.
+func (u *unionFind) grow(n int) int {
+	first := len(u.parent)
+	for i := 0; i < n; i++ {
+		u.parent = append(u.parent, first+i)
+	}
+	return first
+}
+
+func (u *unionFind) find(x int) int {
+	for u.parent[x] != x {
+		u.parent[x] = u.parent[u.parent[x]]
+		x = u.parent[x]
+	}
+	return x
+}
+
+func (u *unionFind) union(a, b int) {
+	ra, rb := u.find(a), u.find(b)
+	if ra != rb {
+		u.parent[rb] = ra
+	}
+}
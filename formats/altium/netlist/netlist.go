@@ -0,0 +1,431 @@
+// Package netlist computes the connectivity of a schema.Schematic: which pins
+// are connected, in nets named as Altium names them.
+//
+//	nl, rep := netlist.Build(sch)
+//	for _, n := range nl.Nets {
+//		fmt.Println(n.Name, n.Nodes)
+//	}
+//
+// Wires connect where a vertex of one touches another wire and at junctions;
+// wires that just cross are not connected. Pins, net labels, power ports,
+// ports and sheet entries connect to the wires and pins they touch. Then nets
+// are joined by name:
+//
+//   - power ports of the same net name, in the whole design;
+//   - net labels of the same name, in the same sheet instance, or in the whole
+//     design if it has neither sheet symbols nor ports. A net label with the
+//     name of a power net joins that net;
+//   - the port of a child sheet and the entry of the same name of the sheet
+//     symbol that places it, or, in a flat design (ports but no sheet
+//     symbols), ports of the same name in the whole design.
+//
+// This is Altium's "Automatic" net identifier scope. Sheets placed more than
+// once (repeated channels, or several sheet symbols with the same file) are
+// flattened: each instance has its own parts and nets, and the references in
+// it get the name of the instance as suffix (R1_CH1), as the KiCad emitter
+// annotates them.
+//
+// A net is named by, in order of priority, a net label, a power port, a port
+// or a sheet entry; between names of the same kind, the one nearest the root
+// sheet wins, and then the first in alphabetical order. Net label, port and
+// sheet entry names below the root are local and get the path of their sheet
+// instance as prefix (/CH1/IN). A net without names is named after its first
+// pin, as NetR1_2.
+package netlist
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/rveen/golib/formats/altium/emit"
+	"github.com/rveen/golib/formats/altium/schema"
+)
+
+// Netlist is the connectivity of a design.
+type Netlist struct {
+	Parts []*Part // components of each sheet instance
+	Nets  []*Net  // nets with at least one pin, by name
+
+	nets map[Node]*Net // index of NetOf
+}
+
+// Part is a component in a sheet instance.
+type Part struct {
+	Ref       string // designator, with the suffix of the sheet instance
+	Component *schema.Component
+	Symbol    *schema.Symbol // nil if the schematic does not define it
+	Sheet     *schema.Sheet
+	Path      string // path of the sheet instance, as /CH1; "" at the top
+}
+
+// Pins returns the pins of the part: those of its unit of the symbol, without
+// hidden pins.
+func (p *Part) Pins() []*schema.Pin {
+	if p.Symbol == nil {
+		return nil
+	}
+	return unitPins(p.Component, p.Symbol)
+}
+
+func unitPins(c *schema.Component, sym *schema.Symbol) []*schema.Pin {
+	var pins []*schema.Pin
+	for _, p := range sym.Pins {
+		if !p.Hidden && (sym.UnitCount <= 1 || p.Unit <= 0 || p.Unit == c.Unit) {
+			pins = append(pins, p)
+		}
+	}
+	return pins
+}
+
+// Net is a set of connected pins.
+type Net struct {
+	Name   string
+	Nodes  []Node              // by reference and pin number
+	Prov   schema.Provenance   // of the element that names the net, if any
+	Powers []*schema.PowerPort // power ports on the net, also if a label names it
+}
+
+// Ground returns true if a ground or earth power port is on the net,
+// whatever its name.
+func (n *Net) Ground() bool {
+	for _, p := range n.Powers {
+		if p.Style == schema.PowerStyleGND || p.Style == schema.PowerStyleEarth {
+			return true
+		}
+	}
+	return false
+}
+
+// Node is a pin of a part.
+type Node struct {
+	Part *Part
+	Pin  *schema.Pin
+}
+
+// String returns the node as R1.2 (reference and pin number).
+func (n Node) String() string { return n.Part.Ref + "." + n.Pin.Number }
+
+// Net returns the net with the given name, or nil.
+func (nl *Netlist) Net(name string) *Net {
+	for _, n := range nl.Nets {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// NetOf returns the net of a pin of a part, or nil if the pin is connected
+// to nothing.
+func (nl *Netlist) NetOf(n Node) *Net {
+	if nl.nets == nil {
+		nl.nets = map[Node]*Net{}
+		for _, net := range nl.Nets {
+			for _, nd := range net.Nodes {
+				nl.nets[nd] = net
+			}
+		}
+	}
+	return nl.nets[n]
+}
+
+// Kinds of net names, by priority.
+const (
+	byLabel = iota
+	byPower
+	byPort
+	byEntry
+)
+
+// instance is a placement of a sheet in the design, with its connectivity.
+type instance struct {
+	*schema.SheetInstance
+	parent *instance
+	local  *local
+	base   int // id of its first group in the design
+	first  int // index of its first part
+}
+
+// Build computes the nets of s. Wires without pins and nets with a single pin
+// are reported.
+func Build(s *schema.Schematic) (*Netlist, *emit.Report) {
+
+	rep := &emit.Report{}
+	b := &builder{s: s, rep: rep, locals: map[*schema.Sheet]*local{}}
+	b.instances()
+
+	// The scope of names.
+	hier := false
+	ports := false
+	for _, sh := range s.Sheets {
+		ports = ports || len(sh.Ports) > 0
+		for _, ss := range sh.SubSheets {
+			hier = hier || ss.Child != nil
+		}
+	}
+	b.globalPorts = !hier && ports
+	b.globalLabels = !hier && !ports
+
+	b.join()
+	return b.nets(), rep
+}
+
+type builder struct {
+	s      *schema.Schematic
+	rep    *emit.Report
+	insts  []*instance
+	locals map[*schema.Sheet]*local
+	uf     unionFind
+	parts  []*Part
+
+	globalLabels bool
+	globalPorts  bool
+}
+
+// instances lists the sheet instances (see schema.Schematic.Instances), with
+// their parts.
+func (b *builder) instances() {
+
+	byInst := map[*schema.SheetInstance]*instance{}
+	for _, si := range b.s.Instances() {
+		sh := si.Sheet
+		if b.locals[sh] == nil {
+			b.locals[sh] = connect(sh, b.s.Symbols)
+		}
+		in := &instance{SheetInstance: si, parent: byInst[si.Parent], local: b.locals[sh]}
+		in.base = b.uf.grow(in.local.groups)
+		in.first = len(b.parts)
+		byInst[si] = in
+		b.insts = append(b.insts, in)
+
+		for _, c := range sh.Components {
+			b.parts = append(b.parts, &Part{
+				Ref:       si.Ref(c),
+				Component: c,
+				Symbol:    b.s.Symbols[c.Symbol],
+				Sheet:     sh,
+				Path:      si.Path,
+			})
+		}
+	}
+}
+
+// join joins the groups of all instances by name, and ports to the entries
+// of the sheet symbols placing them.
+func (b *builder) join() {
+
+	power := map[string]int{}
+	for _, in := range b.insts {
+		for _, p := range in.local.powers {
+			b.joinKey(power, p.name, in.base+p.group)
+		}
+	}
+
+	labels := map[string]int{}
+	ports := map[string]int{}
+	for _, in := range b.insts {
+		for _, l := range in.local.labels {
+			if id, ok := power[l.name]; ok {
+				b.uf.union(id, in.base+l.group)
+				continue
+			}
+			key := l.name
+			if !b.globalLabels {
+				key = in.Path + "\x00" + key
+			}
+			b.joinKey(labels, key, in.base+l.group)
+		}
+
+		if b.globalPorts {
+			for _, p := range in.local.ports {
+				b.joinKey(ports, p.name, in.base+p.group)
+			}
+		}
+
+		if in.parent == nil {
+			continue
+		}
+		for _, e := range in.parent.local.entries[in.Via] {
+			if e.repeated {
+				b.rep.Add(emit.Info, in.Via.Prov, "repeated sheet entry %s of %s: bus connections are not followed", e.name, in.Path)
+				continue
+			}
+			for _, p := range in.local.ports {
+				if p.name == e.name {
+					b.uf.union(in.parent.base+e.group, in.base+p.group)
+				}
+			}
+		}
+	}
+}
+
+func (b *builder) joinKey(m map[string]int, key string, id int) {
+	if first, ok := m[key]; ok {
+		b.uf.union(first, id)
+	} else {
+		m[key] = id
+	}
+}
+
+// candidate is a possible name of a net.
+type candidate struct {
+	kind  int
+	depth int
+	name  string
+	prov  schema.Provenance
+}
+
+func (c candidate) less(d candidate) bool {
+	if c.kind != d.kind {
+		return c.kind < d.kind
+	}
+	if c.depth != d.depth {
+		return c.depth < d.depth
+	}
+	return c.name < d.name
+}
+
+// nets collects the pins and names of each net.
+func (b *builder) nets() *Netlist {
+
+	type acc struct {
+		net   *Net
+		name  candidate
+		named bool
+		wire  *schema.Wire
+		sheet *schema.Sheet
+		wired bool // has more than pins
+	}
+	byRoot := map[int]*acc{}
+	var order []*acc
+	get := func(id int) *acc {
+		r := b.uf.find(id)
+		a := byRoot[r]
+		if a == nil {
+			a = &acc{net: &Net{}}
+			byRoot[r] = a
+			order = append(order, a)
+		}
+		return a
+	}
+	offer := func(a *acc, c candidate) {
+		a.wired = true
+		if !a.named || c.less(a.name) {
+			a.name, a.named = c, true
+		}
+	}
+	local := func(in *instance, name string) string {
+		if in.Path == "" {
+			return name
+		}
+		return in.Path + "/" + name
+	}
+
+	for _, in := range b.insts {
+		lc := in.local
+		for _, pa := range lc.pins {
+			a := get(in.base + pa.group)
+			a.net.Nodes = append(a.net.Nodes, Node{Part: b.parts[in.first+pa.comp], Pin: pa.pin})
+		}
+		for i, w := range in.Sheet.Wires {
+			if a := get(in.base + lc.wires[i]); a.wire == nil {
+				a.wire, a.sheet, a.wired = w, in.Sheet, true
+			}
+		}
+		for _, l := range lc.labels {
+			name := l.name
+			if !b.globalLabels {
+				name = local(in, name)
+			}
+			offer(get(in.base+l.group), candidate{byLabel, in.Depth, name, l.prov})
+		}
+		for i, p := range lc.powers {
+			a := get(in.base + p.group)
+			offer(a, candidate{byPower, 0, p.name, p.prov})
+			if pp := in.Sheet.PowerPorts[i]; !hasPower(a.net.Powers, pp) {
+				a.net.Powers = append(a.net.Powers, pp)
+			}
+		}
+		for _, p := range lc.ports {
+			name := p.name
+			if !b.globalPorts {
+				name = local(in, name)
+			}
+			offer(get(in.base+p.group), candidate{byPort, in.Depth, name, p.prov})
+		}
+		for _, ee := range lc.entries {
+			for _, e := range ee {
+				offer(get(in.base+e.group), candidate{byEntry, in.Depth, local(in, e.name), e.prov})
+			}
+		}
+	}
+
+	nl := &Netlist{Parts: b.parts}
+	reported := map[*schema.Wire]bool{}
+	for _, a := range order {
+		net := a.net
+		if len(net.Nodes) == 0 {
+			if a.wire != nil && !reported[a.wire] {
+				reported[a.wire] = true
+				b.rep.Add(emit.Warn, prov(a.wire.Prov, a.sheet), "floating wire at %s: no pins", point(a.wire.Points[0]))
+			}
+			continue
+		}
+		if len(net.Nodes) == 1 && !a.wired {
+			continue // an unconnected pin
+		}
+		sort.Slice(net.Nodes, func(i, j int) bool {
+			x, y := net.Nodes[i], net.Nodes[j]
+			if x.Part.Ref != y.Part.Ref {
+				return schema.NaturalLess(x.Part.Ref, y.Part.Ref)
+			}
+			return schema.NaturalLess(x.Pin.Number, y.Pin.Number)
+		})
+		if a.named {
+			net.Name, net.Prov = a.name.name, a.name.prov
+		} else {
+			net.Name = "Net" + net.Nodes[0].Part.Ref + "_" + net.Nodes[0].Pin.Number
+		}
+		if len(net.Nodes) == 1 {
+			p := net.Nodes[0].Part
+			b.rep.Add(emit.Warn, prov(p.Component.Prov, p.Sheet), "net %s has a single pin, %s", net.Name, net.Nodes[0])
+		}
+		nl.Nets = append(nl.Nets, net)
+	}
+
+	sort.SliceStable(nl.Nets, func(i, j int) bool { return schema.NaturalLess(nl.Nets[i].Name, nl.Nets[j].Name) })
+
+	// Names are unique.
+	count := map[string]int{}
+	for _, n := range nl.Nets {
+		count[n.Name]++
+		if k := count[n.Name]; k > 1 {
+			b.rep.Add(emit.Warn, n.Prov, "net name %s is used by more than one net", n.Name)
+			n.Name += "_" + strconv.Itoa(k)
+		}
+	}
+	return nl
+}
+
+func hasPower(pp []*schema.PowerPort, p *schema.PowerPort) bool {
+	for _, q := range pp {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// prov returns p with the sheet name set.
+func prov(p schema.Provenance, sh *schema.Sheet) schema.Provenance {
+	if p.Sheet == "" {
+		p.Sheet = sh.Name
+	}
+	return p
+}
+
+// point formats a point in mils, as Altium shows them.
+func point(p schema.Point) string {
+	return fmt.Sprintf("(%d, %d)", p.X/25400, p.Y/25400)
+}
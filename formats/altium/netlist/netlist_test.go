@@ -0,0 +1,170 @@
+package netlist_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rveen/golib/formats/altium/altium/project"
+	"github.com/rveen/golib/formats/altium/netlist"
+	"github.com/rveen/golib/formats/altium/schema"
+)
+
+const mil = 25400
+
+func pt(x, y int64) schema.Point { return schema.Point{X: x * mil, Y: y * mil} }
+
+func wire(pts ...schema.Point) *schema.Wire { return &schema.Wire{Points: pts} }
+
+// res is a resistor with pin 1 at (-20, 0) and pin 2 at (60, 0) mils.
+var res = &schema.Symbol{
+	ID:     "res",
+	LibRef: "RES",
+	Pins: []*schema.Pin{
+		{Number: "1", Position: pt(0, 0), PinLength: 20 * mil, Orientation: schema.DirLeft},
+		{Number: "2", Position: pt(40, 0), PinLength: 20 * mil, Orientation: schema.DirRight},
+	},
+}
+
+func part(ref string, at schema.Point) *schema.Component {
+	return &schema.Component{Symbol: "res", Designator: ref, Position: at}
+}
+
+// nets returns the nets as "NAME: R1.1 R2.1" lines.
+func nets(nl *netlist.Netlist) string {
+	var b strings.Builder
+	for _, n := range nl.Nets {
+		fmt.Fprintf(&b, "%s:", n.Name)
+		for _, nd := range n.Nodes {
+			fmt.Fprintf(&b, " %s", nd)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func TestSheet(t *testing.T) {
+	sh := &schema.Sheet{
+		Name: "main",
+		Components: []*schema.Component{
+			part("R1", pt(0, 0)),
+			part("R2", pt(0, -100)),
+			part("R10", pt(500, 0)),
+		},
+		Wires: []*schema.Wire{
+			// R1.2 to R2.2
+			wire(pt(60, 0), pt(100, 0), pt(100, -100), pt(60, -100)),
+			// through R1.1 and R2.1
+			wire(pt(-20, 50), pt(-20, -150)),
+			// crossing both, with a junction on the first only
+			wire(pt(-50, -50), pt(200, -50)),
+			// nowhere
+			wire(pt(300, 300), pt(400, 300)),
+			// R10.2 alone
+			wire(pt(560, 0), pt(600, 0)),
+		},
+		Junctions: []schema.Point{pt(100, -50)},
+		NetLabels: []*schema.NetLabel{{Text: "IN", Pos: pt(-20, 50)}, {Text: "LONE", Pos: pt(600, 0)}},
+	}
+	s := &schema.Schematic{Sheets: []*schema.Sheet{sh}, Symbols: map[schema.SymbolID]*schema.Symbol{"res": res}}
+
+	nl, rep := netlist.Build(s)
+
+	want := "IN: R1.1 R2.1\nLONE: R10.2\nNetR1_2: R1.2 R2.2\n"
+	if got := nets(nl); got != want {
+		t.Errorf("nets\n%s\nwant\n%s", got, want)
+	}
+	if len(nl.Parts) != 3 || nl.Net("IN") == nil {
+		t.Errorf("%d parts", len(nl.Parts))
+	}
+	r1 := nl.Parts[0]
+	if n := nl.NetOf(netlist.Node{Part: r1, Pin: r1.Pins()[1]}); n == nil || n.Name != "NetR1_2" {
+		t.Errorf("R1.2 on %v", n)
+	}
+	if n := nl.NetOf(netlist.Node{Part: nl.Parts[2], Pin: res.Pins[0]}); n != nil {
+		t.Errorf("R10.1 on %s", n.Name)
+	}
+
+	var notes []string
+	for _, n := range rep.Notes {
+		notes = append(notes, n.Message)
+	}
+	want = "net LONE has a single pin, R10.2|floating wire at (300, 300): no pins"
+	if got := strings.Join(notes, "|"); got != want {
+		t.Errorf("notes %q, want %q", got, want)
+	}
+}
+
+// Power ports join nets in the whole design; net labels only in a flat
+// design without ports.
+func TestFlat(t *testing.T) {
+	a := &schema.Sheet{
+		Name:       "a",
+		Components: []*schema.Component{part("R1", pt(0, 0))},
+		Wires:      []*schema.Wire{wire(pt(-40, 0), pt(-20, 0)), wire(pt(60, 0), pt(80, 0))},
+		PowerPorts: []*schema.PowerPort{{NetName: "GND", Pos: pt(-40, 0)}},
+		NetLabels:  []*schema.NetLabel{{Text: "X", Pos: pt(80, 0)}},
+	}
+	b := &schema.Sheet{
+		Name:       "b",
+		Components: []*schema.Component{part("R2", pt(0, 0))},
+		Wires:      []*schema.Wire{wire(pt(-40, 0), pt(-20, 0)), wire(pt(60, 0), pt(80, 0))},
+		NetLabels:  []*schema.NetLabel{{Text: "GND", Pos: pt(-40, 0)}, {Text: "X", Pos: pt(80, 0)}},
+	}
+	s := &schema.Schematic{Sheets: []*schema.Sheet{a, b}, Symbols: map[schema.SymbolID]*schema.Symbol{"res": res}}
+
+	nl, _ := netlist.Build(s)
+	if got, want := nets(nl), "GND: R1.1 R2.1\nX: R1.2 R2.2\n"; got != want {
+		t.Errorf("nets\n%s\nwant\n%s", got, want)
+	}
+	if n := nl.Net("GND"); len(n.Powers) != 1 || n.Ground() {
+		t.Errorf("power ports %v", n.Powers)
+	}
+	a.PowerPorts[0].Style = schema.PowerStyleGND
+	if n := nl.Net("GND"); !n.Ground() {
+		t.Error("not ground")
+	}
+
+	// With a port, labels are local to their sheet and ports are global.
+	b.NetLabels = b.NetLabels[:1]
+	b.Ports = []*schema.Port{{Name: "P", Pos: pt(80, 0), Width: 40 * mil}}
+	nl, _ = netlist.Build(s)
+	if got, want := nets(nl), "GND: R1.1 R2.1\nP: R2.2\nX: R1.2\n"; got != want {
+		t.Errorf("nets\n%s\nwant\n%s", got, want)
+	}
+}
+
+// The demo project has a Power sheet and a Channel sheet repeated twice,
+// with the power output on the net VCC_OUT of the top sheet.
+func TestProject(t *testing.T) {
+	s, _, err := project.Load("../altium/project/testdata/Demo.PrjPcb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nl, rep := netlist.Build(s)
+	for _, n := range rep.Notes {
+		t.Errorf("note: %s", n.Message)
+	}
+
+	want := "GND: C1_CH1.2 C1_CH2.2 R1.1\nVCC_OUT: C1_CH1.1 C1_CH2.1 R1.2\n"
+	if got := nets(nl); got != want {
+		t.Errorf("nets\n%s\nwant\n%s", got, want)
+	}
+
+	var refs []string
+	for _, p := range nl.Parts {
+		refs = append(refs, p.Ref+p.Path)
+	}
+	if got := strings.Join(refs, " "); got != "R1/Power C1_CH1/CH1 C1_CH2/CH2" {
+		t.Errorf("parts %s", got)
+	}
+
+	// Without the top level label, the net is named by a port below, rather
+	// than by a sheet entry.
+	top := s.Sheets[0]
+	top.NetLabels = nil
+	nl, _ = netlist.Build(s)
+	if nl.Net("/CH1/IN") == nil {
+		t.Errorf("nets\n%s", nets(nl))
+	}
+}
@@ -36,6 +36,21 @@ type Board struct {
 	Meta         Meta
 }
 
+// Library is a footprint library (.PcbLib).
+type Library struct {
+	Footprints []*Footprint
+	Meta       Meta
+}
+
+// Footprint is one footprint of a Library. Its primitives are those of a Board
+// with a single Component at the origin, in footprint coordinates; they all
+// belong to that component (Component 0).
+type Footprint struct {
+	Name        string
+	Description string
+	Board       *Board
+}
+
 // Keepout is a rule-area zone derived from an Altium keepout-layer track. The
 // outline is the track's stroke expanded to a closed polygon (a rounded-end
 // stadium), in absolute board coordinates. It spans all copper layers.
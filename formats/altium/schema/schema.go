@@ -9,6 +9,11 @@
 //   - Colour: RGBA (from Altium BGR via convert.BGRToColor).
 package schema
 
+import (
+	"strconv"
+	"strings"
+)
+
 // Length is a distance in nanometres.
 type Length = int64
 
@@ -47,10 +52,156 @@ type Schematic struct {
 // Meta carries schematic-level metadata.
 type Meta struct {
 	SourceFile string
+	Project    string // project name when read from a project file
 	Tool       string // e.g. "Altium Designer"
 	Raw        map[string]string
 }
 
+// Name returns the name of the project, or else of the first sheet with a
+// name; "schematic" if there is none.
+func (s *Schematic) Name() string {
+	if s.Meta.Project != "" {
+		return s.Meta.Project
+	}
+	for _, sh := range s.Sheets {
+		if sh.Name != "" {
+			return sh.Name
+		}
+	}
+	return "schematic"
+}
+
+// Roots returns the sheets that are not the child of any sheet symbol, in
+// sheet order. A hierarchical design has one; a flat project has one per
+// sheet.
+func (s *Schematic) Roots() []*Sheet {
+	child := map[*Sheet]bool{}
+	for _, sh := range s.Sheets {
+		for _, ss := range sh.SubSheets {
+			if ss.Child != nil {
+				child[ss.Child] = true
+			}
+		}
+	}
+	var roots []*Sheet
+	for _, sh := range s.Sheets {
+		if !child[sh] {
+			roots = append(roots, sh)
+		}
+	}
+	return roots
+}
+
+// SheetInstance is a placement of a sheet in the design.
+type SheetInstance struct {
+	Sheet  *Sheet
+	Path   string // as /CH1; "" for a top-level sheet
+	Suffix string // of the references in it, as _CH1
+	Depth  int
+	Parent *SheetInstance
+	Via    *SheetSymbol // the sheet symbol placing it in Parent
+}
+
+// Ref returns the reference of a component of the sheet in this instance:
+// its designator with the suffix of the instance.
+func (in *SheetInstance) Ref(c *Component) string {
+	return c.Designator + in.Suffix
+}
+
+// Instances returns the sheet instances of the design, depth first from each
+// root (see Roots), and then the sheets that are not reached from a root.
+// Sheets placed more than once (repeated channels, or several sheet symbols
+// with the same file) have one instance per placement, whose references get
+// the name of the instance as suffix (R1_CH1). A sheet that places itself,
+// directly or not, is not followed again.
+func (s *Schematic) Instances() []*SheetInstance {
+
+	placed := map[*Sheet]int{}
+	for _, sh := range s.Sheets {
+		for _, ss := range sh.SubSheets {
+			if ss.Child != nil {
+				placed[ss.Child] += len(ss.Instances())
+			}
+		}
+	}
+
+	var insts []*SheetInstance
+	reached := map[*Sheet]bool{}
+	stack := map[*Sheet]bool{}
+	var visit func(in *SheetInstance)
+	visit = func(in *SheetInstance) {
+		sh := in.Sheet
+		reached[sh] = true
+		stack[sh] = true
+		defer delete(stack, sh)
+
+		insts = append(insts, in)
+
+		for _, ss := range sh.SubSheets {
+			if ss.Child == nil || stack[ss.Child] {
+				continue
+			}
+			for _, name := range ss.Instances() {
+				suffix := in.Suffix
+				if ss.Repeat != nil || placed[ss.Child] > 1 {
+					suffix += "_" + name
+				}
+				visit(&SheetInstance{
+					Sheet:  ss.Child,
+					Path:   in.Path + "/" + name,
+					Suffix: suffix,
+					Depth:  in.Depth + 1,
+					Parent: in,
+					Via:    ss,
+				})
+			}
+		}
+	}
+
+	for _, sh := range s.Roots() {
+		visit(&SheetInstance{Sheet: sh})
+	}
+	for _, sh := range s.Sheets {
+		if !reached[sh] {
+			visit(&SheetInstance{Sheet: sh})
+		}
+	}
+	return insts
+}
+
+// NaturalLess compares strings with numbers in them by value: R2 < R10,
+// C1_CH2 < C1_CH10. Nets, parts and the lines of a BOM are sorted with it.
+func NaturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := digits(a), digits(b)
+		if da > 0 && db > 0 {
+			na := strings.TrimLeft(a[:da], "0")
+			nb := strings.TrimLeft(b[:db], "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[da:], b[db:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func digits(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return i
+}
+
 // ---------- Sheet ----------
 
 // Sheet is one schematic page.
@@ -114,6 +265,7 @@ type Component struct {
 	Unit           int // 1-based; multi-part symbols
 	BodyStyle      int // 1 = normal, 2 = De Morgan
 	Fields         []Field
+	Footprint      string // current PCB footprint (model name), if linked
 	Prov           Provenance
 }
 
@@ -139,6 +291,42 @@ func (c *Component) Value() (text string, font FontRef, ok bool) {
 	return "", 0, false
 }
 
+// ResolvedValue returns the component's value/comment text as Altium shows
+// it: a value as =Name is replaced by the value of the parameter Name (empty
+// if there is no such parameter).
+func (c *Component) ResolvedValue() string {
+	v, _, _ := c.Value()
+	if len(v) > 1 && v[0] == '=' {
+		v, _ = c.Param(v[1:])
+	}
+	return v
+}
+
+// Param returns the value of the named parameter (field) of the component,
+// matching the name without case, and whether the component has it.
+func (c *Component) Param(name string) (string, bool) {
+	for i := range c.Fields {
+		if equalFold(c.Fields[i].Name, name) {
+			return c.Fields[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// Abs returns the sheet position of a point in the component-local frame
+// (as the pins of its symbol), re-applying the component rotation.
+func (c *Component) Abs(local Point) Point {
+	switch int(c.Rotation+0.5) % 360 {
+	case 90:
+		local = Point{X: -local.Y, Y: local.X}
+	case 180:
+		local = Point{X: -local.X, Y: -local.Y}
+	case 270:
+		local = Point{X: local.Y, Y: -local.X}
+	}
+	return Point{X: c.Position.X + local.X, Y: c.Position.Y + local.Y}
+}
+
 // equalFold reports whether a and b are equal under simple ASCII case folding.
 // Kept local so the schema package stays dependency-free.
 func equalFold(a, b string) bool {
@@ -170,6 +358,12 @@ type Symbol struct {
 	Pins       []*Pin
 	Graphics   []Graphic
 	Prov       Provenance
+
+	// Library properties, set for symbols read from a library (.SchLib).
+	Designator  string  // default designator, as U?
+	Description string  // component description
+	Footprint   string  // current PCB footprint (model name)
+	Fields      []Field // parameters, in symbol coordinates
 }
 
 // Pin is a connection point of a symbol.
@@ -188,6 +382,23 @@ type Pin struct {
 	Prov          Provenance
 }
 
+// Hotspot returns the wire-connection end of the pin in the symbol frame:
+// Position is the body end, and the pin extends PinLength in its orientation.
+func (p *Pin) Hotspot() Point {
+	x, y, l := p.Position.X, p.Position.Y, p.PinLength
+	switch p.Orientation {
+	case DirRight:
+		return Point{X: x + l, Y: y}
+	case DirLeft:
+		return Point{X: x - l, Y: y}
+	case DirUp:
+		return Point{X: x, Y: y + l}
+	case DirDown:
+		return Point{X: x, Y: y - l}
+	}
+	return p.Position
+}
+
 // Field is any named property: designator, value, footprint link, custom param.
 type Field struct {
 	Name    string
@@ -250,6 +461,8 @@ type Port struct {
 type SheetSymbol struct {
 	FileName string
 	Name     string
+	Repeat   *Repeat // non-nil for a repeated channel
+	Child    *Sheet  // the sheet in FileName, once resolved
 	Box      RectBox
 	Style    Stroke
 	Fill     *Color
@@ -257,11 +470,32 @@ type SheetSymbol struct {
 	Prov     Provenance
 }
 
+// Repeat is the channel range of a repeated sheet symbol, named
+// Repeat(Name,First,Last) in Altium: the child sheet is placed once per
+// channel, as Name+First ... Name+Last.
+type Repeat struct {
+	First, Last int
+}
+
+// Instances returns the names of the sheet instances of a sheet symbol: its
+// name, or one name per channel.
+func (ss *SheetSymbol) Instances() []string {
+	if ss.Repeat == nil {
+		return []string{ss.Name}
+	}
+	var names []string
+	for i := ss.Repeat.First; i <= ss.Repeat.Last; i++ {
+		names = append(names, ss.Name+strconv.Itoa(i))
+	}
+	return names
+}
+
 // SheetEntry is a port on a SheetSymbol.
 type SheetEntry struct {
 	Name      string
 	Direction PortDir
 	Pos       Point
+	Repeated  bool // Repeat(Name): one bus element per channel
 }
 
 // Text is a free-standing text annotation on a sheet.
@@ -6,6 +6,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/rveen/golib/fn/filetype"
+	"github.com/rveen/golib/fs/gitfs"
 	"github.com/rveen/golib/fs/svnfs"
 	"github.com/rveen/golib/fs/types"
 	"github.com/rveen/ogdl"
@@ -60,9 +62,8 @@ func (fs *fileSystem) Get(path, rev string) (*types.FileEntry, error) {
 	}
 
 	switch dir.Type {
-	case "svn":
-		svn := svnfs.New(path)
-		return svn.Get(path, rev)
+	case "svn", "git":
+		return repo(dir.Type, fs.root).Get(opath, rev)
 	}
 
 	fe := &types.FileEntry{}
@@ -128,12 +129,9 @@ func (fs *fileSystem) Get(path, rev string) (*types.FileEntry, error) {
 			}
 			dir = fe
 
-		case "git":
-			// A Git server repository
-			//return GetGit(path, parts, i, -1)
-
-		case "svn":
-			svn := svnfs.New(path)
+		case "svn", "git":
+			// A server repository
+			r := repo(fe.Type, fs.root+"/"+path)
 			dpath := ""
 			rev = "HEAD"
 
@@ -157,7 +155,7 @@ func (fs *fileSystem) Get(path, rev string) (*types.FileEntry, error) {
 				dpath = dpath[1:]
 			}
 
-			return svn.Get(dpath, rev)
+			return r.Get(dpath, rev)
 
 		case "data/ogdl":
 
@@ -212,6 +210,17 @@ func (fs *fileSystem) Get(path, rev string) (*types.FileEntry, error) {
 
 		default:
 
+			if h := filetype.Lookup(path); i < len(parts)-1 && h != nil && fe.Type != "text/markdown" {
+
+				// A type known to package filetype: navigate with its handler
+				fe.Content, _ = fs.File(path, rev)
+				fe.Param = params
+				fe.Name = path
+				fe.Prepare()
+				fe.Data = h.Get(fe.Data, parts[i+1:])
+				return fe, nil
+			}
+
 			if i < len(parts)-1 {
 				if fe.Type != "text/markdown" {
 					// A file (with no known structure). No more parts can be handled.
@@ -303,9 +312,8 @@ func (fs *fileSystem) GetRaw(path, rev string) (*types.FileEntry, error) {
 	}
 
 	switch dir.Type {
-	case "svn":
-		svn := svnfs.New(path)
-		return svn.Get(path, rev)
+	case "svn", "git":
+		return repo(dir.Type, fs.root).Get(opath, rev)
 	}
 
 	fe := &types.FileEntry{}
@@ -371,12 +379,9 @@ func (fs *fileSystem) GetRaw(path, rev string) (*types.FileEntry, error) {
 			}
 			dir = fe
 
-		case "git":
-			// A Git server repository
-			//return GetGit(path, parts, i, -1)
-
-		case "svn":
-			svn := svnfs.New(path)
+		case "svn", "git":
+			// A server repository
+			r := repo(fe.Type, fs.root+"/"+path)
 			dpath := ""
 			rev = "HEAD"
 
@@ -400,7 +405,7 @@ func (fs *fileSystem) GetRaw(path, rev string) (*types.FileEntry, error) {
 				dpath = dpath[1:]
 			}
 
-			return svn.Get(dpath, rev)
+			return r.Get(dpath, rev)
 
 		case "data/ogdl":
 
@@ -485,6 +490,20 @@ func (fs *fileSystem) GetRaw(path, rev string) (*types.FileEntry, error) {
 	return dir, nil
 }
 
+// versioned is what Get needs from the SVN and Git file systems.
+type versioned interface {
+	Get(path, rev string) (*types.FileEntry, error)
+}
+
+// repo returns the versioned file system of type typ ("svn" or "git") rooted
+// at path.
+func repo(typ, path string) versioned {
+	if typ == "git" {
+		return gitfs.New(path)
+	}
+	return svnfs.New(path)
+}
+
 // returns the missing extension if found, else "".
 func missingExtension(fs FileSystem, dir *types.FileEntry, part, rev string) string {
 
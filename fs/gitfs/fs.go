@@ -0,0 +1,351 @@
+// Git API for accessing LOCAL bare repositories.
+//
+// Uses the git command as interface, with --git-dir pointing to the
+// repository, so that the object store is read directly and no working copy
+// or network access is needed. Revisions can be commit hashes, tags or
+// branches.
+package gitfs
+
+import (
+	"errors"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rveen/golib/fs/types"
+
+	"github.com/rveen/ogdl"
+)
+
+type fileSystem struct {
+	root string
+}
+
+func New(root string) *fileSystem {
+	fs := &fileSystem{}
+	fs.root, _ = filepath.Abs(root)
+	return fs
+}
+
+func (fs *fileSystem) Root() string {
+	return fs.root
+}
+
+func (fs *fileSystem) Type() string {
+	return "git"
+}
+
+func (fs *fileSystem) git(args ...string) ([]byte, error) {
+	return exec.Command("git", append([]string{"--git-dir", fs.root}, args...)...).Output()
+}
+
+// object returns the git object name of path at rev, as in 'HEAD:dir/file'.
+func object(path, rev string) string {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	path = strings.TrimPrefix(path, "/")
+	if path == "." {
+		path = ""
+	}
+	return rev + ":" + path
+}
+
+// CheckRevision returns an error for revisions that git would read as an
+// option, as '--output=file'.
+func CheckRevision(rev string) error {
+	if strings.HasPrefix(rev, "-") {
+		return errors.New("invalid revision: " + rev)
+	}
+	return nil
+}
+
+// LogArgs returns the arguments of the git log of path at rev, whose output
+// is read by ParseLog.
+func LogArgs(path, rev string) []string {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	args := []string{"log", "--name-status", "--format=%x1e%H%x1f%an%x1f%aI%x1f%B%x1f", rev}
+	if path = strings.TrimPrefix(path, "/"); path != "" && path != "." {
+		args = append(args, "--", path)
+	}
+	return args
+}
+
+// ParseLog converts the output of a git log run with LogArgs into the same
+// structure as svnfs.Log:
+//
+//	log
+//	  logentry
+//	    @revision sha
+//	    author name
+//	    date 2006-01-02T15:04:05Z07:00
+//	    msg text
+//	    paths
+//	      path
+//	        @action M
+//	        name file
+func ParseLog(b []byte) *ogdl.Graph {
+
+	g := ogdl.New(nil)
+	l := g.Add("log")
+
+	for _, rec := range strings.Split(string(b), "\x1e") {
+
+		f := strings.SplitN(rec, "\x1f", 5)
+		if len(f) < 5 {
+			continue
+		}
+
+		e := l.Add("logentry")
+		e.Add("@revision").Add(f[0])
+		e.Add("author").Add(f[1])
+		e.Add("date").Add(f[2])
+		e.Add("msg").Add(strings.TrimSpace(f[3]))
+
+		paths := e.Add("paths")
+		for _, line := range strings.Split(f[4], "\n") {
+			ss := strings.Split(strings.TrimSpace(line), "\t")
+			if len(ss) < 2 {
+				continue
+			}
+			p := paths.Add("path")
+			p.Add("@action").Add(ss[0][:1])
+			p.Add("name").Add(ss[len(ss)-1])
+		}
+	}
+
+	return g
+}
+
+// Log returns the commits that touch path, see ParseLog.
+func (fs *fileSystem) Log(path, rev string) (*ogdl.Graph, error) {
+
+	if err := CheckRevision(rev); err != nil {
+		return nil, err
+	}
+
+	b, err := fs.git(LogArgs(path, rev)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseLog(b), nil
+}
+
+func (fs *fileSystem) File(path, rev string) ([]byte, error) {
+
+	if err := CheckRevision(rev); err != nil {
+		return nil, err
+	}
+
+	b, err := fs.git("cat-file", "blob", object(path, rev))
+
+	log.Println("gitfs.File()", path, rev, len(b))
+
+	return b, err
+}
+
+// Revisions returns the log of path. Unlike in SVN, paths do not need to be
+// traced, since Git does not record moves.
+func (fs *fileSystem) Revisions(path, rev string) (*ogdl.Graph, error) {
+
+	path = strings.TrimSuffix(path, "@")
+	return fs.Log(path, rev)
+}
+
+func (fs *fileSystem) Get(path, rev string) (*types.FileEntry, error) {
+
+	log.Println("git.Get", path, rev)
+
+	var err error
+	fe := &types.FileEntry{}
+
+	if rev == "" {
+		rev = "HEAD"
+	}
+
+	// Prepare and clean path
+	path = filepath.Clean(path)
+
+	if path[len(path)-1] == '@' {
+		fe.Data, err = fs.Revisions(path[:len(path)-1], rev)
+		fe.Type = "revs"
+		fe.Name = path
+		return fe, err
+	}
+
+	if strings.Contains(rev, "..") {
+		return fs.Diff(path, rev)
+	}
+
+	fe, err = fs.Info(path, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	switch fe.Type {
+
+	case "dir":
+		err = fs.Index(fe, path, rev)
+
+	case "file":
+		fe.Content, err = fs.File(path, rev)
+		fe.Name = path
+		fe.Prepare()
+	}
+	return fe, err
+}
+
+// Diff returns the differences of the file at path between two revisions given
+// as "from..to" (see types.Diff).
+func (fs *fileSystem) Diff(path, rev string) (*types.FileEntry, error) {
+	return types.Diff(path, rev, fs.File)
+}
+
+// Index checks if there are index.* files in the given directory
+//
+// - index.ogdl -> graph
+// - index.* -> string (if there are several, take highest in the list (htm, md, ...)
+// - dir info -> graph.dir (only if index.nolist is not found)
+//
+// The same file entry is used as output. It just adds the content of the index file
+// if found.
+func (fs *fileSystem) Index(d *types.FileEntry, path, rev string) error {
+
+	nodir := false
+
+	ff, err := fs.Dir(path, rev)
+	if err != nil {
+		return err
+	}
+	d.Content = nil
+
+	// Read any index.* files
+	for _, f := range ff {
+		name := f.Name
+
+		if name == "index.link" {
+			continue
+		}
+
+		if name == "index.nolist" {
+			nodir = true
+			continue
+		}
+
+		if name == "index.ogdl" {
+			b, err := fs.File(path+"/index.ogdl", rev)
+			if err != nil {
+				return err
+			}
+			d.Data = ogdl.FromString(string(b))
+			continue
+		}
+
+		// Index files overwrite readme's
+		if strings.HasPrefix(name, "index.") {
+			b, _ := fs.File(path+"/"+name, rev)
+			d.Content = b
+			d.Name = path + "/" + name
+			d.Prepare()
+			continue
+		}
+
+		// The readme file is only read in if no index file is present
+		if d.Content == nil && strings.HasPrefix(strings.ToLower(name), "readme.") {
+			b, _ := fs.File(path+"/"+name, rev)
+			d.Content = b
+			d.Name = path + "/" + name
+			d.Prepare()
+		}
+	}
+
+	if nodir {
+		return nil
+	}
+
+	dir := ogdl.New("dir")
+
+	for _, f := range ff {
+		gd := dir.Add("-")
+		gd.Add("name").Add(f.Name)
+		gd.Add("type").Add(f.Type)
+	}
+
+	d.Data = dir
+	return nil
+}
+
+// Info returns the type ("dir" or "file") and size of path at the given revision.
+func (fs *fileSystem) Info(path, rev string) (*types.FileEntry, error) {
+
+	if err := CheckRevision(rev); err != nil {
+		return nil, err
+	}
+
+	obj := object(path, rev)
+
+	b, err := fs.git("cat-file", "-t", obj)
+	if err != nil {
+		return nil, errors.New("not found: " + obj)
+	}
+
+	fe := &types.FileEntry{Name: path}
+
+	switch strings.TrimSpace(string(b)) {
+	case "tree":
+		fe.Type = "dir"
+	case "blob":
+		fe.Type = "file"
+		b, err = fs.git("cat-file", "-s", obj)
+		if err == nil {
+			fe.Size, _ = strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+		}
+	default:
+		return nil, errors.New("not a file or directory: " + obj)
+	}
+
+	return fe, nil
+}
+
+func (fs *fileSystem) Dir(path, rev string) ([]*types.FileEntry, error) {
+
+	if err := CheckRevision(rev); err != nil {
+		return nil, err
+	}
+
+	b, err := fs.git("ls-tree", "-z", "-l", object(path, rev))
+	if err != nil {
+		return nil, err
+	}
+
+	var dir []*types.FileEntry
+
+	for _, e := range strings.Split(string(b), "\x00") {
+
+		// <mode> SP <type> SP <object> SP <size> TAB <name>
+		i := strings.IndexByte(e, '\t')
+		if i == -1 {
+			continue
+		}
+		meta := strings.Fields(e[:i])
+		if len(meta) < 4 {
+			continue
+		}
+
+		f := &types.FileEntry{Name: e[i+1:]}
+		if meta[1] == "tree" {
+			f.Type = "dir"
+		} else {
+			f.Type = "file"
+			f.Size, _ = strconv.ParseInt(meta[3], 10, 64)
+		}
+		dir = append(dir, f)
+	}
+
+	return dir, nil
+}
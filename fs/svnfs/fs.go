@@ -219,6 +219,10 @@ func (fs *fileSystem) Get(path, rev string) (*types.FileEntry, error) {
 		return fe, err
 	}
 
+	if strings.Contains(rev, "..") {
+		return fs.Diff(path, rev)
+	}
+
 	fi, err := fs.Info(path, rev)
 
 	if fi == nil {
@@ -246,6 +250,12 @@ func (fs *fileSystem) Get(path, rev string) (*types.FileEntry, error) {
 	return fe, err
 }
 
+// Diff returns the differences of the file at path between two revisions given
+// as "from..to" (see types.Diff).
+func (fs *fileSystem) Diff(path, rev string) (*types.FileEntry, error) {
+	return types.Diff(path, rev, fs.File)
+}
+
 // Index checks if there are index.* files, and the dir info (list).
 //
 // - index.ogdl -> graph
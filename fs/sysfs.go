@@ -2,7 +2,7 @@
 // specifying paths in the file system, it returns directories, files and part of files
 // (specific types of files) that correspond to that path. The particularity of this
 // package is that it allows navigation into either conventional or versioned file
-// systems (Subversion at the moment), data files (OGDL at the moment) and markdown
+// systems (Subversion and Git), data files (OGDL at the moment) and markdown
 // document.
 //
 // Use of file extensions is optional (if the file name is unique).
@@ -198,7 +198,7 @@ func (fs *fileSystem) Info(path, rev string) (*types.FileEntry, error) {
 		case "HEAD":
 			gscore++
 			if gscore > 1 {
-				fe.Type = "svn"
+				fe.Type = "git"
 				return fe, nil
 			}
 		}
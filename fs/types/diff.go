@@ -0,0 +1,43 @@
+package types
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/rveen/golib/diff"
+)
+
+// Diff returns the differences of the file at path between two revisions given
+// as "from..to", reading each version with file. An empty revision means
+// HEAD. fe.Data holds the differences as returned by diff.Revisions and
+// fe.Content a unified diff.
+func Diff(path, rev string, file func(path, rev string) ([]byte, error)) (*FileEntry, error) {
+
+	i := strings.Index(rev, "..")
+	if i == -1 {
+		return nil, errors.New("not a revision range: " + rev)
+	}
+	from, to := rev[:i], rev[i+2:]
+	if from == "" {
+		from = "HEAD"
+	}
+	if to == "" {
+		to = "HEAD"
+	}
+
+	a, err := file(path, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := file(path, to)
+	if err != nil {
+		return nil, err
+	}
+
+	fe := &FileEntry{Name: path, Type: "diff"}
+	var u string
+	fe.Data, u = diff.Revisions(path, from, to, a, b)
+	fe.Content = []byte(u)
+
+	return fe, nil
+}
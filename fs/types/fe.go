@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/rveen/golib/document"
+	"github.com/rveen/golib/fn/filetype"
 	"github.com/rveen/ogdl"
 )
 
@@ -51,7 +52,8 @@ func (f *FileEntry) IsDir() bool {
 	return f.Type == "dir" || f.IsDirectory
 }
 
-// Prepare preprocesses some types of files: markdown, templates.
+// Prepare preprocesses some types of files: markdown, templates, and those
+// with a handler in package filetype, which are parsed into f.Data (or f.Doc).
 func (f *FileEntry) Prepare() {
 
 	// set MIME type
@@ -73,5 +75,7 @@ func (f *FileEntry) Prepare() {
 		f.Type = "m"
 		f.Doc = doc
 
+	} else if h := filetype.Lookup(f.Name); h != nil {
+		f.Data, f.Doc, _ = h.Parse(f.Content)
 	}
 }
@@ -2,8 +2,8 @@ package gosql
 
 import (
 	"database/sql"
+	"errors"
 	"log"
-	"strings"
 
 	_ "github.com/denisenkom/go-mssqldb"
 	_ "github.com/go-sql-driver/mysql"
@@ -12,7 +12,9 @@ import (
 )
 
 type Db struct {
-	Db *sql.DB
+	Db     *sql.DB
+	driver string
+	schema Schema
 }
 
 func Open(typ, uri string) (*Db, error) {
@@ -21,6 +23,7 @@ func Open(typ, uri string) (*Db, error) {
 	var err error
 
 	db.Db, err = sql.Open(typ, uri)
+	db.driver = typ
 	return &db, err
 }
 
@@ -32,6 +35,8 @@ func (db *Db) Open(typ, uri string) error {
 	}
 
 	db.Db, err = sql.Open(typ, uri)
+	db.driver = typ
+	db.schema.Forget("")
 	return err
 }
 
@@ -40,75 +45,31 @@ func (db *Db) Close() {
 	db.Db = nil
 }
 
+// Exec inserts, updates or deletes a row as described in g (see Statement).
+// Values are passed as statement parameters, never as part of the SQL text.
 func (db *Db) Exec(g *ogdl.Graph) error {
 
-	var err error
-
-	f := g.Node("f").String()
-	tb := g.Node("tb").String()
-
-	// fields that are int: ints="a,b,c"
-	ints := g.Node("ints").String()
-	ii := strings.Split(ints, ",")
-
-	obj := g.Node("obj")
-
-	fields := ""
-	values := ""
-	upd := ""
-	for _, f := range obj.Out {
-
-		fname := f.ThisString()
-
-		fields += ", `" + fname + "`"
-		upd += ", `" + fname + "` = "
+	if db.Db == nil {
+		return errors.New("database not open")
+	}
 
-		// is the field an 'int' ?
-		isInt := false
-		for _, i := range ii {
-			if i == fname {
-				isInt = true
-			}
-		}
+	d := DialectOf(db.driver)
+	if d == nil {
+		return errors.New("unknown database driver: " + db.driver)
+	}
 
-		if isInt {
-			values += ", " + f.String()
-			upd += f.String()
-		} else {
-			values += ", '" + f.String() + "'"
-			upd += "'" + f.String() + "'"
-		}
+	t, err := db.schema.Table(db.Db, d, g.Node("tb").String())
+	if err != nil {
+		return err
 	}
-	fields = fields[2:]
-	values = values[2:]
-	upd = upd[2:]
-
-	switch f {
-	case "add":
-		fallthrough
-	case "replace":
-		q := "replace into " + tb + " (" + fields + ") values (" + values + ")"
-		log.Printf("gosql.Exec: %s\n", q)
-
-		_, err = db.Db.Exec(q)
-	case "insert":
-		q := "insert into " + tb + " (" + fields + ") values (" + values + ")"
-		log.Printf("gosql.Exec: %s\n", q)
-		_, err = db.Db.Exec(q)
-
-	case "delete":
-		where := g.Node("where").String()
-		q := "delete from " + tb + " where " + where
-		log.Printf("gosql.Exec: %s\n", q)
-		_, err = db.Db.Exec(q)
-
-	case "update":
-		where := g.Node("where").String()
-		q := "UPDATE " + tb + " SET " + upd + " WHERE " + where
-		log.Printf("gosql.Exec: %s\n", q)
-		_, err = db.Db.Exec(q)
+
+	q, args, err := Statement(d, t, g)
+	if err != nil {
+		return err
 	}
 
+	log.Printf("gosql.Exec: %s\n", q)
+	_, err = db.Db.Exec(q, args...)
 	return err
 }
 
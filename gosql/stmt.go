@@ -0,0 +1,528 @@
+package gosql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rveen/ogdl"
+)
+
+// Dialect describes how a database driver quotes identifiers and writes
+// statement parameters.
+type Dialect struct {
+	Name        string
+	Quote       func(name string) string
+	Placeholder func(n int) string // n starts at 1
+	MaxParams   int                // parameters per statement
+}
+
+var dialects = map[string]*Dialect{
+	"mysql": {
+		Name:        "mysql",
+		Quote:       func(s string) string { return "`" + s + "`" },
+		Placeholder: func(int) string { return "?" },
+		MaxParams:   65535,
+	},
+	"mssql": {
+		Name:        "mssql",
+		Quote:       func(s string) string { return "[" + s + "]" },
+		Placeholder: func(n int) string { return "@p" + strconv.Itoa(n) },
+		MaxParams:   2000, // the limit is 2100, including internal ones
+	},
+	"postgres": {
+		Name:        "postgres",
+		Quote:       func(s string) string { return `"` + s + `"` },
+		Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+		MaxParams:   65535,
+	},
+	"sqlite": {
+		Name:        "sqlite",
+		Quote:       func(s string) string { return `"` + s + `"` },
+		Placeholder: func(int) string { return "?" },
+		MaxParams:   999,
+	},
+}
+
+// DialectOf returns the dialect for a driver name as given to sql.Open, or nil
+// if the driver is unknown.
+func DialectOf(driver string) *Dialect {
+	switch driver {
+	case "sqlserver":
+		driver = "mssql"
+	case "pgx":
+		driver = "postgres"
+	case "sqlite3":
+		driver = "sqlite"
+	}
+	return dialects[driver]
+}
+
+// Column is a column of a table, as reported by the database.
+type Column struct {
+	Name     string
+	Type     string // database type name, such as VARCHAR or INT
+	Nullable bool
+}
+
+// Table is the list of columns of a table.
+type Table struct {
+	Name    string
+	Columns []Column
+}
+
+// Column returns the column with the name given (case insensitive), or nil.
+func (t *Table) Column(name string) *Column {
+	for i := range t.Columns {
+		if t.Columns[i].Name == name {
+			return &t.Columns[i]
+		}
+	}
+	for i := range t.Columns {
+		if strings.EqualFold(t.Columns[i].Name, name) {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+// Schema caches the tables of a database.
+type Schema struct {
+	mu     sync.Mutex
+	tables map[string]*Table
+}
+
+// Queryer is a *sql.DB or *sql.Tx.
+type Queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Table returns the columns of a table. They are read from the database the
+// first time and cached.
+func (s *Schema) Table(db Queryer, d *Dialect, name string) (*Table, error) {
+
+	s.mu.Lock()
+	t := s.tables[name]
+	s.mu.Unlock()
+	if t != nil {
+		return t, nil
+	}
+
+	qn, err := QuoteName(d, name)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT * FROM " + qn + " WHERE 1=0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ct, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	t = &Table{Name: name}
+	for _, c := range ct {
+		nullable, ok := c.Nullable()
+		t.Columns = append(t.Columns, Column{Name: c.Name(), Type: strings.ToUpper(c.DatabaseTypeName()), Nullable: nullable || !ok})
+	}
+
+	s.mu.Lock()
+	if s.tables == nil {
+		s.tables = make(map[string]*Table)
+	}
+	s.tables[name] = t
+	s.mu.Unlock()
+
+	return t, nil
+}
+
+// Forget removes a table from the cache, or all tables if name is empty. Call
+// it after changing the structure of a table.
+func (s *Schema) Forget(name string) {
+	s.mu.Lock()
+	if name == "" {
+		s.tables = nil
+	} else {
+		delete(s.tables, name)
+	}
+	s.mu.Unlock()
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// QuoteName validates and quotes a table name, which may be qualified
+// (schema.table).
+func QuoteName(d *Dialect, name string) (string, error) {
+
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		if !identifier.MatchString(p) {
+			return "", errors.New("invalid table name: " + name)
+		}
+		parts[i] = d.Quote(p)
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// TableQuery returns a query that counts the tables with the name given,
+// which may be qualified (schema.table), in the catalog of the database. An
+// unqualified name is looked up in the current schema.
+func TableQuery(d *Dialect, name string) (string, []interface{}, error) {
+
+	if _, err := QuoteName(d, name); err != nil {
+		return "", nil, err
+	}
+	schema, table, qualified := strings.Cut(name, ".")
+	if !qualified {
+		table = schema
+	}
+
+	var q, current string
+	switch d.Name {
+	case "sqlite":
+		if qualified {
+			return "SELECT count(*) FROM " + d.Quote(schema) + ".sqlite_master WHERE type = 'table' AND name = ? COLLATE NOCASE",
+				[]interface{}{table}, nil
+		}
+		return "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ? COLLATE NOCASE", []interface{}{table}, nil
+	case "postgres":
+		q, current = "SELECT count(*) FROM information_schema.tables WHERE table_name = $1 AND table_schema = ", "current_schema()"
+	case "mysql":
+		q, current = "SELECT count(*) FROM information_schema.tables WHERE table_name = ? AND table_schema = ", "DATABASE()"
+	case "mssql":
+		q, current = "SELECT count(*) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_NAME = @p1 AND TABLE_SCHEMA = ", "SCHEMA_NAME()"
+	default:
+		return "", nil, errors.New("no catalog query for " + d.Name)
+	}
+	if qualified {
+		return q + d.Placeholder(2), []interface{}{table, schema}, nil
+	}
+	return q + current, []interface{}{table}, nil
+}
+
+// Statement builds a parameterized statement from a graph with the following
+// nodes:
+//
+//	f         insert, update, delete, replace (MySQL and SQLite only; add is the same)
+//	tb        table
+//	obj       column value pairs
+//	where     condition for update and delete
+//	rawwhere  SQL condition for update and delete, instead of where
+//
+// The columns in obj must exist in the table. Their values are converted to
+// the column type: numbers, times (RFC 3339, "2006-01-02 15:04:05" or
+// "2006-01-02") and binary. A column without a value, or an empty value in a
+// column that is not text, is NULL.
+//
+// The where node is a list of column value pairs, which must all be equal (a
+// column without value is NULL). A where node with a single string is
+// rejected: an SQL condition can only be given as rawwhere, which is used as
+// is and therefore must never contain user input.
+func Statement(d *Dialect, t *Table, g *ogdl.Graph) (string, []interface{}, error) {
+
+	f := g.Node("f").String()
+
+	tb, err := QuoteName(d, t.Name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var cols []string
+	var args []interface{}
+
+	if obj := g.Node("obj"); obj != nil {
+		for _, n := range obj.Out {
+			c := t.Column(n.ThisString())
+			if c == nil {
+				return "", nil, fmt.Errorf("table %s has no column %s", t.Name, n.ThisString())
+			}
+			v, err := value(c, n)
+			if err != nil {
+				return "", nil, err
+			}
+			cols = append(cols, d.Quote(c.Name))
+			args = append(args, v)
+		}
+	}
+
+	switch f {
+	case "add", "replace", "insert", "update":
+		if len(cols) == 0 {
+			return "", nil, errors.New(f + " without fields")
+		}
+	}
+
+	switch f {
+	case "add", "replace":
+		if d.Name != "mysql" && d.Name != "sqlite" {
+			return "", nil, errors.New(f + " is not supported by " + d.Name)
+		}
+		return "REPLACE INTO " + tb + " (" + strings.Join(cols, ", ") + ") VALUES (" + Placeholders(d, 1, len(cols)) + ")", args, nil
+
+	case "insert":
+		return "INSERT INTO " + tb + " (" + strings.Join(cols, ", ") + ") VALUES (" + Placeholders(d, 1, len(cols)) + ")", args, nil
+
+	case "update":
+		set := make([]string, len(cols))
+		for i, c := range cols {
+			set[i] = c + " = " + d.Placeholder(i+1)
+		}
+		where, wargs, err := whereClause(d, t, g, len(args)+1)
+		if err != nil {
+			return "", nil, err
+		}
+		return "UPDATE " + tb + " SET " + strings.Join(set, ", ") + " WHERE " + where, append(args, wargs...), nil
+
+	case "delete":
+		where, wargs, err := whereClause(d, t, g, 1)
+		if err != nil {
+			return "", nil, err
+		}
+		return "DELETE FROM " + tb + " WHERE " + where, wargs, nil
+	}
+
+	return "", nil, errors.New("unknown operation: " + f)
+}
+
+// Placeholders returns n parameter placeholders separated by commas,
+// numbered from from.
+func Placeholders(d *Dialect, from, n int) string {
+	pp := make([]string, n)
+	for i := range pp {
+		pp[i] = d.Placeholder(from + i)
+	}
+	return strings.Join(pp, ", ")
+}
+
+// whereClause returns the condition of the where or rawwhere node of g.
+// Parameters are numbered from n.
+func whereClause(d *Dialect, t *Table, g *ogdl.Graph, n int) (string, []interface{}, error) {
+
+	w := g.Node("where")
+	if raw := g.Node("rawwhere"); raw != nil && raw.Len() != 0 {
+		if w != nil && w.Len() != 0 {
+			return "", nil, errors.New("both where and rawwhere given")
+		}
+		return raw.String(), nil, nil
+	}
+
+	if w == nil || w.Len() == 0 {
+		return "", nil, errors.New("missing where")
+	}
+
+	// A single string
+	if w.Len() == 1 && w.Out[0].Len() == 0 {
+		return "", nil, errors.New("where: expected column value pairs; use rawwhere for an SQL condition")
+	}
+
+	var cc []string
+	var args []interface{}
+
+	for _, e := range w.Out {
+		if e.Len() > 1 || (e.Len() == 1 && e.Out[0].Len() != 0) {
+			return "", nil, errors.New("where: expected column value pairs")
+		}
+		c := t.Column(e.ThisString())
+		if c == nil {
+			return "", nil, fmt.Errorf("table %s has no column %s", t.Name, e.ThisString())
+		}
+		v, err := value(c, e)
+		if err != nil {
+			return "", nil, err
+		}
+		if v == nil {
+			cc = append(cc, d.Quote(c.Name)+" IS NULL")
+			continue
+		}
+		cc = append(cc, d.Quote(c.Name)+" = "+d.Placeholder(n))
+		args = append(args, v)
+		n++
+	}
+
+	return strings.Join(cc, " AND "), args, nil
+}
+
+// Kinds of columns, for converting values
+const (
+	kindText = iota
+	kindInt
+	kindFloat
+	kindDecimal
+	kindBool
+	kindTime
+	kindBinary
+)
+
+// kinds maps database type names, as reported by the drivers and as declared
+// in SQLite, to kinds. Other types are text.
+var kinds = map[string]int{
+	"INT": kindInt, "INTEGER": kindInt, "TINYINT": kindInt, "SMALLINT": kindInt,
+	"MEDIUMINT": kindInt, "BIGINT": kindInt, "INT2": kindInt, "INT4": kindInt,
+	"INT8": kindInt, "SERIAL": kindInt, "BIGSERIAL": kindInt, "SMALLSERIAL": kindInt,
+	"YEAR": kindInt,
+
+	"FLOAT": kindFloat, "FLOAT4": kindFloat, "FLOAT8": kindFloat, "DOUBLE": kindFloat,
+	"DOUBLE PRECISION": kindFloat, "REAL": kindFloat,
+
+	"DECIMAL": kindDecimal, "NUMERIC": kindDecimal, "MONEY": kindDecimal,
+	"SMALLMONEY": kindDecimal,
+
+	"BOOL": kindBool, "BOOLEAN": kindBool, "BIT": kindBool,
+
+	"DATE": kindTime, "TIME": kindTime, "TIMETZ": kindTime, "DATETIME": kindTime,
+	"DATETIME2": kindTime, "SMALLDATETIME": kindTime, "DATETIMEOFFSET": kindTime,
+	"TIMESTAMP": kindTime, "TIMESTAMPTZ": kindTime,
+
+	"BLOB": kindBinary, "TINYBLOB": kindBinary, "MEDIUMBLOB": kindBinary,
+	"LONGBLOB": kindBinary, "BINARY": kindBinary, "VARBINARY": kindBinary,
+	"BYTEA": kindBinary, "IMAGE": kindBinary,
+}
+
+// kind returns the kind of a column type, ignoring a size or precision, as in
+// DECIMAL(10,2), and UNSIGNED.
+func kind(typ string) int {
+	if i := strings.IndexByte(typ, '('); i >= 0 {
+		typ = typ[:i]
+	}
+	typ = strings.TrimPrefix(typ, "UNSIGNED ")
+	typ = strings.TrimSuffix(typ, " UNSIGNED")
+	return kinds[strings.TrimSpace(typ)]
+}
+
+var decimal = regexp.MustCompile(`^[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?$`)
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"15:04:05",
+}
+
+// value converts the value of n to the type of column c.
+func value(c *Column, n *ogdl.Graph) (interface{}, error) {
+
+	if n.Len() == 0 {
+		return nil, nil
+	}
+	return convert(c, n.String())
+}
+
+// convert converts s to the type of column c.
+func convert(c *Column, s string) (interface{}, error) {
+
+	k := kind(c.Type)
+
+	if s == "" && k != kindText {
+		return nil, nil
+	}
+
+	switch k {
+	case kindInt:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: not an integer: %s", c.Name, s)
+		}
+		return i, nil
+	case kindFloat:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: not a number: %s", c.Name, s)
+		}
+		return f, nil
+	case kindDecimal:
+		// Bound as text, so that no digits are lost
+		if !decimal.MatchString(s) {
+			return nil, fmt.Errorf("column %s: not a number: %s", c.Name, s)
+		}
+		return s, nil
+	case kindBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: not a boolean: %s", c.Name, s)
+		}
+		return b, nil
+	case kindTime:
+		for _, l := range timeLayouts {
+			if t, err := time.Parse(l, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("column %s: not a time: %s", c.Name, s)
+	case kindBinary:
+		return []byte(s), nil
+	}
+	return s, nil
+}
+
+// Native converts a value as returned by a database driver for a column of
+// type typ (as in sql.ColumnType.DatabaseTypeName) to int64, float64, bool,
+// time.Time, []byte (binary columns only), string or nil (NULL). Drivers that
+// return numbers or times as text, such as MySQL, are thereby made to agree
+// with the others. Decimal values (DECIMAL, NUMERIC, MONEY) are strings, as
+// float64 would lose digits.
+func Native(typ string, v interface{}) interface{} {
+
+	var s string
+
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case []byte:
+		if kind(strings.ToUpper(typ)) == kindBinary {
+			// The driver may reuse the buffer
+			return append([]byte(nil), x...)
+		}
+		s = string(x)
+	case string:
+		s = x
+	case int:
+		return int64(x)
+	case int32:
+		return int64(x)
+	case float32:
+		return float64(x)
+	case float64:
+		if kind(strings.ToUpper(typ)) == kindDecimal {
+			return strconv.FormatFloat(x, 'f', -1, 64)
+		}
+		return x
+	default:
+		// int64, float64, bool and time.Time
+		return v
+	}
+
+	switch kind(strings.ToUpper(typ)) {
+	case kindInt:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case kindFloat:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case kindBool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case kindTime:
+		for _, l := range timeLayouts {
+			if t, err := time.Parse(l, s); err == nil {
+				return t
+			}
+		}
+	case kindBinary:
+		return []byte(s)
+	}
+	return s
+}
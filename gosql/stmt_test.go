@@ -0,0 +1,278 @@
+package gosql
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rveen/ogdl"
+)
+
+var people = &Table{Name: "people", Columns: []Column{
+	{Name: "id", Type: "INT"},
+	{Name: "name", Type: "VARCHAR"},
+	{Name: "born", Type: "DATETIME", Nullable: true},
+	{Name: "photo", Type: "BLOB", Nullable: true},
+	{Name: "score", Type: "DECIMAL", Nullable: true},
+}}
+
+func TestStatement(t *testing.T) {
+
+	tests := []struct {
+		driver string
+		in     string
+		q      string
+		args   string
+	}{
+		{"mssql", "f update\ntb people\nobj\n  NAME bob\n  photo abc\nwhere\n  id 7",
+			"UPDATE [people] SET [name] = @p1, [photo] = @p2 WHERE [id] = @p3",
+			"[bob [97 98 99] 7]"},
+		{"postgres", "f delete\ntb people\nwhere\n  id 7\n  born",
+			`DELETE FROM "people" WHERE "id" = $1 AND "born" IS NULL`,
+			"[7]"},
+		{"sqlite", "f delete\ntb people\nrawwhere 'id > 7'",
+			`DELETE FROM "people" WHERE id > 7`,
+			"[]"},
+		{"mysql", "f replace\ntb people\nobj\n  id 1\n  born 2024-02-29",
+			"REPLACE INTO `people` (`id`, `born`) VALUES (?, ?)",
+			fmt.Sprint([]interface{}{int64(1), time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)})},
+	}
+
+	for _, tc := range tests {
+		q, args, err := Statement(DialectOf(tc.driver), people, ogdl.FromString(tc.in))
+		if err != nil {
+			t.Errorf("%s: %v", tc.q, err)
+			continue
+		}
+		if q != tc.q {
+			t.Errorf("got %s, want %s", q, tc.q)
+		}
+		if fmt.Sprint(args) != tc.args {
+			t.Errorf("%s: got args %v, want %s", q, args, tc.args)
+		}
+	}
+
+	// Values never end up in the statement
+	g := ogdl.New(nil)
+	g.Add("f").Add("insert")
+	g.Add("tb").Add("people")
+	obj := g.Add("obj")
+	obj.Add("id").Add("7")
+	obj.Add("name").Add("O'Brien'); drop table people; --")
+	obj.Add("score")
+
+	q, args, err := Statement(DialectOf("mysql"), people, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != "INSERT INTO `people` (`id`, `name`, `score`) VALUES (?, ?, ?)" {
+		t.Error(q)
+	}
+	if fmt.Sprint(args) != "[7 O'Brien'); drop table people; -- <nil>]" {
+		t.Error(args)
+	}
+}
+
+func TestStatementErrors(t *testing.T) {
+
+	for _, in := range []string{
+		"f insert\ntb people\nobj\n  age 7",
+		"f insert\ntb people\nobj\n  id seven",
+		"f update\ntb people\nobj\n  id 7",
+		"f delete\ntb people",
+		"f delete\ntb people\nwhere 'id = 7 or 1=1'",
+		"f update\ntb people\nobj\n  name x\nwhere 'id = 7'",
+		"f delete\ntb people\nwhere\n  id 7\nrawwhere 'id = 8'",
+		"f drop\ntb people",
+	} {
+		if _, _, err := Statement(DialectOf("mysql"), people, ogdl.FromString(in)); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+
+	if _, _, err := Statement(DialectOf("postgres"), people, ogdl.FromString("f replace\ntb people\nobj\n  id 1")); err == nil {
+		t.Error("replace is only for mysql")
+	}
+
+	if _, err := QuoteName(DialectOf("mysql"), "people; drop table x"); err == nil {
+		t.Error("invalid table name accepted")
+	}
+}
+
+func TestNative(t *testing.T) {
+
+	tests := []struct {
+		typ  string
+		in   interface{}
+		want interface{}
+	}{
+		{"INT", []byte("42"), int64(42)},
+		{"BIGINT", int64(42), int64(42)},
+		{"DECIMAL", []byte("12345678901234567.89"), "12345678901234567.89"},
+		{"NUMERIC", 1.5, "1.5"},
+		{"DOUBLE", []byte("1.5"), 1.5},
+		{"INTERVAL", []byte("1 day"), "1 day"},
+		{"POINT", []byte("(1,2)"), "(1,2)"},
+		{"UNSIGNED BIGINT", []byte("7"), int64(7)},
+		{"VARCHAR", []byte("0"), "0"},
+		{"VARCHAR", []byte(""), ""},
+		{"TEXT", nil, nil},
+		{"DATETIME", []byte("2024-02-29 10:11:12"), time.Date(2024, 2, 29, 10, 11, 12, 0, time.UTC)},
+		{"BOOL", "true", true},
+	}
+
+	for _, tc := range tests {
+		if got := Native(tc.typ, tc.in); got != tc.want {
+			t.Errorf("%s %v: got %#v, want %#v", tc.typ, tc.in, got, tc.want)
+		}
+	}
+
+	if b, ok := Native("BLOB", []byte{0, 1}).([]byte); !ok || len(b) != 2 {
+		t.Error("binary values should stay []byte")
+	}
+}
+
+func TestUpsert(t *testing.T) {
+
+	rows := []map[string]string{
+		{"id": "1", "name": "ann", "score": ""},
+		{"ID": "2", "name": "bob", "score": "1.5"},
+	}
+
+	tests := []struct {
+		driver string
+		q      string
+	}{
+		{"mysql", "INSERT INTO `people` (`id`, `name`, `score`) VALUES (?, ?, ?), (?, ?, ?) " +
+			"ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `score` = VALUES(`score`)"},
+		{"postgres", `INSERT INTO "people" ("id", "name", "score") VALUES ($1, $2, $3), ($4, $5, $6) ` +
+			`ON CONFLICT ("id") DO UPDATE SET "name" = excluded."name", "score" = excluded."score"`},
+		{"mssql", "MERGE INTO [people] AS t USING (VALUES (@p1, @p2, @p3), (@p4, @p5, @p6)) AS s ([id], [name], [score]) " +
+			"ON t.[id] = s.[id] WHEN MATCHED THEN UPDATE SET t.[name] = s.[name], t.[score] = s.[score] " +
+			"WHEN NOT MATCHED THEN INSERT ([id], [name], [score]) VALUES (s.[id], s.[name], s.[score]);"},
+	}
+
+	for _, tc := range tests {
+		q, args, err := Upsert(DialectOf(tc.driver), people, rows, []string{"id"})
+		if err != nil {
+			t.Errorf("%s: %v", tc.driver, err)
+			continue
+		}
+		if q != tc.q {
+			t.Errorf("got %s, want %s", q, tc.q)
+		}
+		if fmt.Sprint(args) != "[1 ann <nil> 2 bob 1.5]" {
+			t.Errorf("%s: args %v", tc.driver, args)
+		}
+	}
+
+	q, _, err := Upsert(DialectOf("sqlite"), people, []map[string]string{{"id": "1"}}, []string{"id"})
+	if err != nil || q != `INSERT INTO "people" ("id") VALUES (?) ON CONFLICT ("id") DO NOTHING` {
+		t.Errorf("%s %v", q, err)
+	}
+
+	for _, keys := range [][]string{nil, {"nothing"}} {
+		if _, _, err := Upsert(DialectOf("mysql"), people, rows, keys); err == nil {
+			t.Errorf("keys %v accepted", keys)
+		}
+	}
+	if _, _, err := Upsert(DialectOf("mysql"), people, []map[string]string{{"id": "x"}}, []string{"id"}); err == nil {
+		t.Error("invalid value accepted")
+	}
+
+	// A row without a column would set it to NULL
+	if _, _, err := Upsert(DialectOf("postgres"), people, []map[string]string{{"id": "1", "name": "ann"}, {"id": "2"}}, []string{"id"}); err == nil {
+		t.Error("rows with other columns accepted")
+	}
+	// Postgres and SQL Server cannot update a row twice in one statement
+	if _, _, err := Upsert(DialectOf("mssql"), people, []map[string]string{{"id": "1"}, {"id": "01"}}, []string{"id"}); err == nil {
+		t.Error("duplicate keys accepted")
+	}
+}
+
+func TestUpsertGroups(t *testing.T) {
+
+	rows := []map[string]string{
+		{"id": "1", "name": "ann"},
+		{"id": "2", "name": "bob", "score": "1.5"},
+		{"ID": "01", "score": "2"},
+		{"id": "3", "name": "cy"},
+		{"name": "nokey"},
+		{"name": "nokey"},
+	}
+
+	groups, err := UpsertGroups(people, rows, []string{"id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "[[map[id:01 name:ann score:2] map[id:2 name:bob score:1.5]] [map[id:3 name:cy]] [map[name:nokey] map[name:nokey]]]"
+	if got := fmt.Sprint(groups); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	for _, g := range groups[:2] {
+		if _, _, err := Upsert(DialectOf("postgres"), people, g, []string{"id"}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err := UpsertGroups(people, []map[string]string{{"id": "1"}, {"id": "2", "score": "high"}}, []string{"id"}); err == nil || !strings.Contains(err.Error(), "row 2") {
+		t.Errorf("error %v", err)
+	}
+
+	if n := BatchSize(DialectOf("mssql"), 3); n != 500 {
+		t.Errorf("batch size %d", n)
+	}
+	if n := BatchSize(DialectOf("sqlite"), 10); n != 99 {
+		t.Errorf("batch size %d", n)
+	}
+}
+
+func TestConvert(t *testing.T) {
+
+	tests := []struct {
+		typ  string
+		in   string
+		want interface{}
+	}{
+		{"DECIMAL(20,2)", "12345678901234567.89", "12345678901234567.89"},
+		{"MONEY", "-1.5e3", "-1.5e3"},
+		{"NUMERIC", "", nil},
+		{"INTERVAL", "1 day", "1 day"},
+		{"POINT", "(1,2)", "(1,2)"},
+		{"INT4", "7", int64(7)},
+		{"FLOAT8", "0.5", 0.5},
+	}
+
+	for _, tc := range tests {
+		got, err := convert(&Column{Name: "c", Type: tc.typ}, tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("%s %q: got %#v %v, want %#v", tc.typ, tc.in, got, err, tc.want)
+		}
+	}
+
+	if _, err := convert(&Column{Name: "c", Type: "DECIMAL"}, "1.5; drop"); err == nil {
+		t.Error("invalid decimal accepted")
+	}
+}
+
+func TestTableQuery(t *testing.T) {
+
+	tests := []struct {
+		driver, name, q, args string
+	}{
+		{"sqlite", "people", "SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ? COLLATE NOCASE", "[people]"},
+		{"postgres", "people", "SELECT count(*) FROM information_schema.tables WHERE table_name = $1 AND table_schema = current_schema()", "[people]"},
+		{"mssql", "dbo.people", "SELECT count(*) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_NAME = @p1 AND TABLE_SCHEMA = @p2", "[people dbo]"},
+		{"mysql", "people", "SELECT count(*) FROM information_schema.tables WHERE table_name = ? AND table_schema = DATABASE()", "[people]"},
+	}
+	for _, tc := range tests {
+		q, args, err := TableQuery(DialectOf(tc.driver), tc.name)
+		if err != nil || q != tc.q || fmt.Sprint(args) != tc.args {
+			t.Errorf("%s: got %s %v %v", tc.driver, q, args, err)
+		}
+	}
+	if _, _, err := TableQuery(DialectOf("mysql"), "a'; drop"); err == nil {
+		t.Error("invalid name accepted")
+	}
+}
@@ -0,0 +1,310 @@
+package gosql
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxBatch is the maximum number of rows in an upsert statement.
+const maxBatch = 500
+
+// BatchSize returns the number of rows with n columns that fit in one upsert
+// statement.
+func BatchSize(d *Dialect, n int) int {
+	if n < 1 {
+		n = 1
+	}
+	b := d.MaxParams / n
+	if b > maxBatch {
+		b = maxBatch
+	}
+	if b < 1 {
+		b = 1
+	}
+	return b
+}
+
+// Upsert builds a parameterized statement that inserts rows, or updates them
+// if a row with the same values in the key columns exists:
+//
+//	mysql     INSERT ... ON DUPLICATE KEY UPDATE
+//	mssql     MERGE
+//	postgres  INSERT ... ON CONFLICT (keys) DO UPDATE
+//	sqlite    INSERT ... ON CONFLICT (keys) DO UPDATE
+//
+// The key columns must have a primary key or unique index (MySQL uses any
+// such index, not only the one on the key columns). Values are converted to
+// the column types as in Statement.
+//
+// All rows must have the same columns, as the columns of existing rows are
+// all updated, and no two rows may have the same key values, which Postgres
+// and SQL Server reject. UpsertGroups prepares any list of rows accordingly.
+// Use BatchSize to keep the number of parameters within the limit of the
+// database.
+func Upsert(d *Dialect, t *Table, rows []map[string]string, keys []string) (string, []interface{}, error) {
+
+	if len(rows) == 0 {
+		return "", nil, errors.New("upsert without rows")
+	}
+	if len(keys) == 0 {
+		return "", nil, errors.New("upsert without key columns")
+	}
+
+	tb, err := QuoteName(d, t.Name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	first, err := columnSet(t, rows[0])
+	if err != nil {
+		return "", nil, err
+	}
+	dup := make(map[string]bool)
+	for i, row := range rows {
+		set, err := columnSet(t, row)
+		if err != nil {
+			return "", nil, err
+		}
+		if set != first {
+			return "", nil, fmt.Errorf("row %d: other columns than row 1", i+1)
+		}
+		k, ok, err := keyOf(t, row, keys)
+		if err != nil {
+			return "", nil, fmt.Errorf("row %d: %v", i+1, err)
+		}
+		if ok && dup[k] {
+			return "", nil, fmt.Errorf("row %d: duplicate key", i+1)
+		}
+		dup[k] = true
+	}
+
+	// Key columns first, then the others in alphabetical order
+	var cols []*Column
+	seen := make(map[string]bool)
+
+	add := func(name string) error {
+		c := t.Column(name)
+		if c == nil {
+			return fmt.Errorf("table %s has no column %s", t.Name, name)
+		}
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			cols = append(cols, c)
+		}
+		return nil
+	}
+
+	for _, k := range keys {
+		if err := add(k); err != nil {
+			return "", nil, err
+		}
+	}
+	nkeys := len(cols)
+
+	var names []string
+	for name := range rows[0] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := add(name); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if len(cols)*len(rows) > d.MaxParams {
+		return "", nil, fmt.Errorf("upsert: too many parameters (%d rows of %d columns)", len(rows), len(cols))
+	}
+
+	// The row values, with the names in the row as given
+	var args []interface{}
+	for i, row := range rows {
+
+		byColumn := make(map[string]string, len(row))
+		for name, s := range row {
+			byColumn[t.Column(name).Name] = s
+		}
+
+		for _, c := range cols {
+			s, ok := byColumn[c.Name]
+			if !ok {
+				// A key column missing in all rows
+				args = append(args, nil)
+				continue
+			}
+			v, err := convert(c, s)
+			if err != nil {
+				return "", nil, fmt.Errorf("row %d: %v", i+1, err)
+			}
+			args = append(args, v)
+		}
+	}
+
+	quoted := make([]string, len(cols))
+	for i, c := range cols {
+		quoted[i] = d.Quote(c.Name)
+	}
+	key, other := quoted[:nkeys], quoted[nkeys:]
+
+	values := make([]string, len(rows))
+	for i := range rows {
+		values[i] = "(" + Placeholders(d, i*len(cols)+1, len(cols)) + ")"
+	}
+
+	insert := "INSERT INTO " + tb + " (" + strings.Join(quoted, ", ") + ") VALUES " + strings.Join(values, ", ")
+
+	switch d.Name {
+
+	case "mysql":
+		set := make([]string, len(other))
+		for i, c := range other {
+			set[i] = c + " = VALUES(" + c + ")"
+		}
+		if len(set) == 0 {
+			// Nothing to update, but the row must not fail
+			set = []string{key[0] + " = " + key[0]}
+		}
+		return insert + " ON DUPLICATE KEY UPDATE " + strings.Join(set, ", "), args, nil
+
+	case "postgres", "sqlite":
+		q := insert + " ON CONFLICT (" + strings.Join(key, ", ") + ")"
+		if len(other) == 0 {
+			return q + " DO NOTHING", args, nil
+		}
+		set := make([]string, len(other))
+		for i, c := range other {
+			set[i] = c + " = excluded." + c
+		}
+		return q + " DO UPDATE SET " + strings.Join(set, ", "), args, nil
+
+	case "mssql":
+		on := make([]string, len(key))
+		for i, c := range key {
+			on[i] = "t." + c + " = s." + c
+		}
+		src := make([]string, len(quoted))
+		for i, c := range quoted {
+			src[i] = "s." + c
+		}
+		q := "MERGE INTO " + tb + " AS t USING (VALUES " + strings.Join(values, ", ") + ") AS s (" +
+			strings.Join(quoted, ", ") + ") ON " + strings.Join(on, " AND ")
+		if len(other) > 0 {
+			set := make([]string, len(other))
+			for i, c := range other {
+				set[i] = "t." + c + " = s." + c
+			}
+			q += " WHEN MATCHED THEN UPDATE SET " + strings.Join(set, ", ")
+		}
+		// MERGE must end with a semicolon
+		return q + " WHEN NOT MATCHED THEN INSERT (" + strings.Join(quoted, ", ") + ") VALUES (" +
+			strings.Join(src, ", ") + ");", args, nil
+	}
+
+	return "", nil, errors.New("upsert is not supported by " + d.Name)
+}
+
+// UpsertGroups prepares rows for Upsert. Rows with the same key values are
+// merged into one, where later values take precedence, as if the rows were
+// written one after the other. The rows are then grouped by their columns,
+// in the order in which they first appear, so that no row sets a column it
+// does not have. Values are checked against the column types, with errors
+// reported by row number.
+func UpsertGroups(t *Table, rows []map[string]string, keys []string) ([][]map[string]string, error) {
+
+	var merged []map[string]string
+	byKey := make(map[string]map[string]string)
+
+	for i, row := range rows {
+		r := make(map[string]string, len(row))
+		for name, s := range row {
+			c := t.Column(name)
+			if c == nil {
+				return nil, fmt.Errorf("row %d: table %s has no column %s", i+1, t.Name, name)
+			}
+			if _, err := convert(c, s); err != nil {
+				return nil, fmt.Errorf("row %d: %v", i+1, err)
+			}
+			r[c.Name] = s
+		}
+
+		k, ok, err := keyOf(t, r, keys)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", i+1, err)
+		}
+		if prev := byKey[k]; ok && prev != nil {
+			for name, s := range r {
+				prev[name] = s
+			}
+			continue
+		}
+		if ok {
+			byKey[k] = r
+		}
+		merged = append(merged, r)
+	}
+
+	var groups [][]map[string]string
+	index := make(map[string]int)
+	for _, r := range merged {
+		set, _ := columnSet(t, r)
+		i, ok := index[set]
+		if !ok {
+			i = len(groups)
+			index[set] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], r)
+	}
+	return groups, nil
+}
+
+// columnSet returns the columns of a row as a string, to compare rows.
+func columnSet(t *Table, row map[string]string) (string, error) {
+
+	var names []string
+	for name := range row {
+		c := t.Column(name)
+		if c == nil {
+			return "", fmt.Errorf("table %s has no column %s", t.Name, name)
+		}
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "\x00"), nil
+}
+
+// keyOf returns the key values of a row as a string, to compare rows, with
+// the values converted to the column types so that 1 and 01 are the same
+// integer. ok is false if the row lacks a key column; such a row is NULL in
+// that column and never the same as another.
+func keyOf(t *Table, row map[string]string, keys []string) (string, bool, error) {
+
+	var kk []string
+	for _, k := range keys {
+		c := t.Column(k)
+		if c == nil {
+			return "", false, fmt.Errorf("table %s has no column %s", t.Name, k)
+		}
+		s, found := "", false
+		for name, v := range row {
+			if t.Column(name) == c {
+				s, found = v, true
+				break
+			}
+		}
+		if !found {
+			return "", false, nil
+		}
+		v, err := convert(c, s)
+		if err != nil {
+			return "", false, err
+		}
+		if v == nil {
+			return "", false, nil
+		}
+		kk = append(kk, fmt.Sprintf("%T %v", v, v))
+	}
+	return strings.Join(kk, "\x00"), true, nil
+}
@@ -0,0 +1,411 @@
+package gosql2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rveen/golib/gosql"
+	"github.com/rveen/ogdl"
+)
+
+// Query is a named query of the catalog, read from the queries section of
+// the configuration:
+//
+//	queries
+//	  openOrders
+//	    db main
+//	    sql "select id, total from orders where customer = :customer and status = :status limit :max"
+//	    params
+//	      customer
+//	        type int
+//	        required true
+//	      status
+//	        default open
+//	        values open closed
+//	      max
+//	        type int
+//	        default 100
+//	        min 1
+//	        max 1000
+//	    result list
+//
+// Parameters are written as :name in the SQL text and passed to the database
+// as statement parameters. Their type is string (the default), int, float,
+// bool or time. A parameter can have a default value, be required, have a
+// minimum and maximum (numbers), a pattern (a regular expression that must
+// match the whole value) and a list of allowed values.
+//
+// The result is list (the default, as in QueryCtx), row (the first row, as
+// in Query1: column names with their values) or scalar (the first value of
+// the first row).
+type Query struct {
+	Name   string
+	Db     string
+	Sql    string // with :name parameters
+	Params []Param
+	Result string
+
+	q    string   // with the placeholders of the driver
+	args []string // parameter name of each placeholder
+}
+
+// Param is a parameter of a named query.
+type Param struct {
+	Name     string
+	Type     string
+	Default  string
+	Required bool
+	Min, Max *float64
+	Pattern  *regexp.Regexp
+	Values   []string
+}
+
+// AddQuery adds a named query to the catalog. q has the format of an entry of
+// the queries section (see Query).
+func (db *Db) AddQuery(q *ogdl.Graph) error {
+
+	qq := &Query{
+		Name:   q.ThisString(),
+		Db:     q.Node("db").String(),
+		Sql:    q.Node("sql").String(),
+		Result: q.Node("result").String("list"),
+	}
+
+	switch qq.Result {
+	case "list", "row", "scalar":
+	default:
+		return fmt.Errorf("query %s: unknown result %s", qq.Name, qq.Result)
+	}
+
+	db1 := db.dbs[qq.Db]
+	if db1 == nil {
+		return fmt.Errorf("query %s: no database defined in config.ogdl with name %s", qq.Name, qq.Db)
+	}
+	d := gosql.DialectOf(db1.driver)
+	if d == nil {
+		return fmt.Errorf("query %s: unknown database driver: %s", qq.Name, db1.driver)
+	}
+
+	if pp := q.Node("params"); pp != nil {
+		for _, p := range pp.Out {
+			par, err := param(p)
+			if err != nil {
+				return fmt.Errorf("query %s: %v", qq.Name, err)
+			}
+			qq.Params = append(qq.Params, par)
+		}
+	}
+
+	var err error
+	qq.q, qq.args, err = bindNames(d, qq.Sql)
+	if err != nil {
+		return fmt.Errorf("query %s: %v", qq.Name, err)
+	}
+	for _, a := range qq.args {
+		if qq.param(a) == nil {
+			return fmt.Errorf("query %s: parameter %s is not declared", qq.Name, a)
+		}
+	}
+
+	db.mu.Lock()
+	if db.queries == nil {
+		db.queries = make(map[string]*Query)
+	}
+	db.queries[qq.Name] = qq
+	db.mu.Unlock()
+	return nil
+}
+
+// Run executes a named query with the parameters given as name value pairs.
+func (db *Db) Run(name string, params *ogdl.Graph) (*ogdl.Graph, error) {
+	return db.RunCtx(context.Background(), name, params)
+}
+
+// RunCtx is Run with a context.
+func (db *Db) RunCtx(ctx context.Context, name string, params *ogdl.Graph) (*ogdl.Graph, error) {
+
+	db.mu.Lock()
+	qq := db.queries[name]
+	db.mu.Unlock()
+
+	if qq == nil {
+		return nil, errors.New("no query defined in config.ogdl with name " + name)
+	}
+
+	args, err := qq.bind(params)
+	if err != nil {
+		return nil, err
+	}
+
+	switch qq.Result {
+	case "row", "scalar":
+		var r *ogdl.Graph
+		errFirst := errors.New("first row")
+		err := db.query(ctx, qq.Db, qq.q, args, nil, func(cols []string, vv []interface{}) error {
+			r = ogdl.New(nil)
+			if qq.Result == "scalar" {
+				if len(vv) > 0 {
+					r.Add(vv[0])
+				}
+			} else {
+				for i, col := range cols {
+					r.Add(col).Add(vv[i])
+				}
+			}
+			return errFirst
+		})
+		if err != nil && err != errFirst {
+			return nil, err
+		}
+		if r == nil {
+			r = ogdl.New(nil)
+		}
+		return r, nil
+	}
+
+	return db.QueryCtx(ctx, qq.Db, qq.q, args...)
+}
+
+// bind returns the statement parameters for the values given.
+func (qq *Query) bind(params *ogdl.Graph) ([]interface{}, error) {
+
+	values := make(map[string]interface{})
+
+	if params != nil {
+		for _, n := range params.Out {
+			if qq.param(n.ThisString()) == nil {
+				return nil, fmt.Errorf("query %s: unknown parameter %s", qq.Name, n.ThisString())
+			}
+		}
+	}
+
+	for i := range qq.Params {
+		p := &qq.Params[i]
+
+		s, ok := p.Default, p.Default != ""
+		if params != nil {
+			if n := params.Node(p.Name); n != nil && n.Len() > 0 {
+				s, ok = n.String(), true
+			}
+		}
+		if !ok {
+			if p.Required {
+				return nil, fmt.Errorf("query %s: parameter %s is required", qq.Name, p.Name)
+			}
+			values[p.Name] = nil
+			continue
+		}
+
+		v, err := p.check(s)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: parameter %s: %v", qq.Name, p.Name, err)
+		}
+		values[p.Name] = v
+	}
+
+	args := make([]interface{}, len(qq.args))
+	for i, a := range qq.args {
+		args[i] = values[a]
+	}
+	return args, nil
+}
+
+func (qq *Query) param(name string) *Param {
+	for i := range qq.Params {
+		if qq.Params[i].Name == name {
+			return &qq.Params[i]
+		}
+	}
+	return nil
+}
+
+// Column types that gosql.Native converts to the parameter types
+var paramTypes = map[string]string{
+	"string": "TEXT",
+	"int":    "BIGINT",
+	"float":  "DOUBLE",
+	"bool":   "BOOL",
+	"time":   "DATETIME",
+}
+
+// param reads the declaration of a parameter.
+func param(n *ogdl.Graph) (Param, error) {
+
+	p := Param{
+		Name:     n.ThisString(),
+		Type:     n.Node("type").String("string"),
+		Default:  n.Node("default").String(),
+		Required: n.Node("required").String() == "true",
+	}
+
+	if _, ok := paramTypes[p.Type]; !ok {
+		return p, fmt.Errorf("parameter %s: unknown type %s", p.Name, p.Type)
+	}
+
+	for _, lim := range []struct {
+		key string
+		v   **float64
+	}{{"min", &p.Min}, {"max", &p.Max}} {
+		if s := n.Node(lim.key).String(); s != "" {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return p, fmt.Errorf("parameter %s: %s is not a number", p.Name, lim.key)
+			}
+			*lim.v = &f
+		}
+	}
+
+	if s := n.Node("pattern").String(); s != "" {
+		re, err := regexp.Compile("^(?:" + s + ")$")
+		if err != nil {
+			return p, fmt.Errorf("parameter %s: %v", p.Name, err)
+		}
+		p.Pattern = re
+	}
+
+	// values a b c, or values with a list below
+	var words func(g *ogdl.Graph)
+	words = func(g *ogdl.Graph) {
+		for _, c := range g.Out {
+			p.Values = append(p.Values, c.ThisString())
+			words(c)
+		}
+	}
+	if v := n.Node("values"); v != nil {
+		words(v)
+	}
+
+	if p.Default != "" {
+		if _, err := p.check(p.Default); err != nil {
+			return p, fmt.Errorf("parameter %s: default: %v", p.Name, err)
+		}
+	}
+
+	return p, nil
+}
+
+// check converts a value to the type of the parameter and validates it.
+func (p *Param) check(s string) (interface{}, error) {
+
+	v := gosql.Native(paramTypes[p.Type], s)
+	if _, isString := v.(string); isString && p.Type != "string" {
+		return nil, fmt.Errorf("not a valid %s: %s", p.Type, s)
+	}
+
+	if p.Min != nil || p.Max != nil {
+		var f float64
+		switch x := v.(type) {
+		case int64:
+			f = float64(x)
+		case float64:
+			f = x
+		default:
+			return nil, errors.New("min and max only apply to numbers")
+		}
+		if p.Min != nil && f < *p.Min {
+			return nil, fmt.Errorf("must be at least %v", *p.Min)
+		}
+		if p.Max != nil && f > *p.Max {
+			return nil, fmt.Errorf("must be at most %v", *p.Max)
+		}
+	}
+
+	if p.Pattern != nil && !p.Pattern.MatchString(s) {
+		return nil, fmt.Errorf("does not match %s", p.Pattern)
+	}
+
+	if p.Values != nil {
+		ok := false
+		for _, a := range p.Values {
+			if a == s {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(p.Values, ", "))
+		}
+	}
+
+	return v, nil
+}
+
+// bindNames replaces the :name parameters in an SQL text by placeholders, and
+// returns the parameter names in order. Quoted strings, quoted identifiers
+// and :: casts are left alone.
+func bindNames(d *gosql.Dialect, s string) (string, []string, error) {
+
+	var sb strings.Builder
+	var names []string
+	index := make(map[string]int)
+
+	for i := 0; i < len(s); i++ {
+
+		c := s[i]
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			j := strings.IndexByte(s[i+1:], c)
+			if j == -1 {
+				return "", nil, errors.New("unterminated quote in sql")
+			}
+			sb.WriteString(s[i : i+j+2])
+			i += j + 1
+
+		case c == ':' && i+1 < len(s) && s[i+1] == ':':
+			sb.WriteString("::")
+			i++
+
+		case c == ':' && i+1 < len(s) && isNameStart(s[i+1]):
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			name := s[i+1 : j]
+
+			// Drivers with numbered placeholders can reuse them
+			n, ok := index[name]
+			if !ok || d.Placeholder(1) == d.Placeholder(2) {
+				names = append(names, name)
+				n = len(names)
+				index[name] = n
+			}
+			sb.WriteString(d.Placeholder(n))
+			i = j - 1
+
+		default:
+			sb.WriteByte(c)
+		}
+	}
+
+	return sb.String(), names, nil
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// loadQueries adds the queries section of a configuration. Errors are logged.
+func (db *Db) loadQueries(cfg *ogdl.Graph) {
+
+	qq := cfg.Node("queries")
+	if qq == nil {
+		return
+	}
+	for _, q := range qq.Out {
+		if err := db.AddQuery(q); err != nil {
+			log.Println(err)
+			continue
+		}
+		log.Printf("query %s added\n", q.ThisString())
+	}
+}
@@ -0,0 +1,92 @@
+package gosql2
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rveen/golib/gosql"
+	"github.com/rveen/ogdl"
+)
+
+func TestBindNames(t *testing.T) {
+
+	sql := "select a::text, ':x' from t where a = :a and (b = :b or c = :a)"
+
+	for driver, want := range map[string]string{
+		"mysql":    "select a::text, ':x' from t where a = ? and (b = ? or c = ?) [a b a]",
+		"postgres": "select a::text, ':x' from t where a = $1 and (b = $2 or c = $1) [a b]",
+		"mssql":    "select a::text, ':x' from t where a = @p1 and (b = @p2 or c = @p1) [a b]",
+	} {
+		q, names, err := bindNames(gosql.DialectOf(driver), sql)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(q, " ", names); got != want {
+			t.Errorf("%s: got %s", driver, got)
+		}
+	}
+}
+
+func TestCatalog(t *testing.T) {
+
+	cfg := ogdl.FromString(`databases
+  main
+    driver postgres
+queries
+  orders
+    db main
+    params
+      customer
+        type int
+        required true
+      status
+        default open
+        values open closed
+      max
+        type int
+        default 100
+        min 1
+        max 1000
+  bad
+    db main`)
+	cfg.Node("queries").Node("orders").Add("sql").Add("select * from orders where customer = :customer and status = :status limit :max")
+	cfg.Node("queries").Node("bad").Add("sql").Add("select :nope")
+
+	db := New(cfg)
+
+	if db.queries["bad"] != nil {
+		t.Error("query with undeclared parameter accepted")
+	}
+
+	qq := db.queries["orders"]
+	if qq == nil {
+		t.Fatal("query not loaded")
+	}
+	if qq.q != "select * from orders where customer = $1 and status = $2 limit $3" {
+		t.Error(qq.q)
+	}
+
+	tests := []struct {
+		params string
+		want   string
+	}{
+		{"customer 7", "[7 open 100]"},
+		{"customer 7\nstatus closed\nmax 5", "[7 closed 5]"},
+		{"", "error"},
+		{"customer x", "error"},
+		{"customer 7\nmax 5000", "error"},
+		{"customer 7\nstatus lost", "error"},
+		{"customer 7\ndrop 1", "error"},
+	}
+
+	for _, tc := range tests {
+		args, err := qq.bind(ogdl.FromString(tc.params))
+		got := fmt.Sprint(args)
+		if err != nil {
+			got = "error"
+		}
+		if got != tc.want {
+			t.Errorf("%q: got %s (%v), want %s", tc.params, got, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package gosql2
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/rveen/golib/gosql"
+	"github.com/rveen/ogdl"
+)
+
+// The functions in this file take a context and return errors. The timeout
+// of the database, if configured, applies to each call. Values keep their type
+// (see gosql.Native): int64, float64, bool, time.Time, []byte, string (also
+// for decimals), or nil for NULL.
+
+// QueryCtx runs a query with parameters and returns the result as
+//
+//	columns
+//	  name1
+//	  name2
+//	rows
+//	  -
+//	    value1
+//	    value2
+func (db *Db) QueryCtx(ctx context.Context, name, q string, args ...interface{}) (*ogdl.Graph, error) {
+
+	r, head, row := list()
+	if err := db.query(ctx, name, q, args, head, row); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// QueryEach runs a query with parameters and calls each for every row, with
+// the column names as keys:
+//
+//	name1 value1
+//	name2 value2
+//
+// Rows are not kept in memory, so that large results can be processed. If each
+// returns an error, QueryEach stops and returns it.
+func (db *Db) QueryEach(ctx context.Context, name, q string, each func(row *ogdl.Graph) error, args ...interface{}) error {
+	return db.query(ctx, name, q, args, nil, eachRow(each))
+}
+
+// list returns an empty result as in QueryCtx, and the head and row functions
+// that fill it.
+func list() (*ogdl.Graph, func(cols []string), func(cols []string, vv []interface{}) error) {
+
+	r := ogdl.New(nil)
+	c := r.Add("columns")
+	rr := r.Add("rows")
+
+	head := func(cols []string) {
+		for _, col := range cols {
+			c.Add(col)
+		}
+	}
+
+	row := func(cols []string, vv []interface{}) error {
+		n := rr.Add("-")
+		for _, v := range vv {
+			n.Add(v)
+		}
+		return nil
+	}
+
+	return r, head, row
+}
+
+// eachRow returns a row function that calls each as in QueryEach.
+func eachRow(each func(row *ogdl.Graph) error) func(cols []string, vv []interface{}) error {
+
+	return func(cols []string, vv []interface{}) error {
+		g := ogdl.New(nil)
+		for i, col := range cols {
+			g.Add(col).Add(vv[i])
+		}
+		return each(g)
+	}
+}
+
+// ExecCtx is Exec with a context.
+func (db *Db) ExecCtx(ctx context.Context, name string, g *ogdl.Graph) error {
+
+	db1, err := db.get(name)
+	if err != nil {
+		return err
+	}
+
+	err = db1.exec(ctx, db1.Db, g)
+	db.failed(db1, err)
+	return err
+}
+
+// conn is a *sql.DB or *sql.Tx.
+type conn interface {
+	gosql.Queryer
+	ExecContext(ctx context.Context, q string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, q string, args ...interface{}) (*sql.Rows, error)
+}
+
+// exec runs the statement described in g on c.
+func (db1 *Db1) exec(ctx context.Context, c conn, g *ogdl.Graph) error {
+
+	d := gosql.DialectOf(db1.driver)
+	if d == nil {
+		return errors.New("unknown database driver: " + db1.driver)
+	}
+
+	t, err := db1.schema.Table(c, d, g.Node("tb").String())
+	if err != nil {
+		return err
+	}
+
+	q, args, err := gosql.Statement(d, t, g)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := db1.context(ctx)
+	defer cancel()
+
+	log.Printf("gosql.Exec: %s\n", q)
+	_, err = c.ExecContext(ctx, q, args...)
+	return err
+}
+
+// ExecSqlCtx is ExecSql with a context and statement parameters.
+func (db *Db) ExecSqlCtx(ctx context.Context, name, q string, args ...interface{}) (sql.Result, error) {
+
+	db1, err := db.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := db1.context(ctx)
+	defer cancel()
+
+	r, err := db1.Db.ExecContext(ctx, q, args...)
+	db.failed(db1, err)
+	return r, err
+}
+
+// query runs a query and calls head (if not nil) with the column names, and
+// row for each row with typed values. The slice of values is new for each row.
+func (db *Db) query(ctx context.Context, name, q string, args []interface{}, head func(cols []string), row func(cols []string, vv []interface{}) error) error {
+
+	db1, err := db.get(name)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := db1.context(ctx)
+	defer cancel()
+
+	rows, err := db1.Db.QueryContext(ctx, q, args...)
+	if err != nil && db.failed(db1, err) && notSent(err) {
+		// Queries are retried once after a connection error, if the
+		// statement did not reach the database: it may be INSERT ...
+		// RETURNING, which must not run twice
+		if db1, err = db.get(name); err != nil {
+			return err
+		}
+		rows, err = db1.Db.QueryContext(ctx, q, args...)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scan(rows, head, row)
+}
+
+// scan reads the rows of a query result, as described in query.
+func scan(rows *sql.Rows, head func(cols []string), row func(cols []string, vv []interface{}) error) error {
+
+	ct, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	cols := make([]string, len(ct))
+	for i, c := range ct {
+		cols[i] = c.Name()
+	}
+	if head != nil {
+		head(cols)
+	}
+
+	raw := make([]interface{}, len(ct))
+	ptrs := make([]interface{}, len(ct))
+	for i := range raw {
+		ptrs[i] = &raw[i]
+	}
+
+	for rows.Next() {
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+
+		vv := make([]interface{}, len(ct))
+		for i, v := range raw {
+			vv[i] = gosql.Native(ct[i].DatabaseTypeName(), v)
+		}
+
+		if err := row(cols, vv); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// context applies the timeout of the database to ctx.
+func (db1 *Db1) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db1.timeout > 0 {
+		return context.WithTimeout(ctx, db1.timeout)
+	}
+	return context.WithCancel(ctx)
+}
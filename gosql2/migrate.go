@@ -0,0 +1,430 @@
+package gosql2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rveen/golib/gosql"
+	"github.com/rveen/ogdl"
+)
+
+// Migrations describes a set of schema migrations for a database.
+//
+// Migrations are files named <version>_<name>.<ext>, where version is a
+// number that gives the order. The files are:
+//
+//	001_people.up.sql    statements to apply the migration
+//	001_people.down.sql  statements to revert it (optional)
+//	002_index.sql        the same as .up.sql
+//	003_orders.ogdl      up and down as lists of statements
+//
+// Statements in .sql files are separated by semicolons; for statements that
+// contain semicolons themselves (such as triggers), use .ogdl:
+//
+//	up
+//	  "create table orders (id integer primary key, total real)"
+//	down
+//	  "drop table orders"
+//
+// The applied migrations are recorded in a table of the database, together
+// with a checksum of their files, so that a migration that was edited after
+// being applied is detected.
+type Migrations struct {
+	Dir    string    // directory with the migration files
+	FS     fs.FS     // if not nil, read files from here instead of Dir
+	Table  string    // bookkeeping table, schema_migrations if empty
+	DryRun io.Writer // if not nil, write the SQL here instead of executing it
+}
+
+// Migration is a migration, as read from its files.
+type Migration struct {
+	Version   int64
+	Name      string
+	Up, Down  []string // statements
+	Checksum  string
+	Applied   bool
+	AppliedAt string // RFC 3339, empty if not applied
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_([^.]+)\.(up\.sql|down\.sql|sql|ogdl)$`)
+
+// Load reads the migration files, sorted by version.
+func (m *Migrations) Load() ([]Migration, error) {
+
+	fsys := m.FS
+	if fsys == nil {
+		fsys = os.DirFS(m.Dir)
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	type files struct {
+		name     string
+		up, down []byte
+		ogdl     bool
+	}
+	byVersion := make(map[int64]*files)
+
+	for _, e := range entries {
+
+		mm := migrationFile.FindStringSubmatch(e.Name())
+		if e.IsDir() || mm == nil {
+			continue
+		}
+		v, err := strconv.ParseInt(mm[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %v", e.Name(), err)
+		}
+
+		f := byVersion[v]
+		if f == nil {
+			f = &files{name: mm[2]}
+			byVersion[v] = f
+		} else if f.name != mm[2] {
+			return nil, fmt.Errorf("migration %d: two names, %s and %s", v, f.name, mm[2])
+		}
+
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		switch mm[3] {
+		case "down.sql":
+			if f.down != nil {
+				return nil, fmt.Errorf("migration %d: more than one down file", v)
+			}
+			f.down = b
+		default:
+			if f.up != nil {
+				return nil, fmt.Errorf("migration %d: more than one up file", v)
+			}
+			f.up = b
+			f.ogdl = mm[3] == "ogdl"
+		}
+	}
+
+	var mm []Migration
+
+	for v, f := range byVersion {
+
+		if f.up == nil {
+			return nil, fmt.Errorf("migration %d: no up file", v)
+		}
+
+		h := sha256.New()
+		h.Write(f.up)
+		h.Write([]byte{0})
+		h.Write(f.down)
+
+		mg := Migration{Version: v, Name: f.name, Checksum: hex.EncodeToString(h.Sum(nil))}
+
+		if f.ogdl {
+			g := ogdl.FromBytes(f.up)
+			mg.Up = statements(g.Node("up"))
+			mg.Down = statements(g.Node("down"))
+		} else {
+			mg.Up = splitSql(string(f.up))
+			mg.Down = splitSql(string(f.down))
+		}
+		mm = append(mm, mg)
+	}
+
+	sort.Slice(mm, func(i, j int) bool { return mm[i].Version < mm[j].Version })
+	return mm, nil
+}
+
+func statements(g *ogdl.Graph) []string {
+	if g == nil {
+		return nil
+	}
+	var ss []string
+	for _, n := range g.Out {
+		if s := strings.TrimSpace(n.ThisString()); s != "" {
+			ss = append(ss, s)
+		}
+	}
+	return ss
+}
+
+// splitSql splits a script into statements at semicolons that are not in
+// quotes or comments. Comments are kept.
+func splitSql(s string) []string {
+
+	var ss []string
+	start := 0
+
+	add := func(end int) {
+		st := strings.TrimSpace(s[start:end])
+		if st != "" && !onlyComments(st) {
+			ss = append(ss, st)
+		}
+		start = end + 1
+	}
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			if j := strings.IndexByte(s[i+1:], c); j != -1 {
+				i += j + 1
+			} else {
+				i = len(s)
+			}
+		case c == '-' && strings.HasPrefix(s[i:], "--"):
+			if j := strings.IndexByte(s[i:], '\n'); j != -1 {
+				i += j
+			} else {
+				i = len(s)
+			}
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			if j := strings.Index(s[i:], "*/"); j != -1 {
+				i += j + 1
+			} else {
+				i = len(s)
+			}
+		case c == ';':
+			add(i)
+		}
+	}
+	if start < len(s) {
+		add(len(s))
+	}
+	return ss
+}
+
+func onlyComments(s string) bool {
+	for _, l := range strings.Split(s, "\n") {
+		if l = strings.TrimSpace(l); l != "" && !strings.HasPrefix(l, "--") {
+			return false
+		}
+	}
+	return true
+}
+
+// MigrationStatus returns the migrations with the applied ones marked. It
+// fails if an applied migration was edited or is missing.
+func (db *Db) MigrationStatus(ctx context.Context, name string, m *Migrations) ([]Migration, error) {
+
+	db1, d, table, err := db.migrationDb(name, m)
+	if err != nil {
+		return nil, err
+	}
+	return db.status(ctx, db1, d, table, m)
+}
+
+// MigrateUp applies the pending migrations with a version up to to (all if to
+// is 0), each in a transaction. It returns the migrations applied.
+//
+// Note that some databases (such as MySQL) commit DDL statements
+// implicitly, so that a failed migration can be partially applied.
+func (db *Db) MigrateUp(ctx context.Context, name string, m *Migrations, to int64) ([]Migration, error) {
+
+	db1, d, table, err := db.migrationDb(name, m)
+	if err != nil {
+		return nil, err
+	}
+
+	mm, err := db.status(ctx, db1, d, table, m)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+
+	for _, mg := range mm {
+		if mg.Applied || (to > 0 && mg.Version > to) {
+			continue
+		}
+		insert := fmt.Sprintf("INSERT INTO %s (version, name, checksum, applied_at) VALUES (%s)", table, gosql.Placeholders(d, 1, 4))
+		now := time.Now().UTC().Format(time.RFC3339)
+		if err := db.apply(ctx, db1, m, mg, "up", mg.Up, insert, mg.Version, mg.Name, mg.Checksum, now); err != nil {
+			return done, err
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// MigrateDown reverts the applied migrations with a version above to, newest
+// first, each in a transaction. It returns the migrations reverted.
+func (db *Db) MigrateDown(ctx context.Context, name string, m *Migrations, to int64) ([]Migration, error) {
+
+	db1, d, table, err := db.migrationDb(name, m)
+	if err != nil {
+		return nil, err
+	}
+
+	mm, err := db.status(ctx, db1, d, table, m)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+
+	for i := len(mm) - 1; i >= 0; i-- {
+		mg := mm[i]
+		if !mg.Applied || mg.Version <= to {
+			continue
+		}
+		if len(mg.Down) == 0 {
+			return done, fmt.Errorf("migration %d %s: no down statements", mg.Version, mg.Name)
+		}
+		del := fmt.Sprintf("DELETE FROM %s WHERE version = %s", table, d.Placeholder(1))
+		if err := db.apply(ctx, db1, m, mg, "down", mg.Down, del, mg.Version); err != nil {
+			return done, err
+		}
+		done = append(done, mg)
+	}
+	return done, nil
+}
+
+// migrationDb returns the database, its dialect and the quoted name of the
+// bookkeeping table.
+func (db *Db) migrationDb(name string, m *Migrations) (*Db1, *gosql.Dialect, string, error) {
+
+	db1, err := db.get(name)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	d := gosql.DialectOf(db1.driver)
+	if d == nil {
+		return nil, nil, "", errors.New("unknown database driver: " + db1.driver)
+	}
+
+	table, err := gosql.QuoteName(d, m.table())
+	return db1, d, table, err
+}
+
+// table returns the name of the bookkeeping table.
+func (m *Migrations) table() string {
+	if m.Table == "" {
+		return "schema_migrations"
+	}
+	return m.Table
+}
+
+// status loads the migrations and marks the applied ones. The bookkeeping
+// table is created if needed (except in a dry run).
+func (db *Db) status(ctx context.Context, db1 *Db1, d *gosql.Dialect, table string, m *Migrations) ([]Migration, error) {
+
+	mm, err := m.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := db1.context(ctx)
+	defer cancel()
+
+	// Does the table exist? Other errors than its absence are returned.
+	q, args, err := gosql.TableQuery(d, m.table())
+	if err != nil {
+		return nil, err
+	}
+	var n int64
+	if err := db1.Db.QueryRowContext(ctx, q, args...).Scan(&n); err != nil {
+		db.failed(db1, err)
+		return nil, err
+	}
+	if n == 0 {
+		if m.DryRun != nil {
+			return mm, nil
+		}
+		q := "CREATE TABLE " + table + " (version BIGINT PRIMARY KEY, name VARCHAR(255), checksum VARCHAR(64), applied_at VARCHAR(32))"
+		if _, err := db1.Db.ExecContext(ctx, q); err != nil {
+			db.failed(db1, err)
+			return nil, err
+		}
+		return mm, nil
+	}
+
+	rows, err := db1.Db.QueryContext(ctx, "SELECT version, checksum, applied_at FROM "+table)
+	if err != nil {
+		db.failed(db1, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	index := make(map[int64]int)
+	for i, mg := range mm {
+		index[mg.Version] = i
+	}
+
+	var errs []string
+
+	for rows.Next() {
+		var v int64
+		var sum, at string
+		if err := rows.Scan(&v, &sum, &at); err != nil {
+			return nil, err
+		}
+		i, ok := index[v]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("migration %d is applied but has no files", v))
+			continue
+		}
+		if mm[i].Checksum != sum {
+			errs = append(errs, fmt.Sprintf("migration %d %s was edited after being applied", v, mm[i].Name))
+		}
+		mm[i].Applied = true
+		mm[i].AppliedAt = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if errs != nil {
+		return mm, errors.New(strings.Join(errs, "; "))
+	}
+	return mm, nil
+}
+
+// apply runs the statements of a migration and the bookkeeping statement in
+// a transaction, or writes them to m.DryRun.
+func (db *Db) apply(ctx context.Context, db1 *Db1, m *Migrations, mg Migration, dir string, ss []string, book string, args ...interface{}) error {
+
+	if m.DryRun != nil {
+		fmt.Fprintf(m.DryRun, "-- %d %s (%s)\n", mg.Version, mg.Name, dir)
+		for _, s := range ss {
+			fmt.Fprintf(m.DryRun, "%s;\n", s)
+		}
+		return nil
+	}
+
+	ctx, cancel := db1.context(ctx)
+	defer cancel()
+
+	tx, err := db1.Db.BeginTx(ctx, nil)
+	if err != nil {
+		db.failed(db1, err)
+		return err
+	}
+
+	for i, s := range ss {
+		if _, err := tx.ExecContext(ctx, s); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d %s (%s): statement %d: %v", mg.Version, mg.Name, dir, i+1, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, book, args...); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("migration %d %s (%s): %v", mg.Version, mg.Name, dir, err)
+	}
+
+	return tx.Commit()
+}
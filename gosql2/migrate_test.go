@@ -0,0 +1,109 @@
+package gosql2
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSplitSql(t *testing.T) {
+
+	ss := splitSql("-- people\ncreate table a (x text default ';');\n/* ; */ insert into a values ('a;b');\n-- end\n")
+	if len(ss) != 2 || !strings.HasPrefix(ss[1], "/* ; */ insert") {
+		t.Errorf("%d statements: %q", len(ss), ss)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+
+	db := testDb(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	write := func(name, s string) {
+		if err := os.WriteFile(dir+"/"+name, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("001_orders.up.sql", "create table orders (id integer primary key, total real);\ninsert into orders (total) values (1.5);")
+	write("001_orders.down.sql", "drop table orders;")
+	write("002_tags.sql", "create table tags (name text);")
+	write("003_notes.ogdl", "up\n  \"create table notes (body text)\"\ndown\n  \"drop table notes\"")
+	write("README.md", "not a migration")
+
+	m := &Migrations{Dir: dir}
+
+	done, err := db.MigrateUp(ctx, "test", m, 2)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("up to 2: %d applied, %v", len(done), err)
+	}
+
+	mm, err := db.MigrationStatus(ctx, "test", m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mm) != 3 || !mm[0].Applied || !mm[1].Applied || mm[2].Applied {
+		t.Errorf("status: %+v", mm)
+	}
+
+	// Dry run
+	var sb strings.Builder
+	m.DryRun = &sb
+	if done, err := db.MigrateUp(ctx, "test", m, 0); err != nil || len(done) != 1 {
+		t.Fatalf("dry run: %d, %v", len(done), err)
+	}
+	if !strings.Contains(sb.String(), "create table notes (body text);") {
+		t.Errorf("dry run output: %s", sb.String())
+	}
+	m.DryRun = nil
+	if mm, _ := db.MigrationStatus(ctx, "test", m); mm[2].Applied {
+		t.Error("dry run applied a migration")
+	}
+
+	if _, err := db.MigrateUp(ctx, "test", m, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 002 has no down file
+	if _, err := db.MigrateDown(ctx, "test", m, 0); err == nil {
+		t.Error("expected an error reverting a migration without down")
+	}
+	if mm, _ := db.MigrationStatus(ctx, "test", m); mm[2].Applied {
+		t.Error("003 should be reverted")
+	}
+
+	// Edited migrations are detected
+	write("001_orders.up.sql", "create table orders (id integer primary key);")
+	if _, err := db.MigrationStatus(ctx, "test", m); err == nil || !strings.Contains(err.Error(), "edited") {
+		t.Errorf("edit not detected: %v", err)
+	}
+
+	// A failing migration is rolled back
+	write("001_orders.up.sql", "create table orders (id integer primary key, total real);\ninsert into orders (total) values (1.5);")
+	write("004_bad.sql", "create table bad (x text);\ninsert into nothing values (1);")
+	if _, err := db.MigrateUp(ctx, "test", m, 0); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err := db.QueryCtx(ctx, "test", "select * from bad"); err == nil {
+		t.Error("failed migration not rolled back")
+	}
+
+	// A bookkeeping table that cannot be read is an error, not a missing
+	// table, also in a dry run
+	if _, err := db.ExecSqlCtx(ctx, "test", "create table old_migrations (v integer)"); err != nil {
+		t.Fatal(err)
+	}
+	m2 := &Migrations{Dir: dir, Table: "old_migrations", DryRun: &sb}
+	if _, err := db.MigrationStatus(ctx, "test", m2); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("unreadable table: %v", err)
+	}
+
+	// A new table is found in the catalog once created
+	m2 = &Migrations{Dir: dir, Table: "New_Migrations"}
+	for i := 0; i < 2; i++ {
+		if _, err := db.MigrationStatus(ctx, "test", m2); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package gosql2
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rveen/ogdl"
+)
+
+// pingTimeout is used by Ping and reconnections if the database has no
+// timeout.
+const pingTimeout = 5 * time.Second
+
+// pool holds the connection pool settings of a database:
+//
+//	name
+//	  driver postgres
+//	  uri ...
+//	  maxopen 20
+//	  maxidle 5
+//	  lifetime 30m
+//
+// Zero values keep the defaults of database/sql.
+type pool struct {
+	maxOpen  int
+	maxIdle  int
+	lifetime time.Duration
+}
+
+func readPool(name string, d *ogdl.Graph) pool {
+
+	var p pool
+	for _, n := range []struct {
+		key string
+		v   *int
+	}{{"maxopen", &p.maxOpen}, {"maxidle", &p.maxIdle}} {
+		if s := d.Node(n.key).String(); s != "" {
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				log.Printf("database %s: invalid %s %s\n", name, n.key, s)
+			}
+			*n.v = i
+		}
+	}
+	if s := d.Node("lifetime").String(); s != "" {
+		var err error
+		if p.lifetime, err = time.ParseDuration(s); err != nil {
+			log.Printf("database %s: invalid lifetime %s\n", name, s)
+		}
+	}
+	return p
+}
+
+// failed marks a database for a connection check if err is a connection
+// error. The next call to get then pings it and reopens it if needed.
+func (db *Db) failed(db1 *Db1, err error) bool {
+
+	if !isConnErr(err) {
+		return false
+	}
+	log.Printf("database %s: %v\n", db1.name, err)
+
+	db.mu.Lock()
+	db1.broken = true
+	db.mu.Unlock()
+	return true
+}
+
+// reconnect checks a database that was marked as broken, given as sdb. If the
+// check fails, the idle connections are closed, so that new ones are made.
+// Connections in use are not affected. db.mu must not be locked, as the check
+// can take as long as the timeout of the database.
+func (db1 *Db1) reconnect(sdb *sql.DB) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), db1.pingTimeout())
+	defer cancel()
+
+	if err := sdb.PingContext(ctx); err != nil {
+		log.Printf("database %s: reconnecting: %v\n", db1.name, err)
+		sdb.SetMaxIdleConns(0)
+		sdb.SetMaxIdleConns(db1.pool.idle())
+	}
+}
+
+// idle returns the maximum number of idle connections.
+func (p pool) idle() int {
+	if p.maxIdle == 0 {
+		return 2 // the default of database/sql
+	}
+	return p.maxIdle
+}
+
+// apply sets the pool settings of db.
+func (p pool) apply(db *sql.DB) {
+	if p.maxOpen != 0 {
+		db.SetMaxOpenConns(p.maxOpen)
+	}
+	if p.maxIdle != 0 {
+		db.SetMaxIdleConns(p.maxIdle)
+	}
+	if p.lifetime != 0 {
+		db.SetConnMaxLifetime(p.lifetime)
+	}
+}
+
+func (db1 *Db1) pingTimeout() time.Duration {
+	if db1.timeout > 0 {
+		return db1.timeout
+	}
+	return pingTimeout
+}
+
+// isConnErr returns true for errors that indicate a lost or refused
+// connection, rather than an error in a statement. Timeouts and canceled
+// contexts are not connection errors: the connection may be fine, and only
+// the statement too slow.
+func isConnErr(err error) bool {
+
+	if err == nil || isTimeout(err) {
+		return false
+	}
+
+	var ne net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &ne)
+}
+
+// isTimeout returns true for canceled contexts and timeouts.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, os.ErrDeadlineExceeded) ||
+		(errors.As(err, &ne) && ne.Timeout())
+}
+
+// notSent returns true for connection errors that occur before a statement
+// is sent to the database, after which it can safely be run again. Other
+// connection errors can occur after the database received the statement.
+func notSent(err error) bool {
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// Ping checks the connection to a database, opening it if needed.
+func (db *Db) Ping(name string) error {
+	return db.PingCtx(context.Background(), name)
+}
+
+// PingCtx is Ping with a context.
+func (db *Db) PingCtx(ctx context.Context, name string) error {
+
+	db1, err := db.get(name)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, db1.pingTimeout())
+	defer cancel()
+
+	err = db1.Db.PingContext(ctx)
+	db.failed(db1, err)
+	return err
+}
+
+// Health pings all configured databases and returns a report:
+//
+//	name
+//	  driver mysql
+//	  ok true
+//	  error "..."       (if not ok)
+//	  latency 1.2ms
+//	  open 4            (connections: all, in use and idle)
+//	  inuse 1
+//	  idle 3
+func (db *Db) Health(ctx context.Context) *ogdl.Graph {
+
+	names := make([]string, 0, len(db.dbs))
+	for name := range db.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r := ogdl.New(nil)
+
+	for _, name := range names {
+
+		db1 := db.dbs[name]
+		n := r.Add(name)
+		n.Add("driver").Add(db1.driver)
+
+		t := time.Now()
+		err := db.PingCtx(ctx, name)
+		latency := time.Since(t)
+
+		n.Add("ok").Add(strconv.FormatBool(err == nil))
+		if err != nil {
+			n.Add("error").Add(err.Error())
+		} else {
+			n.Add("latency").Add(latency.String())
+		}
+
+		db.mu.Lock()
+		sdb := db1.Db
+		db.mu.Unlock()
+
+		if sdb != nil {
+			st := sdb.Stats()
+			n.Add("open").Add(strconv.Itoa(st.OpenConnections))
+			n.Add("inuse").Add(strconv.Itoa(st.InUse))
+			n.Add("idle").Add(strconv.Itoa(st.Idle))
+		}
+	}
+
+	return r
+}
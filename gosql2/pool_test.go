@@ -0,0 +1,117 @@
+package gosql2
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rveen/ogdl"
+)
+
+// slowDriver is a driver whose connections take until release is closed to
+// answer a ping.
+type slowDriver struct{ release chan struct{} }
+
+type slowConn struct{ d *slowDriver }
+
+func (d *slowDriver) Open(string) (driver.Conn, error) { return &slowConn{d}, nil }
+
+func (c *slowConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *slowConn) Close() error                        { return nil }
+func (c *slowConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c *slowConn) Ping(ctx context.Context) error {
+	select {
+	case <-c.d.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// slowDrivers counts the registered slowDrivers, to give each a name.
+var slowDrivers int
+
+// newSlowDriver registers a new slowDriver and returns its name.
+func newSlowDriver() (*slowDriver, string) {
+	slowDrivers++
+	d := &slowDriver{release: make(chan struct{})}
+	name := fmt.Sprintf("gosql2-slow%d", slowDrivers)
+	sql.Register(name, d)
+	return d, name
+}
+
+// A database being checked after a connection error does not hold up calls
+// on the others.
+func TestReconnectUnlocked(t *testing.T) {
+
+	slow, name := newSlowDriver()
+	db := New(ogdl.FromString("databases\n  slow\n    driver " + name + "\n  other\n    driver " + name))
+
+	if _, err := db.get("slow"); err != nil {
+		t.Fatal(err)
+	}
+	db.failed(db.dbs["slow"], driver.ErrBadConn)
+
+	checked := make(chan struct{})
+	go func() {
+		db.get("slow")
+		close(checked)
+	}()
+	defer func() {
+		close(slow.release)
+		<-checked
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error)
+	go func() {
+		_, err := db.get("other")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("get blocked by the check of another database")
+	}
+}
+
+func TestIsConnErr(t *testing.T) {
+
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+
+	for _, tc := range []struct {
+		err           error
+		conn, notSent bool
+	}{
+		{nil, false, false},
+		{errors.New("syntax error"), false, false},
+		{context.DeadlineExceeded, false, false},
+		{fmt.Errorf("query: %w", context.Canceled), false, false},
+		{timeout, false, false},
+		{driver.ErrBadConn, true, true},
+		{refused, true, true},
+		{fmt.Errorf("read: %w", syscall.ECONNRESET), true, false},
+		{&net.OpError{Op: "read", Net: "tcp", Err: errors.New("closed")}, true, false},
+	} {
+		if got := isConnErr(tc.err); got != tc.conn {
+			t.Errorf("isConnErr(%v) = %v", tc.err, got)
+		}
+		if tc.conn {
+			if got := notSent(tc.err); got != tc.notSent {
+				t.Errorf("notSent(%v) = %v", tc.err, got)
+			}
+		}
+	}
+}
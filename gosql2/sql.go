@@ -1,26 +1,67 @@
 package gosql2
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"log"
-	"strings"
+	"strconv"
+	"sync"
+	"time"
 
 	_ "github.com/denisenkom/go-mssqldb"
 	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
 
+	"github.com/rveen/golib/gosql"
 	"github.com/rveen/ogdl"
 )
 
 type Db struct {
-	dbs map[string]*Db1
+	dbs     map[string]*Db1
+	queries map[string]*Query
+	mu      sync.Mutex // for opening databases and the catalog
 }
 
 type Db1 struct {
-	name   string
-	driver string
-	uri    string
-	Db     *sql.DB
+	name    string
+	driver  string
+	uri     string
+	timeout time.Duration // for the Ctx functions, 0 for none
+	pool    pool
+	broken  bool // a connection error occurred
+	Db      *sql.DB
+	schema  gosql.Schema
+}
+
+// newDb1 reads the configuration of a database:
+//
+//	name
+//	  driver mysql
+//	  uri user:pass@/db
+//	  timeout 10s
+//	  maxopen 20
+//
+// where timeout is a duration or a number of seconds. The drivers are mysql,
+// mssql, postgres and sqlite (a file name as uri). See pool for the
+// connection pool settings.
+func newDb1(d *ogdl.Graph) *Db1 {
+
+	db := &Db1{}
+	db.name = d.ThisString()
+	db.driver = d.Node("driver").String()
+	db.uri = d.Node("uri").String()
+
+	if t := d.Node("timeout").String(); t != "" {
+		if n, err := strconv.Atoi(t); err == nil {
+			db.timeout = time.Duration(n) * time.Second
+		} else if db.timeout, err = time.ParseDuration(t); err != nil {
+			log.Printf("database %s: invalid timeout %s\n", db.name, t)
+		}
+	}
+	db.pool = readPool(db.name, d)
+	return db
 }
 
 func New(cfg *ogdl.Graph) *Db {
@@ -31,15 +72,14 @@ func New(cfg *ogdl.Graph) *Db {
 	dd := cfg.Node("databases")
 	if dd != nil {
 		for _, d := range dd.Out {
-			db := &Db1{}
-			db.name = d.ThisString()
-			db.driver = d.Node("driver").String()
-			db.uri = d.Node("uri").String()
+			db := newDb1(d)
 			dbs.dbs[db.name] = db
 			log.Printf("database %s added\n", db.name)
 		}
 	}
 
+	dbs.loadQueries(cfg)
+
 	return &dbs
 }
 
@@ -52,10 +92,7 @@ func NewDb(d *ogdl.Graph) *Db {
 	var dbs Db
 	dbs.dbs = make(map[string]*Db1)
 
-	db := &Db1{}
-	db.name = d.ThisString()
-	db.driver = d.Node("driver").String()
-	db.uri = d.Node("uri").String()
+	db := newDb1(d)
 	dbs.dbs[db.name] = db
 	log.Printf("database %s added\n", db.name)
 
@@ -72,119 +109,74 @@ func (db *Db) open(name string) error {
 	}
 
 	db1.Db, err = sql.Open(db1.driver, db1.uri)
-	return err
+	if err != nil {
+		db1.Db = nil
+		return err
+	}
+	db1.pool.apply(db1.Db)
+	return nil
 }
 
-func (db *Db) ExecSql(name, q string) (sql.Result, error) {
+// get returns a database, opening it if needed, and checking it if a
+// connection error occurred since the last call.
+func (db *Db) get(name string) (*Db1, error) {
 
 	db1 := db.dbs[name]
 	if db1 == nil {
 		return nil, errors.New("no database defined in config.ogdl with name " + name)
 	}
 
+	db.mu.Lock()
 	if db1.Db == nil {
-		db.open(name)
+		if err := db.open(name); err != nil {
+			db.mu.Unlock()
+			return nil, err
+		}
 	}
+	check := db1.broken
+	db1.broken = false
+	sdb := db1.Db
+	db.mu.Unlock()
 
-	return db1.Db.Exec(q)
+	// Without the lock, so that other calls go on meanwhile
+	if check {
+		db1.reconnect(sdb)
+	}
+	return db1, nil
 }
 
-func (db *Db) Exec(name string, g *ogdl.Graph) error {
-
-	db1 := db.dbs[name]
-	if db1 == nil {
-		return errors.New("no database defined in config.ogdl with name " + name)
-	}
+func (db *Db) ExecSql(name, q string) (sql.Result, error) {
 
-	if db1.Db == nil {
-		db.open(name)
+	db1, err := db.get(name)
+	if err != nil {
+		return nil, err
 	}
 
-	var err error
-
-	f := g.Node("f").String()
-	tb := g.Node("tb").String()
-
-	// fields that are int: ints="a,b,c"
-	ints := g.Node("ints").String()
-	ii := strings.Split(ints, ",")
-
-	obj := g.Node("obj")
-
-	fields := ""
-	values := ""
-	upd := ""
-	for _, f := range obj.Out {
-
-		fname := f.ThisString()
-
-		fields += ", `" + fname + "`"
-		upd += ", `" + fname + "` = "
-
-		// is the field an 'int' ?
-		isInt := false
-		for _, i := range ii {
-			if i == fname {
-				isInt = true
-			}
-		}
-
-		if isInt {
-			values += ", " + f.String()
-			upd += f.String()
-		} else {
-			values += ", '" + f.String() + "'"
-			upd += "'" + f.String() + "'"
-		}
-	}
-	fields = fields[2:]
-	values = values[2:]
-	upd = upd[2:]
-
-	switch f {
-	case "add":
-		fallthrough
-	case "replace":
-		q := "replace into " + tb + " (" + fields + ") values (" + values + ")"
-		log.Printf("gosql.Exec: %s\n", q)
-
-		_, err = db1.Db.Exec(q)
-	case "insert":
-		q := "insert into " + tb + " (" + fields + ") values (" + values + ")"
-		log.Printf("gosql.Exec: %s\n", q)
-		_, err = db1.Db.Exec(q)
-
-	case "delete":
-		where := g.Node("where").String()
-		q := "delete from " + tb + " where " + where
-		log.Printf("gosql.Exec: %s\n", q)
-		_, err = db1.Db.Exec(q)
-
-	case "update":
-		where := g.Node("where").String()
-		q := "UPDATE " + tb + " SET " + upd + " WHERE " + where
-		log.Printf("gosql.Exec: %s\n", q)
-		_, err = db1.Db.Exec(q)
-	}
+	r, err := db1.Db.Exec(q)
+	db.failed(db1, err)
+	return r, err
+}
 
-	return err
+// Exec inserts, updates or deletes a row as described in g (see
+// gosql.Statement). Values are passed as statement parameters, never as part
+// of the SQL text.
+func (db *Db) Exec(name string, g *ogdl.Graph) error {
+	return db.ExecCtx(context.Background(), name, g)
 }
 
 func (db *Db) Query(name, q string) *ogdl.Graph {
 
 	log.Printf("Query %s: %s\n", name, q)
 
-	db1 := db.dbs[name]
-	if db1 == nil {
+	db1, err := db.get(name)
+	if err != nil {
+		log.Println(err)
 		return nil
 	}
 
-	if db1.Db == nil {
-		db.open(name)
-	}
-
 	rows, err := db1.Db.Query(q)
 	if err != nil {
+		db.failed(db1, err)
 		log.Println("Error reading rows: " + err.Error())
 		return nil
 	}
@@ -251,17 +243,15 @@ func (db *Db) Query(name, q string) *ogdl.Graph {
 // Add column names to all results
 func (db *Db) Query2(name, q string) *ogdl.Graph {
 
-	db1 := db.dbs[name]
-	if db1 == nil {
+	db1, err := db.get(name)
+	if err != nil {
+		log.Println(err)
 		return nil
 	}
 
-	if db1.Db == nil {
-		db.open(name)
-	}
-
 	rows, err := db1.Db.Query(q)
 	if err != nil {
+		db.failed(db1, err)
 		log.Println("Error reading rows: " + err.Error())
 		return nil
 	}
@@ -323,17 +313,15 @@ func (db *Db) Query2(name, q string) *ogdl.Graph {
 // Return all results in a list of lists and a separated list of columns
 func (db *Db) QueryToList(name, q string) ([][]string, []string) {
 
-	db1 := db.dbs[name]
-	if db1 == nil {
+	db1, err := db.get(name)
+	if err != nil {
+		log.Println(err)
 		return nil, nil
 	}
 
-	if db1.Db == nil {
-		db.open(name)
-	}
-
 	rows, err := db1.Db.Query(q)
 	if err != nil {
+		db.failed(db1, err)
 		return nil, nil
 	}
 	defer rows.Close()
@@ -382,17 +370,15 @@ func (db *Db) QueryToList(name, q string) ([][]string, []string) {
 // Return 1 result (the query should return 1 in the first place)
 func (db *Db) Query1ToMap(name, q string) map[string]string {
 
-	db1 := db.dbs[name]
-	if db1 == nil {
+	db1, err := db.get(name)
+	if err != nil {
+		log.Println(err)
 		return nil
 	}
 
-	if db1.Db == nil {
-		db.open(name)
-	}
-
 	rows, err := db1.Db.Query(q)
 	if err != nil {
+		db.failed(db1, err)
 		log.Println(err.Error())
 		return nil
 	}
@@ -444,17 +430,15 @@ func (db *Db) Query1ToMap(name, q string) map[string]string {
 // Return 1 result (the query should return 1 in the first place)
 func (db *Db) Query1(name, q string) *ogdl.Graph {
 
-	db1 := db.dbs[name]
-	if db1 == nil {
+	db1, err := db.get(name)
+	if err != nil {
+		log.Println(err)
 		return nil
 	}
 
-	if db1.Db == nil {
-		db.open(name)
-	}
-
 	rows, err := db1.Db.Query(q)
 	if err != nil {
+		db.failed(db1, err)
 		log.Println(err.Error())
 		return nil
 	}
@@ -0,0 +1,24 @@
+package gosql2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rveen/ogdl"
+)
+
+func TestConfig(t *testing.T) {
+
+	db := New(ogdl.FromString("databases\n  a\n    driver mysql\n    uri u@/a\n    timeout 5\n  b\n    driver mssql\n    timeout 250ms\n  c\n    driver mysql"))
+
+	for name, want := range map[string]time.Duration{"a": 5 * time.Second, "b": 250 * time.Millisecond, "c": 0} {
+		if db.dbs[name] == nil || db.dbs[name].timeout != want {
+			t.Errorf("%s: timeout %v, want %v", name, db.dbs[name], want)
+		}
+	}
+
+	if _, err := db.QueryCtx(context.Background(), "x", "select 1"); err == nil {
+		t.Error("expected an error for an unknown database")
+	}
+}
@@ -0,0 +1,135 @@
+package gosql2
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rveen/ogdl"
+)
+
+// testDb returns a Db with a SQLite database "test" in a temporary file.
+func testDb(t *testing.T) *Db {
+
+	cfg := ogdl.FromString("databases\n  test\n    driver sqlite\n    maxopen 1\n    timeout 5s")
+	cfg.Node("databases").Node("test").Add("uri").Add(t.TempDir() + "/test.db")
+
+	db := New(cfg)
+	t.Cleanup(func() {
+		if db1 := db.dbs["test"]; db1.Db != nil {
+			db1.Db.Close()
+		}
+	})
+
+	_, err := db.ExecSqlCtx(context.Background(), "test", `create table people (
+		id integer primary key,
+		name text,
+		score real,
+		born datetime,
+		photo blob)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestSqlite(t *testing.T) {
+
+	db := testDb(t)
+	ctx := context.Background()
+
+	if st := db.dbs["test"].Db.Stats(); st.MaxOpenConnections != 1 {
+		t.Errorf("pool setting not applied: %d", st.MaxOpenConnections)
+	}
+
+	for _, row := range []string{
+		"f insert\ntb people\nobj\n  id 1\n  name ann\n  score 1.5\n  born 2001-02-03",
+		"f insert\ntb people\nobj\n  id 2\n  name bob\n  score",
+		"f update\ntb people\nobj\n  name Bob\nwhere\n  id 2",
+	} {
+		if err := db.Exec("test", ogdl.FromString(row)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Values that would break a concatenated statement
+	g := ogdl.FromString("f insert\ntb people\nobj\n  id 3")
+	g.Node("obj").Add("name").Add("O'Brien")
+	if err := db.Exec("test", g); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := db.QueryCtx(ctx, "test", "select id, name, score, born from people where id <= ? order by id", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := r.Node("rows")
+	if rows.Len() != 2 || r.Node("columns").Len() != 4 {
+		t.Fatalf("unexpected result\n%s", r.Text())
+	}
+	ann, bob := rows.Out[0], rows.Out[1]
+	if v := ann.Out[0].This; v != int64(1) {
+		t.Errorf("id: %#v", v)
+	}
+	if v := ann.Out[2].This; v != 1.5 {
+		t.Errorf("score: %#v", v)
+	}
+	if v, ok := ann.Out[3].This.(time.Time); !ok || v.Year() != 2001 {
+		t.Errorf("born: %#v", ann.Out[3].This)
+	}
+	if bob.Out[1].This != "Bob" || bob.Out[2].This != nil {
+		t.Errorf("bob: %#v %#v", bob.Out[1].This, bob.Out[2].This)
+	}
+
+	n := 0
+	err = db.QueryEach(ctx, "test", "select * from people", func(row *ogdl.Graph) error {
+		n++
+		if row.Node("name") == nil {
+			t.Error("row without name")
+		}
+		return nil
+	})
+	if err != nil || n != 3 {
+		t.Errorf("QueryEach: %d rows, %v", n, err)
+	}
+
+	if _, err := db.QueryCtx(ctx, "test", "select * from nothing"); err == nil {
+		t.Error("expected an error")
+	}
+
+	h := db.Health(ctx)
+	if h.Node("test").Node("ok").String() != "true" {
+		t.Errorf("health\n%s", h.Text())
+	}
+}
+
+func TestSqliteRun(t *testing.T) {
+
+	db := testDb(t)
+
+	for _, s := range []string{"ann", "bob", "cid"} {
+		g := ogdl.FromString("f insert\ntb people\nobj")
+		g.Node("obj").Add("name").Add(s)
+		if err := db.Exec("test", g); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := ogdl.FromString("count\n  db test\n  params\n    min\n      type int\n      default 1\n  result scalar")
+	q.Node("count").Add("sql").Add("select count(*) from people where id >= :min")
+	if err := db.AddQuery(q.Node("count")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := db.Run("count", ogdl.FromString("min 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 1 || r.Out[0].This != int64(2) {
+		t.Errorf("count\n%s", r.Text())
+	}
+
+	if _, err := db.Run("count", ogdl.FromString("min two")); err == nil {
+		t.Error("invalid parameter accepted")
+	}
+}
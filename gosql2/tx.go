@@ -0,0 +1,228 @@
+package gosql2
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/rveen/golib/gosql"
+	"github.com/rveen/ogdl"
+)
+
+// Tx is a transaction on one database. It has the functions of Db that work
+// on a single database, without the database name. A Tx must end with
+// Commit or Rollback:
+//
+//	tx, err := db.Begin("main")
+//	if err != nil {
+//	    return err
+//	}
+//	defer tx.Rollback()
+//	...
+//	return tx.Commit()
+//
+// The timeout of the database applies to each statement, not to the whole
+// transaction.
+type Tx struct {
+	Tx  *sql.Tx
+	db  *Db
+	db1 *Db1
+}
+
+// Begin starts a transaction on a database.
+func (db *Db) Begin(name string) (*Tx, error) {
+	return db.BeginCtx(context.Background(), name, nil)
+}
+
+// BeginCtx is Begin with a context and options. The transaction is rolled
+// back if the context is canceled before Commit.
+func (db *Db) BeginCtx(ctx context.Context, name string, opts *sql.TxOptions) (*Tx, error) {
+
+	db1, err := db.get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db1.Db.BeginTx(ctx, opts)
+	if err != nil {
+		db.failed(db1, err)
+		return nil, err
+	}
+	return &Tx{Tx: tx, db: db, db1: db1}, nil
+}
+
+// Commit commits the transaction.
+func (tx *Tx) Commit() error {
+	err := tx.Tx.Commit()
+	tx.db.failed(tx.db1, err)
+	return err
+}
+
+// Rollback aborts the transaction. It does nothing if the transaction was
+// already committed or rolled back, so that it can be deferred.
+func (tx *Tx) Rollback() error {
+	err := tx.Tx.Rollback()
+	if err == sql.ErrTxDone {
+		return nil
+	}
+	return err
+}
+
+// Exec inserts, updates or deletes a row as described in g (see Db.Exec).
+func (tx *Tx) Exec(g *ogdl.Graph) error {
+	return tx.ExecCtx(context.Background(), g)
+}
+
+// ExecCtx is Exec with a context.
+func (tx *Tx) ExecCtx(ctx context.Context, g *ogdl.Graph) error {
+	err := tx.db1.exec(ctx, tx.Tx, g)
+	tx.db.failed(tx.db1, err)
+	return err
+}
+
+// ExecSql runs a statement with parameters.
+func (tx *Tx) ExecSql(q string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecSqlCtx(context.Background(), q, args...)
+}
+
+// ExecSqlCtx is ExecSql with a context.
+func (tx *Tx) ExecSqlCtx(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+
+	ctx, cancel := tx.db1.context(ctx)
+	defer cancel()
+
+	r, err := tx.Tx.ExecContext(ctx, q, args...)
+	tx.db.failed(tx.db1, err)
+	return r, err
+}
+
+// Query runs a query with parameters and returns the result as in
+// Db.QueryCtx.
+func (tx *Tx) Query(q string, args ...interface{}) (*ogdl.Graph, error) {
+	return tx.QueryCtx(context.Background(), q, args...)
+}
+
+// QueryCtx is Query with a context.
+func (tx *Tx) QueryCtx(ctx context.Context, q string, args ...interface{}) (*ogdl.Graph, error) {
+
+	r, head, row := list()
+	if err := tx.query(ctx, q, args, head, row); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// QueryEach runs a query with parameters and calls each for every row, as in
+// Db.QueryEach.
+func (tx *Tx) QueryEach(ctx context.Context, q string, each func(row *ogdl.Graph) error, args ...interface{}) error {
+	return tx.query(ctx, q, args, nil, eachRow(each))
+}
+
+// query is Db.query within the transaction. There is no retry after a
+// connection error, since the transaction is lost.
+func (tx *Tx) query(ctx context.Context, q string, args []interface{}, head func(cols []string), row func(cols []string, vv []interface{}) error) error {
+
+	ctx, cancel := tx.db1.context(ctx)
+	defer cancel()
+
+	rows, err := tx.Tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		tx.db.failed(tx.db1, err)
+		return err
+	}
+	defer rows.Close()
+
+	return scan(rows, head, row)
+}
+
+// Upsert inserts or updates rows of a table within the transaction, in
+// batches (see gosql.Upsert). Rows are column value pairs and keys the
+// columns that identify a row. A row only sets the columns it has, and of
+// rows with the same key, later values take precedence (see
+// gosql.UpsertGroups).
+func (tx *Tx) Upsert(table string, rows []map[string]string, keys []string) error {
+	return tx.UpsertCtx(context.Background(), table, rows, keys)
+}
+
+// UpsertCtx is Upsert with a context.
+func (tx *Tx) UpsertCtx(ctx context.Context, table string, rows []map[string]string, keys []string) error {
+
+	d := gosql.DialectOf(tx.db1.driver)
+	if d == nil {
+		return errors.New("unknown database driver: " + tx.db1.driver)
+	}
+
+	t, err := tx.db1.schema.Table(tx.Tx, d, table)
+	if err != nil {
+		return err
+	}
+
+	groups, err := gosql.UpsertGroups(t, rows, keys)
+	if err != nil {
+		return fmt.Errorf("upsert into %s: %v", table, err)
+	}
+
+	for _, group := range groups {
+
+		size := gosql.BatchSize(d, columns(group[:1], keys))
+
+		for i := 0; i < len(group); {
+
+			n := size
+			if n > len(group)-i {
+				n = len(group) - i
+			}
+			batch := group[i : i+n]
+
+			q, args, err := gosql.Upsert(d, t, batch, keys)
+			if err == nil {
+				_, err = tx.ExecSqlCtx(ctx, q, args...)
+			}
+			if err != nil {
+				return fmt.Errorf("upsert into %s: %v", table, err)
+			}
+			i += n
+		}
+	}
+
+	log.Printf("gosql.Upsert: %d rows into %s\n", len(rows), table)
+	return nil
+}
+
+// columns returns the number of distinct column names in rows and keys.
+func columns(rows []map[string]string, keys []string) int {
+
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		seen[k] = true
+	}
+	for _, row := range rows {
+		for k := range row {
+			seen[k] = true
+		}
+	}
+	return len(seen)
+}
+
+// Upsert inserts or updates rows of a table (see Tx.Upsert), all in one
+// transaction: if a row fails, none are written.
+func (db *Db) Upsert(name, table string, rows []map[string]string, keys []string) error {
+	return db.UpsertCtx(context.Background(), name, table, rows, keys)
+}
+
+// UpsertCtx is Upsert with a context.
+func (db *Db) UpsertCtx(ctx context.Context, name, table string, rows []map[string]string, keys []string) error {
+
+	tx, err := db.BeginCtx(ctx, name, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := tx.UpsertCtx(ctx, table, rows, keys); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,124 @@
+package gosql2
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/rveen/ogdl"
+)
+
+// count returns the number of rows in people.
+func count(t *testing.T, db *Db) int64 {
+	r, err := db.QueryCtx(context.Background(), "test", "select count(*) from people")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r.Node("rows").Out[0].Out[0].This.(int64)
+}
+
+func TestTx(t *testing.T) {
+
+	db := testDb(t)
+
+	tx, err := db.Begin("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Exec(ogdl.FromString("f insert\ntb people\nobj\n  id 1\n  name ann")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := tx.Query("select name from people where id = ?", 1)
+	if err != nil || r.Node("rows").Len() != 1 {
+		t.Fatalf("query in transaction: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db); n != 0 {
+		t.Errorf("%d rows after rollback", n)
+	}
+
+	tx, err = db.Begin("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecSql("insert into people (id, name) values (?, ?)", 1, "ann"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db); n != 1 {
+		t.Errorf("%d rows after commit", n)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+
+	db := testDb(t)
+
+	// More rows than fit in one statement
+	var rows []map[string]string
+	for i := 1; i <= 1200; i++ {
+		rows = append(rows, map[string]string{"id": strconv.Itoa(i), "name": "p" + strconv.Itoa(i)})
+	}
+	if err := db.Upsert("test", "people", rows, []string{"id"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db); n != 1200 {
+		t.Fatalf("%d rows", n)
+	}
+
+	// Updates, and an insert
+	rows = []map[string]string{
+		{"id": "1", "name": "ann", "score": "2.5"},
+		{"id": "1201", "name": "new"},
+	}
+	if err := db.Upsert("test", "people", rows, []string{"id"}); err != nil {
+		t.Fatal(err)
+	}
+	r, err := db.QueryCtx(context.Background(), "test", "select name, score from people where id = 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row := r.Node("rows").Out[0]; row.Out[0].This != "ann" || row.Out[1].This != 2.5 {
+		t.Errorf("not updated\n%s", r.Text())
+	}
+	if n := count(t, db); n != 1201 {
+		t.Errorf("%d rows", n)
+	}
+
+	// A row without score keeps it; of rows with the same key, later values
+	// win
+	rows = []map[string]string{
+		{"id": "1", "name": "anna"},
+		{"id": "2", "name": "bob", "score": "1"},
+		{"id": "2", "score": "3"},
+	}
+	if err := db.Upsert("test", "people", rows, []string{"id"}); err != nil {
+		t.Fatal(err)
+	}
+	r, err = db.QueryCtx(context.Background(), "test", "select name, score from people where id <= 2 order by id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := r.Node("rows").Out
+	if len(rr) != 2 || rr[0].Out[0].This != "anna" || rr[0].Out[1].This != 2.5 || rr[1].Out[1].This != 3.0 {
+		t.Errorf("rows\n%s", r.Text())
+	}
+
+	// A bad row in a later batch leaves the table as it was
+	rows = nil
+	for i := 2000; i < 2600; i++ {
+		rows = append(rows, map[string]string{"id": strconv.Itoa(i), "name": "x"})
+	}
+	rows = append(rows, map[string]string{"id": "2600", "score": "high"})
+	if err := db.Upsert("test", "people", rows, []string{"id"}); err == nil {
+		t.Error("invalid score accepted")
+	}
+	if n := count(t, db); n != 1201 {
+		t.Errorf("%d rows after a failed upsert", n)
+	}
+}
@@ -2,12 +2,18 @@ package ini
 
 import (
 	"bufio"
+	"bytes"
+	"io"
 	"os"
 	"strings"
 
 	"github.com/rveen/ogdl"
 )
 
+// Load reads an INI file into a graph. Each section is a node with its
+// 'var = value' (or 'var=value') pairs below it. The value is everything
+// after the first '='. A section whose first line is not such a pair is read
+// as OGDL text.
 func Load(file string) (*ogdl.Graph, error) {
 
 	f, err := os.Open(file)
@@ -16,9 +22,19 @@ func Load(file string) (*ogdl.Graph, error) {
 	}
 	defer f.Close()
 
+	return parse(f)
+}
+
+// FromBytes is Load for INI content that is already in memory.
+func FromBytes(b []byte) (*ogdl.Graph, error) {
+	return parse(bytes.NewReader(b))
+}
+
+func parse(r io.Reader) (*ogdl.Graph, error) {
+
 	g := ogdl.New(nil)
 
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(r)
 
 	section := ""
 	og := ""
@@ -28,7 +44,7 @@ func Load(file string) (*ogdl.Graph, error) {
 	rawTest := false
 
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := strings.TrimRight(scanner.Text(), "\r")
 
 		// Empty line
 		if line == "" {
@@ -66,17 +82,19 @@ func Load(file string) (*ogdl.Graph, error) {
 			line = line[0:i]
 		}
 
-		// line has 'var = value' format ?
+		// line has 'var = value' (or var=value) format ?
 		if rawTest {
-			raw = !strings.Contains(line, " = ")
+			raw = !isPair(line)
 			rawTest = false
 		}
 
 		if raw {
 			og += line + "\n"
 		} else {
-			ff := strings.Split(line, " = ")
+			ff := strings.SplitN(line, "=", 2)
 			if len(ff) == 2 {
+				ff[0] = strings.TrimSpace(ff[0])
+				ff[1] = strings.TrimSpace(ff[1])
 				if strings.HasPrefix(ff[1], "\"") {
 					ff[1] = ff[1][1:]
 				}
@@ -100,3 +118,15 @@ func Load(file string) (*ogdl.Graph, error) {
 
 	return g, nil
 }
+
+// isPair returns true if the line has the form 'var = value' or 'var=value',
+// with a single word before the first '='. OGDL lines such as 'url x?a=b'
+// are not pairs.
+func isPair(line string) bool {
+	i := strings.Index(line, "=")
+	if i < 1 {
+		return false
+	}
+	v := strings.TrimSpace(line[:i])
+	return v != "" && !strings.ContainsAny(v, " \t")
+}
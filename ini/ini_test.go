@@ -0,0 +1,73 @@
+package ini
+
+import (
+	"testing"
+
+	"github.com/rveen/ogdl"
+)
+
+func value(g *ogdl.Graph, section, key string) string {
+	return g.Node(section).Node(key).GetAt(0).ThisString()
+}
+
+func TestPairs(t *testing.T) {
+
+	g, err := FromBytes([]byte("[old]\r\nname = \"kf.db\"\r\nport = 80 # comment\r\n" +
+		"[new]\nname=kf.db\nport =80\nurl=http://host/?a=b&c=d\nempty=\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		section, key, value string
+	}{
+		{"old", "name", "kf.db"},
+		{"old", "port", "80"},
+		{"new", "name", "kf.db"},
+		{"new", "port", "80"},
+		{"new", "url", "http://host/?a=b&c=d"},
+		{"new", "empty", ""},
+	} {
+		if v := value(g, tc.section, tc.key); v != tc.value {
+			t.Errorf("%s %s: got %q, want %q", tc.section, tc.key, v, tc.value)
+		}
+	}
+}
+
+func TestRaw(t *testing.T) {
+
+	g, err := FromBytes([]byte("[ogdl]\nurl http://host/?a=b\nuser\n  name john\n[pairs]\na = b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := value(g, "ogdl", "url"); v != "http://host/?a=b" {
+		t.Errorf("raw section read as pairs: %q", v)
+	}
+	if v := g.Node("ogdl").Node("user").Node("name").GetAt(0).ThisString(); v != "john" {
+		t.Errorf("raw section: %q", v)
+	}
+	if v := value(g, "pairs", "a"); v != "b" {
+		t.Errorf("pairs after raw section: %q", v)
+	}
+}
+
+func TestIsPair(t *testing.T) {
+
+	for _, tc := range []struct {
+		line string
+		pair bool
+	}{
+		{"a = b", true},
+		{"a=b", true},
+		{"a==b", true},
+		{"a b=c", false},
+		{"=b", false},
+		{" = b", false},
+		{"a b", false},
+	} {
+		if isPair(tc.line) != tc.pair {
+			t.Errorf("%q: want %t", tc.line, tc.pair)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/rveen/golib/eventhandler"
+	"github.com/rveen/ogdl"
 )
 
 func TestByte(t *testing.T) {
@@ -147,6 +148,83 @@ func TestQuoted(t *testing.T) {
 	}
 }
 
+func TestNumber(t *testing.T) {
+
+	for _, tc := range []struct {
+		in, num string
+		ok      bool
+		ix      int
+	}{
+		{"12 a", "12", true, 2},
+		{"-1.5", "-1.5", true, 4},
+		{"+7", "7", true, 2},
+		{"-a", "", false, 0},
+		{"+", "", false, 0},
+		{"x", "", false, 0},
+	} {
+		p := New([]byte(tc.in), nil)
+		s, ok := p.Number()
+		if s != tc.num || ok != tc.ok || p.Ix != tc.ix {
+			t.Errorf("%q: got %q %t at %d", tc.in, s, ok, p.Ix)
+		}
+	}
+
+	// The sign stays for the operator
+	p := New([]byte("-a"), nil)
+	p.Number()
+	if op := p.Operator(); op != "-" {
+		t.Errorf("sign consumed: %q", op)
+	}
+}
+
+// tree writes g as nested lists: (node child ...)
+func tree(g *ogdl.Graph) string {
+	if g.Len() == 0 {
+		return g.ThisString()
+	}
+	s := "(" + g.ThisString()
+	for _, n := range g.Out {
+		s += " " + tree(n)
+	}
+	return s + ")"
+}
+
+func TestExpression(t *testing.T) {
+
+	for _, tc := range []struct {
+		in, ast string
+	}{
+		// Unary operands are children of the operator
+		{"-a", "(- (!p a))"},
+		{"!a && b", "(&& (! (!p a)) (!p b))"},
+		{"1 - -2", "(- 1 -2)"},
+		{"a * -b", "(* (!p a) (- (!p b)))"},
+		{"-(1 + 2) * 3", "(* (- (+ 1 2)) 3)"},
+
+		// Chained operators of the same precedence are all collapsed
+		{"1 + 2 + 3", "(+ (+ 1 2) 3)"},
+		{"1 - 2 + 3 - 4", "(- (+ (- 1 2) 3) 4)"},
+		{"1 * 2 + 3 * 4 * 5", "(+ (* 1 2) (* (* 3 4) 5))"},
+		{"a == 1 && b == 2 && c", "(&& (&& (== (!p a) 1) (== (!p b) 2)) (!p c))"},
+	} {
+		ev := eventhandler.New()
+		p := New([]byte(tc.in), ev)
+		if !p.Expression() {
+			t.Errorf("%q: not parsed", tc.in)
+			continue
+		}
+		g := ev.Graph()
+		Ast(g)
+		if g.Len() != 1 {
+			t.Errorf("%q: %d roots", tc.in, g.Len())
+			continue
+		}
+		if s := tree(g.Out[0]); s != tc.ast {
+			t.Errorf("%q: got %s, want %s", tc.in, s, tc.ast)
+		}
+	}
+}
+
 /*
 
 func TestUnreadByte(t *testing.T) {
@@ -221,6 +221,7 @@ func (p *Parser) Number() (string, bool) {
 	var buf []byte
 	var sign byte
 	point := false
+	ix := p.Ix
 
 	c := p.PeekByte()
 	if c == '-' || c == '+' {
@@ -229,19 +230,27 @@ func (p *Parser) Number() (string, bool) {
 	}
 
 	for {
-		c, _ := p.Byte()
+		c, ok := p.Byte()
+		if !ok {
+			break
+		}
 		if !isDigit(rune(c)) {
 			if !point && c == '.' {
 				point = true
 				buf = append(buf, c)
 				continue
 			}
+			p.UnreadByte()
 			break
 		}
 		buf = append(buf, c)
 	}
 
-	p.UnreadByte()
+	if len(buf) == 0 {
+		// Not a number: don't consume the sign
+		p.Ix = ix
+		return "", false
+	}
 	if sign == '-' {
 		return "-" + string(buf), len(buf) > 0
 	}
@@ -53,7 +53,8 @@ func ast(g *ogdl.Graph) {
 		for i := 0; i < n; i++ {
 			node := g.Out[i]
 
-			if Precedence(node.ThisString()) == j {
+			// Operators that already have operands are unary
+			if node.Len() == 0 && Precedence(node.ThisString()) == j && i > 0 && i < n-1 {
 				e1 = g.Out[i-1]
 				e2 = g.Out[i+1]
 				g.Out = append(g.Out[:i-1], g.Out[i+1:]...)
@@ -61,6 +62,8 @@ func ast(g *ogdl.Graph) {
 				node.Add(e1)
 				node.Add(e2)
 				n = len(g.Out)
+				// The next operator is now at i
+				i--
 			}
 		}
 	}
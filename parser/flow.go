@@ -78,7 +78,9 @@ func (p *Parser) ArgList() bool {
 		p.ev.Add(TypeArguments)
 		p.ev.Inc()
 
-		if !p.Expression() {
+		// An expression that reads nothing would loop here forever
+		ix := p.Ix
+		if !p.Expression() || p.Ix == ix {
 
 			p.ev.Dec()
 			p.ev.Delete()
@@ -195,10 +197,15 @@ func (p *Parser) UnaryExpression() bool {
 		return true
 	}
 
-	// unary operator
+	// unary operator: the operand is a child of the operator
 	b = p.Operator()
 	if b != "" {
 		p.ev.Add(b)
+		p.ev.Inc()
+		p.Space()
+		ok := p.UnaryExpression()
+		p.ev.Dec()
+		return ok
 	}
 
 	// group
@@ -0,0 +1,541 @@
+package polarion
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rveen/ogdl"
+)
+
+// History gives access to a Polarion project in a repository at any
+// revision: the state of work items, the changes of their fields over time
+// and the differences between two revisions (baselines).
+//
+// Directory listings of revisions are cached; a History is not safe for
+// concurrent use.
+type History struct {
+	ID        string
+	Path      string // of the project in the repository
+	Revisions []Revision
+
+	repo Repository
+	revs map[int]*revision
+}
+
+// ItemChange is a change of a work item.
+type ItemChange struct {
+	ID       string
+	Action   string // added, modified, moved or removed
+	Revision int
+	Author   string
+	Date     time.Time
+	Path     string // of the workitem.xml file in the project, after the change
+	Fields   []FieldChange
+}
+
+// FieldChange is a change of one field of a work item. Fields with structure
+// (such as linkedWorkItems) have their values in OGDL text format.
+type FieldChange struct {
+	Field    string
+	Old, New string
+}
+
+// LinkRef is a link between two work items.
+type LinkRef struct {
+	Source, Destination, Type string
+}
+
+// Changeset holds the differences of a project between two revisions.
+type Changeset struct {
+	From, To     int
+	Added        []string // work item IDs
+	Removed      []string
+	Modified     []ItemChange
+	LinksAdded   []LinkRef
+	LinksRemoved []LinkRef
+}
+
+// Work items are in .polarion/tracker/workitems/<range>/<ID>/workitem.xml or
+// modules/<space>/<document>/workitems/<ID>/workitem.xml
+var itemFile = regexp.MustCompile(`^(?:\.polarion/tracker/workitems/(?:.*/)?|modules/[^/]+/[^/]+/workitems/)([^/]+)/workitem\.xml$`)
+
+// itemID returns the work item ID of the path of a workitem.xml file in a
+// project, or "".
+func itemID(p string) string {
+	if m := itemFile.FindStringSubmatch(p); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// OpenHistory reads the log of the project at path in a repository. The
+// project ID is the last element of the path.
+func OpenHistory(repo Repository, prj string) (*History, error) {
+
+	prj = clean(prj)
+	rr, err := repo.Log(prj)
+	if err != nil {
+		return nil, err
+	}
+	if len(rr) == 0 {
+		return nil, errors.New("no revisions for " + prj)
+	}
+
+	return &History{ID: path.Base("/" + prj), Path: prj, Revisions: rr, repo: repo, revs: make(map[int]*revision)}, nil
+}
+
+// AddRepository loads a project from a repository at a revision (the last
+// one if rev is 0).
+func (P *Polarion) AddRepository(repo Repository, prj string, rev int) error {
+
+	h, err := OpenHistory(repo, prj)
+	if err != nil {
+		return err
+	}
+	p, err := h.Project(rev)
+	if err != nil {
+		return err
+	}
+	P.addProject(p)
+	return nil
+}
+
+// Head returns the last revision of the project.
+func (h *History) Head() int {
+	return h.Revisions[len(h.Revisions)-1].Number
+}
+
+func (h *History) at(rev int) (*revision, error) {
+
+	if rev <= 0 {
+		rev = h.Head()
+	}
+	if r := h.revs[rev]; r != nil {
+		return r, nil
+	}
+	r, err := newRevision(h.repo, h.Path, rev)
+	if err != nil {
+		return nil, err
+	}
+	h.revs[rev] = r
+	return r, nil
+}
+
+// Project loads the project as it was at a revision (the last one if rev is
+// 0).
+func (h *History) Project(rev int) (*Project, error) {
+
+	r, err := h.at(rev)
+	if err != nil {
+		return nil, err
+	}
+	p := &Project{ID: h.ID, Path: h.Path, src: r}
+	p.load()
+	return p, nil
+}
+
+// Item returns a work item as it was at a revision (the last one if rev is
+// 0).
+func (h *History) Item(id string, rev int) (*Item, error) {
+
+	r, err := h.at(rev)
+	if err != nil {
+		return nil, err
+	}
+	file, ok := r.items[id]
+	if !ok {
+		return nil, fmt.Errorf("work item %s does not exist at revision %d", id, r.rev)
+	}
+	return h.item(id, file, r.rev)
+}
+
+// item reads the workitem.xml file of an item.
+func (h *History) item(id, file string, rev int) (*Item, error) {
+
+	b, err := h.repo.Cat(join(h.Path, file), rev)
+	if err != nil {
+		return nil, err
+	}
+	return newItem(id, itemPath(file), b), nil
+}
+
+// itemPath returns Item.Path for a workitem.xml file: the workitems
+// directory of a document, or "".
+func itemPath(file string) string {
+	if strings.HasPrefix(file, "modules/") {
+		return "/" + path.Dir(path.Dir(file))
+	}
+	return ""
+}
+
+// ItemHistory returns the changes of a work item, oldest first.
+func (h *History) ItemHistory(id string) ([]ItemChange, error) {
+
+	var cc []ItemChange
+	var prev *Item
+	file := ""
+
+	for _, rv := range h.Revisions {
+
+		direct, touched := h.touches(rv, id, file)
+		if !touched {
+			continue
+		}
+
+		var it *Item
+		var err error
+
+		if direct {
+			// Only the file itself changed
+			it, err = h.item(id, file, rv.Number)
+		} else {
+			var r *revision
+			if r, err = h.at(rv.Number); err != nil {
+				return nil, err
+			}
+			f, ok := r.items[id]
+			if ok {
+				it, err = h.item(id, f, rv.Number)
+			}
+			file = f
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		c := ItemChange{ID: id, Revision: rv.Number, Author: rv.Author, Date: rv.Date, Path: file}
+
+		switch {
+		case it == nil && prev == nil:
+			continue
+		case it == nil:
+			c.Action = "removed"
+		case prev == nil:
+			c.Action = "added"
+			c.Fields = diffFields(nil, it)
+		default:
+			c.Fields = diffFields(prev, it)
+			c.Action = "modified"
+			if prev.Path != it.Path {
+				c.Action = "moved"
+			} else if len(c.Fields) == 0 {
+				prev = it
+				continue
+			}
+		}
+
+		cc = append(cc, c)
+		prev = it
+	}
+
+	return cc, nil
+}
+
+// touches tells if a revision may change a work item, and if so, whether only
+// its known workitem.xml file was modified.
+func (h *History) touches(rv Revision, id, file string) (direct, touched bool) {
+
+	direct = file != ""
+
+	for _, cp := range rv.Paths {
+
+		p, ok := h.rel(cp.Path)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case p == file && cp.Action == "M":
+			touched = true
+		case itemID(p) == id || strings.HasSuffix(p, "/"+id) || strings.Contains(p, "/"+id+"/"):
+			touched, direct = true, false
+		case cp.Action != "M" && file != "" && (p == "" || strings.HasPrefix(file, p+"/")):
+			// A directory with the item was added, deleted or replaced
+			touched, direct = true, false
+		}
+	}
+	return direct && touched, touched
+}
+
+// rel returns a path of a log entry relative to the project.
+func (h *History) rel(p string) (string, bool) {
+
+	p = clean(p)
+	switch {
+	case h.Path == "":
+		return p, true
+	case p == h.Path:
+		return "", true
+	case strings.HasPrefix(p, h.Path+"/"):
+		return p[len(h.Path)+1:], true
+	}
+	return "", false
+}
+
+// Changes returns the differences between two revisions.
+func (h *History) Changes(from, to int) (*Changeset, error) {
+
+	a, err := h.at(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := h.at(to)
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &Changeset{From: a.rev, To: b.rev}
+
+	// Items whose workitem.xml changed, and directories that were added,
+	// deleted or replaced (possibly with items in them)
+	touched := make(map[string]bool)
+	var dirs []string
+
+	for _, rv := range h.Revisions {
+		if rv.Number <= a.rev || rv.Number > b.rev {
+			continue
+		}
+		for _, cp := range rv.Paths {
+			p, ok := h.rel(cp.Path)
+			if !ok {
+				continue
+			}
+			if id := itemID(p); id != "" {
+				touched[id] = true
+			} else if cp.Action != "M" {
+				dirs = append(dirs, p)
+			}
+		}
+	}
+
+	changed := func(id string) bool {
+		if touched[id] || a.items[id] != b.items[id] {
+			return true
+		}
+		for _, d := range dirs {
+			if d == "" || strings.HasPrefix(b.items[id], d+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, id := range sortedKeys(b.items) {
+
+		if _, ok := a.items[id]; !ok {
+			cs.Added = append(cs.Added, id)
+			it, err := h.item(id, b.items[id], b.rev)
+			if err != nil {
+				return nil, err
+			}
+			cs.LinksAdded = append(cs.LinksAdded, links(it)...)
+			continue
+		}
+
+		if !changed(id) {
+			continue
+		}
+
+		old, err := h.item(id, a.items[id], a.rev)
+		if err != nil {
+			return nil, err
+		}
+		it, err := h.item(id, b.items[id], b.rev)
+		if err != nil {
+			return nil, err
+		}
+
+		c := ItemChange{ID: id, Action: "modified", Revision: b.rev, Path: b.items[id], Fields: diffFields(old, it)}
+		if old.Path != it.Path {
+			c.Action = "moved"
+		} else if len(c.Fields) == 0 {
+			continue
+		}
+		cs.Modified = append(cs.Modified, c)
+
+		added, removed := diffLinks(links(old), links(it))
+		cs.LinksAdded = append(cs.LinksAdded, added...)
+		cs.LinksRemoved = append(cs.LinksRemoved, removed...)
+	}
+
+	for _, id := range sortedKeys(a.items) {
+		if _, ok := b.items[id]; !ok {
+			cs.Removed = append(cs.Removed, id)
+			it, err := h.item(id, a.items[id], a.rev)
+			if err != nil {
+				return nil, err
+			}
+			cs.LinksRemoved = append(cs.LinksRemoved, links(it)...)
+		}
+	}
+
+	return cs, nil
+}
+
+// Graph returns the changeset as
+//
+//	from 10
+//	to 12
+//	added
+//	  ID
+//	removed
+//	  ID
+//	modified
+//	  ID
+//	    field
+//	      old value
+//	      new value
+//	links
+//	  added
+//	    - source type destination
+//	  removed
+//	    - source type destination
+func (cs *Changeset) Graph() *ogdl.Graph {
+
+	g := ogdl.New(nil)
+	g.Add("from").Add(cs.From)
+	g.Add("to").Add(cs.To)
+
+	n := g.Add("added")
+	for _, id := range cs.Added {
+		n.Add(id)
+	}
+	n = g.Add("removed")
+	for _, id := range cs.Removed {
+		n.Add(id)
+	}
+	n = g.Add("modified")
+	for _, c := range cs.Modified {
+		m := n.Add(c.ID)
+		for _, f := range c.Fields {
+			ff := m.Add(f.Field)
+			ff.Add(f.Old)
+			ff.Add(f.New)
+		}
+	}
+
+	n = g.Add("links")
+	for _, l := range []struct {
+		name string
+		ll   []LinkRef
+	}{{"added", cs.LinksAdded}, {"removed", cs.LinksRemoved}} {
+		m := n.Add(l.name)
+		for _, lr := range l.ll {
+			e := m.Add("-")
+			e.Add(lr.Source)
+			e.Add(lr.Type)
+			e.Add(lr.Destination)
+		}
+	}
+
+	return g
+}
+
+// fields returns the fields of a work item with their values as text.
+func fields(it *Item) map[string]string {
+
+	m := make(map[string]string)
+	if it == nil || it.Tree == nil {
+		return m
+	}
+	for _, n := range it.Tree.Out {
+		name := n.ThisString()
+		if name == "id" || strings.HasPrefix(name, "@") {
+			continue
+		}
+		if n.Len() == 1 && n.Out[0].Len() == 0 {
+			m[name] = n.Out[0].ThisString()
+		} else {
+			m[name] = strings.TrimSpace(n.Text())
+		}
+	}
+	return m
+}
+
+// diffFields returns the fields that differ, in alphabetical order.
+func diffFields(a, b *Item) []FieldChange {
+
+	fa, fb := fields(a), fields(b)
+
+	names := sortedKeys(fb)
+	for name := range fa {
+		if _, ok := fb[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var ff []FieldChange
+	for _, name := range names {
+		if fa[name] != fb[name] {
+			ff = append(ff, FieldChange{Field: name, Old: fa[name], New: fb[name]})
+		}
+	}
+	return ff
+}
+
+// links returns the links of a work item to other items, as in
+//
+//	linkedWorkItems
+//	  list
+//	    struct
+//	      role parent
+//	      workItem DEMO-1
+func links(it *Item) []LinkRef {
+
+	lw := it.Tree.Node("linkedWorkItems")
+	if lw == nil {
+		return nil
+	}
+	if l := lw.Node("list"); l != nil {
+		lw = l
+	}
+
+	var ll []LinkRef
+	for _, s := range lw.Out {
+		wi := s.Node("workItem").String()
+		if wi == "" {
+			continue
+		}
+		ll = append(ll, LinkRef{Source: it.ID, Destination: wi, Type: s.Node("role").String()})
+	}
+	return ll
+}
+
+func diffLinks(a, b []LinkRef) (added, removed []LinkRef) {
+
+	in := func(l LinkRef, ll []LinkRef) bool {
+		for _, x := range ll {
+			if x == l {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, l := range b {
+		if !in(l, a) {
+			added = append(added, l)
+		}
+	}
+	for _, l := range a {
+		if !in(l, b) {
+			removed = append(removed, l)
+		}
+	}
+	return added, removed
+}
+
+func sortedKeys(m map[string]string) []string {
+	ss := make([]string, 0, len(m))
+	for k := range m {
+		ss = append(ss, k)
+	}
+	sort.Strings(ss)
+	return ss
+}
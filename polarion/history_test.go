@@ -0,0 +1,239 @@
+package polarion
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memRepo is a repository in memory: a snapshot of all files per revision.
+type memRepo struct {
+	revs  []Revision
+	files []map[string]string // index is revision - 1
+}
+
+// commit adds a revision with the changes given as path content pairs. An
+// empty content deletes the file, or the directory if the path ends with /.
+func (m *memRepo) commit(changes ...string) {
+
+	files := make(map[string]string)
+	if n := len(m.files); n > 0 {
+		for k, v := range m.files[n-1] {
+			files[k] = v
+		}
+	}
+
+	rev := Revision{Number: len(m.revs) + 1, Author: "ann", Date: time.Date(2024, 1, len(m.revs)+1, 0, 0, 0, 0, time.UTC)}
+
+	for i := 0; i < len(changes); i += 2 {
+		p, content := changes[i], changes[i+1]
+		action := "M"
+		switch {
+		case content == "":
+			action = "D"
+			for k := range files {
+				if k == p || strings.HasPrefix(k, p) {
+					delete(files, k)
+				}
+			}
+			p = strings.TrimSuffix(p, "/")
+		case files[p] == "":
+			action = "A"
+			files[p] = content
+		default:
+			files[p] = content
+		}
+		rev.Paths = append(rev.Paths, ChangedPath{Action: action, Path: "/" + p})
+	}
+
+	m.revs = append(m.revs, rev)
+	m.files = append(m.files, files)
+}
+
+func (m *memRepo) Log(path string) ([]Revision, error) {
+	var rr []Revision
+	for _, r := range m.revs {
+		for _, p := range r.Paths {
+			if strings.HasPrefix(p.Path, "/"+path) {
+				rr = append(rr, r)
+				break
+			}
+		}
+	}
+	return rr, nil
+}
+
+func (m *memRepo) List(path string, rev int) ([]string, error) {
+
+	if rev < 1 || rev > len(m.files) {
+		return nil, errors.New("no such revision")
+	}
+
+	seen := make(map[string]bool)
+	for f := range m.files[rev-1] {
+		if !strings.HasPrefix(f, path+"/") {
+			continue
+		}
+		f = f[len(path)+1:]
+		seen[f] = true
+		for i := range f {
+			if f[i] == '/' {
+				seen[f[:i+1]] = true
+			}
+		}
+	}
+
+	var ss []string
+	for f := range seen {
+		ss = append(ss, f)
+	}
+	sort.Strings(ss)
+	return ss, nil
+}
+
+func (m *memRepo) Cat(path string, rev int) ([]byte, error) {
+	s, ok := m.files[rev-1][path]
+	if !ok {
+		return nil, errors.New("no such file: " + path)
+	}
+	return []byte(s), nil
+}
+
+func workitem(title, parent string) string {
+	s := `<?xml version="1.0" encoding="UTF-8"?>
+<work-item>
+  <field id="title">` + title + `</field>
+  <field id="type">requirement</field>`
+	if parent != "" {
+		s += `
+  <field id="linkedWorkItems"><list><struct><item id="role">parent</item><item id="workItem">` + parent + `</item></struct></list></field>`
+	}
+	return s + "\n</work-item>\n"
+}
+
+const (
+	prj   = "Projects/DEMO/"
+	item1 = prj + ".polarion/tracker/workitems/00000-00099/DEMO-1/workitem.xml"
+	item2 = prj + "modules/Specs/Reqs/workitems/DEMO-2/workitem.xml"
+	item3 = prj + ".polarion/tracker/workitems/00000-00099/DEMO-3/workitem.xml"
+)
+
+func testRepo() *memRepo {
+
+	m := &memRepo{}
+	m.commit(
+		item1, workitem("Brakes", ""),
+		prj+"modules/Specs/Reqs/module.xml", `<module><field id="homePageContent">text</field></module>`,
+		item2, workitem("Brake pedal", "DEMO-1"))
+	m.commit(item2, workitem("Brake pedal force", "DEMO-1"))
+	m.commit(
+		item3, workitem("Lights", ""),
+		item2, workitem("Brake pedal force", ""))
+	m.commit(prj+"modules/Specs/", "")
+	return m
+}
+
+func TestHistory(t *testing.T) {
+
+	h, err := OpenHistory(testRepo(), "/Projects/DEMO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.ID != "DEMO" || h.Head() != 4 {
+		t.Errorf("id %s head %d", h.ID, h.Head())
+	}
+
+	it, err := h.Item("DEMO-2", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields(it)["title"] != "Brake pedal" || it.Path != "/modules/Specs/Reqs/workitems" {
+		t.Errorf("DEMO-2 at 1: %v %s", fields(it), it.Path)
+	}
+	if _, err := h.Item("DEMO-2", 4); err == nil {
+		t.Error("DEMO-2 is deleted at 4")
+	}
+	if _, err := h.Item("DEMO-3", 2); err == nil {
+		t.Error("DEMO-3 is added at 3")
+	}
+
+	p, err := h.Project(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Items) != 2 || len(p.documents) != 1 || len(p.documents[0].Items) != 0 {
+		t.Errorf("project at 1: %d items, %d documents", len(p.Items), len(p.documents))
+	}
+
+	var P Polarion
+	if err := P.AddRepository(testRepo(), "Projects/DEMO", 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(P.Items) != 2 || P.Item("DEMO-3") == nil {
+		t.Errorf("head: %d items", len(P.Items))
+	}
+}
+
+func TestItemHistory(t *testing.T) {
+
+	h, err := OpenHistory(testRepo(), "Projects/DEMO")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cc, err := h.ItemHistory("DEMO-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, c := range cc {
+		s := c.Action
+		for _, f := range c.Fields {
+			s += " " + f.Field
+		}
+		got = append(got, s)
+	}
+	want := "added linkedWorkItems title type; modified title; modified linkedWorkItems; removed"
+	if strings.Join(got, "; ") != want {
+		t.Errorf("got %s", strings.Join(got, "; "))
+	}
+	if cc[1].Revision != 2 || cc[1].Fields[0].Old != "Brake pedal" || cc[1].Fields[0].New != "Brake pedal force" {
+		t.Errorf("change 2: %+v", cc[1])
+	}
+}
+
+func TestChanges(t *testing.T) {
+
+	h, err := OpenHistory(testRepo(), "Projects/DEMO")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err := h.Changes(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.Added) != 1 || cs.Added[0] != "DEMO-3" || len(cs.Removed) != 0 {
+		t.Errorf("added %v removed %v", cs.Added, cs.Removed)
+	}
+	if len(cs.Modified) != 1 || len(cs.Modified[0].Fields) != 2 {
+		t.Errorf("modified %+v", cs.Modified)
+	}
+	if len(cs.LinksRemoved) != 1 || cs.LinksRemoved[0] != (LinkRef{"DEMO-2", "DEMO-1", "parent"}) {
+		t.Errorf("links removed %v", cs.LinksRemoved)
+	}
+
+	cs, err = h.Changes(1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.Removed) != 1 || cs.Removed[0] != "DEMO-2" || len(cs.Modified) != 0 {
+		t.Errorf("removed %v modified %v", cs.Removed, cs.Modified)
+	}
+	if g := cs.Graph(); g.Node("removed").String() != "DEMO-2" {
+		t.Errorf("graph\n%s", g.Text())
+	}
+}
@@ -0,0 +1,493 @@
+package polarion
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Markdown returns the document in the Markdown dialect of package document,
+// so that it can be served, compared and searched like any other text:
+//
+//	#! Document title
+//
+//	# Heading
+//
+//	Text of the document
+//
+//	## Work item title {#DEMO-12} {!requirement}
+//
+//	{
+//	status approved
+//	priority "50.0"
+//	}
+//
+//	Description of the work item
+//
+//	- verifies [DEMO-3 Other item](#DEMO-3)
+//
+// Headings of the document are sections. Other work items are sections one
+// level below the current heading, with their ID as anchor, their type, and
+// their simple fields as a data block. Links to work items in the same
+// document point to their anchor; links to items in other documents to
+// ../<space>/<document>.md#<ID>, as written by ExportMarkdown.
+func (doc *Document) Markdown() string {
+
+	if doc == nil || doc.Tree == nil {
+		return ""
+	}
+
+	m := &mdWriter{doc: doc, inDoc: make(map[string]bool)}
+
+	if t := doc.Tree.Get("module.title").String(); t != "" {
+		m.sb.WriteString("#! " + t + "\n\n")
+	}
+
+	nodes, _ := html.ParseFragment(strings.NewReader(doc.Tree.Get("module.homePageContent").String()), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+
+	// Work items of the document, headings included
+	var walk func(nn []*html.Node)
+	walk = func(nn []*html.Node) {
+		for _, n := range nn {
+			if id := workitemID(n); id != "" && doc.Prj.Items[id] != nil {
+				m.inDoc[id] = true
+			}
+			walk(children(n))
+		}
+	}
+	walk(nodes)
+
+	m.blocks(nodes, 0)
+
+	return strings.TrimRight(m.sb.String(), "\n") + "\n"
+}
+
+// ExportMarkdown writes the documents of the project to
+// dir/<space>/<document>.md.
+func (p *Project) ExportMarkdown(dir string) error {
+
+	for _, doc := range p.documents {
+		file := filepath.Join(dir, doc.Space, doc.ID+".md")
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, []byte(doc.Markdown()), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (doc *Document) attachmentDir() string {
+	return PolarionBasePath + doc.Prj.ID + "/modules/" + doc.Space + "/" + doc.ID + "/attachments/"
+}
+
+func (doc *Document) workitemDir() string {
+	return PolarionBasePath + doc.Prj.ID + "/modules/" + doc.Space + "/" + doc.ID + "/workitems/"
+}
+
+type mdWriter struct {
+	sb    strings.Builder
+	doc   *Document
+	inDoc map[string]bool // work items of the document
+	level int             // of the last heading
+}
+
+// workitemID returns the ID of the work item that an element stands for, or "".
+func workitemID(n *html.Node) string {
+
+	id := attr(n, "id")
+	i := strings.Index(id, "workitem;params=id=")
+	if i == -1 {
+		return ""
+	}
+	id = id[i+19:]
+	if i = strings.Index(id, "|"); i != -1 { // External!
+		id = id[:i]
+	}
+	return id
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// blocks writes a list of block elements. depth is the list depth.
+func (m *mdWriter) blocks(nodes []*html.Node, depth int) {
+
+	for _, n := range nodes {
+
+		if n.Type == html.TextNode {
+			m.paragraph(collapse(n.Data))
+			continue
+		}
+		if n.Type != html.ElementNode {
+			continue
+		}
+
+		switch n.DataAtom {
+
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			m.level = int(n.Data[1] - '0')
+			id := workitemID(n)
+			if id == "" {
+				m.heading(m.level, m.inline(n), "", "")
+			} else if it := m.doc.Prj.Items[id]; it != nil {
+				m.heading(m.level, it.Title(), id, "")
+			}
+
+		case atom.Div:
+			if id := workitemID(n); id != "" {
+				if it := m.doc.Prj.Items[id]; it != nil {
+					m.item(it)
+				}
+				continue
+			}
+			m.blocks(children(n), depth)
+
+		case atom.P:
+			m.paragraph(m.inline(n))
+
+		case atom.Ul, atom.Ol:
+			m.list(n, depth)
+			m.sb.WriteString("\n")
+
+		case atom.Table:
+			m.table(tableRows(n))
+
+		case atom.Pre:
+			m.sb.WriteString("```\n" + strings.TrimRight(text(n), "\n") + "\n```\n\n")
+
+		case atom.Br, atom.Hr, atom.Style, atom.Script:
+
+		default:
+			m.paragraph(m.inline(n))
+		}
+	}
+}
+
+func (m *mdWriter) heading(lev int, title, id, typ string) {
+
+	if lev < 1 {
+		lev = 1
+	}
+	if lev > 6 {
+		lev = 6
+	}
+
+	m.sb.WriteString(strings.Repeat("#", lev) + " " + title)
+	if id != "" {
+		m.sb.WriteString(" {#" + id + "}")
+	}
+	if typ != "" {
+		m.sb.WriteString(" {!" + typ + "}")
+	}
+	m.sb.WriteString("\n\n")
+}
+
+// item writes a work item that is not a heading.
+func (m *mdWriter) item(it *Item) {
+
+	m.heading(m.level+1, it.Title(), it.ID, it.Type)
+
+	// Simple fields as data
+	ff := fields(it)
+	var names []string
+	for name, v := range ff {
+		switch name {
+		case "title", "description", "type":
+			continue
+		}
+		if v != "" && !strings.Contains(v, "\n") && it.Tree.Node(name).Len() == 1 && it.Tree.Node(name).Out[0].Len() == 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 {
+		m.sb.WriteString("{\n")
+		for _, name := range names {
+			m.sb.WriteString(name + " " + ogdlString(ff[name]) + "\n")
+		}
+		m.sb.WriteString("}\n\n")
+	}
+
+	// Description (HTML)
+	desc := it.Tree.Node("description").String()
+	desc = strings.Replace(desc, "workitemimg:", m.doc.workitemDir()+it.ID+"/attachment", -1)
+	nodes, _ := html.ParseFragment(strings.NewReader(desc), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	lev := m.level
+	m.blocks(nodes, 0)
+	m.level = lev
+
+	// Test steps
+	if ts := it.Tree.Get("testSteps.struct.steps.list"); ts != nil && ts.Len() > 0 {
+		rows := [][]string{{"Step", "Description", "Criteria"}}
+		for _, t := range ts.Out {
+			var row []string
+			if step := t.Get("values.list"); step != nil {
+				for _, col := range step.Out {
+					row = append(row, m.inlineHtml(col.GetAt(1).ThisString()))
+				}
+			}
+			rows = append(rows, row)
+		}
+		m.table(rows)
+	}
+
+	// Links
+	ll := links(it)
+	for _, l := range ll {
+		m.sb.WriteString("- " + l.Type + " " + m.itemLink(l.Destination) + "\n")
+	}
+	if len(ll) > 0 {
+		m.sb.WriteString("\n")
+	}
+}
+
+// itemLink returns a link to a work item.
+func (m *mdWriter) itemLink(id string) string {
+
+	it := m.doc.Prj.Items[id]
+	text := id
+	if it != nil && it.Title() != "" {
+		text += " " + it.Title()
+	}
+	text = strings.NewReplacer("[", "(", "]", ")").Replace(text)
+
+	switch {
+	case m.inDoc[id]:
+		return "[" + text + "](#" + id + ")"
+	case it != nil && strings.HasPrefix(it.Path, "/modules/"):
+		// /modules/<space>/<document>/workitems
+		pp := strings.Split(it.Path, "/")
+		if len(pp) >= 4 {
+			return "[" + text + "](../" + pp[2] + "/" + pp[3] + ".md#" + id + ")"
+		}
+	}
+	return text
+}
+
+func (m *mdWriter) paragraph(s string) {
+
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return
+	}
+	// Characters that start other blocks
+	if strings.IndexByte("#:.>-+|`{", s[0]) != -1 {
+		s = " " + s
+	}
+	m.sb.WriteString(s + "\n\n")
+}
+
+func (m *mdWriter) list(n *html.Node, depth int) {
+
+	mark := "- "
+	if n.DataAtom == atom.Ol {
+		mark = "+ "
+	}
+
+	for _, li := range children(n) {
+		if li.DataAtom != atom.Li {
+			continue
+		}
+		var text strings.Builder
+		var sub []*html.Node
+		for _, c := range children(li) {
+			if c.DataAtom == atom.Ul || c.DataAtom == atom.Ol {
+				sub = append(sub, c)
+			} else {
+				text.WriteString(m.inlineNode(c))
+			}
+		}
+		m.sb.WriteString(strings.Repeat("  ", depth) + mark + strings.TrimSpace(collapse(text.String())) + "\n")
+		for _, s := range sub {
+			m.list(s, depth+1)
+		}
+	}
+}
+
+// table writes rows as a table, the first one as header.
+func (m *mdWriter) table(rows [][]string) {
+
+	if len(rows) == 0 {
+		return
+	}
+
+	ncols := 0
+	for _, r := range rows {
+		if len(r) > ncols {
+			ncols = len(r)
+		}
+	}
+
+	for i, r := range rows {
+		m.sb.WriteString("|")
+		for j := 0; j < ncols; j++ {
+			cell := ""
+			if j < len(r) {
+				cell = strings.Replace(strings.TrimSpace(r[j]), "|", "&#124;", -1)
+			}
+			m.sb.WriteString(" " + cell + " |")
+		}
+		m.sb.WriteString("\n")
+		if i == 0 {
+			m.sb.WriteString("|" + strings.Repeat("---|", ncols) + "\n")
+		}
+	}
+	m.sb.WriteString("\n")
+}
+
+// tableRows returns the text of the cells of a table.
+func tableRows(n *html.Node) [][]string {
+
+	var rows [][]string
+	var walk func(n *html.Node)
+	m := &mdWriter{}
+
+	walk = func(n *html.Node) {
+		for _, c := range children(n) {
+			switch c.DataAtom {
+			case atom.Tr:
+				var row []string
+				for _, td := range children(c) {
+					if td.DataAtom == atom.Td || td.DataAtom == atom.Th {
+						row = append(row, collapse(m.inline(td)))
+					}
+				}
+				rows = append(rows, row)
+			case atom.Table:
+				// nested tables are not supported
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return rows
+}
+
+// inline returns the content of an element as text with Markdown markup.
+func (m *mdWriter) inline(n *html.Node) string {
+	var sb strings.Builder
+	for _, c := range children(n) {
+		sb.WriteString(m.inlineNode(c))
+	}
+	return collapse(sb.String())
+}
+
+func (m *mdWriter) inlineHtml(s string) string {
+	nodes, _ := html.ParseFragment(strings.NewReader(s), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	var sb strings.Builder
+	for _, n := range nodes {
+		sb.WriteString(m.inlineNode(n))
+	}
+	return collapse(sb.String())
+}
+
+func (m *mdWriter) inlineNode(n *html.Node) string {
+
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	if n.Type != html.ElementNode {
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.B, atom.Strong:
+		return wrap("**", m.inline(n))
+	case atom.I, atom.Em:
+		return wrap("*", m.inline(n))
+	case atom.Code:
+		return wrap("`", m.inline(n))
+	case atom.Br:
+		return " "
+	case atom.A:
+		href := attr(n, "href")
+		if href == "" {
+			return m.inline(n)
+		}
+		return "[" + m.inline(n) + "](" + href + ")"
+	case atom.Img:
+		src := attr(n, "src")
+		if strings.HasPrefix(src, "attachment:") && m.doc != nil {
+			src = m.doc.attachmentDir() + src[11:]
+		}
+		return "![](" + src + ")"
+	case atom.Span:
+		if id := attr(n, "data-item-id"); id != "" && m.doc != nil {
+			return m.itemLink(id)
+		}
+	case atom.Style, atom.Script:
+		return ""
+	}
+	return m.inline(n)
+}
+
+func wrap(mark, s string) string {
+	if strings.TrimSpace(s) == "" {
+		return s
+	}
+	return mark + strings.TrimSpace(s) + mark
+}
+
+func children(n *html.Node) []*html.Node {
+	var nn []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		nn = append(nn, c)
+	}
+	return nn
+}
+
+// text returns the text of an element, as is.
+func text(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var sb strings.Builder
+	for _, c := range children(n) {
+		sb.WriteString(text(c))
+	}
+	return sb.String()
+}
+
+// collapse replaces runs of white space by one space.
+func collapse(s string) string {
+
+	var sb strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == ' ' {
+			space = true
+			continue
+		}
+		if space && sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		space = false
+		sb.WriteRune(r)
+	}
+	if space && sb.Len() > 0 {
+		sb.WriteByte(' ')
+	}
+	return sb.String()
+}
+
+// ogdlString quotes a value if needed in OGDL.
+func ogdlString(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'(),#\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,79 @@
+package polarion
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rveen/golib/document"
+)
+
+func TestMarkdown(t *testing.T) {
+
+	content := `<h1 id="polarion_wiki macro name=module-workitem;params=id=DEMO-0"></h1>` +
+		`<p>Intro with <b>bold</b> and a <a href="http://x.org">link</a>.</p>` +
+		`<table><tr><th>Name</th><th>Value</th></tr><tr><td>speed</td><td>10 | 20</td></tr></table>` +
+		`<div id="polarion_wiki macro name=module-workitem;params=id=DEMO-1"></div>` +
+		`<ul><li>one</li><li>two</li></ul>`
+
+	files := map[string]string{
+		"modules/Specs/Reqs/module.xml": `<module><field id="title">Requirements</field><field id="homePageContent">` +
+			strings.NewReplacer("<", "&lt;", ">", "&gt;", `"`, "&quot;").Replace(content) + `</field></module>`,
+		"modules/Specs/Reqs/workitems/DEMO-0/workitem.xml": item("Brakes", "heading"),
+		"modules/Specs/Reqs/workitems/DEMO-1/workitem.xml": `<work-item>
+  <field id="title">Pedal</field>
+  <field id="type">requirement</field>
+  <field id="status">in review</field>
+  <field id="priority">50.0</field>
+  <field id="description" content-type="text/html">&lt;p&gt;The pedal &lt;i&gt;shall&lt;/i&gt; work.&lt;/p&gt;</field>
+  <field id="linkedWorkItems"><list><struct><item id="role">parent</item><item id="workItem">DEMO-0</item></struct><struct><item id="role">relates_to</item><item id="workItem">DEMO-10</item></struct></list></field>
+</work-item>`,
+		"modules/Tests/Cases/module.xml":                     module("DEMO-10"),
+		"modules/Tests/Cases/workitems/DEMO-10/workitem.xml": item("Press pedal", "test"),
+	}
+
+	P := writeProject(t, files)
+	md := P.Document("DEMO", "Specs", "Reqs").Markdown()
+
+	for _, s := range []string{
+		"#! Requirements\n",
+		"# Brakes {#DEMO-0}\n",
+		"Intro with **bold** and a [link](http://x.org).\n",
+		"| Name | Value |\n|---|---|\n| speed | 10 &#124; 20 |\n",
+		"## Pedal {#DEMO-1} {!requirement}\n",
+		"{\npriority 50.0\nstatus \"in review\"\n}\n",
+		"The pedal *shall* work.\n",
+		"- parent [DEMO-0 Brakes](#DEMO-0)\n",
+		"- relates_to [DEMO-10 Press pedal](../Tests/Cases.md#DEMO-10)\n",
+		"- one\n- two\n",
+	} {
+		if !strings.Contains(md, s) {
+			t.Errorf("missing %q in\n%s", s, md)
+		}
+	}
+
+	// Read back as a document
+	doc, err := document.New(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := doc.Data().Node("DEMO-0").Node("DEMO-1")
+	if g == nil {
+		t.Fatalf("no data for DEMO-1:\n%s", doc.Data().Text())
+	}
+	if s := g.Node("status").String(); s != "in review" {
+		t.Errorf("status %q", s)
+	}
+	if h := doc.Html(); !strings.Contains(h, `id="DEMO-1"`) || !strings.Contains(h, "<table") {
+		t.Errorf("html:\n%s", h)
+	}
+
+	dir := t.TempDir()
+	if err := P.Document("DEMO", "Specs", "Reqs").Prj.ExportMarkdown(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "Tests", "Cases.md")); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,5 +1,6 @@
 // This package implements an API over a working copy of a Subversion repository
-// of a Polarion project. It qualifies as a hack.
+// of a Polarion project, or over the repository itself at any revision (see
+// History). It qualifies as a hack.
 //
 // NOTE To build a local copy with revisions, svnrdump can be used, and then a
 // local SVN or Git server repo created. But: Git doesn't support files > 100 MB !
@@ -40,6 +41,9 @@ type Polarion struct {
 	// items contain all the workitems present in all the projects in []folders
 	Items map[string]*Item
 	Links []*Link
+
+	// links by the ID of their source and destination
+	from, to map[string][]*Link
 }
 
 // Project is a container in RAM of parts of the project on disk.
@@ -49,6 +53,7 @@ type Polarion struct {
 type Project struct {
 	ID   string
 	Path string
+	src  source
 
 	documents []*Document
 	Items     map[string]*Item
@@ -76,9 +81,10 @@ type Item struct {
 // Link holds the relation between two workitems, which may possibly reside in
 // another project.
 type Link struct {
-	Source      *Item
-	Destination *Item
-	Type        string
+	Source        *Item
+	Destination   *Item // nil if not loaded
+	DestinationID string
+	Type          string
 }
 
 func (P *Polarion) AddFolder(path string) {
@@ -92,7 +98,7 @@ func (P *Polarion) AddFolder(path string) {
 
 	for _, d := range dd {
 
-		p := getProject(path, d)
+		p := getProject(workingCopy{}, path, d)
 		P.projects = append(P.projects, p)
 		P.documents = append(P.documents, p.documents...)
 		for _, it := range p.Items {
@@ -113,7 +119,11 @@ func (P *Polarion) AddProject(path string) {
 	base := filepath.Base(path)
 	dir := filepath.Dir(path)
 
-	p := getProject(dir, base)
+	P.addProject(getProject(workingCopy{}, dir, base))
+}
+
+func (P *Polarion) addProject(p *Project) {
+
 	P.projects = append(P.projects, p)
 	P.documents = append(P.documents, p.documents...)
 	for _, it := range p.Items {
@@ -180,33 +190,36 @@ func (P *Polarion) Projects() *ogdl.Graph {
 
 // Discover all links between work items (fill P.Links)
 func (P *Polarion) findLinks() {
-	// Range over all work items
-	for _, item := range P.Items {
-		links := item.Tree.Get("linkedWorkItems")
-		if links == nil {
-			continue
-		}
-		links = links.Out[0]
-		for _, link := range links.Out {
-			role, _ := link.GetString("role")
-			wi, _ := link.GetString("workItem")
-			l := Link{}
-			l.Source = item
-			l.Destination = P.Items[wi]
-			l.Type = role
-			P.Links = append(P.Links, &l)
+
+	P.Links = nil
+	P.from = make(map[string][]*Link)
+	P.to = make(map[string][]*Link)
+
+	// Range over all work items, in order
+	for _, id := range sortedIDs(P.Items) {
+		item := P.Items[id]
+		for _, lr := range links(item) {
+			l := &Link{Source: item, Destination: P.Items[lr.Destination], DestinationID: lr.Destination, Type: lr.Type}
+			P.Links = append(P.Links, l)
+			P.from[item.ID] = append(P.from[item.ID], l)
+			P.to[lr.Destination] = append(P.to[lr.Destination], l)
 		}
 	}
 }
 
 // Read project info, load documents and items
-func getProject(path, name string) *Project {
+func getProject(src source, path, name string) *Project {
 
 	if path[len(path)-1] != '/' {
 		path = path + "/"
 	}
 
-	p := &Project{Path: path + name, ID: name}
+	p := &Project{Path: path + name, ID: name, src: src}
+	p.load()
+	return p
+}
+
+func (p *Project) load() {
 
 	// Range over spaces
 	for _, space := range p.Spaces() {
@@ -223,107 +236,106 @@ func getProject(path, name string) *Project {
 	}
 
 	p.getItemsNoDoc()
-
-	return p
 }
 
 func (p *Project) getItems(space, doc string) {
 
 	path := p.Path + "/modules/" + space + "/" + doc + "/workitems"
-	files, err := ioutil.ReadDir(path)
+	dirs, _, err := p.src.list(path)
 
 	if err != nil {
 		return
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			wi := Item{}
-
-			wi.ID = file.Name()
-			wi.Path = "/modules/" + space + "/" + doc + "/workitems"
-			wi.Tree = readXml(path + "/" + wi.ID + "/workitem.xml")
-
-			// normalize
-			wi.Tree = wi.Tree.GetAt(0)
-			simplify(wi.Tree)
-
-			wi.Tree.This = "workitem"
-			wi.Tree.Add("id").Add(wi.ID)
-			// log.Println("wi.ID", wi.ID)
-
-			wi.Type, _ = wi.Tree.GetString("type")
-
-			if p.Items == nil {
-				p.Items = make(map[string]*Item)
-			}
-
-			p.Items[wi.ID] = &wi
-		}
+	for _, id := range dirs {
+		p.addItem(id, "/modules/"+space+"/"+doc+"/workitems", path+"/"+id+"/workitem.xml")
 	}
 }
 
 func (p *Project) getItemsNoDoc() {
 
 	path := p.Path + "/.polarion/tracker/workitems"
-	files, err := ioutil.ReadDir(path)
+	dirs, _, err := p.src.list(path)
 
 	if err != nil {
 		log.Println("no workitems outside docs")
 	}
 
-	for _, file := range files {
-		p.getItemsNoDoc_(path + "/" + file.Name())
+	for _, dir := range dirs {
+		p.getItemsNoDoc_(path + "/" + dir)
 	}
 }
 
 func (p *Project) getItemsNoDoc_(path string) {
 
-	files, err := ioutil.ReadDir(path)
+	dirs, files, err := p.src.list(path)
 
 	if err != nil {
 		return
 	}
 
-	for _, file := range files {
-		if file.IsDir() {
-			p.getItemsNoDoc_(path + "/" + file.Name())
-			continue
-		}
+	for _, dir := range dirs {
+		p.getItemsNoDoc_(path + "/" + dir)
+	}
 
+	for _, file := range files {
 		// if not workitem.xml ignore
-		if file.Name() != "workitem.xml" {
-			continue
+		if file == "workitem.xml" {
+			p.addItem(filepath.Base(path), "", path+"/"+file)
 		}
+	}
+}
 
-		wi := Item{}
+// addItem reads a workitem.xml file
+func (p *Project) addItem(id, path, file string) {
 
-		wi.ID = filepath.Base(path)
-		wi.Path = ""
-		wi.Tree = readXml(path + "/" + file.Name())
+	b, err := p.src.read(file)
+	if err != nil {
+		log.Println(err)
+		return
+	}
 
-		// normalize
-		wi.Tree = wi.Tree.GetAt(0)
-		simplify(wi.Tree)
+	if p.Items == nil {
+		p.Items = make(map[string]*Item)
+	}
+	p.Items[id] = newItem(id, path, b)
+}
 
-		wi.Tree.This = "workitem"
-		wi.Tree.Add("id").Add(wi.ID)
+func newItem(id, path string, b []byte) *Item {
 
-		wi.Type, _ = wi.Tree.GetString("type")
+	wi := Item{}
 
-		if p.Items == nil {
-			p.Items = make(map[string]*Item)
-		}
+	wi.ID = id
+	wi.Path = path
+	wi.Tree = parseXml(b)
 
-		p.Items[wi.ID] = &wi
+	// normalize
+	wi.Tree = wi.Tree.GetAt(0)
+	if wi.Tree == nil {
+		wi.Tree = ogdl.New(nil)
 	}
+	simplify(wi.Tree)
+
+	wi.Tree.This = "workitem"
+	wi.Tree.Add("id").Add(wi.ID)
+
+	wi.Type, _ = wi.Tree.GetString("type")
+
+	return &wi
 }
 
 func (p *Project) getDocument(space, doc string) *Document {
 
 	path := p.Path + "/modules/" + space + "/" + doc + "/module.xml"
-	g := readXml(path)
+	b, err := p.src.read(path)
+	if err != nil {
+		log.Println(err)
+	}
+	g := parseXml(b)
 	simplify(g)
+	if g.Len() == 0 {
+		g.Add("module")
+	}
 	g.Out[0].Add("id").Add(doc)
 
 	d := &Document{}
@@ -409,8 +421,8 @@ func (doc *Document) Html() string {
 
 	var h = []int{0, 0, 0, 0, 0, 0}
 
-	attachmentDir := PolarionBasePath + doc.Prj.ID + "/modules/" + doc.Space + "/" + doc.ID + "/attachments/"
-	wiDir := PolarionBasePath + doc.Prj.ID + "/modules/" + doc.Space + "/" + doc.ID + "/workitems/"
+	attachmentDir := doc.attachmentDir()
+	wiDir := doc.workitemDir()
 
 	removeStyle := regexp.MustCompile(`style=".*"`)
 
@@ -583,13 +595,23 @@ func (doc *Document) Html() string {
 
 // Spaces returns all names of directories in the modules/ directory of the project
 func (p *Project) Spaces() []string {
-	return ListDirectories(p.Path + "/modules")
+	return p.directories(p.Path + "/modules")
 }
 
 // Documents returns all names of directories in the modules/<space>/ directory of
 // the project
 func (p *Project) Documents(space string) []string {
-	return ListDirectories(p.Path + "/modules/" + space)
+	return p.directories(p.Path + "/modules/" + space)
+}
+
+func (p *Project) directories(path string) []string {
+
+	dirs, _, err := p.src.list(path)
+	if err != nil {
+		log.Println("ListDirectories", err)
+		return nil
+	}
+	return dirs
 }
 
 func ListDirectories(path string) []string {
@@ -639,12 +661,7 @@ func isMn(r rune) bool {
 	return unicode.Is(unicode.Mn, r) // Mn: nonspacing marks
 }
 
-func readXml(file string) *ogdl.Graph {
-
-	b, err := ioutil.ReadFile(file)
-	if err != nil {
-		log.Fatal(err)
-	}
+func parseXml(b []byte) *ogdl.Graph {
 
 	decoder := xml.NewDecoder(bytes.NewReader(b))
 
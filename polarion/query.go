@@ -0,0 +1,704 @@
+package polarion
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rveen/golib/eventhandler"
+	"github.com/rveen/golib/parser"
+	"github.com/rveen/ogdl"
+)
+
+// Queries select work items of all loaded projects:
+//
+//	type:requirement AND status:approved AND linked(verifies) = 0 AND document:"SRS"
+//	SELECT id, title, status ORDER BY priority DESC GROUP BY document
+//
+// field:value is true if a field has that value, ignoring case; * matches any
+// text (title:*pedal*). Besides the fields of the work items, id, type, title,
+// project, space and document (the ID of the LiveDoc) can be used. Conditions
+// can be combined with AND, OR, NOT and parentheses, and fields compared with
+// = != < <= > >= (numerically if both sides are numbers). linked(role, ...)
+// gives the number of links of an item with those roles (all if none), in
+// both directions.
+//
+// The condition is translated to the expression grammar of package parser.
+// SELECT gives the fields of the result (id, type and title by default), ORDER
+// BY sorts it (by ID by default) and GROUP BY splits it in groups.
+
+// Query is a parsed query.
+type Query struct {
+	Select  []string
+	OrderBy []Order
+	GroupBy string
+
+	cond *ogdl.Graph // nil: all items
+}
+
+// Order is a field to sort by.
+type Order struct {
+	Field string
+	Desc  bool
+}
+
+// Result holds the items that match a query, with the values of the selected
+// fields (Rows[i] belongs to Items[i]).
+type Result struct {
+	Fields []string
+	Items  Items
+	Rows   [][]string
+	Groups []Group // if GROUP BY was given
+}
+
+// Group is a range of the items in a Result with the same value of the GROUP
+// BY field.
+type Group struct {
+	Key        string
+	Start, End int
+}
+
+// token kinds
+const (
+	tWord = iota
+	tString
+	tOp
+	tPunct // ( ) ,
+	tMatch // field:value
+)
+
+type token struct {
+	kind  int
+	s     string
+	field string // of tMatch
+}
+
+// ParseQuery parses a query.
+func ParseQuery(s string) (*Query, error) {
+
+	tt, err := tokens(s)
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Query{}
+
+	// The condition goes up to the first clause
+	i := 0
+	for ; i < len(tt) && !isClause(tt, i); i++ {
+	}
+	if i > 0 {
+		if q.cond, err = condition(tt[:i]); err != nil {
+			return nil, err
+		}
+	}
+
+	for i < len(tt) {
+
+		kw := strings.ToUpper(tt[i].s)
+		i++
+		if kw != "SELECT" {
+			i++ // BY
+		}
+
+		var list []string
+		var desc []bool
+		for i < len(tt) && !isClause(tt, i) {
+			if tt[i].kind != tWord {
+				return nil, errors.New("invalid query: " + kw + " expects field names")
+			}
+			list = append(list, tt[i].s)
+			desc = append(desc, false)
+			i++
+			if i < len(tt) && tt[i].kind == tWord && (strings.EqualFold(tt[i].s, "ASC") || strings.EqualFold(tt[i].s, "DESC")) {
+				desc[len(desc)-1] = strings.EqualFold(tt[i].s, "DESC")
+				i++
+			}
+			if i < len(tt) && tt[i].s == "," {
+				i++
+			}
+		}
+		if len(list) == 0 {
+			return nil, errors.New("invalid query: " + kw + " without fields")
+		}
+
+		switch kw {
+		case "SELECT":
+			q.Select = list
+		case "ORDER":
+			for j, f := range list {
+				q.OrderBy = append(q.OrderBy, Order{Field: f, Desc: desc[j]})
+			}
+		case "GROUP":
+			if len(list) != 1 {
+				return nil, errors.New("invalid query: GROUP BY takes one field")
+			}
+			q.GroupBy = list[0]
+		}
+	}
+
+	return q, nil
+}
+
+func isClause(tt []token, i int) bool {
+	if tt[i].kind != tWord {
+		return false
+	}
+	switch strings.ToUpper(tt[i].s) {
+	case "SELECT":
+		return true
+	case "ORDER", "GROUP":
+		return i+1 < len(tt) && strings.EqualFold(tt[i+1].s, "BY")
+	}
+	return false
+}
+
+// tokens splits a query in words, strings, operators, punctuation and
+// field:value pairs.
+func tokens(s string) ([]token, error) {
+
+	p := parser.New([]byte(s), nil)
+	var tt []token
+
+	for {
+		p.WhiteSpace()
+		if p.End() {
+			return tt, nil
+		}
+
+		switch c := p.PeekByte(); {
+
+		case c == '(' || c == ')' || c == ',':
+			p.Byte()
+			tt = append(tt, token{kind: tPunct, s: string(c)})
+
+		case c == '"' || c == '\'' || c == '`':
+			v, ok := quoted(p)
+			if !ok {
+				return nil, errors.New("invalid query: unterminated string")
+			}
+			tt = append(tt, token{kind: tString, s: v})
+
+		case strings.IndexByte("+-*/%&|!<>=~^", c) != -1:
+			tt = append(tt, token{kind: tOp, s: p.Operator()})
+
+		default:
+			w := p.Token(isWordChar)
+			if w == "" {
+				return nil, errors.New("invalid query: unexpected " + strconv.QuoteRune(rune(c)))
+			}
+			if p.PeekByte() != ':' {
+				tt = append(tt, token{kind: tWord, s: w})
+				continue
+			}
+			p.Byte()
+			v, ok := quoted(p)
+			if !ok {
+				v = p.Token(func(r rune) bool { return isWordChar(r) || r == '*' })
+			}
+			tt = append(tt, token{kind: tMatch, field: w, s: v})
+		}
+	}
+}
+
+func isWordChar(r rune) bool {
+	return r == '_' || r == '-' || r == '.' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || r > 127
+}
+
+// quoted reads a quoted string, which can be empty.
+func quoted(p *parser.Parser) (string, bool) {
+	c := p.PeekByte()
+	if c != '"' && c != '\'' && c != '`' {
+		return "", false
+	}
+	ix := p.Ix
+	if v := p.Quoted(0); v != "" {
+		return v, true
+	}
+	// Empty string
+	if ix+1 < len(p.Buf) && p.Buf[ix+1] == c {
+		p.Ix = ix + 2
+		return "", true
+	}
+	return "", false
+}
+
+// condition translates the tokens of a condition to an expression, and parses
+// it.
+func condition(tt []token) (*ogdl.Graph, error) {
+
+	var sb strings.Builder
+	var calls []bool // for each open parenthesis: is it a function call?
+
+	for i, t := range tt {
+
+		inCall := len(calls) > 0 && calls[len(calls)-1]
+		afterCmp := i > 0 && tt[i-1].kind == tOp && parser.Precedence(op(tt[i-1].s)) == 3
+
+		switch t.kind {
+		case tMatch:
+			sb.WriteString(" match(" + quote(t.field) + "," + quote(t.s) + ")")
+		case tString:
+			sb.WriteString(" " + quote(t.s))
+		case tOp:
+			sb.WriteString(" " + op(t.s))
+		case tPunct:
+			switch t.s {
+			case "(":
+				call := i > 0 && tt[i-1].kind == tWord && !isKeyword(tt[i-1].s)
+				calls = append(calls, call)
+				if !call {
+					sb.WriteString(" ")
+				}
+				sb.WriteString("(")
+			case ")":
+				if len(calls) == 0 {
+					return nil, errors.New("invalid query: unbalanced )")
+				}
+				calls = calls[:len(calls)-1]
+				sb.WriteString(")")
+			default:
+				sb.WriteString(",")
+			}
+		case tWord:
+			switch {
+			case isKeyword(t.s):
+				sb.WriteString(" " + map[string]string{"AND": "&&", "OR": "||", "NOT": "!"}[strings.ToUpper(t.s)])
+			case i+1 < len(tt) && tt[i+1].s == "(":
+				if !isIdent(t.s) {
+					return nil, errors.New("invalid query: invalid function name " + t.s)
+				}
+				sb.WriteString(" " + t.s) // function, without space before (
+			case isNumber(t.s):
+				sb.WriteString(" " + t.s)
+			case inCall || afterCmp || !isIdent(t.s):
+				sb.WriteString(" " + quote(t.s))
+			default:
+				sb.WriteString(" " + t.s)
+			}
+		}
+	}
+
+	src := strings.TrimSpace(sb.String())
+	if src == "" {
+		return nil, nil
+	}
+	src += " "
+
+	eh := eventhandler.New()
+	p := parser.New([]byte(src), eh)
+	if !p.Expression() || p.Ix != len(src) {
+		return nil, errors.New("invalid query: " + strings.TrimSpace(src))
+	}
+	g := eh.Graph()
+	parser.Ast(g)
+	if g.Len() != 1 {
+		return nil, errors.New("invalid query: " + strings.TrimSpace(src))
+	}
+	return g.Out[0], nil
+}
+
+func isKeyword(s string) bool {
+	switch strings.ToUpper(s) {
+	case "AND", "OR", "NOT":
+		return true
+	}
+	return false
+}
+
+// isIdent returns true for ASCII identifiers ([A-Za-z_][A-Za-z0-9_]*), the
+// only words that are passed to package parser as function names and paths.
+// Other words are quoted.
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+func op(s string) string {
+	switch s {
+	case "=":
+		return "=="
+	case "<>":
+		return "!="
+	}
+	return s
+}
+
+// quote quotes a string for package parser, which has no escapes.
+func quote(s string) string {
+	for _, q := range []string{`"`, `'`, "`"} {
+		if !strings.Contains(s, q) {
+			return q + s + q
+		}
+	}
+	return `"` + strings.Replace(s, `"`, "'", -1) + `"`
+}
+
+// Query returns the work items of all loaded projects that match a query.
+func (P *Polarion) Query(s string) (*Result, error) {
+
+	q, err := ParseQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	return P.Run(q), nil
+}
+
+// QueryGraph is Query for templates. It returns Result.Graph(), or
+//
+//	error
+//	  invalid query: ...
+func (P *Polarion) QueryGraph(s string) *ogdl.Graph {
+
+	r, err := P.Query(s)
+	if err != nil {
+		g := ogdl.New(nil)
+		g.Add("error").Add(err.Error())
+		return g
+	}
+	return r.Graph()
+}
+
+// Run evaluates a parsed query.
+func (P *Polarion) Run(q *Query) *Result {
+
+	e := &qenv{P: P, docs: make(map[string]*Document), prjs: make(map[string]string)}
+	for _, d := range P.documents {
+		for _, id := range d.Items {
+			if e.docs[id] == nil {
+				e.docs[id] = d
+			}
+		}
+	}
+	for _, p := range P.projects {
+		for id := range p.Items {
+			e.prjs[id] = p.ID
+		}
+	}
+
+	r := &Result{Fields: q.Select}
+	if len(r.Fields) == 0 {
+		r.Fields = []string{"id", "type", "title"}
+	}
+
+	for _, id := range sortedIDs(P.Items) {
+		it := P.Items[id]
+		if q.cond == nil || truth(e.eval(it, q.cond)) {
+			r.Items = append(r.Items, it)
+		}
+	}
+
+	// Sort by group, then by the ORDER BY fields, keeping the ID order
+	order := q.OrderBy
+	if q.GroupBy != "" {
+		order = append([]Order{{Field: q.GroupBy}}, order...)
+	}
+	if len(order) > 0 {
+		keys := make(map[*Item][]string)
+		for _, it := range r.Items {
+			for _, o := range order {
+				keys[it] = append(keys[it], e.field(it, o.Field))
+			}
+		}
+		sort.SliceStable(r.Items, func(i, j int) bool {
+			a, b := keys[r.Items[i]], keys[r.Items[j]]
+			for k, o := range order {
+				c := compare(a[k], b[k])
+				if c != 0 {
+					return (c < 0) != o.Desc
+				}
+			}
+			return false
+		})
+	}
+
+	for i, it := range r.Items {
+		row := make([]string, len(r.Fields))
+		for j, f := range r.Fields {
+			row[j] = e.field(it, f)
+		}
+		r.Rows = append(r.Rows, row)
+
+		if q.GroupBy == "" {
+			continue
+		}
+		key := e.field(it, q.GroupBy)
+		if n := len(r.Groups); n == 0 || r.Groups[n-1].Key != key {
+			r.Groups = append(r.Groups, Group{Key: key, Start: i, End: i + 1})
+		} else {
+			r.Groups[n-1].End = i + 1
+		}
+	}
+
+	return r
+}
+
+// Graph returns the result as
+//
+//	fields
+//	  id
+//	  title
+//	items
+//	  DEMO-1
+//	    id DEMO-1
+//	    title ...
+//	groups
+//	  approved
+//	    DEMO-1
+//	      id DEMO-1
+//	      title ...
+func (r *Result) Graph() *ogdl.Graph {
+
+	g := ogdl.New(nil)
+
+	ff := g.Add("fields")
+	for _, f := range r.Fields {
+		ff.Add(f)
+	}
+
+	r.rows(g.Add("items"), 0, len(r.Items))
+
+	if len(r.Groups) > 0 {
+		gg := g.Add("groups")
+		for _, gr := range r.Groups {
+			r.rows(gg.Add(gr.Key), gr.Start, gr.End)
+		}
+	}
+	return g
+}
+
+func (r *Result) rows(g *ogdl.Graph, start, end int) {
+	for i := start; i < end; i++ {
+		n := g.Add(r.Items[i].ID)
+		for j, f := range r.Fields {
+			n.Add(f).Add(r.Rows[i][j])
+		}
+	}
+}
+
+// CSV writes the selected fields of the result.
+func (r *Result) CSV(w io.Writer) error {
+
+	cw := csv.NewWriter(w)
+	cw.Write(r.Fields)
+	for _, row := range r.Rows {
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// qenv evaluates conditions.
+type qenv struct {
+	P    *Polarion
+	docs map[string]*Document // item ID => LiveDoc
+	prjs map[string]string    // item ID => project ID
+}
+
+// field returns the value of a field of an item.
+func (e *qenv) field(it *Item, name string) string {
+
+	switch name {
+	case "id":
+		return it.ID
+	case "type":
+		return it.Type
+	case "project":
+		return e.prjs[it.ID]
+	case "space", "document":
+		d := e.docs[it.ID]
+		if d == nil {
+			return ""
+		}
+		if name == "space" {
+			return d.Space
+		}
+		return d.ID
+	}
+	return fields(it)[name]
+}
+
+// eval returns the value of an expression for an item: a string, a float64,
+// a bool or nil.
+func (e *qenv) eval(it *Item, n *ogdl.Graph) interface{} {
+
+	s := n.ThisString()
+
+	switch s {
+	case parser.TypePath:
+		if n.Len() == 0 {
+			return nil
+		}
+		if n.Len() == 2 && n.Out[1].ThisString() == parser.TypeArguments {
+			var args []interface{}
+			for _, a := range n.Out[1].Out {
+				if a.Len() > 0 {
+					args = append(args, e.eval(it, a.Out[0]))
+				}
+			}
+			return e.call(it, n.Out[0].ThisString(), args)
+		}
+		var path []string
+		for _, c := range n.Out {
+			path = append(path, c.ThisString())
+		}
+		return e.field(it, strings.Join(path, "."))
+	case parser.TypeString:
+		if n.Len() == 0 {
+			return ""
+		}
+		return n.Out[0].ThisString()
+	case parser.TypeGroup:
+		if n.Len() == 0 {
+			return nil
+		}
+		return e.eval(it, n.Out[0])
+	}
+
+	if n.Len() == 0 {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+		return s
+	}
+
+	if n.Len() == 1 {
+		v := e.eval(it, n.Out[0])
+		switch s {
+		case "!":
+			return !truth(v)
+		case "-":
+			if f, ok := number(v); ok {
+				return -f
+			}
+		}
+		return nil
+	}
+
+	switch s {
+	case "&&":
+		return truth(e.eval(it, n.Out[0])) && truth(e.eval(it, n.Out[1]))
+	case "||":
+		return truth(e.eval(it, n.Out[0])) || truth(e.eval(it, n.Out[1]))
+	}
+
+	c := compare(str(e.eval(it, n.Out[0])), str(e.eval(it, n.Out[1])))
+	switch s {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return nil
+}
+
+// call evaluates the functions match(field, value) and linked(role, ...).
+func (e *qenv) call(it *Item, fn string, args []interface{}) interface{} {
+
+	switch fn {
+	case "match":
+		if len(args) != 2 {
+			return false
+		}
+		return match(e.field(it, str(args[0])), str(args[1]))
+	case "linked":
+		var roles []string
+		for _, a := range args {
+			roles = append(roles, str(a))
+		}
+		n := 0
+		e.P.eachLink(it.ID, roles, func(l *Link, other string) { n++ })
+		return float64(n)
+	}
+	return nil
+}
+
+// match compares a value with a pattern, ignoring case. * matches any text.
+func match(v, pattern string) bool {
+	if !strings.Contains(pattern, "*") {
+		return strings.EqualFold(v, pattern)
+	}
+	re := "(?is)^" + strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1) + "$"
+	ok, _ := regexp.MatchString(re, v)
+	return ok
+}
+
+// compare compares two values as numbers if both are numbers, and as strings
+// otherwise.
+func compare(a, b string) int {
+	if x, err := strconv.ParseFloat(a, 64); err == nil {
+		if y, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a, b)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// str converts a value to a string. Missing values are empty strings.
+func str(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return ""
+}
+
+// truth returns false for nil, false, 0, "", "false" and "0", and true for
+// anything else.
+func truth(v interface{}) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != "" && v != "false" && v != "0"
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package polarion
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+
+	P := testProject(t)
+
+	ids := func(ii Items) string {
+		var ss []string
+		for _, it := range ii {
+			ss = append(ss, it.ID)
+		}
+		return strings.Join(ss, " ")
+	}
+
+	tests := []struct{ q, ids string }{
+		{`type:requirement`, "DEMO-1 DEMO-2 DEMO-3"},
+		{`type:requirement AND linked(verifies) = 0`, "DEMO-2 DEMO-3"},
+		{`type:Requirement and not (title:horn or title:lights)`, "DEMO-1"},
+		{`document:"Reqs" AND type != heading`, "DEMO-1 DEMO-2 DEMO-3"},
+		{`title:*pedal*`, "DEMO-1 DEMO-10"},
+		{`linked() >= 1 AND space:Tests`, "DEMO-10 DEMO-11"},
+		{`linked(implements, verifies) > 0 AND project:DEMO AND type:design`, "DEMO-4"},
+		{`type:test ORDER BY title DESC`, "DEMO-11 DEMO-10 DEMO-12"},
+		{`id:DEMO-1*`, "DEMO-1 DEMO-10 DEMO-11 DEMO-12"},
+		{`title:""`, ""},
+	}
+
+	for _, tc := range tests {
+		r, err := P.Query(tc.q)
+		if err != nil {
+			t.Errorf("%s: %v", tc.q, err)
+			continue
+		}
+		if s := ids(r.Items); s != tc.ids {
+			t.Errorf("%s: got %q, want %q", tc.q, s, tc.ids)
+		}
+	}
+
+	r, err := P.Query(`linked() > 0 SELECT id, title GROUP BY type ORDER BY id DESC`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Groups) != 3 || r.Groups[0].Key != "design" || r.Groups[2].Key != "test" {
+		t.Fatalf("groups %v", r.Groups)
+	}
+	if s := ids(r.Items[r.Groups[2].Start:r.Groups[2].End]); s != "DEMO-11 DEMO-10" {
+		t.Errorf("group test: %s", s)
+	}
+	if s := r.Graph().Node("groups").Node("requirement").Node("DEMO-2").Node("title").String(); s != "Lights" {
+		t.Errorf("graph: %q\n%s", s, r.Graph().Text())
+	}
+
+	var buf bytes.Buffer
+	r.CSV(&buf)
+	if !strings.HasPrefix(buf.String(), "id,title\nDEMO-4,Lamp driver\n") {
+		t.Errorf("csv:\n%s", buf.String())
+	}
+
+	for _, q := range []string{`type:"test`, `(type:test`, `type:test)`, `type:test AND`, `SELECT`, `type:x GROUP BY a, b`} {
+		if _, err := P.Query(q); err == nil {
+			t.Errorf("%s: no error", q)
+		}
+	}
+	// Words that are not ASCII identifiers are not function names or paths
+	// for package parser (which used to loop forever on them)
+	for _, q := range []string{"linked(€(x))", "T(€(", "T(\xe2(", "€(x) = 1"} {
+		done := make(chan error, 1)
+		go func() {
+			_, err := P.Query(q)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Errorf("%q: no error", q)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q: query does not return", q)
+		}
+	}
+	if r, err := P.Query("title = Lámpara OR Lámpara = title"); err != nil || len(r.Items) != 0 {
+		t.Errorf("non-ASCII word: %v %v", r, err)
+	}
+
+	if g := P.QueryGraph("(("); g.Node("error") == nil {
+		t.Error("QueryGraph without error")
+	}
+}
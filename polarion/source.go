@@ -0,0 +1,126 @@
+package polarion
+
+import (
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+)
+
+// source is where the files of a project are read from: a working copy or a
+// revision of a repository.
+type source interface {
+	// list returns the names of the directories and files in a directory
+	list(dir string) (dirs, files []string, err error)
+	read(file string) ([]byte, error)
+}
+
+// workingCopy reads files from disk.
+type workingCopy struct{}
+
+func (workingCopy) list(dir string) ([]string, []string, error) {
+
+	ff, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dirs, files []string
+	for _, f := range ff {
+		if f.IsDir() {
+			dirs = append(dirs, f.Name())
+		} else {
+			files = append(files, f.Name())
+		}
+	}
+	return dirs, files, nil
+}
+
+func (workingCopy) read(file string) ([]byte, error) {
+	return ioutil.ReadFile(file)
+}
+
+// revision reads a project as it was at a revision of a repository. The
+// directory tree is read at once and kept.
+type revision struct {
+	repo Repository
+	root string // path of the project in the repository
+	rev  int
+
+	dirs  map[string][]string // directory => subdirectories
+	files map[string][]string // directory => files
+	items map[string]string   // work item ID => its workitem.xml
+}
+
+func newRevision(repo Repository, root string, rev int) (*revision, error) {
+
+	root = clean(root)
+	paths, err := repo.List(root, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &revision{
+		repo:  repo,
+		root:  root,
+		rev:   rev,
+		dirs:  make(map[string][]string),
+		files: make(map[string][]string),
+		items: make(map[string]string),
+	}
+
+	for _, p := range paths {
+		isDir := strings.HasSuffix(p, "/")
+		p = clean(p)
+		dir, name := path.Split(p)
+		dir = clean(dir)
+		if isDir {
+			r.dirs[dir] = append(r.dirs[dir], name)
+		} else {
+			r.files[dir] = append(r.files[dir], name)
+			if id := itemID(p); id != "" {
+				r.items[id] = p
+			}
+		}
+	}
+
+	for _, m := range []map[string][]string{r.dirs, r.files} {
+		for _, ss := range m {
+			sort.Strings(ss)
+		}
+	}
+	return r, nil
+}
+
+// list takes paths as built by Project: the project path followed by a path
+// in the project.
+func (r *revision) list(dir string) ([]string, []string, error) {
+	dir = r.rel(dir)
+	return r.dirs[dir], r.files[dir], nil
+}
+
+func (r *revision) read(file string) ([]byte, error) {
+	return r.repo.Cat(join(r.root, r.rel(file)), r.rev)
+}
+
+// rel returns a path relative to the project.
+func (r *revision) rel(p string) string {
+	p = clean(p)
+	if r.root == "" {
+		return p
+	}
+	if p == r.root {
+		return ""
+	}
+	return strings.TrimPrefix(p, r.root+"/")
+}
+
+// clean returns a path without leading or trailing slashes.
+func clean(p string) string {
+	p = path.Clean("/" + p)
+	return strings.Trim(p, "/")
+}
+
+func join(a, b string) string {
+	return clean(a + "/" + b)
+}
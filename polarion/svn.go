@@ -0,0 +1,135 @@
+package polarion
+
+import (
+	"encoding/xml"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rveen/golib/fs/svnfs"
+)
+
+// Repository gives access to the revisions of a repository with Polarion
+// projects. Paths are relative to the root of the repository.
+type Repository interface {
+	// Log returns the revisions that changed something below path, oldest
+	// first.
+	Log(path string) ([]Revision, error)
+	// List returns all files and directories below path at a revision,
+	// relative to path. Directories end with a slash.
+	List(path string, rev int) ([]string, error)
+	// Cat returns the content of a file at a revision.
+	Cat(path string, rev int) ([]byte, error)
+}
+
+// Revision is an entry of the log of a repository.
+type Revision struct {
+	Number  int
+	Author  string
+	Date    time.Time
+	Message string
+	Paths   []ChangedPath
+}
+
+// ChangedPath is a path changed in a revision. Paths start at the root of
+// the repository, with a slash.
+type ChangedPath struct {
+	Action   string // A (added), M (modified), D (deleted) or R (replaced)
+	Path     string
+	CopyFrom string // if the path was copied
+	CopyRev  int
+}
+
+type svnRepo struct {
+	root string
+	fs   interface {
+		File(path, rev string) ([]byte, error)
+	}
+}
+
+// Svn returns a local Subversion repository (a directory made with svnadmin
+// create). It uses the svn and svnlook commands.
+func Svn(root string) Repository {
+	root, _ = filepath.Abs(root)
+	return &svnRepo{root: root, fs: svnfs.New(root)}
+}
+
+func (r *svnRepo) url(path string) string {
+	return "file:///" + r.root + "/" + clean(path)
+}
+
+func (r *svnRepo) Log(path string) ([]Revision, error) {
+
+	b, err := exec.Command("svn", "log", "-v", "--xml", r.url(path)).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var lg struct {
+		Entries []struct {
+			Revision int    `xml:"revision,attr"`
+			Author   string `xml:"author"`
+			Date     string `xml:"date"`
+			Msg      string `xml:"msg"`
+			Paths    []struct {
+				Action   string `xml:"action,attr"`
+				CopyFrom string `xml:"copyfrom-path,attr"`
+				CopyRev  int    `xml:"copyfrom-rev,attr"`
+				Path     string `xml:",chardata"`
+			} `xml:"paths>path"`
+		} `xml:"logentry"`
+	}
+	if err := xml.Unmarshal(b, &lg); err != nil {
+		return nil, err
+	}
+
+	var rr []Revision
+	for _, e := range lg.Entries {
+		rev := Revision{Number: e.Revision, Author: e.Author, Message: e.Msg}
+		rev.Date, _ = time.Parse(time.RFC3339Nano, e.Date)
+		for _, p := range e.Paths {
+			rev.Paths = append(rev.Paths, ChangedPath{Action: p.Action, Path: p.Path, CopyFrom: p.CopyFrom, CopyRev: p.CopyRev})
+		}
+		rr = append(rr, rev)
+	}
+
+	// svn log gives the newest first
+	sort.Slice(rr, func(i, j int) bool { return rr[i].Number < rr[j].Number })
+	return rr, nil
+}
+
+func (r *svnRepo) List(path string, rev int) ([]string, error) {
+
+	n := strconv.Itoa(rev)
+	b, err := exec.Command("svn", "list", "-R", "--xml", "-r", n, r.url(path)+"@"+n).Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var ls struct {
+		Entries []struct {
+			Kind string `xml:"kind,attr"`
+			Name string `xml:"name"`
+		} `xml:"list>entry"`
+	}
+	if err := xml.Unmarshal(b, &ls); err != nil {
+		return nil, err
+	}
+
+	var ss []string
+	for _, e := range ls.Entries {
+		name := strings.TrimSpace(e.Name)
+		if e.Kind == "dir" {
+			name += "/"
+		}
+		ss = append(ss, name)
+	}
+	return ss, nil
+}
+
+func (r *svnRepo) Cat(path string, rev int) ([]byte, error) {
+	return r.fs.File(clean(path), strconv.Itoa(rev))
+}
@@ -0,0 +1,405 @@
+package polarion
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/rveen/ogdl"
+)
+
+// Traceability reports. Links are stored in the work item that is their
+// source (a test verifies a requirement), but reports follow them in both
+// directions. Each report can be given to a template as an ogdl.Graph, or be
+// written as CSV.
+
+// Matrix is a traceability matrix between the work items of two documents,
+// such as requirements (rows) and tests (columns), for one link role.
+type Matrix struct {
+	Role    string
+	Rows    Items
+	Columns Items
+
+	linked map[string]map[string]bool // row ID => column IDs
+}
+
+// Items is a list of work items.
+type Items []*Item
+
+// TraceStep is a work item reached from another one.
+type TraceStep struct {
+	ID    string
+	Item  *Item // nil if not loaded
+	Depth int   // number of links followed
+	From  string
+	Role  string
+}
+
+// Trace is the result of Reachable, ordered by depth.
+type Trace []TraceStep
+
+// Title returns the title of a work item.
+func (item *Item) Title() string {
+	return item.Tree.Node("title").String()
+}
+
+// Matrix returns the traceability matrix of the work items in two documents
+// for a link role (all roles if empty). Headings are left out.
+func (P *Polarion) Matrix(rows, cols *Document, role string) *Matrix {
+
+	m := &Matrix{Role: role, Rows: P.docItems(rows), Columns: P.docItems(cols), linked: make(map[string]map[string]bool)}
+
+	inCols := make(map[string]bool)
+	for _, it := range m.Columns {
+		inCols[it.ID] = true
+	}
+
+	for _, r := range m.Rows {
+		P.eachLink(r.ID, []string{role}, func(l *Link, other string) {
+			if !inCols[other] {
+				return
+			}
+			if m.linked[r.ID] == nil {
+				m.linked[r.ID] = make(map[string]bool)
+			}
+			m.linked[r.ID][other] = true
+		})
+	}
+	return m
+}
+
+// docItems returns the loaded work items of a document, in document order.
+func (P *Polarion) docItems(doc *Document) Items {
+
+	var ii Items
+	if doc == nil {
+		return ii
+	}
+	seen := make(map[string]bool)
+	for _, id := range doc.Items {
+		it := P.Items[id]
+		if it == nil || seen[id] || it.Type == "heading" {
+			continue
+		}
+		seen[id] = true
+		ii = append(ii, it)
+	}
+	return ii
+}
+
+// eachLink calls f for the links of an item with one of the roles given (all
+// if none or an empty one), in both directions, with the ID of the item at
+// the other end.
+func (P *Polarion) eachLink(id string, roles []string, f func(l *Link, other string)) {
+	P.eachLinkDir(id, roles, dirBoth, f)
+}
+
+// Link directions, as seen from an item.
+const (
+	dirBoth = iota
+	dirOut  // links of the item to others
+	dirIn   // links of others to the item
+)
+
+// eachLinkDir is eachLink for the links in one direction, or both.
+func (P *Polarion) eachLinkDir(id string, roles []string, dir int, f func(l *Link, other string)) {
+
+	ok := func(l *Link) bool {
+		if len(roles) == 0 {
+			return true
+		}
+		for _, r := range roles {
+			if r == "" || r == l.Type {
+				return true
+			}
+		}
+		return false
+	}
+
+	if dir != dirIn {
+		for _, l := range P.from[id] {
+			if ok(l) {
+				f(l, l.DestinationID)
+			}
+		}
+	}
+	if dir != dirOut {
+		for _, l := range P.to[id] {
+			if ok(l) {
+				f(l, l.Source.ID)
+			}
+		}
+	}
+}
+
+// Linked tells if a row and a column are linked.
+func (m *Matrix) Linked(row, col string) bool {
+	return m.linked[row][col]
+}
+
+// Coverage returns the percentage of rows linked to at least one column.
+func (m *Matrix) Coverage() float64 {
+	if len(m.Rows) == 0 {
+		return 0
+	}
+	return 100 * float64(len(m.Rows)-len(m.Uncovered())) / float64(len(m.Rows))
+}
+
+// Uncovered returns the rows that are not linked to any column.
+func (m *Matrix) Uncovered() Items {
+	var ii Items
+	for _, r := range m.Rows {
+		if len(m.linked[r.ID]) == 0 {
+			ii = append(ii, r)
+		}
+	}
+	return ii
+}
+
+// Unlinked returns the columns that are not linked to any row.
+func (m *Matrix) Unlinked() Items {
+
+	used := make(map[string]bool)
+	for _, cc := range m.linked {
+		for c := range cc {
+			used[c] = true
+		}
+	}
+
+	var ii Items
+	for _, c := range m.Columns {
+		if !used[c.ID] {
+			ii = append(ii, c)
+		}
+	}
+	return ii
+}
+
+// Graph returns the matrix as
+//
+//	role verifies
+//	coverage 75.0
+//	columns
+//	  TEST-1
+//	    title ...
+//	rows
+//	  REQ-1
+//	    title ...
+//	    links
+//	      TEST-1
+//	uncovered
+//	  REQ-2
+//	    title ...
+//	unlinked
+//	  TEST-2
+//	    title ...
+func (m *Matrix) Graph() *ogdl.Graph {
+
+	g := ogdl.New(nil)
+	g.Add("role").Add(m.Role)
+	g.Add("coverage").Add(strconv.FormatFloat(m.Coverage(), 'f', 1, 64))
+	g.Add("columns").AddNodes(m.Columns.Graph())
+
+	rows := g.Add("rows")
+	for _, r := range m.Rows {
+		n := rows.Add(r.ID)
+		n.Add("title").Add(r.Title())
+		ll := n.Add("links")
+		for _, c := range m.Columns {
+			if m.Linked(r.ID, c.ID) {
+				ll.Add(c.ID)
+			}
+		}
+	}
+
+	g.Add("uncovered").AddNodes(m.Uncovered().Graph())
+	g.Add("unlinked").AddNodes(m.Unlinked().Graph())
+	return g
+}
+
+// CSV writes the matrix with a row per row item and an x in the columns it is
+// linked to.
+func (m *Matrix) CSV(w io.Writer) error {
+
+	cw := csv.NewWriter(w)
+
+	head := []string{"id", "title"}
+	for _, c := range m.Columns {
+		head = append(head, c.ID)
+	}
+	cw.Write(head)
+
+	for _, r := range m.Rows {
+		rec := []string{r.ID, r.Title()}
+		for _, c := range m.Columns {
+			if m.Linked(r.ID, c.ID) {
+				rec = append(rec, "x")
+			} else {
+				rec = append(rec, "")
+			}
+		}
+		cw.Write(rec)
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// Orphans returns the work items of the types given (all if none) that have
+// no links at all, ordered by ID. Headings are left out.
+func (P *Polarion) Orphans(types ...string) Items {
+
+	var ii Items
+	for _, id := range sortedIDs(P.Items) {
+		it := P.Items[id]
+		if it.Type == "heading" || (len(types) > 0 && !contains(types, it.Type)) {
+			continue
+		}
+		if len(P.from[id]) == 0 && len(P.to[id]) == 0 {
+			ii = append(ii, it)
+		}
+	}
+	return ii
+}
+
+// Reachable returns the work items that can be reached from an item through
+// links with the roles given (all if none), breadth first. Each item is
+// given once, with the shortest path.
+//
+// The links of the item itself are followed in both directions, and then
+// each path keeps its direction: down from a requirement to the items that
+// link to it (designs, tests), or up from a test to the items it links to.
+// A path does not turn around at an item linked to more than one other, so
+// a test that verifies two requirements does not lead from one requirement
+// to the tests of the other.
+func (P *Polarion) Reachable(id string, roles ...string) Trace {
+
+	type step struct {
+		id  string
+		dir int
+	}
+
+	var tr Trace
+	seen := map[string]bool{id: true}
+	queue := []step{{id, dirBoth}}
+
+	for depth := 1; len(queue) > 0; depth++ {
+		var next []step
+		for _, from := range queue {
+			for _, dir := range []int{dirOut, dirIn} {
+				if from.dir != dirBoth && from.dir != dir {
+					continue
+				}
+				P.eachLinkDir(from.id, roles, dir, func(l *Link, other string) {
+					if seen[other] {
+						return
+					}
+					seen[other] = true
+					tr = append(tr, TraceStep{ID: other, Item: P.Items[other], Depth: depth, From: from.id, Role: l.Type})
+					next = append(next, step{other, dir})
+				})
+			}
+		}
+		queue = next
+	}
+	return tr
+}
+
+// Filter returns the steps with items of the types given.
+func (tr Trace) Filter(types ...string) Trace {
+	var out Trace
+	for _, s := range tr {
+		if s.Item != nil && contains(types, s.Item.Type) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Graph returns the trace as
+//
+//	TEST-1
+//	  type test
+//	  title ...
+//	  depth 2
+//	  from DES-1
+//	  role verifies
+func (tr Trace) Graph() *ogdl.Graph {
+
+	g := ogdl.New(nil)
+	for _, s := range tr {
+		n := g.Add(s.ID)
+		if s.Item != nil {
+			n.Add("type").Add(s.Item.Type)
+			n.Add("title").Add(s.Item.Title())
+		}
+		n.Add("depth").Add(strconv.Itoa(s.Depth))
+		n.Add("from").Add(s.From)
+		n.Add("role").Add(s.Role)
+	}
+	return g
+}
+
+// CSV writes the trace with the columns id, type, title, depth, from and
+// role.
+func (tr Trace) CSV(w io.Writer) error {
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "type", "title", "depth", "from", "role"})
+	for _, s := range tr {
+		typ, title := "", ""
+		if s.Item != nil {
+			typ, title = s.Item.Type, s.Item.Title()
+		}
+		cw.Write([]string{s.ID, typ, title, strconv.Itoa(s.Depth), s.From, s.Role})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Graph returns the items as
+//
+//	ID
+//	  type ...
+//	  title ...
+func (ii Items) Graph() *ogdl.Graph {
+
+	g := ogdl.New(nil)
+	for _, it := range ii {
+		n := g.Add(it.ID)
+		n.Add("type").Add(it.Type)
+		n.Add("title").Add(it.Title())
+	}
+	return g
+}
+
+// CSV writes the items with the columns id, type and title.
+func (ii Items) CSV(w io.Writer) error {
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "type", "title"})
+	for _, it := range ii {
+		cw.Write([]string{it.ID, it.Type, it.Title()})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func contains(ss []string, s string) bool {
+	for _, x := range ss {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedIDs(m map[string]*Item) []string {
+	ss := make([]string, 0, len(m))
+	for k := range m {
+		ss = append(ss, k)
+	}
+	sort.Strings(ss)
+	return ss
+}
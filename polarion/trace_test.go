@@ -0,0 +1,181 @@
+package polarion
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// item returns a workitem.xml with links given as role, item pairs.
+func item(title, typ string, links ...string) string {
+	s := `<work-item>
+  <field id="title">` + title + `</field>
+  <field id="type">` + typ + `</field>`
+	if len(links) > 0 {
+		s += "\n  <field id=\"linkedWorkItems\"><list>"
+		for i := 0; i < len(links); i += 2 {
+			s += `<struct><item id="role">` + links[i] + `</item><item id="workItem">` + links[i+1] + `</item></struct>`
+		}
+		s += "</list></field>"
+	}
+	return s + "\n</work-item>\n"
+}
+
+// module returns a module.xml with the work items given.
+func module(ids ...string) string {
+	s := `<module><field id="homePageContent">`
+	for _, id := range ids {
+		s += `&lt;div id="polarion_wiki macro name=module-workitem;params=id=` + id + `"&gt;&lt;/div&gt;`
+	}
+	return s + "</field></module>"
+}
+
+func testProject(t *testing.T) *Polarion {
+
+	files := map[string]string{
+		"modules/Specs/Reqs/module.xml":                               module("DEMO-0", "DEMO-1", "DEMO-2", "DEMO-3"),
+		"modules/Specs/Reqs/workitems/DEMO-0/workitem.xml":            item("Brakes", "heading"),
+		"modules/Specs/Reqs/workitems/DEMO-1/workitem.xml":            item("Pedal", "requirement"),
+		"modules/Specs/Reqs/workitems/DEMO-2/workitem.xml":            item("Lights", "requirement"),
+		"modules/Specs/Reqs/workitems/DEMO-3/workitem.xml":            item("Horn", "requirement"),
+		"modules/Tests/Cases/module.xml":                              module("DEMO-10", "DEMO-11", "DEMO-12"),
+		"modules/Tests/Cases/workitems/DEMO-10/workitem.xml":          item("Press pedal", "test", "verifies", "DEMO-1"),
+		"modules/Tests/Cases/workitems/DEMO-11/workitem.xml":          item("Switch on", "test", "verifies", "DEMO-4"),
+		"modules/Tests/Cases/workitems/DEMO-12/workitem.xml":          item("Old test", "test"),
+		".polarion/tracker/workitems/00000-00099/DEMO-4/workitem.xml": item("Lamp driver", "design", "implements", "DEMO-2"),
+	}
+
+	return writeProject(t, files)
+}
+
+// writeProject writes the files of project DEMO and loads it.
+func writeProject(t *testing.T, files map[string]string) *Polarion {
+
+	dir := filepath.Join(t.TempDir(), "DEMO")
+	for name, content := range files {
+		f := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(f, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var P Polarion
+	P.AddProject(dir)
+	return &P
+}
+
+func TestMatrix(t *testing.T) {
+
+	P := testProject(t)
+	if len(P.Items) != 8 || len(P.Links) != 3 {
+		t.Fatalf("%d items, %d links", len(P.Items), len(P.Links))
+	}
+
+	m := P.Matrix(P.Document("DEMO", "Specs", "Reqs"), P.Document("DEMO", "Tests", "Cases"), "verifies")
+	if len(m.Rows) != 3 || len(m.Columns) != 3 {
+		t.Fatalf("%d rows, %d columns", len(m.Rows), len(m.Columns))
+	}
+	if !m.Linked("DEMO-1", "DEMO-10") || m.Linked("DEMO-2", "DEMO-11") {
+		t.Error("wrong links")
+	}
+	if c := m.Coverage(); c < 33.3 || c > 33.4 {
+		t.Errorf("coverage %f", c)
+	}
+	if u := m.Uncovered(); len(u) != 2 || u[0].ID != "DEMO-2" {
+		t.Errorf("uncovered %v", u)
+	}
+	if u := m.Unlinked(); len(u) != 2 || u[0].ID != "DEMO-11" {
+		t.Errorf("unlinked %v", u)
+	}
+
+	g := m.Graph()
+	if g.Node("coverage").String() != "33.3" || g.Node("rows").Node("DEMO-1").Node("links").String() != "DEMO-10" {
+		t.Errorf("graph\n%s", g.Text())
+	}
+
+	var buf bytes.Buffer
+	if err := m.CSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "id,title,DEMO-10,DEMO-11,DEMO-12\nDEMO-1,Pedal,x,,\nDEMO-2,Lights,,,\nDEMO-3,Horn,,,\n"
+	if buf.String() != want {
+		t.Errorf("csv\n%s", buf.String())
+	}
+}
+
+func TestReachable(t *testing.T) {
+
+	P := testProject(t)
+
+	tr := P.Reachable("DEMO-2", "implements", "verifies")
+	var ids []string
+	for _, s := range tr {
+		ids = append(ids, s.ID)
+	}
+	if strings.Join(ids, " ") != "DEMO-4 DEMO-11" || tr[1].Depth != 2 || tr[1].From != "DEMO-4" {
+		t.Errorf("trace %v", tr)
+	}
+
+	if tests := tr.Filter("test"); len(tests) != 1 || tests[0].ID != "DEMO-11" {
+		t.Errorf("tests %v", tests)
+	}
+	if tr := P.Reachable("DEMO-2", "verifies"); len(tr) != 0 {
+		t.Errorf("only verifies: %v", tr)
+	}
+
+	// Up from the test to the requirement
+	if tr := P.Reachable("DEMO-11"); len(tr) != 2 || tr[1].ID != "DEMO-2" || tr[1].Depth != 2 {
+		t.Errorf("up: %v", tr)
+	}
+
+	var buf bytes.Buffer
+	tr.CSV(&buf)
+	if !strings.Contains(buf.String(), "DEMO-11,test,Switch on,2,DEMO-4,verifies\n") {
+		t.Errorf("csv\n%s", buf.String())
+	}
+
+	o := P.Orphans()
+	if len(o) != 2 || o[0].ID != "DEMO-12" || o[1].ID != "DEMO-3" {
+		t.Errorf("orphans %v", o)
+	}
+	if o := P.Orphans("requirement"); len(o) != 1 {
+		t.Errorf("orphan requirements %v", o)
+	}
+}
+
+// A test shared by two requirements does not lead from one requirement to the
+// tests of the other.
+func TestReachableShared(t *testing.T) {
+
+	P := writeProject(t, map[string]string{
+		"modules/Specs/Reqs/module.xml":                      module("DEMO-1", "DEMO-2"),
+		"modules/Specs/Reqs/workitems/DEMO-1/workitem.xml":   item("Pedal", "requirement"),
+		"modules/Specs/Reqs/workitems/DEMO-2/workitem.xml":   item("Lights", "requirement"),
+		"modules/Tests/Cases/module.xml":                     module("DEMO-10", "DEMO-11"),
+		"modules/Tests/Cases/workitems/DEMO-10/workitem.xml": item("Drive", "test", "verifies", "DEMO-1", "verifies", "DEMO-2"),
+		"modules/Tests/Cases/workitems/DEMO-11/workitem.xml": item("Switch on", "test", "verifies", "DEMO-2"),
+	})
+
+	ids := func(tr Trace) string {
+		var ss []string
+		for _, s := range tr {
+			ss = append(ss, s.ID)
+		}
+		return strings.Join(ss, " ")
+	}
+
+	if s := ids(P.Reachable("DEMO-1", "verifies")); s != "DEMO-10" {
+		t.Errorf("DEMO-1: %s", s)
+	}
+	if s := ids(P.Reachable("DEMO-2", "verifies").Filter("test")); s != "DEMO-10 DEMO-11" && s != "DEMO-11 DEMO-10" {
+		t.Errorf("DEMO-2: %s", s)
+	}
+	if s := ids(P.Reachable("DEMO-10", "verifies")); s != "DEMO-1 DEMO-2" {
+		t.Errorf("DEMO-10: %s", s)
+	}
+}
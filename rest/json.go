@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/rveen/ogdl"
+)
+
+// JSON returns a graph as JSON. A node with a single leaf is a key with a
+// value; a node whose subnodes are all - is an array; other nodes are
+// objects. Values keep their Go type (numbers, booleans), so that
+//
+//	name pedal
+//	count 3
+//	tags
+//	  - a
+//	  - b
+//
+// read with ogdl.FromString gives {"name":"pedal","count":"3","tags":["a","b"]}.
+// Use raw JSON if the types matter.
+func JSON(g *ogdl.Graph) []byte {
+	var sb strings.Builder
+	object(&sb, g)
+	return []byte(sb.String())
+}
+
+func object(sb *strings.Builder, g *ogdl.Graph) {
+
+	if isArray(g) {
+		sb.WriteByte('[')
+		for i, n := range g.Out {
+			if i > 0 {
+				sb.WriteByte(',')
+			}
+			value(sb, n)
+		}
+		sb.WriteByte(']')
+		return
+	}
+
+	sb.WriteByte('{')
+	for i, n := range g.Out {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		scalarJSON(sb, n.ThisString())
+		sb.WriteByte(':')
+		value(sb, n)
+	}
+	sb.WriteByte('}')
+}
+
+// value writes the value of a key or array element, that is, its subnodes.
+func value(sb *strings.Builder, n *ogdl.Graph) {
+	switch {
+	case n.Len() == 0:
+		sb.WriteString("null")
+	case n.Len() == 1 && n.Out[0].Len() == 0:
+		b, err := json.Marshal(n.Out[0].This)
+		if err != nil {
+			scalarJSON(sb, n.Out[0].ThisString())
+		} else {
+			sb.Write(b)
+		}
+	default:
+		object(sb, n)
+	}
+}
+
+func isArray(g *ogdl.Graph) bool {
+	if g.Len() == 0 {
+		return false
+	}
+	for _, n := range g.Out {
+		if n.ThisString() != "-" {
+			return false
+		}
+	}
+	return true
+}
+
+func scalarJSON(sb *strings.Builder, s string) {
+	b, _ := json.Marshal(s)
+	sb.Write(b)
+}
@@ -0,0 +1,218 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/rveen/ogdl"
+)
+
+// maxPages stops GetAll if the server keeps giving a next page.
+const maxPages = 10000
+
+// Paging tells how a paginated response is read. The next page is given by a
+// Link header with rel="next" (as in GitHub), by Next, or by Cursor. Paths
+// into the JSON response are dotted, as in meta.next_cursor.
+type Paging struct {
+	// Items is the path of the array with the items of a page (value for
+	// OData, data, items ...). If empty, the page itself should be an array.
+	Items string
+
+	// Next is the path of the URL of the next page (@odata.nextLink,
+	// links.next ...).
+	Next string
+
+	// Cursor is the path of the cursor of the next page. It is sent in the
+	// query parameter CursorParam (cursor by default).
+	Cursor      string
+	CursorParam string
+}
+
+// GetAll gets all pages and returns their items as
+//
+//	-
+//	  (item 1)
+//	-
+//	  (item 2)
+func (rest *Rest) GetAll(url string, pg Paging) (*ogdl.Graph, error) {
+
+	g := ogdl.New(nil)
+	err := rest.Pages(context.Background(), url, pg, func(items []json.RawMessage) error {
+		for _, it := range items {
+			var v any
+			if err := json.Unmarshal(it, &v); err != nil {
+				return err
+			}
+			n := g.Add("-")
+			switch v.(type) {
+			case nil:
+			case map[string]any, []any:
+				ig, err := ogdl.FromJSON(it)
+				if err != nil {
+					return err
+				}
+				n.AddNodes(ig)
+			default:
+				n.Add(v)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Pages gets the pages of a paginated resource and calls f with the items of
+// each one, until there is no next page or f returns an error.
+func (rest *Rest) Pages(ctx context.Context, url string, pg Paging, f func(items []json.RawMessage) error) error {
+
+	url = rest.url(url)
+	seen := make(map[string]bool)
+
+	for n := 0; url != ""; n++ {
+
+		if n == maxPages || seen[url] {
+			return errors.New("rest: pagination does not end at " + url)
+		}
+		seen[url] = true
+
+		res, err := rest.Do(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+
+		var page any
+		if len(bytes.TrimSpace(res.Body)) > 0 {
+			if err := json.Unmarshal(res.Body, &page); err != nil {
+				return err
+			}
+		}
+
+		items, err := pageItems(page, pg.Items)
+		if err != nil {
+			return errors.New("rest: " + url + ": " + err.Error())
+		}
+		if err := f(items); err != nil {
+			return err
+		}
+
+		next := linkNext(res.Header)
+		if next == "" && pg.Next != "" {
+			next, _ = lookup(page, pg.Next).(string)
+		}
+		if next == "" && pg.Cursor != "" {
+			if c := lookup(page, pg.Cursor); c != nil && c != "" {
+				next = withParam(url, pg.cursorParam(), scalar(c))
+			}
+		}
+		if next == "" || (len(items) == 0 && pg.Cursor != "") {
+			return nil
+		}
+		url = resolve(url, next)
+	}
+	return nil
+}
+
+func (pg Paging) cursorParam() string {
+	if pg.CursorParam == "" {
+		return "cursor"
+	}
+	return pg.CursorParam
+}
+
+// pageItems returns the elements of the array at path.
+func pageItems(page any, path string) ([]json.RawMessage, error) {
+
+	v := page
+	if path != "" {
+		v = lookup(page, path)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	arr, ok := v.([]any)
+	if !ok {
+		if path == "" {
+			return nil, errors.New("page is not an array")
+		}
+		return nil, errors.New(path + " is not an array")
+	}
+
+	var items []json.RawMessage
+	for _, x := range arr {
+		b, err := json.Marshal(x)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, b)
+	}
+	return items, nil
+}
+
+// lookup returns the value at a dotted path of a decoded JSON value. Keys
+// with dots, like @odata.nextLink, are tried as a whole first.
+func lookup(v any, path string) any {
+
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	if x, ok := m[path]; ok {
+		return x
+	}
+	i := strings.IndexByte(path, '.')
+	if i == -1 {
+		return nil
+	}
+	return lookup(m[path[:i]], path[i+1:])
+}
+
+func scalar(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+var linkRe = regexp.MustCompile(`<([^>]*)>([^,]*)`)
+
+// linkNext returns the URL with rel="next" of a Link header, or "".
+func linkNext(h http.Header) string {
+	for _, l := range h.Values("Link") {
+		for _, m := range linkRe.FindAllStringSubmatch(l, -1) {
+			for _, p := range strings.Split(m[2], ";") {
+				p = strings.TrimSpace(p)
+				if !strings.HasPrefix(p, "rel=") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(p[4:], `"`)) {
+					if rel == "next" {
+						return m[1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// withParam sets a query parameter of an URL.
+func withParam(u, key, value string) string {
+	p, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	q := p.Query()
+	q.Set(key, value)
+	p.RawQuery = q.Encode()
+	return p.String()
+}
@@ -1,110 +1,398 @@
+// Package rest is a client for JSON REST APIs. Responses are returned as
+// ogdl graphs; request bodies can be graphs, raw JSON or any value that
+// encoding/json accepts.
+//
+//	r := rest.New("", "")
+//	r.URL = "https://server/api/v1"
+//	r.Token = "..."
+//
+//	g, err := r.Get("/items/12")
+//	g, err = r.Post("/items", ogdl.FromString("name pedal"))
+//	all, err := r.GetAll("/items", rest.Paging{Items: "data"})
+//
+// Requests answered with 429 or 503 are retried with exponential backoff, and
+// so are idempotent requests (not POST or PATCH) answered with another 5xx.
+// Other errors of the server are returned as *Error.
+//
+// Post takes a body and returns the response, unlike the former
+// Post(url, nonce string) error; see Post.
 package rest
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/rveen/ogdl"
 )
 
+// Defaults for Rest.Retries and Rest.Backoff.
+const (
+	retries    = 3
+	backoff    = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
 type Rest struct {
+	// URL is prepended to request URLs that do not start with http:// or
+	// https://, as in https://server:1443/api.
+	URL string
+
+	// Timeout of each request, including reading the body. 0 for none.
+	Timeout time.Duration
+
+	// TLS configuration, for example with custom root CAs or client
+	// certificates. Insecure skips the verification of the server certificate.
+	TLS      *tls.Config
+	Insecure bool
+
+	// Authentication. Token is sent as a bearer token, or as is if it
+	// contains a space ("Basic ...", "Bearer ..."). Earlier versions sent a
+	// token without a space as is: a server that expects such a bare
+	// Authorization header now needs the scheme in Token. A Token takes the
+	// place of basic authentication. Nonce is sent in the NonceHeader header
+	// (CSRF_NONCE by default), as Windchill requires for write requests.
+	// User and password are set in New and sent with basic authentication.
+	Token       string
+	Nonce       string
+	NonceHeader string
+
+	// Header is added to every request.
+	Header http.Header
+
+	// Retries is the number of retries after a 429 or 5xx response (-1 for
+	// none, 0 for the default of 3). Backoff is the wait before the first
+	// retry, doubled after each one (500ms if 0). A Retry-After header is
+	// honored.
+	//
+	// POST and PATCH requests are only retried after 429 and 503, which
+	// mean that the request was not handled. After another 5xx the server
+	// may have done what was asked, and a retry could do it twice.
+	// RetryUnsafe retries them after any 5xx too.
+	Retries     int
+	Backoff     time.Duration
+	RetryUnsafe bool
+
 	user   string
 	passwd string
-	Token  string
+
+	mu     sync.Mutex
+	client *http.Client
+}
+
+// Response is a response of the server with a status 2xx.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
 }
 
-// Set the connection parameters, in this order: server URL, user, password.
-// If no parameters are given, the hardcoded set is used.
-// The usual server URL has the form https://server:1443.
+// Error is returned when the server responds with a status other than 2xx,
+// after retries.
+type Error struct {
+	Method string
+	URL    string
+	Status int
+	Body   []byte
+}
+
+func (e *Error) Error() string {
+	s := fmt.Sprintf("rest: %s %s: %d %s", e.Method, e.URL, e.Status, http.StatusText(e.Status))
+	if b := strings.TrimSpace(string(e.Body)); b != "" {
+		if len(b) > 200 {
+			b = b[:200] + "..."
+		}
+		s += ": " + b
+	}
+	return s
+}
+
+// New returns a client with basic authentication if user is not empty.
 func New(user, passwd string) *Rest {
-	return &Rest{user, passwd, ""}
+	return &Rest{user: user, passwd: passwd}
 }
 
-// Rest GET request
+// Get sends a GET request and returns the response as a graph.
 func (rest *Rest) Get(url string) (*ogdl.Graph, error) {
+	return rest.graph(http.MethodGet, url, nil)
+}
 
-	body := []byte(`{}`)
+// Post sends a POST request with a body (see Do) and returns the response as
+// a graph.
+//
+// This is an incompatible change. Post was Post(url, nonce string) error,
+// which sent an empty object with the nonce in CSRF_NONCE. Calls that use its
+// result, as err := r.Post(url, nonce), no longer compile. Calls used as a
+// statement still compile, but send the nonce as the body, or fail with
+// "rest: body is not valid JSON" when it is not JSON. Set Nonce (or call
+// CSRF) and pass the body instead.
+func (rest *Rest) Post(url string, body any) (*ogdl.Graph, error) {
+	return rest.graph(http.MethodPost, url, body)
+}
 
-	r, err := http.NewRequest("GET", url, bytes.NewBuffer(body))
+// Put sends a PUT request.
+func (rest *Rest) Put(url string, body any) (*ogdl.Graph, error) {
+	return rest.graph(http.MethodPut, url, body)
+}
+
+// Patch sends a PATCH request.
+func (rest *Rest) Patch(url string, body any) (*ogdl.Graph, error) {
+	return rest.graph(http.MethodPatch, url, body)
+}
+
+// Delete sends a DELETE request.
+func (rest *Rest) Delete(url string) (*ogdl.Graph, error) {
+	return rest.graph(http.MethodDelete, url, nil)
+}
+
+func (rest *Rest) graph(method, url string, body any) (*ogdl.Graph, error) {
+	res, err := rest.Do(context.Background(), method, url, body)
 	if err != nil {
 		return nil, err
 	}
+	return res.Graph()
+}
 
-	r.Header.Add("accept", "application/json")
-	r.Header.Add("Content-Type", "application/json")
+// Graph returns the body of the response as a graph, or nil if it is empty.
+func (res *Response) Graph() (*ogdl.Graph, error) {
+	if len(bytes.TrimSpace(res.Body)) == 0 {
+		return nil, nil
+	}
+	return ogdl.FromJSON(res.Body)
+}
 
-	fmt.Println(rest.Token)
+// Do sends a request. The body can be nil, a *ogdl.Graph (see JSON), raw
+// JSON as []byte, json.RawMessage or string, or any other value, which is
+// encoded with encoding/json.
+func (rest *Rest) Do(ctx context.Context, method, url string, body any) (*Response, error) {
 
-	if rest.Token != "" {
-		r.Header.Add("Authorization", rest.Token)
+	b, err := encode(body)
+	if err != nil {
+		return nil, err
 	}
+	url = rest.url(url)
 
-	if rest.user != "" {
-		r.SetBasicAuth(rest.user, rest.passwd)
+	wait := rest.Backoff
+	if wait <= 0 {
+		wait = backoff
+	}
+	n := rest.Retries
+	if n == 0 {
+		n = retries
 	}
 
-	client := &http.Client{}
-	res, err := client.Do(r)
-	if err != nil {
-		return nil, err
+	for try := 0; ; try++ {
+
+		res, err := rest.do(ctx, method, url, b)
+		if err != nil {
+			return nil, err
+		}
+		if res.Status >= 200 && res.Status < 300 {
+			return res, nil
+		}
+
+		if try >= n || !rest.retry(method, res.Status) {
+			return nil, &Error{Method: method, URL: url, Status: res.Status, Body: res.Body}
+		}
+
+		d := wait
+		if ra := retryAfter(res.Header); ra >= 0 {
+			d = ra
+		}
+		if d > maxBackoff {
+			d = maxBackoff
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(d):
+		}
+		wait *= 2
 	}
+}
 
-	defer res.Body.Close()
+// retry returns true if a request may be retried after a response with the
+// status given.
+func (rest *Rest) retry(method string, status int) bool {
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		return true
+	case status < 500:
+		return false
+	}
+	return rest.RetryUnsafe || (method != http.MethodPost && method != http.MethodPatch)
+}
 
-	body, err = ioutil.ReadAll(res.Body)
+// do sends a request once.
+func (rest *Rest) do(ctx context.Context, method, url string, body []byte) (*Response, error) {
 
-	var result map[string]any
+	if rest.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, rest.Timeout)
+		defer cancel()
+	}
 
-	err = json.Unmarshal(body, &result)
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	r, err := http.NewRequestWithContext(ctx, method, url, rd)
 	if err != nil {
-		log.Printf("%s\n", string(body))
 		return nil, err
 	}
 
-	g, err := ogdl.FromJSON(body)
-
-	return g, err
-}
+	for k, vv := range rest.Header {
+		for _, v := range vv {
+			r.Header.Add(k, v)
+		}
+	}
+	r.Header.Set("Accept", "application/json")
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
 
-// Windchill POST request
-func (rest *Rest) Post(url, token string) error {
+	switch {
+	case rest.Token != "" && strings.Contains(rest.Token, " "):
+		r.Header.Set("Authorization", rest.Token)
+	case rest.Token != "":
+		r.Header.Set("Authorization", "Bearer "+rest.Token)
+	case rest.user != "":
+		r.SetBasicAuth(rest.user, rest.passwd)
+	}
+	if rest.Nonce != "" {
+		h := rest.NonceHeader
+		if h == "" {
+			h = "CSRF_NONCE"
+		}
+		r.Header.Set(h, rest.Nonce)
+	}
 
-	body := []byte(`{}`)
+	res, err := rest.httpClient().Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
 
-	r, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	b, err := io.ReadAll(res.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return &Response{Status: res.StatusCode, Header: res.Header, Body: b}, nil
+}
 
-	r.SetBasicAuth(rest.user, rest.passwd)
-	r.Header.Add("accept", "application/json")
-	r.Header.Add("Content-Type", "application/json")
-	r.Header.Add("CSRF_NONCE", token)
+func (rest *Rest) httpClient() *http.Client {
 
-	client := &http.Client{}
-	res, err := client.Do(r)
-	if err != nil {
-		return err
+	rest.mu.Lock()
+	defer rest.mu.Unlock()
+
+	if rest.client == nil {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		if rest.TLS != nil {
+			tr.TLSClientConfig = rest.TLS.Clone()
+		}
+		if rest.Insecure {
+			if tr.TLSClientConfig == nil {
+				tr.TLSClientConfig = &tls.Config{}
+			}
+			tr.TLSClientConfig.InsecureSkipVerify = true
+		}
+		rest.client = &http.Client{Transport: tr}
+	}
+	return rest.client
+}
+
+// url returns an absolute URL.
+func (rest *Rest) url(u string) string {
+	if rest.URL == "" || strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+		return u
 	}
+	return strings.TrimRight(rest.URL, "/") + "/" + strings.TrimLeft(u, "/")
+}
 
-	defer res.Body.Close()
+// encode returns the body of a request as JSON.
+func encode(body any) ([]byte, error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, nil
+	case *ogdl.Graph:
+		return JSON(b), nil
+	case []byte:
+		return b, nil
+	case json.RawMessage:
+		return b, nil
+	case string:
+		if !json.Valid([]byte(b)) {
+			return nil, errors.New("rest: body is not valid JSON")
+		}
+		return []byte(b), nil
+	}
+	return json.Marshal(body)
+}
 
-	body, err = ioutil.ReadAll(res.Body)
+// retryAfter returns the wait given in a Retry-After header, or -1.
+func retryAfter(h http.Header) time.Duration {
+	s := h.Get("Retry-After")
+	if s == "" {
+		return -1
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d
+	}
+	return -1
+}
 
-	var result map[string]any
+// CSRF gets a nonce from Windchill (from an URL such as
+// /Windchill/servlet/odata/PTC/GetCSRFToken()) and sets Nonce and
+// NonceHeader.
+func (rest *Rest) CSRF(url string) error {
 
-	err = json.Unmarshal(body, &result)
+	res, err := rest.Do(context.Background(), http.MethodGet, url, nil)
 	if err != nil {
 		return err
 	}
 
-	g, err := ogdl.FromJSON(body)
-
-	fmt.Println(g.Text())
+	var v struct {
+		NonceKey   string
+		NonceValue string
+	}
+	if err := json.Unmarshal(res.Body, &v); err != nil {
+		return err
+	}
+	if v.NonceValue == "" {
+		return errors.New("rest: no nonce in response of " + url)
+	}
+	rest.Nonce = v.NonceValue
+	rest.NonceHeader = v.NonceKey
+	return nil
+}
 
-	return err
+// resolve returns ref relative to base.
+func resolve(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
 }
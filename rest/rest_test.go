@@ -0,0 +1,270 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rveen/ogdl"
+)
+
+// echo answers with the method, headers and body of the request.
+func echo(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	u, p, _ := r.BasicAuth()
+	json.NewEncoder(w).Encode(map[string]string{
+		"method": r.Method,
+		"path":   r.URL.Path,
+		"auth":   r.Header.Get("Authorization"),
+		"user":   u + ":" + p,
+		"nonce":  r.Header.Get("CSRF_NONCE"),
+		"body":   string(b),
+	})
+}
+
+func TestMethods(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(echo))
+	defer srv.Close()
+
+	r := New("joe", "secret")
+	r.URL = srv.URL + "/api/"
+
+	g, err := r.Get("items/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := g.Get("path").String(); s != "/api/items/1" {
+		t.Errorf("path %q", s)
+	}
+	if s := g.Get("user").String(); s != "joe:secret" {
+		t.Errorf("user %q", s)
+	}
+
+	r.Token = "abc"
+	r.Nonce = "n1"
+	for _, tc := range []struct {
+		f    func() (*ogdl.Graph, error)
+		m, b string
+	}{
+		{func() (*ogdl.Graph, error) { return r.Post("items", ogdl.FromString("name pedal")) }, "POST", `{"name":"pedal"}`},
+		{func() (*ogdl.Graph, error) { return r.Put("items/1", `{"a":[1,2]}`) }, "PUT", `{"a":[1,2]}`},
+		{func() (*ogdl.Graph, error) { return r.Patch("items/1", map[string]int{"n": 2}) }, "PATCH", `{"n":2}`},
+		{func() (*ogdl.Graph, error) { return r.Delete(srv.URL + "/x") }, "DELETE", ""},
+	} {
+		g, err := tc.f()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.Get("method").String() != tc.m || g.Get("body").String() != tc.b {
+			t.Errorf("%s: got %s %q", tc.m, g.Get("method").String(), g.Get("body").String())
+		}
+		if g.Get("auth").String() != "Bearer abc" || g.Get("nonce").String() != "n1" {
+			t.Errorf("%s: auth %q, nonce %q", tc.m, g.Get("auth").String(), g.Get("nonce").String())
+		}
+	}
+
+	if _, err := r.Post("items", "{bad"); err == nil {
+		t.Error("invalid JSON accepted")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	g := ogdl.New(nil)
+	g.Add("name").Add("pedal")
+	g.Add("count").Add(3)
+	tags := g.Add("tags")
+	tags.Add("-").Add("a")
+	tags.Add("-").Add("b")
+	g.Add("sub").Add("x").Add(true)
+
+	if s := string(JSON(g)); s != `{"name":"pedal","count":3,"tags":["a","b"],"sub":{"x":true}}` {
+		t.Error(s)
+	}
+}
+
+func TestRetry(t *testing.T) {
+
+	var n int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&n, 1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			echo(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	r := New("", "")
+	r.URL = srv.URL
+	r.Backoff = time.Millisecond
+
+	if _, err := r.Post("/a", `{}`); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("%d requests", n)
+	}
+
+	// Giving up
+	srv2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		w.WriteHeader(http.StatusBadGateway)
+		io.WriteString(w, "upstream down")
+	}))
+	defer srv2.Close()
+
+	n = 0
+	r.URL = srv2.URL
+	r.Retries = 2
+	_, err := r.Get("/b")
+	var e *Error
+	if !errors.As(err, &e) || e.Status != http.StatusBadGateway || string(e.Body) != "upstream down" || e.Method != "GET" {
+		t.Fatalf("error %v", err)
+	}
+	if n != 3 {
+		t.Errorf("%d requests", n)
+	}
+	if !strings.Contains(err.Error(), "502 Bad Gateway: upstream down") {
+		t.Error(err)
+	}
+
+	// Not retried
+	n = 0
+	srv3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		http.NotFound(w, r)
+	}))
+	defer srv3.Close()
+	if _, err := r.Get(srv3.URL); !errors.As(err, &e) || e.Status != 404 || n != 1 {
+		t.Errorf("404: %v, %d requests", err, n)
+	}
+
+	// POST and PATCH may have been done: only retried after 5xx if asked
+	r.URL = srv2.URL
+	for _, tc := range []struct {
+		f      func() (*ogdl.Graph, error)
+		unsafe bool
+		n      int32
+	}{
+		{func() (*ogdl.Graph, error) { return r.Post("/c", `{}`) }, false, 1},
+		{func() (*ogdl.Graph, error) { return r.Patch("/c", `{}`) }, false, 1},
+		{func() (*ogdl.Graph, error) { return r.Put("/c", `{}`) }, false, 3},
+		{func() (*ogdl.Graph, error) { return r.Post("/c", `{}`) }, true, 3},
+	} {
+		n = 0
+		r.RetryUnsafe = tc.unsafe
+		if _, err := tc.f(); !errors.As(err, &e) || n != tc.n {
+			t.Errorf("%s (unsafe %v): %v, %d requests", e.Method, tc.unsafe, err, n)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	r := New("", "")
+	r.Timeout = 20 * time.Millisecond
+	if _, err := r.Get(srv.URL); err == nil {
+		t.Error("no timeout")
+	}
+}
+
+func TestPages(t *testing.T) {
+
+	// Link header, with the page as array
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if p < 2 {
+			w.Header().Set("Link", `<`+r.URL.Path+`?page=`+strconv.Itoa(p+1)+`>; rel="next", </items?page=0>; rel="first"`)
+		}
+		json.NewEncoder(w).Encode([]map[string]int{{"id": 2 * p}, {"id": 2*p + 1}})
+	}))
+	defer srv.Close()
+
+	r := New("", "")
+	g, err := r.GetAll(srv.URL+"/items", Paging{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Len() != 6 || g.Out[5].Get("id").String() != "5" {
+		t.Errorf("link pages:\n%s", g.Text())
+	}
+
+	// Cursor
+	srv2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, _ := strconv.Atoi(r.URL.Query().Get("after"))
+		res := map[string]any{"data": []int{c + 1, c + 2}, "meta": map[string]any{}}
+		if c < 4 {
+			res["meta"] = map[string]any{"next": c + 2}
+		}
+		json.NewEncoder(w).Encode(res)
+	}))
+	defer srv2.Close()
+
+	var ids []string
+	err = r.Pages(t.Context(), srv2.URL, Paging{Items: "data", Cursor: "meta.next", CursorParam: "after"}, func(items []json.RawMessage) error {
+		for _, it := range items {
+			ids = append(ids, string(it))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.Join(ids, " "); s != "1 2 3 4 5 6" {
+		t.Errorf("cursor pages: %s", s)
+	}
+
+	// Next URL in the body, and a loop
+	srv3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"value":[1],"@odata.nextLink":"/again"}`)
+	}))
+	defer srv3.Close()
+	if _, err := r.GetAll(srv3.URL+"/again", Paging{Items: "value", Next: "@odata.nextLink"}); err == nil {
+		t.Error("no error for a loop")
+	}
+}
+
+func TestCSRF(t *testing.T) {
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "GetCSRFToken()") {
+			io.WriteString(w, `{"NonceKey":"CSRF_NONCE","NonceValue":"xyz"}`)
+			return
+		}
+		echo(w, r)
+	}))
+	defer srv.Close()
+
+	r := New("u", "p")
+	r.URL = srv.URL + "/Windchill/servlet/odata"
+	if err := r.CSRF("PTC/GetCSRFToken()"); err != nil {
+		t.Fatal(err)
+	}
+	g, err := r.Post("ProdMgmt/Parts", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Get("nonce").String() != "xyz" {
+		t.Errorf("nonce %q", g.Get("nonce").String())
+	}
+}
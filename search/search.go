@@ -0,0 +1,414 @@
+// Package search maintains a full-text and structured index over the files
+// of an fn root.
+//
+// Markdown documents are indexed per section: a hit refers to the section
+// (as addressed by document.Part) where the words were found, and its Path can
+// be passed to fn.FNode.Get. The data in documents (Document.Data) and in data
+// files (.ogdl and other types known to fn/filetype) is indexed as key:value
+// pairs, so that a query can combine words and fields:
+//
+//	ix := search.New(fn.New("/srv/docs"))
+//	ix.Update()
+//	hits := ix.Search("owner:alice status:open interface", 10)
+//
+// Update can be called at any time to re-index the files that changed since
+// the previous call. An Index is safe for concurrent use.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rveen/golib/document"
+	"github.com/rveen/golib/fn"
+	"github.com/rveen/golib/fn/filetype"
+	"github.com/rveen/ogdl"
+)
+
+// Hit is a section that matches a query.
+type Hit struct {
+	Path    string  // fn path of the section, e.g. "docs/spec.md/design/interfaces"
+	File    string  // fn path of the file
+	Section string  // section path as used in document.Part ("" for a whole file)
+	Title   string  // header text of the section
+	Score   float64 // higher is better
+	Snippet string  // text around the first matching word
+}
+
+// Index is an inverted index over the files of an fn root.
+type Index struct {
+	root *fn.FNode
+
+	mu     sync.RWMutex
+	files  map[string]*file
+	words  map[string]map[*section]int  // word -> section -> count
+	fields map[string]map[*section]bool // key:value -> section
+	nsec   int
+}
+
+type file struct {
+	path     string
+	stamp    string
+	sections []*section
+}
+
+type section struct {
+	file   *file
+	path   string
+	title  string
+	text   string
+	words  map[string]int
+	fields map[string]bool
+}
+
+// New returns an empty index for the root given. Only Root, RootFs and Overlay
+// are used from it. Call Update to fill the index.
+func New(root *fn.FNode) *Index {
+	return &Index{
+		root:   &fn.FNode{Root: root.Root, RootFs: root.RootFs, Overlay: root.Overlay},
+		files:  make(map[string]*file),
+		words:  make(map[string]map[*section]int),
+		fields: make(map[string]map[*section]bool),
+	}
+}
+
+// Update walks the root and (re)indexes the files that are new or changed
+// since the last call, and removes those that disappeared. It returns the
+// number of files indexed.
+func (ix *Index) Update() (int, error) {
+
+	seen := make(map[string]bool)
+	n := 0
+
+	err := ix.root.Walk(func(path, stamp string) error {
+
+		if filetype.Lookup(path) == nil {
+			return nil
+		}
+		seen[path] = true
+
+		ix.mu.RLock()
+		f := ix.files[path]
+		ix.mu.RUnlock()
+		if f != nil && f.stamp == stamp {
+			return nil
+		}
+
+		f, err := ix.read(path, stamp)
+		if err != nil {
+			// Unreadable files are left out, not fatal
+			ix.Remove(path)
+			return nil
+		}
+
+		ix.mu.Lock()
+		ix.remove(path)
+		ix.add(f)
+		ix.mu.Unlock()
+		n++
+		return nil
+	})
+	if err != nil {
+		return n, err
+	}
+
+	ix.mu.Lock()
+	for path := range ix.files {
+		if !seen[path] {
+			ix.remove(path)
+		}
+	}
+	ix.mu.Unlock()
+
+	return n, nil
+}
+
+// Remove drops a file from the index.
+func (ix *Index) Remove(path string) {
+	ix.mu.Lock()
+	ix.remove(path)
+	ix.mu.Unlock()
+}
+
+// Len returns the number of files in the index.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.files)
+}
+
+// Search returns the sections that match all the terms of the query, best
+// first, and at most max of them (all if max <= 0).
+//
+// Terms are separated by spaces. A term of the form key:value matches
+// sections with that value (or a word of it) for the key in their data. Other
+// terms are words that must appear in the text of the section. Matching is
+// case insensitive.
+func (ix *Index) Search(query string, max int) []Hit {
+
+	words, fields := parseQuery(query)
+	if len(words) == 0 && len(fields) == 0 {
+		return nil
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	// Candidates: sections with all fields and all words
+	var cand map[*section]bool
+	filter := func(set func(*section) bool, all map[*section]bool) {
+		if cand == nil {
+			cand = all
+			return
+		}
+		for s := range cand {
+			if !set(s) {
+				delete(cand, s)
+			}
+		}
+	}
+
+	for _, f := range fields {
+		all := make(map[*section]bool, len(ix.fields[f]))
+		for s := range ix.fields[f] {
+			all[s] = true
+		}
+		filter(func(s *section) bool { return s.fields[f] }, all)
+	}
+	for _, w := range words {
+		all := make(map[*section]bool, len(ix.words[w]))
+		for s := range ix.words[w] {
+			all[s] = true
+		}
+		filter(func(s *section) bool { return s.words[w] > 0 }, all)
+	}
+
+	hits := make([]Hit, 0, len(cand))
+
+	for s := range cand {
+
+		score := 0.0
+		for _, w := range words {
+			idf := math.Log(1 + float64(ix.nsec)/float64(len(ix.words[w])))
+			tf := 1 + math.Log(float64(s.words[w]))
+			if strings.Contains(strings.ToLower(s.title), w) {
+				tf *= 2
+			}
+			score += tf * idf
+		}
+		score += float64(len(fields))
+
+		hits = append(hits, Hit{
+			Path:    sectionPath(s),
+			File:    s.file.path,
+			Section: s.path,
+			Title:   s.title,
+			Score:   score,
+			Snippet: snippet(s.text, words),
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Path < hits[j].Path
+	})
+
+	if max > 0 && len(hits) > max {
+		hits = hits[:max]
+	}
+	return hits
+}
+
+// read loads and parses a file, and splits it into sections.
+func (ix *Index) read(path, stamp string) (*file, error) {
+
+	n := *ix.root
+	if err := n.GetRaw(path); err != nil {
+		return nil, err
+	}
+
+	g, doc, err := filetype.Lookup(path).Parse(n.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &file{path: path, stamp: stamp}
+
+	if doc == nil {
+		s := f.section("", "", string(n.Content))
+		addFields(s, g)
+		return f, nil
+	}
+
+	src := string(n.Content)
+	lines := strings.SplitAfter(src, "\n")
+	ss := document.Sections(src)
+
+	// Text before the first header
+	end := len(lines)
+	if len(ss) > 0 {
+		end = ss[0].Start
+	}
+	f.section("", "", strings.Join(lines[:end], ""))
+
+	for _, sec := range ss {
+		if sec.Level == 0 {
+			continue
+		}
+		title := strings.TrimSpace(strings.TrimLeft(lines[sec.Start], "#"))
+		f.section(sec.Path, title, strings.Join(lines[sec.Start:sec.Body], ""))
+	}
+
+	// Data is attributed to the innermost section that contains it
+	byPath := make(map[string]*section)
+	for _, s := range f.sections {
+		byPath[s.path] = s
+	}
+	walkData(doc.Data(), "", func(key, value, path string) {
+		for {
+			if s := byPath[path]; s != nil {
+				s.field(key, value)
+				return
+			}
+			i := strings.LastIndexByte(path, '.')
+			if i == -1 {
+				if path == "" {
+					return
+				}
+				path = ""
+			} else {
+				path = path[:i]
+			}
+		}
+	})
+
+	return f, nil
+}
+
+func (f *file) section(path, title, text string) *section {
+	s := &section{file: f, path: path, title: title, text: text, words: make(map[string]int), fields: make(map[string]bool)}
+	for _, w := range tokens(text) {
+		s.words[w]++
+	}
+	f.sections = append(f.sections, s)
+	return s
+}
+
+func (s *section) field(key, value string) {
+	key = strings.ToLower(strings.TrimPrefix(key, "_"))
+	value = strings.ToLower(strings.TrimSpace(value))
+	if key == "" || value == "" {
+		return
+	}
+	s.fields[key+":"+value] = true
+	for _, w := range tokens(value) {
+		s.fields[key+":"+w] = true
+	}
+}
+
+// addFields adds all key:value pairs of g to s.
+func addFields(s *section, g *ogdl.Graph) {
+	walkData(g, "", func(key, value, _ string) { s.field(key, value) })
+}
+
+// walkData calls f for each key with leaf values in g, with the dotted path of
+// the key's parent.
+func walkData(g *ogdl.Graph, path string, f func(key, value, path string)) {
+
+	if g == nil {
+		return
+	}
+
+	for _, n := range g.Out {
+
+		key := n.ThisString()
+		if len(n.Out) == 0 {
+			continue
+		}
+
+		leaves := true
+		for _, c := range n.Out {
+			if len(c.Out) != 0 {
+				leaves = false
+				break
+			}
+		}
+
+		if leaves {
+			for _, c := range n.Out {
+				f(key, c.ThisString(), path)
+			}
+			continue
+		}
+
+		p := key
+		if path != "" {
+			p = path + "." + key
+		}
+		walkData(n, p, f)
+	}
+}
+
+// add and remove need ix.mu to be locked.
+
+func (ix *Index) add(f *file) {
+
+	ix.files[f.path] = f
+
+	for _, s := range f.sections {
+		ix.nsec++
+		for w, c := range s.words {
+			m := ix.words[w]
+			if m == nil {
+				m = make(map[*section]int)
+				ix.words[w] = m
+			}
+			m[s] = c
+		}
+		for k := range s.fields {
+			m := ix.fields[k]
+			if m == nil {
+				m = make(map[*section]bool)
+				ix.fields[k] = m
+			}
+			m[s] = true
+		}
+	}
+}
+
+func (ix *Index) remove(path string) {
+
+	f := ix.files[path]
+	if f == nil {
+		return
+	}
+	delete(ix.files, path)
+
+	for _, s := range f.sections {
+		ix.nsec--
+		for w := range s.words {
+			delete(ix.words[w], s)
+			if len(ix.words[w]) == 0 {
+				delete(ix.words, w)
+			}
+		}
+		for k := range s.fields {
+			delete(ix.fields[k], s)
+			if len(ix.fields[k]) == 0 {
+				delete(ix.fields, k)
+			}
+		}
+	}
+}
+
+// sectionPath returns the fn path of a section.
+func sectionPath(s *section) string {
+	if s.path == "" {
+		return s.file.path
+	}
+	return s.file.path + "/" + strings.ReplaceAll(s.path, ".", "/")
+}
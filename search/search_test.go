@@ -0,0 +1,93 @@
+package search
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rveen/golib/fn"
+)
+
+const spec = `# Introduction
+
+This specification describes the power supply.
+
+# Design
+
+## Interfaces
+
+The supply has a CAN interface and an analog interface.
+
+## Thermal
+
+Cooling is passive.
+`
+
+func TestSearch(t *testing.T) {
+
+	root := t.TempDir()
+	os.MkdirAll(root+"/docs", 0755)
+	os.WriteFile(root+"/docs/spec.md", []byte(spec), 0644)
+	os.WriteFile(root+"/tasks.ogdl", []byte("task\n  owner alice\n  status open\n"), 0644)
+	os.WriteFile(root+"/image.png", []byte("interface"), 0644)
+
+	ix := New(fn.New(root))
+	if n, err := ix.Update(); err != nil || n != 2 {
+		t.Fatalf("indexed %d, %v", n, err)
+	}
+
+	hits := ix.Search("interface", 0)
+	if len(hits) != 1 {
+		t.Fatalf("expected 1 hit, got %v", hits)
+	}
+	h := hits[0]
+	if h.Path != "docs/spec.md/design/interfaces" || h.Section != "design.interfaces" || h.Title != "Interfaces" {
+		t.Errorf("hit %+v", h)
+	}
+	if !strings.Contains(h.Snippet, "CAN interface") {
+		t.Errorf("snippet %q", h.Snippet)
+	}
+
+	if hits := ix.Search("owner:alice status:open", 0); len(hits) != 1 || hits[0].Path != "tasks.ogdl" {
+		t.Errorf("fields: %v", hits)
+	}
+	if hits := ix.Search("owner:bob", 0); len(hits) != 0 {
+		t.Errorf("owner:bob: %v", hits)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+
+	root := t.TempDir()
+	os.WriteFile(root+"/a.md", []byte("# A\n\nalpha\n"), 0644)
+	os.WriteFile(root+"/b.md", []byte("# B\n\nbeta\n"), 0644)
+
+	ix := New(fn.New(root))
+	ix.Update()
+
+	os.WriteFile(root+"/a.md", []byte("# A\n\ngamma text\n"), 0644)
+	os.Remove(root + "/b.md")
+
+	if n, _ := ix.Update(); n != 1 {
+		t.Errorf("expected 1 file re-indexed, got %d", n)
+	}
+	if ix.Len() != 1 {
+		t.Errorf("expected 1 file, got %d", ix.Len())
+	}
+	if len(ix.Search("alpha", 0)) != 0 || len(ix.Search("beta", 0)) != 0 {
+		t.Error("old content still found")
+	}
+	if len(ix.Search("gamma", 0)) != 1 {
+		t.Error("new content not found")
+	}
+}
+
+func TestSnippet(t *testing.T) {
+
+	text := strings.Repeat("word ", 100) + "needle " + strings.Repeat("word ", 100)
+	s := snippet(text, []string{"needle"})
+
+	if !strings.Contains(s, "needle") || !strings.HasPrefix(s, "...") || !strings.HasSuffix(s, "...") {
+		t.Errorf("snippet %q", s)
+	}
+}
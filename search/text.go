@@ -0,0 +1,99 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// snippetLength is the approximate length of Hit.Snippet, in bytes.
+const snippetLength = 160
+
+// tokens returns the lower case words of s. Words are sequences of letters
+// and digits of at least two characters.
+func tokens(s string) []string {
+
+	ff := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	ww := ff[:0]
+	for _, f := range ff {
+		if len(f) > 1 {
+			ww = append(ww, f)
+		}
+	}
+	return ww
+}
+
+// parseQuery splits a query into words and key:value fields.
+func parseQuery(q string) (words, fields []string) {
+
+	for _, t := range strings.Fields(q) {
+
+		if i := strings.IndexByte(t, ':'); i > 0 && i < len(t)-1 {
+			fields = append(fields, strings.ToLower(t))
+			continue
+		}
+		words = append(words, tokens(t)...)
+	}
+	return words, fields
+}
+
+// snippet returns the text around the first occurrence of any of the words,
+// in a single line. Markdown header marks are removed.
+func snippet(text string, words []string) string {
+
+	var sb strings.Builder
+	for _, l := range strings.Split(text, "\n") {
+		l = strings.TrimSpace(strings.TrimLeft(l, "#"))
+		if l == "" {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(l)
+	}
+	s := sb.String()
+	ls := strings.ToLower(s)
+
+	at := -1
+	for _, w := range words {
+		if i := strings.Index(ls, w); i != -1 && (at == -1 || i < at) {
+			at = i
+		}
+	}
+
+	// ToLower can change the length of some characters
+	if at > len(s) {
+		at = -1
+	}
+
+	start := 0
+	if at > snippetLength/3 {
+		start = at - snippetLength/3
+		for start < at && s[start] != ' ' {
+			start++
+		}
+	}
+	end := start + snippetLength
+	if end >= len(s) {
+		end = len(s)
+	} else {
+		for end > start && s[end] != ' ' {
+			end--
+		}
+		if end == start {
+			end = start + snippetLength
+		}
+	}
+
+	r := strings.TrimSpace(s[start:end])
+	if start > 0 {
+		r = "..." + r
+	}
+	if end < len(s) {
+		r += "..."
+	}
+	return r
+}